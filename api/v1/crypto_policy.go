@@ -0,0 +1,324 @@
+/*
+Copyright 2023 kubecombo.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CryptoPolicy decides which ssl vpn and ipsec algorithms are accepted by the webhooks
+type CryptoPolicy string
+
+const (
+	// CryptoPolicyStrict only accepts the strong algorithms, eg. aead ciphers, sha2 and dh groups of 3072 bits or ecp256 at least
+	CryptoPolicyStrict CryptoPolicy = "strict"
+	// CryptoPolicyDefault also accepts the algorithms still considered safe, eg. aes cbc, sha1 and modp1536
+	CryptoPolicyDefault CryptoPolicy = "default"
+	// CryptoPolicyLegacy also accepts the weak algorithms, eg. des, md5 and modp1024, for the old peers only
+	CryptoPolicyLegacy CryptoPolicy = "legacy"
+)
+
+// algorithm strength, a policy accepts the algorithms at least as strong as it requires
+type strength int
+
+const (
+	weak strength = iota
+	acceptable
+	strong
+)
+
+func (s strength) String() string {
+	switch s {
+	case weak:
+		return "weak"
+	case acceptable:
+		return "not strong"
+	}
+	return "strong"
+}
+
+func (p CryptoPolicy) accepts(s strength) bool {
+	switch p {
+	case CryptoPolicyStrict:
+		return s >= strong
+	case CryptoPolicyLegacy:
+		return true
+	}
+	return s >= acceptable
+}
+
+// ParseCryptoPolicy parses the crypto policy of the vpn gw and ipsec connection webhooks
+func ParseCryptoPolicy(policy string) (CryptoPolicy, error) {
+	switch p := CryptoPolicy(policy); p {
+	case CryptoPolicyStrict, CryptoPolicyDefault, CryptoPolicyLegacy:
+		return p, nil
+	case "":
+		return CryptoPolicyDefault, nil
+	}
+	return "", fmt.Errorf("unknown crypto policy %q, should be %s, %s or %s", policy, CryptoPolicyStrict, CryptoPolicyDefault, CryptoPolicyLegacy)
+}
+
+// openvpn data channel ciphers
+var sslVpnCiphers = map[string]strength{
+	"AES-128-GCM":       strong,
+	"AES-192-GCM":       strong,
+	"AES-256-GCM":       strong,
+	"CHACHA20-POLY1305": strong,
+	"AES-128-CBC":       acceptable,
+	"AES-192-CBC":       acceptable,
+	"AES-256-CBC":       acceptable,
+	"AES-128-CFB":       acceptable,
+	"AES-192-CFB":       acceptable,
+	"AES-256-CFB":       acceptable,
+	"AES-128-OFB":       acceptable,
+	"AES-192-OFB":       acceptable,
+	"AES-256-OFB":       acceptable,
+	"CAMELLIA-128-CBC":  acceptable,
+	"CAMELLIA-192-CBC":  acceptable,
+	"CAMELLIA-256-CBC":  acceptable,
+	"DES-EDE3-CBC":      weak,
+	"DES-EDE-CBC":       weak,
+	"DES-CBC":           weak,
+	"DESX-CBC":          weak,
+	"BF-CBC":            weak,
+	"CAST5-CBC":         weak,
+	"RC2-CBC":           weak,
+	"RC2-40-CBC":        weak,
+	"RC2-64-CBC":        weak,
+	"NONE":              weak,
+}
+
+// openvpn hmac digests
+var sslVpnAuths = map[string]strength{
+	"SHA256":     strong,
+	"SHA384":     strong,
+	"SHA512":     strong,
+	"SHA512-256": strong,
+	"SHA3-256":   strong,
+	"SHA3-384":   strong,
+	"SHA3-512":   strong,
+	"SHA224":     acceptable,
+	"SHA512-224": acceptable,
+	"SHA1":       acceptable,
+	"RIPEMD160":  acceptable,
+	"MD5":        weak,
+	"MD4":        weak,
+	"NONE":       weak,
+}
+
+// validateSslVpnAlgorithm checks the openvpn cipher or auth name against the crypto policy,
+// the accepted algorithm which is not strong is returned as a warning
+func validateSslVpnAlgorithm(policy CryptoPolicy, kind, name string, known map[string]strength) (string, error) {
+	s, ok := known[strings.ToUpper(name)]
+	if !ok {
+		return "", fmt.Errorf("unknown ssl vpn %s %q", kind, name)
+	}
+	if !policy.accepts(s) {
+		return "", fmt.Errorf("ssl vpn %s %s is %s, rejected by the %s crypto policy", kind, name, s, policy)
+	}
+	if s < strong {
+		return fmt.Sprintf("ssl vpn %s %s is %s", kind, name, s), nil
+	}
+	return "", nil
+}
+
+// strongswan proposal keyword kinds
+type proposalKind int
+
+const (
+	encryption proposalKind = iota
+	aead
+	integrity
+	prf
+	keyExchange
+	esn
+)
+
+func (k proposalKind) String() string {
+	switch k {
+	case encryption, aead:
+		return "encryption algorithm"
+	case integrity:
+		return "integrity algorithm"
+	case prf:
+		return "prf"
+	case keyExchange:
+		return "dh group"
+	}
+	return "esn mode"
+}
+
+type proposalKeyword struct {
+	kind     proposalKind
+	strength strength
+}
+
+var (
+	// aes and camellia ccm/gcm with the icv length, eg. aes256gcm16, aes128ccm12, aes256gcm128
+	aeadPattern = regexp.MustCompile(`^(aes|camellia)(128|192|256)?(gcm|ccm)(8|12|16|64|96|128)?$`)
+	// aes and camellia cbc/ctr, eg. aes256, aes128ctr, camellia256
+	cipherPattern = regexp.MustCompile(`^(aes|camellia)(128|192|256)?(ctr)?$`)
+)
+
+// strongswan proposal keywords, see https://docs.strongswan.org/docs/latest/config/proposals.html
+var proposalKeywords = map[string]proposalKeyword{
+	"chacha20poly1305": {aead, strong},
+	"3des":             {encryption, weak},
+	"des":              {encryption, weak},
+	"blowfish":         {encryption, weak},
+	"blowfish128":      {encryption, weak},
+	"blowfish192":      {encryption, weak},
+	"blowfish256":      {encryption, weak},
+	"cast128":          {encryption, weak},
+	"null":             {encryption, weak},
+
+	"sha256":      {integrity, strong},
+	"sha2_256":    {integrity, strong},
+	"sha384":      {integrity, strong},
+	"sha2_384":    {integrity, strong},
+	"sha512":      {integrity, strong},
+	"sha2_512":    {integrity, strong},
+	"aes128gmac":  {integrity, strong},
+	"aes192gmac":  {integrity, strong},
+	"aes256gmac":  {integrity, strong},
+	"sha256_96":   {integrity, acceptable},
+	"sha2_256_96": {integrity, acceptable},
+	"sha1":        {integrity, acceptable},
+	"sha1_160":    {integrity, acceptable},
+	"aesxcbc":     {integrity, acceptable},
+	"aescmac":     {integrity, acceptable},
+	"md5":         {integrity, weak},
+	"md5_128":     {integrity, weak},
+
+	"prfsha256":    {prf, strong},
+	"prfsha384":    {prf, strong},
+	"prfsha512":    {prf, strong},
+	"prfsha1":      {prf, acceptable},
+	"prfaesxcbc":   {prf, acceptable},
+	"prfaescmac":   {prf, acceptable},
+	"prfmd5":       {prf, weak},
+	"modp3072":     {keyExchange, strong},
+	"modp4096":     {keyExchange, strong},
+	"modp6144":     {keyExchange, strong},
+	"modp8192":     {keyExchange, strong},
+	"ecp256":       {keyExchange, strong},
+	"ecp384":       {keyExchange, strong},
+	"ecp521":       {keyExchange, strong},
+	"ecp256bp":     {keyExchange, strong},
+	"ecp384bp":     {keyExchange, strong},
+	"ecp512bp":     {keyExchange, strong},
+	"curve25519":   {keyExchange, strong},
+	"x25519":       {keyExchange, strong},
+	"curve448":     {keyExchange, strong},
+	"x448":         {keyExchange, strong},
+	"mlkem512":     {keyExchange, strong},
+	"mlkem768":     {keyExchange, strong},
+	"mlkem1024":    {keyExchange, strong},
+	"modp2048":     {keyExchange, acceptable},
+	"modp1536":     {keyExchange, acceptable},
+	"ecp224":       {keyExchange, acceptable},
+	"ecp224bp":     {keyExchange, acceptable},
+	"modp2048s256": {keyExchange, weak},
+	"modp2048s224": {keyExchange, weak},
+	"modp1024s160": {keyExchange, weak},
+	"modp1024":     {keyExchange, weak},
+	"modp768":      {keyExchange, weak},
+	"ecp192":       {keyExchange, weak},
+
+	"esn":   {esn, strong},
+	"noesn": {esn, strong},
+}
+
+func lookupProposalKeyword(name string) (proposalKeyword, bool) {
+	if m := aeadPattern.FindStringSubmatch(name); m != nil {
+		// the 8 bytes icv is too short for a strong aead
+		if m[4] == "8" || m[4] == "64" {
+			return proposalKeyword{aead, acceptable}, true
+		}
+		return proposalKeyword{aead, strong}, true
+	}
+	if cipherPattern.MatchString(name) {
+		return proposalKeyword{encryption, acceptable}, true
+	}
+	k, ok := proposalKeywords[name]
+	return k, ok
+}
+
+// validateProposals parses the comma separated strongswan proposals and checks them against the crypto policy,
+// the ike proposals require a dh group, the esp proposals may omit it and must not set a prf,
+// the accepted algorithms which are not strong are returned as warnings
+func validateProposals(policy CryptoPolicy, proposals string, ike bool) ([]string, error) {
+	var warnings []string
+	for i, proposal := range strings.Split(proposals, ",") {
+		proposal = strings.TrimSpace(proposal)
+		if proposal == "default" {
+			continue
+		}
+		w, err := validateProposal(policy, proposal, ike)
+		if err != nil {
+			return nil, fmt.Errorf("proposal %d %q: %w", i+1, proposal, err)
+		}
+		for _, warning := range w {
+			warnings = append(warnings, fmt.Sprintf("proposal %d %q: %s", i+1, proposal, warning))
+		}
+	}
+	return warnings, nil
+}
+
+func validateProposal(policy CryptoPolicy, proposal string, ike bool) ([]string, error) {
+	if proposal == "" {
+		return nil, fmt.Errorf("empty proposal")
+	}
+	var warnings []string
+	found := map[proposalKind]bool{}
+	for _, name := range strings.Split(strings.ToLower(proposal), "-") {
+		k, ok := lookupProposalKeyword(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown algorithm %q", name)
+		}
+		switch {
+		case k.kind == prf && !ike:
+			return nil, fmt.Errorf("prf %s is only used by ike proposals", name)
+		case k.kind == esn && ike:
+			return nil, fmt.Errorf("esn mode %s is only used by esp proposals", name)
+		}
+		if !policy.accepts(k.strength) {
+			return nil, fmt.Errorf("%s %s is %s, rejected by the %s crypto policy", k.kind, name, k.strength, policy)
+		}
+		if k.strength < strong {
+			warnings = append(warnings, fmt.Sprintf("%s %s is %s", k.kind, name, k.strength))
+		}
+		found[k.kind] = true
+	}
+	switch {
+	case found[aead] && found[encryption]:
+		return nil, fmt.Errorf("aead and non-aead encryption algorithms should be in separate proposals")
+	case !found[aead] && !found[encryption]:
+		return nil, fmt.Errorf("encryption algorithm is required")
+	case found[encryption] && !found[integrity]:
+		return nil, fmt.Errorf("integrity algorithm is required by the non-aead encryption algorithm")
+	case found[aead] && found[integrity]:
+		return nil, fmt.Errorf("integrity algorithm should not be used with the aead encryption algorithm")
+	case ike && found[aead] && !found[prf]:
+		return nil, fmt.Errorf("prf is required by the aead encryption algorithm")
+	case ike && !found[keyExchange]:
+		return nil, fmt.Errorf("dh group is required")
+	}
+	return warnings, nil
+}
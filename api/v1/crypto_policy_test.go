@@ -0,0 +1,137 @@
+/*
+Copyright 2023 kubecombo.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateProposals(t *testing.T) {
+	cases := []struct {
+		policy    CryptoPolicy
+		proposals string
+		ike       bool
+		err       string
+	}{
+		{CryptoPolicyDefault, "default", true, ""},
+		{CryptoPolicyDefault, "aes256-sha256-modp1536", true, ""},
+		{CryptoPolicyDefault, "aes256gcm16-prfsha384-ecp384,default", true, ""},
+		{CryptoPolicyDefault, "AES128-SHA1-MODP2048", true, ""},
+		{CryptoPolicyDefault, "aes256-sha256-modp1536", false, ""},
+		{CryptoPolicyDefault, "aes256gcm16-esn", false, ""},
+		{CryptoPolicyDefault, "aes256-sha256", false, ""},
+		{CryptoPolicyDefault, "aes256-sha256", true, "dh group is required"},
+		{CryptoPolicyDefault, "aes256gcm16-ecp256", true, "prf is required"},
+		{CryptoPolicyDefault, "aes256-ecp256", true, "integrity algorithm is required"},
+		{CryptoPolicyDefault, "aes256gcm16-sha256-ecp256", false, "should not be used with the aead"},
+		{CryptoPolicyDefault, "aes256-aes256gcm16-sha256", false, "separate proposals"},
+		{CryptoPolicyDefault, "sha256-modp2048", true, "encryption algorithm is required"},
+		{CryptoPolicyDefault, "aes256-sha256-prfsha256", false, "only used by ike proposals"},
+		{CryptoPolicyDefault, "aes256-sha256-modp2048-esn", true, "only used by esp proposals"},
+		{CryptoPolicyDefault, "aes256-sha256-modp2048,", true, "proposal 2 \"\": empty proposal"},
+		{CryptoPolicyDefault, "aes256-sha265-modp2048", true, "unknown algorithm \"sha265\""},
+		{CryptoPolicyDefault, "des-sha256-modp2048", true, "encryption algorithm des is weak"},
+		{CryptoPolicyDefault, "aes256-md5-modp2048", true, "integrity algorithm md5 is weak"},
+		{CryptoPolicyDefault, "aes256-sha256-modp2048,aes256-sha256-modp1024", true, "proposal 2 \"aes256-sha256-modp1024\": dh group modp1024 is weak"},
+		{CryptoPolicyLegacy, "3des-md5-modp1024", true, ""},
+		{CryptoPolicyStrict, "aes256gcm16-prfsha384-ecp384", true, ""},
+		{CryptoPolicyStrict, "aes256-sha256-modp1536", true, "encryption algorithm aes256 is not strong"},
+		{CryptoPolicyStrict, "aes256gcm16-prfsha256-modp2048", true, "dh group modp2048 is not strong"},
+	}
+	for _, c := range cases {
+		_, err := validateProposals(c.policy, c.proposals, c.ike)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s proposals %q: unexpected error %v", c.policy, c.proposals, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s proposals %q: expected error %q, got %v", c.policy, c.proposals, c.err, err)
+		}
+	}
+}
+
+func TestValidateSslVpnAlgorithm(t *testing.T) {
+	cases := []struct {
+		policy CryptoPolicy
+		kind   string
+		name   string
+		known  map[string]strength
+		err    string
+	}{
+		{CryptoPolicyDefault, "cipher", "AES-256-GCM", sslVpnCiphers, ""},
+		{CryptoPolicyDefault, "cipher", "aes-256-cbc", sslVpnCiphers, ""},
+		{CryptoPolicyDefault, "cipher", "BF-CBC", sslVpnCiphers, "ssl vpn cipher BF-CBC is weak"},
+		{CryptoPolicyDefault, "cipher", "AES-256-XTS", sslVpnCiphers, "unknown ssl vpn cipher"},
+		{CryptoPolicyLegacy, "cipher", "DES-CBC", sslVpnCiphers, ""},
+		{CryptoPolicyStrict, "cipher", "AES-256-CBC", sslVpnCiphers, "not strong"},
+		{CryptoPolicyDefault, "auth", "SHA1", sslVpnAuths, ""},
+		{CryptoPolicyDefault, "auth", "MD5", sslVpnAuths, "ssl vpn auth MD5 is weak"},
+		{CryptoPolicyStrict, "auth", "SHA1", sslVpnAuths, "not strong"},
+		{CryptoPolicyStrict, "auth", "SHA512", sslVpnAuths, ""},
+	}
+	for _, c := range cases {
+		_, err := validateSslVpnAlgorithm(c.policy, c.kind, c.name, c.known)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s %s %s: unexpected error %v", c.policy, c.kind, c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s %s %s: expected error %q, got %v", c.policy, c.kind, c.name, c.err, err)
+		}
+	}
+}
+
+func TestCryptoPolicyWarnings(t *testing.T) {
+	warning, err := validateSslVpnAlgorithm(CryptoPolicyDefault, "auth", "SHA1", sslVpnAuths)
+	if err != nil || warning != "ssl vpn auth SHA1 is not strong" {
+		t.Errorf("unexpected ssl vpn auth warning %q, error %v", warning, err)
+	}
+	warning, err = validateSslVpnAlgorithm(CryptoPolicyDefault, "cipher", "AES-256-GCM", sslVpnCiphers)
+	if err != nil || warning != "" {
+		t.Errorf("unexpected ssl vpn cipher warning %q, error %v", warning, err)
+	}
+
+	warnings, err := validateProposals(CryptoPolicyDefault, "aes256gcm16-prfsha384-ecp384,aes256-sha1-modp2048", true)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{
+		`proposal 2 "aes256-sha1-modp2048": encryption algorithm aes256 is not strong`,
+		`proposal 2 "aes256-sha1-modp2048": integrity algorithm sha1 is not strong`,
+		`proposal 2 "aes256-sha1-modp2048": dh group modp2048 is not strong`,
+	}
+	if strings.Join(warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected warnings %q, got %q", expected, warnings)
+	}
+}
+
+func TestParseCryptoPolicy(t *testing.T) {
+	if policy, err := ParseCryptoPolicy("strict"); err != nil || policy != CryptoPolicyStrict {
+		t.Errorf("failed to parse strict crypto policy: %v", err)
+	}
+	if policy, err := ParseCryptoPolicy(""); err != nil || policy != CryptoPolicyDefault {
+		t.Errorf("failed to parse empty crypto policy: %v", err)
+	}
+	if _, err := ParseCryptoPolicy("weak"); err == nil {
+		t.Error("expected error for unknown crypto policy")
+	}
+}
@@ -17,62 +17,205 @@ limitations under the License.
 package v1
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/kubecombo/kube-combo/internal/util"
 )
 
 // log is for logging in this package.
 var debuggerlog = logf.Log.WithName("debugger-resource")
 
-// SetupWebhookWithManager will setup the manager to manage the webhooks
-func (r *Debugger) SetupWebhookWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewWebhookManagedBy(mgr).
-		For(r).
+// SetupDebuggerWebhookWithManager registers the webhook for Debugger in the manager.
+func SetupDebuggerWebhookWithManager(mgr ctrl.Manager, opts WebhookOptions) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&Debugger{}).
+		WithDefaulter(&DebuggerCustomDefaulter{Defaults: opts.Defaults}).
+		WithValidator(&DebuggerCustomValidator{Client: mgr.GetAPIReader()}).
 		Complete()
 }
 
-// TODO(user): EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-
 // +kubebuilder:webhook:path=/mutate-vpn-gw-kubecombo-com-v1-debugger,mutating=true,failurePolicy=fail,sideEffects=None,groups=vpn-gw.kubecombo.com,resources=debuggers,verbs=create;update,versions=v1,name=mdebugger.kb.io,admissionReviewVersions=v1
 
-// var _ webhook.Defaulter = &Debugger{}
-
-// Default implements webhook.Defaulter so a webhook will be registered for the type
-func (r *Debugger) Default() {
-	debuggerlog.Info("default", "name", r.Name)
+// DebuggerCustomDefaulter sets the default values of the Debugger
+// +kubebuilder:object:generate=false
+type DebuggerCustomDefaulter struct {
+	Defaults DefaultOptions
+}
 
-	// TODO(user): fill in your defaulting logic.
+var _ webhook.CustomDefaulter = &DebuggerCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (d *DebuggerCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	debugger, ok := obj.(*Debugger)
+	if !ok {
+		return fmt.Errorf("expected a Debugger object but got %T", obj)
+	}
+	debuggerlog.Info("default", "name", debugger.Name)
+	debugger.SetDefaults(d.Defaults)
+	return nil
 }
 
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
 // NOTE: The 'path' attribute must follow a specific pattern and should not be modified directly here.
 // Modifying the path for an invalid path can cause API server errors; failing to locate the webhook.
 // +kubebuilder:webhook:path=/validate-vpn-gw-kubecombo-com-v1-debugger,mutating=false,failurePolicy=fail,sideEffects=None,groups=vpn-gw.kubecombo.com,resources=debuggers,verbs=create;update,versions=v1,name=vdebugger.kb.io,admissionReviewVersions=v1
 
-// var _ webhook.Validator = &Debugger{}
+// DebuggerCustomValidator validates the Debugger and the objects it references
+// +kubebuilder:object:generate=false
+type DebuggerCustomValidator struct {
+	// Client reads the referenced objects, it is the api reader of the manager
+	Client client.Reader
+}
+
+var _ webhook.CustomValidator = &DebuggerCustomValidator{}
 
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
-func (r *Debugger) ValidateCreate() (admission.Warnings, error) {
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *DebuggerCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, ok := obj.(*Debugger)
+	if !ok {
+		return nil, fmt.Errorf("expected a Debugger object but got %T", obj)
+	}
 	debuggerlog.Info("validate create", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object creation.
-	return nil, nil
+	warnings, err := r.validateDebugger()
+	if err != nil {
+		debuggerlog.Error(err, "validate debugger failed")
+		return warnings, err
+	}
+	refWarnings, err := r.validateDebuggerRefs(ctx, v.Client)
+	if err != nil {
+		debuggerlog.Error(err, "validate debugger references failed")
+	}
+	return append(warnings, refWarnings...), err
 }
 
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
-func (r *Debugger) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *DebuggerCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	r, ok := newObj.(*Debugger)
+	if !ok {
+		return nil, fmt.Errorf("expected a Debugger object but got %T", newObj)
+	}
+	oldDebugger, ok := oldObj.(*Debugger)
+	if !ok {
+		return nil, fmt.Errorf("expected a Debugger object but got %T", oldObj)
+	}
 	debuggerlog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
-	return nil, nil
+	warnings, err := r.validateDebugger()
+	if err != nil {
+		debuggerlog.Error(err, "validate debugger failed")
+		return warnings, err
+	}
+	if oldDebugger.Spec.Subnet != "" && oldDebugger.Spec.Subnet != r.Spec.Subnet {
+		err := errors.New("debugger subnet can not be changed")
+		e := field.Invalid(field.NewPath("spec").Child("subnet"), r.Spec.Subnet, err.Error())
+		return warnings, field.ErrorList{e}.ToAggregate()
+	}
+	refWarnings, err := r.validateDebuggerRefs(ctx, v.Client)
+	if err != nil {
+		debuggerlog.Error(err, "validate debugger references failed")
+	}
+	return append(warnings, refWarnings...), err
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
-func (r *Debugger) ValidateDelete() (admission.Warnings, error) {
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *DebuggerCustomValidator) ValidateDelete(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, ok := obj.(*Debugger)
+	if !ok {
+		return nil, fmt.Errorf("expected a Debugger object but got %T", obj)
+	}
 	debuggerlog.Info("validate delete", "name", r.Name)
-
-	// TODO(user): fill in your validation logic upon object deletion.
 	return nil, nil
 }
+
+// validateDebugger validates the spec, the sys permissions are returned as a warning
+func (r *Debugger) validateDebugger() (admission.Warnings, error) {
+	var warnings admission.Warnings
+	var allErrs field.ErrorList
+	if r.Spec.CPU == "" || r.Spec.Memory == "" {
+		err := errors.New("debugger pod cpu and memory is required")
+		e := field.Invalid(field.NewPath("spec").Child("cpu"), r.Spec.CPU, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	if r.Spec.Image == "" {
+		err := errors.New("debugger image is required")
+		e := field.Invalid(field.NewPath("spec").Child("image"), r.Spec.Image, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	switch r.Spec.WorkloadType {
+	case util.WorkloadTypePod:
+	case util.WorkloadTypeDaemonset:
+		if r.Spec.NodeName != "" {
+			err := errors.New("debugger daemonset does not need node name")
+			e := field.Invalid(field.NewPath("spec").Child("nodeName"), r.Spec.NodeName, err.Error())
+			allErrs = append(allErrs, e)
+		}
+	default:
+		err := fmt.Errorf("debugger workload type should be %s or %s", util.WorkloadTypePod, util.WorkloadTypeDaemonset)
+		e := field.Invalid(field.NewPath("spec").Child("workloadType"), r.Spec.WorkloadType, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	if r.Spec.EnableConfigMap && r.Spec.ConfigMap == "" {
+		err := errors.New("debugger config map is required if config map is enabled")
+		e := field.Invalid(field.NewPath("spec").Child("configMap"), r.Spec.ConfigMap, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	if r.Spec.EnablePinger && r.Spec.Pinger == "" {
+		err := errors.New("debugger pinger is required if pinger is enabled")
+		e := field.Invalid(field.NewPath("spec").Child("pinger"), r.Spec.Pinger, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	if r.Spec.HostNetwork && r.Spec.Subnet != "" {
+		err := errors.New("debugger host network pod does not need subnet")
+		e := field.Invalid(field.NewPath("spec").Child("subnet"), r.Spec.Subnet, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	if r.Spec.EnableSys {
+		warnings = append(warnings, "debugger sys is enabled, the debugger pod is privileged and mounts the host directories")
+	}
+	if len(allErrs) == 0 {
+		return warnings, nil
+	}
+	return warnings, allErrs.ToAggregate()
+}
+
+// validateDebuggerRefs checks the pinger and config maps referenced by the debugger,
+// the missing ones are warnings, the empty config maps are denied as the controller never retries them
+func (r *Debugger) validateDebuggerRefs(ctx context.Context, c client.Reader) (admission.Warnings, error) {
+	var warnings admission.Warnings
+	var allErrs field.ErrorList
+	if r.Spec.Pinger != "" {
+		_, w := validateRef(ctx, c, "pinger", r.Namespace, r.Spec.Pinger, &Pinger{})
+		warnings = append(warnings, w...)
+	}
+	configMaps := map[string]string{
+		"runAt":          r.Spec.RunAt,
+		"debuggerConfig": r.Spec.DebuggerConfig,
+	}
+	if r.Spec.EnableConfigMap {
+		configMaps["configMap"] = r.Spec.ConfigMap
+	}
+	for _, child := range []string{"configMap", "runAt", "debuggerConfig"} {
+		name := configMaps[child]
+		if name == "" {
+			continue
+		}
+		w, e := validateConfigMapRef(ctx, c, field.NewPath("spec").Child(child), r.Namespace, name)
+		warnings = append(warnings, w...)
+		if e != nil {
+			allErrs = append(allErrs, e)
+		}
+	}
+	if len(allErrs) == 0 {
+		return warnings, nil
+	}
+	return warnings, allErrs.ToAggregate()
+}
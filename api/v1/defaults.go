@@ -0,0 +1,129 @@
+/*
+Copyright 2023 kubecombo.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+const (
+	// WorkloadTypeStatefulset runs the vpn gw in a statefulset
+	WorkloadTypeStatefulset = "statefulset"
+	// WorkloadTypeStatic runs the vpn gw in host network static pods copied by a daemonset
+	WorkloadTypeStatic = "static"
+
+	// CNIProviderKubeOVN attaches the vpn gw pods to the kube-ovn subnet
+	CNIProviderKubeOVN = "kube-ovn"
+	// CNIProviderMultus attaches the vpn gw pods to the multus network attachment definition
+	CNIProviderMultus = "multus"
+	// CNIProviderCNI only limits the bandwidth of the vpn gw pods with the bandwidth plugin
+	CNIProviderCNI = "cni"
+
+	DefaultSslVpnProto         = "udp"
+	DefaultSslVpnCipher        = "AES-256-GCM"
+	DefaultSslVpnAuth          = "SHA256"
+	DefaultWireGuardListenPort = 51820
+
+	DefaultIpsecAuth        = "pubkey"
+	DefaultIkeVersion       = "2"
+	DefaultIKEProposals     = "default"
+	DefaultDebuggerWorkload = "pod"
+)
+
+// DefaultOptions are the controller flags the objects are defaulted with,
+// the defaulting webhooks and the reconcilers share them, so the defaults live in one place
+// +kubebuilder:object:generate=false
+type DefaultOptions struct {
+	SslVpnImage     string
+	IPSecVpnImage   string
+	WireGuardImage  string
+	KeepalivedImage string
+	DebuggerImage   string
+	PingerImage     string
+}
+
+// SetDefaults fills in the defaults of the enabled vpns
+func (r *VpnGw) SetDefaults(opts DefaultOptions) {
+	if r.Spec.WorkloadType == "" {
+		r.Spec.WorkloadType = WorkloadTypeStatefulset
+	}
+	if r.Spec.EnableSslVpn {
+		if r.Spec.SslVpnProto == "" {
+			r.Spec.SslVpnProto = DefaultSslVpnProto
+		}
+		if r.Spec.SslVpnCipher == "" {
+			r.Spec.SslVpnCipher = DefaultSslVpnCipher
+		}
+		if r.Spec.SslVpnAuth == "" {
+			r.Spec.SslVpnAuth = DefaultSslVpnAuth
+		}
+		if r.Spec.SslVpnImage == "" {
+			r.Spec.SslVpnImage = opts.SslVpnImage
+		}
+	}
+	if r.Spec.EnableIPSecVpn && r.Spec.IPSecVpnImage == "" {
+		r.Spec.IPSecVpnImage = opts.IPSecVpnImage
+	}
+	if r.Spec.EnableWireGuard {
+		if r.Spec.WireGuardListenPort == 0 {
+			r.Spec.WireGuardListenPort = DefaultWireGuardListenPort
+		}
+		if r.Spec.WireGuardImage == "" {
+			r.Spec.WireGuardImage = opts.WireGuardImage
+		}
+	}
+}
+
+// SetDefaults fills in the auth, ike version and proposals
+func (r *IpsecConn) SetDefaults() {
+	if r.Spec.Auth == "" {
+		r.Spec.Auth = DefaultIpsecAuth
+	}
+	if r.Spec.IkeVersion == "" {
+		r.Spec.IkeVersion = DefaultIkeVersion
+	}
+	if r.Spec.IKEProposals == "" {
+		r.Spec.IKEProposals = DefaultIKEProposals
+	}
+}
+
+// SetDefaults fills in the keepalived image
+func (r *KeepAlived) SetDefaults(opts DefaultOptions) {
+	if r.Spec.Image == "" {
+		r.Spec.Image = opts.KeepalivedImage
+	}
+}
+
+// SetDefaults fills in the workload type and the debugger image
+func (r *Debugger) SetDefaults(opts DefaultOptions) {
+	if r.Spec.WorkloadType == "" {
+		r.Spec.WorkloadType = DefaultDebuggerWorkload
+	}
+	if r.Spec.Image == "" {
+		r.Spec.Image = opts.DebuggerImage
+	}
+}
+
+// SetDefaults fills in the pinger image
+func (r *Pinger) SetDefaults(opts DefaultOptions) {
+	if r.Spec.Image == "" {
+		r.Spec.Image = opts.PingerImage
+	}
+}
+
+// WebhookOptions are the controller flags the webhooks are set up with
+// +kubebuilder:object:generate=false
+type WebhookOptions struct {
+	Defaults     DefaultOptions
+	CryptoPolicy CryptoPolicy
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023 kubecombo.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestVpnGwDefaults(t *testing.T) {
+	gw := &VpnGw{Spec: VpnGwSpec{
+		CPU:              "1",
+		Memory:           "1Gi",
+		Replicas:         1,
+		EnableSslVpn:     true,
+		SslVpnSecret:     "ssl",
+		DhSecret:         "dh",
+		SslVpnAuth:       "SHA1",
+		SslVpnSubnetCidr: "10.240.0.0/16",
+	}}
+	defaulter := &VpnGwCustomDefaulter{Defaults: DefaultOptions{SslVpnImage: "openvpn:v1"}}
+	if err := defaulter.Default(context.Background(), gw); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if gw.Spec.WorkloadType != WorkloadTypeStatefulset || gw.Spec.SslVpnProto != DefaultSslVpnProto ||
+		gw.Spec.SslVpnCipher != DefaultSslVpnCipher || gw.Spec.SslVpnAuth != "SHA1" || gw.Spec.SslVpnImage != "openvpn:v1" {
+		t.Errorf("unexpected defaults %+v", gw.Spec)
+	}
+	if gw.Spec.IPSecVpnImage != "" || gw.Spec.WireGuardListenPort != 0 {
+		t.Errorf("disabled vpns should not be defaulted, %+v", gw.Spec)
+	}
+
+	warnings, err := gw.validateVpnGw(CryptoPolicyDefault)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{"only one replica", "ssl vpn auth SHA1 is not strong"}
+	if len(warnings) != len(expected) {
+		t.Fatalf("expected warnings %q, got %q", expected, warnings)
+	}
+	for i, w := range expected {
+		if !strings.Contains(warnings[i], w) {
+			t.Errorf("expected warning %q, got %q", w, warnings[i])
+		}
+	}
+}
+
+func TestIpsecConnDefaults(t *testing.T) {
+	conn := newTestIpsecConn("conn1", "10.1.0.0/24", "10.2.0.0/24")
+	conn.Spec.Auth = ""
+	conn.Spec.IkeVersion = ""
+	conn.Spec.IKEProposals = ""
+	if err := (&IpsecConnCustomDefaulter{}).Default(context.Background(), conn); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if conn.Spec.Auth != DefaultIpsecAuth || conn.Spec.IkeVersion != DefaultIkeVersion || conn.Spec.IKEProposals != DefaultIKEProposals {
+		t.Errorf("unexpected defaults %+v", conn.Spec)
+	}
+	warnings, err := conn.validateIpsecConn(CryptoPolicyDefault)
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("unexpected warnings %q, error %v", warnings, err)
+	}
+
+	conn.Spec.IkeVersion = "1"
+	warnings, err = conn.validateIpsecConn(CryptoPolicyDefault)
+	if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "ikev1 is deprecated") {
+		t.Errorf("expected ikev1 warning, got %q, error %v", warnings, err)
+	}
+}
+
+func TestDebuggerDefaults(t *testing.T) {
+	debugger := &Debugger{Spec: DebuggerSpec{CPU: "100m", Memory: "100Mi"}}
+	defaulter := &DebuggerCustomDefaulter{Defaults: DefaultOptions{DebuggerImage: "debugger:v1"}}
+	if err := defaulter.Default(context.Background(), debugger); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if debugger.Spec.WorkloadType != DefaultDebuggerWorkload || debugger.Spec.Image != "debugger:v1" {
+		t.Errorf("unexpected defaults %+v", debugger.Spec)
+	}
+	if _, err := debugger.validateDebugger(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
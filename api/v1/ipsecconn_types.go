@@ -17,6 +17,7 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -100,10 +101,55 @@ type IpsecConnSpec struct {
 
 	// +kubebuilder:validation:Optional
 	ESPProposals string `json:"espProposals,omitempty"`
+
+	// pre-shared key of this connection, only used in psk auth
+	// the secret should be in the same namespace, use the vpn gw default psk if not set
+	// +kubebuilder:validation:Optional
+	PSKSecretRef *corev1.SecretKeySelector `json:"pskSecretRef,omitempty"`
 }
 
-// type IpsecConnStatus struct {
-// }
+const (
+	// IpsecConnConfigured means the connection is loaded into charon
+	IpsecConnConfigured = "Configured"
+	// IpsecConnIKEEstablished means the IKE SA is established
+	IpsecConnIKEEstablished = "IKEEstablished"
+	// IpsecConnChildSAInstalled means the CHILD SA is installed, traffic can pass through the tunnel
+	IpsecConnChildSAInstalled = "ChildSAInstalled"
+)
+
+// IpsecConnStatus defines the observed state of IpsecConn
+// it is reported by the vpn gw controller which queries strongSwan in the vpn gw pods periodically
+type IpsecConnStatus struct {
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// vpn gw pod which reported the connection state
+	// +kubebuilder:validation:Optional
+	Pod string `json:"pod,omitempty"`
+
+	// the last time the child sa was installed or rekeyed
+	// +kubebuilder:validation:Optional
+	LastRekeyTime *metav1.Time `json:"lastRekeyTime,omitempty"`
+
+	// bytes received by the installed child sa
+	// +kubebuilder:validation:Optional
+	BytesIn int64 `json:"bytesIn,omitempty"`
+
+	// bytes sent by the installed child sa
+	// +kubebuilder:validation:Optional
+	BytesOut int64 `json:"bytesOut,omitempty"`
+}
+
+func (m *IpsecConn) GetConditions() []metav1.Condition {
+	return m.Status.Conditions
+}
+
+func (m *IpsecConn) SetConditions(conditions []metav1.Condition) {
+	m.Status.Conditions = conditions
+}
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
@@ -115,14 +161,20 @@ type IpsecConnSpec struct {
 // +kubebuilder:printcolumn:name="RemoteEIP",type=string,JSONPath=`.spec.remoteEIP`
 // +kubebuilder:printcolumn:name="LocalPrivateCidrs",type=string,JSONPath=`.spec.localPrivateCidrs`
 // +kubebuilder:printcolumn:name="RemotePrivateCidrs",type=string,JSONPath=`.spec.remotePrivateCidrs`
+// +kubebuilder:printcolumn:name="IKE",type=string,JSONPath=`.status.conditions[?(@.type=="IKEEstablished")].status`
+// +kubebuilder:printcolumn:name="ChildSA",type=string,JSONPath=`.status.conditions[?(@.type=="ChildSAInstalled")].status`
+// +kubebuilder:printcolumn:name="Pod",type=string,JSONPath=`.status.pod`
+// +kubebuilder:printcolumn:name="BytesIn",type=integer,JSONPath=`.status.bytesIn`,priority=1
+// +kubebuilder:printcolumn:name="BytesOut",type=integer,JSONPath=`.status.bytesOut`,priority=1
+// +kubebuilder:printcolumn:name="LastRekey",type=date,JSONPath=`.status.lastRekeyTime`,priority=1
 
 // IpsecConn is the Schema for the ipsecconns API
 type IpsecConn struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec IpsecConnSpec `json:"spec,omitempty"`
-	// Status IpsecConnStatus `json:"status,omitempty"`  // TODO: add status if needed
+	Spec   IpsecConnSpec   `json:"spec,omitempty"`
+	Status IpsecConnStatus `json:"status,omitempty"`
 }
 
 //+kubebuilder:object:root=true
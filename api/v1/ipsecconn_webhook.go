@@ -17,98 +17,148 @@ limitations under the License.
 package v1
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/kubecombo/kube-combo/internal/util"
 )
 
 // log is for logging in this package.
 var ipsecconnlog = logf.Log.WithName("ipsecconn-resource")
 
-func (r *IpsecConn) SetupWebhookWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewWebhookManagedBy(mgr).
-		For(r).
+// SetupIpsecConnWebhookWithManager registers the webhook for IpsecConn in the manager.
+func SetupIpsecConnWebhookWithManager(mgr ctrl.Manager, opts WebhookOptions) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&IpsecConn{}).
+		WithDefaulter(&IpsecConnCustomDefaulter{}).
+		WithValidator(&IpsecConnCustomValidator{Client: mgr.GetAPIReader(), CryptoPolicy: opts.CryptoPolicy}).
 		Complete()
 }
 
-// TODO(user): EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-
 // +kubebuilder:webhook:path=/mutate-vpn-gw-kubecombo-com-v1-ipsecconn,mutating=true,failurePolicy=fail,sideEffects=None,groups=vpn-gw.kubecombo.com,resources=ipsecconns,verbs=create;update,versions=v1,name=mipsecconn.kb.io,admissionReviewVersions=v1
-// var _ webhook.Defaulter = &IpsecConn{}
 
-// Default implements webhook.Defaulter so a webhook will be registered for the type
-func (r *IpsecConn) Default() {
-	ipsecconnlog.Info("default", "name", r.Name)
+// IpsecConnCustomDefaulter sets the default values of the IpsecConn
+// +kubebuilder:object:generate=false
+type IpsecConnCustomDefaulter struct{}
 
-	// TODO(user): fill in your defaulting logic.
-	ipsecconnlog.Info("default", "name", r.Name)
-	if r.Spec.Auth == "" {
-		r.Spec.Auth = "pubkey"
-	}
-	if r.Spec.IkeVersion == "" {
-		r.Spec.IkeVersion = "2"
-	}
-	if r.Spec.IKEProposals == "" {
-		r.Spec.IKEProposals = "default"
+var _ webhook.CustomDefaulter = &IpsecConnCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (d *IpsecConnCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	conn, ok := obj.(*IpsecConn)
+	if !ok {
+		return fmt.Errorf("expected an IpsecConn object but got %T", obj)
 	}
+	ipsecconnlog.Info("default", "name", conn.Name)
+	conn.SetDefaults()
+	return nil
 }
 
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
 //+kubebuilder:webhook:path=/validate-vpn-gw-kubecombo-com-v1-ipsecconn,mutating=false,failurePolicy=fail,sideEffects=None,groups=vpn-gw.kubecombo.com,resources=ipsecconns,verbs=create;update,versions=v1,name=vipsecconn.kb.io,admissionReviewVersions=v1
 
-// var _ webhook.Validator = &IpsecConn{}
+// IpsecConnCustomValidator validates the IpsecConn against the other connections of the vpn gw
+// +kubebuilder:object:generate=false
+type IpsecConnCustomValidator struct {
+	// Client lists the other connections of the vpn gw to check the traffic selectors overlap
+	Client       client.Reader
+	CryptoPolicy CryptoPolicy
+}
+
+var _ webhook.CustomValidator = &IpsecConnCustomValidator{}
 
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
-func (r *IpsecConn) ValidateCreate() error {
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *IpsecConnCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, ok := obj.(*IpsecConn)
+	if !ok {
+		return nil, fmt.Errorf("expected an IpsecConn object but got %T", obj)
+	}
 	ipsecconnlog.Info("validate create", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object creation.
-	if err := r.validateIpsecConn(); err != nil {
+	warnings, err := r.validateIpsecConn(v.CryptoPolicy)
+	if err != nil {
 		ipsecconnlog.Error(err, "validate ipsec conn failed")
-		return err
+		return warnings, err
 	}
-	return nil
+	if err := r.validateIpsecConnOverlaps(ctx, v.Client); err != nil {
+		ipsecconnlog.Error(err, "validate ipsec conn overlaps failed")
+		return warnings, err
+	}
+	return warnings, nil
 }
 
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
-func (r *IpsecConn) ValidateUpdate(old runtime.Object) error {
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *IpsecConnCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	r, ok := newObj.(*IpsecConn)
+	if !ok {
+		return nil, fmt.Errorf("expected an IpsecConn object but got %T", newObj)
+	}
+	oldIpsecConn, ok := oldObj.(*IpsecConn)
+	if !ok {
+		return nil, fmt.Errorf("expected an IpsecConn object but got %T", oldObj)
+	}
 	ipsecconnlog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
-	ipsecconnlog.Info("validate update", "name", r.Name)
-	if err := r.validateIpsecConn(); err != nil {
+	if !r.DeletionTimestamp.IsZero() || reflect.DeepEqual(oldIpsecConn.Spec, r.Spec) {
+		// deletes and metadata only updates, eg. removing the finalizers, are always allowed
+		return nil, nil
+	}
+	policy := v.CryptoPolicy
+	if oldIpsecConn.Spec.IKEProposals == r.Spec.IKEProposals && oldIpsecConn.Spec.ESPProposals == r.Spec.ESPProposals {
+		// the crypto policy only applies to the changed proposals, a stricter policy does not block the other updates
+		policy = CryptoPolicyLegacy
+	}
+	warnings, err := r.validateIpsecConn(policy)
+	if err != nil {
 		ipsecconnlog.Error(err, "validate ipsec conn failed")
-		return err
+		return warnings, err
 	}
-	oldIpsecConn, _ := old.(*IpsecConn)
 	var allErrs field.ErrorList
 	if oldIpsecConn.Spec.VpnGw != "" && oldIpsecConn.Spec.VpnGw != r.Spec.VpnGw {
 		err := errors.New("ipsecConn vpn gw can not be changed")
 		e := field.Invalid(field.NewPath("spec").Child("vpnGw"), r.Spec.VpnGw, err.Error())
 		allErrs = append(allErrs, e)
 	}
-	if len(allErrs) == 0 {
-		return nil
+	if len(allErrs) != 0 {
+		return warnings, allErrs.ToAggregate()
 	}
-	return allErrs.ToAggregate()
+	if oldIpsecConn.Spec.LocalPrivateCidrs == r.Spec.LocalPrivateCidrs && oldIpsecConn.Spec.RemotePrivateCidrs == r.Spec.RemotePrivateCidrs {
+		// the traffic selectors are not changed, the overlaps created by the other connections are not blamed on this one
+		return warnings, nil
+	}
+	if err := r.validateIpsecConnOverlaps(ctx, v.Client); err != nil {
+		ipsecconnlog.Error(err, "validate ipsec conn overlaps failed")
+		return warnings, err
+	}
+	return warnings, nil
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
-func (r *IpsecConn) ValidateDelete() error {
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *IpsecConnCustomValidator) ValidateDelete(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, ok := obj.(*IpsecConn)
+	if !ok {
+		return nil, fmt.Errorf("expected an IpsecConn object but got %T", obj)
+	}
 	ipsecconnlog.Info("validate delete", "name", r.Name)
-
-	// TODO(user): fill in your validation logic upon object deletion.
-	return nil
+	return nil, nil
 }
 
-func (r *IpsecConn) validateIpsecConn() error {
+// validateIpsecConn validates the spec, the ikev1 and the algorithms which are not strong are returned as warnings
+func (r *IpsecConn) validateIpsecConn(policy CryptoPolicy) (admission.Warnings, error) {
+	var warnings admission.Warnings
 	var allErrs field.ErrorList
 
-	// TODO:// use a func to format and append the error
-
 	if r.Spec.VpnGw == "" {
 		err := errors.New("ipsecConn vpn gw is required")
 		e := field.Invalid(field.NewPath("spec").Child("vpnGw"), r.Spec.VpnGw, err.Error())
@@ -119,6 +169,8 @@ func (r *IpsecConn) validateIpsecConn() error {
 		err := errors.New("ipsec connection spec ike version is invalid")
 		e := field.Invalid(field.NewPath("spec").Child("ikeVersion"), r.Spec.IkeVersion, err.Error())
 		allErrs = append(allErrs, e)
+	} else if r.Spec.IkeVersion != "2" {
+		warnings = append(warnings, "ikev1 is deprecated, use ike version 2 unless the remote gateway only supports ikev1")
 	}
 
 	if r.Spec.Auth != "psk" && r.Spec.Auth != "pubkey" {
@@ -127,39 +179,243 @@ func (r *IpsecConn) validateIpsecConn() error {
 		allErrs = append(allErrs, e)
 	}
 
+	var err error
+	var remoteEIP []netip.Addr
 	if r.Spec.RemoteEIP == "" {
 		err := errors.New("ipsecConn remote public ip is required")
-		e := field.Invalid(field.NewPath("spec").Child("localEIP"), r.Spec.RemoteEIP, err.Error())
+		e := field.Invalid(field.NewPath("spec").Child("remoteEIP"), r.Spec.RemoteEIP, err.Error())
+		allErrs = append(allErrs, e)
+	} else if remoteEIP, err = parseIpsecAddrs(r.Spec.RemoteEIP, true); err != nil {
+		err = fmt.Errorf("ipsecConn remote public ip is invalid: %w", err)
+		e := field.Invalid(field.NewPath("spec").Child("remoteEIP"), r.Spec.RemoteEIP, err.Error())
 		allErrs = append(allErrs, e)
 	}
 
+	var remoteCidrs []netip.Prefix
 	if r.Spec.RemotePrivateCidrs == "" {
 		err := errors.New("ipsecConn remote private cidrs is required")
 		e := field.Invalid(field.NewPath("spec").Child("remotePrivateCidrs"), r.Spec.RemotePrivateCidrs, err.Error())
 		allErrs = append(allErrs, e)
+	} else if remoteCidrs, err = parseIpsecCidrs(r.Spec.RemotePrivateCidrs); err != nil {
+		err = fmt.Errorf("ipsecConn remote private cidrs is invalid: %w", err)
+		e := field.Invalid(field.NewPath("spec").Child("remotePrivateCidrs"), r.Spec.RemotePrivateCidrs, err.Error())
+		allErrs = append(allErrs, e)
 	}
 
+	var localVIP []netip.Addr
 	if r.Spec.LocalVIP == "" {
 		err := errors.New("ipsecConn localVIP is required")
 		e := field.Invalid(field.NewPath("spec").Child("localVIP"), r.Spec.LocalVIP, err.Error())
 		allErrs = append(allErrs, e)
+	} else if localVIP, err = parseIpsecAddrs(r.Spec.LocalVIP, false); err != nil {
+		err = fmt.Errorf("ipsecConn localVIP is invalid: %w", err)
+		e := field.Invalid(field.NewPath("spec").Child("localVIP"), r.Spec.LocalVIP, err.Error())
+		allErrs = append(allErrs, e)
 	}
 
+	var localEIP []netip.Addr
 	if r.Spec.LocalEIP == "" {
 		err := errors.New("ipsecConn localEIP is required")
 		e := field.Invalid(field.NewPath("spec").Child("localEIP"), r.Spec.LocalEIP, err.Error())
 		allErrs = append(allErrs, e)
+	} else if localEIP, err = parseIpsecAddrs(r.Spec.LocalEIP, true); err != nil {
+		err = fmt.Errorf("ipsecConn localEIP is invalid: %w", err)
+		e := field.Invalid(field.NewPath("spec").Child("localEIP"), r.Spec.LocalEIP, err.Error())
+		allErrs = append(allErrs, e)
 	}
 
+	var localCidrs []netip.Prefix
 	if r.Spec.LocalPrivateCidrs == "" {
 		err := errors.New("ipsecConn local private cidrs is required")
 		e := field.Invalid(field.NewPath("spec").Child("localPrivateCidrs"), r.Spec.LocalPrivateCidrs, err.Error())
 		allErrs = append(allErrs, e)
+	} else if localCidrs, err = parseIpsecCidrs(r.Spec.LocalPrivateCidrs); err != nil {
+		err = fmt.Errorf("ipsecConn local private cidrs is invalid: %w", err)
+		e := field.Invalid(field.NewPath("spec").Child("localPrivateCidrs"), r.Spec.LocalPrivateCidrs, err.Error())
+		allErrs = append(allErrs, e)
+	}
+
+	// the ike sa is negotiated between the local vip and the remote eip, the eips are the ike identities
+	if len(remoteEIP) != 0 && len(localEIP) != 0 && remoteEIP[0].Is4() != localEIP[0].Is4() {
+		err := fmt.Errorf("ipsecConn localEIP %s and remote public ip %s are in different ip families", localEIP[0], remoteEIP[0])
+		e := field.Invalid(field.NewPath("spec").Child("localEIP"), r.Spec.LocalEIP, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	if len(remoteEIP) != 0 && len(localVIP) != 0 && !slices.ContainsFunc(localVIP, func(addr netip.Addr) bool { return addr.Is4() == remoteEIP[0].Is4() }) {
+		err := fmt.Errorf("ipsecConn localVIP has no %s address to reach the remote public ip %s", addrProtocol(remoteEIP[0]), remoteEIP[0])
+		e := field.Invalid(field.NewPath("spec").Child("localVIP"), r.Spec.LocalVIP, err.Error())
+		allErrs = append(allErrs, e)
+	}
+
+	// the child sa of an ip family is only installed when both traffic selectors have it
+	if len(localCidrs) != 0 && len(remoteCidrs) != 0 {
+		if local, remote := cidrsProtocol(localCidrs), cidrsProtocol(remoteCidrs); local != remote {
+			err := fmt.Errorf("ipsecConn local private cidrs are %s but remote private cidrs are %s", local, remote)
+			e := field.Invalid(field.NewPath("spec").Child("remotePrivateCidrs"), r.Spec.RemotePrivateCidrs, err.Error())
+			allErrs = append(allErrs, e)
+		}
+		if local, remote, ok := cidrsOverlap(localCidrs, remoteCidrs); ok {
+			err := fmt.Errorf("ipsecConn local private cidr %s overlaps remote private cidr %s", local, remote)
+			e := field.Invalid(field.NewPath("spec").Child("remotePrivateCidrs"), r.Spec.RemotePrivateCidrs, err.Error())
+			allErrs = append(allErrs, e)
+		}
+	}
+
+	if w, err := validateProposals(policy, r.Spec.IKEProposals, true); err != nil {
+		e := field.Invalid(field.NewPath("spec").Child("ikeProposals"), r.Spec.IKEProposals, err.Error())
+		allErrs = append(allErrs, e)
+	} else {
+		for _, warning := range w {
+			warnings = append(warnings, "ike "+warning)
+		}
+	}
+
+	if r.Spec.ESPProposals != "" {
+		if w, err := validateProposals(policy, r.Spec.ESPProposals, false); err != nil {
+			e := field.Invalid(field.NewPath("spec").Child("espProposals"), r.Spec.ESPProposals, err.Error())
+			allErrs = append(allErrs, e)
+		} else {
+			for _, warning := range w {
+				warnings = append(warnings, "esp "+warning)
+			}
+		}
 	}
 
 	if len(allErrs) == 0 {
-		return nil
+		return warnings, nil
 	}
 
+	return warnings, allErrs.ToAggregate()
+}
+
+// validateIpsecConnOverlaps rejects the connection whose traffic selectors overlap another connection of the same vpn gw,
+// the kernel picks only one of the overlapped ipsec policies and the traffic of the other connection is blackholed
+func (r *IpsecConn) validateIpsecConnOverlaps(ctx context.Context, c client.Reader) error {
+	if c == nil {
+		return nil
+	}
+	localCidrs, err := parseIpsecCidrs(r.Spec.LocalPrivateCidrs)
+	if err != nil {
+		return err
+	}
+	remoteCidrs, err := parseIpsecCidrs(r.Spec.RemotePrivateCidrs)
+	if err != nil {
+		return err
+	}
+	conns := &IpsecConnList{}
+	if err := c.List(ctx, conns, client.InNamespace(r.Namespace)); err != nil {
+		return fmt.Errorf("failed to list ipsec connections: %w", err)
+	}
+	var allErrs field.ErrorList
+	for _, conn := range conns.Items {
+		if conn.Name == r.Name || conn.Spec.VpnGw != r.Spec.VpnGw || !conn.DeletionTimestamp.IsZero() {
+			continue
+		}
+		// the connection is validated on its own admission, skip the invalid one created before the webhook
+		connLocalCidrs, err := parseIpsecCidrs(conn.Spec.LocalPrivateCidrs)
+		if err != nil {
+			continue
+		}
+		connRemoteCidrs, err := parseIpsecCidrs(conn.Spec.RemotePrivateCidrs)
+		if err != nil {
+			continue
+		}
+		local, connLocal, ok := cidrsOverlap(localCidrs, connLocalCidrs)
+		if !ok {
+			continue
+		}
+		remote, connRemote, ok := cidrsOverlap(remoteCidrs, connRemoteCidrs)
+		if !ok {
+			continue
+		}
+		err = fmt.Errorf("ipsecConn traffic selectors %s === %s overlap ipsecConn %s traffic selectors %s === %s", local, remote, conn.Name, connLocal, connRemote)
+		e := field.Invalid(field.NewPath("spec").Child("remotePrivateCidrs"), r.Spec.RemotePrivateCidrs, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
 	return allErrs.ToAggregate()
 }
+
+// parseIpsecAddrs parses the comma separated ips, the dual stack ones should be one ipv4 and one ipv6
+func parseIpsecAddrs(s string, single bool) ([]netip.Addr, error) {
+	parts := strings.Split(s, ",")
+	if single && len(parts) != 1 {
+		return nil, fmt.Errorf("%q should be a single ip", s)
+	}
+	if len(parts) > 2 || (len(parts) == 2 && util.CheckProtocol(s) != util.ProtocolDual) {
+		return nil, fmt.Errorf("%q should be a single ip or a dual stack pair", s)
+	}
+	var addrs []netip.Addr
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if strings.Contains(part, "/") || util.CheckProtocol(part) == "" {
+			return nil, fmt.Errorf("invalid ip %q", part)
+		}
+		addr, err := netip.ParseAddr(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip %q: %w", part, err)
+		}
+		addrs = append(addrs, addr.Unmap())
+	}
+	return addrs, nil
+}
+
+// parseIpsecCidrs parses the comma separated cidrs of both ip families, a single ip is a host cidr
+func parseIpsecCidrs(s string) ([]netip.Prefix, error) {
+	var cidrs []netip.Prefix
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if util.CheckProtocol(part) == "" {
+			return nil, fmt.Errorf("invalid cidr %q", part)
+		}
+		if !strings.Contains(part, "/") {
+			addr, err := netip.ParseAddr(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cidr %q: %w", part, err)
+			}
+			addr = addr.Unmap()
+			cidrs = append(cidrs, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		cidr, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", part, err)
+		}
+		cidrs = append(cidrs, cidr.Masked())
+	}
+	return cidrs, nil
+}
+
+// cidrsOverlap returns the first pair of overlapped cidrs
+func cidrsOverlap(a, b []netip.Prefix) (netip.Prefix, netip.Prefix, bool) {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Overlaps(y) {
+				return x, y, true
+			}
+		}
+	}
+	return netip.Prefix{}, netip.Prefix{}, false
+}
+
+// cidrsProtocol returns the ip families of the cidrs in the util.CheckProtocol format
+func cidrsProtocol(cidrs []netip.Prefix) string {
+	v4 := slices.ContainsFunc(cidrs, func(cidr netip.Prefix) bool { return cidr.Addr().Is4() })
+	v6 := slices.ContainsFunc(cidrs, func(cidr netip.Prefix) bool { return !cidr.Addr().Is4() })
+	switch {
+	case v4 && v6:
+		return util.ProtocolDual
+	case v6:
+		return util.ProtocolIPv6
+	}
+	return util.ProtocolIPv4
+}
+
+func addrProtocol(addr netip.Addr) string {
+	if addr.Is4() {
+		return util.ProtocolIPv4
+	}
+	return util.ProtocolIPv6
+}
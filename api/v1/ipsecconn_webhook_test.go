@@ -0,0 +1,207 @@
+/*
+Copyright 2023 kubecombo.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestIpsecConn(name, localCidrs, remoteCidrs string) *IpsecConn {
+	return &IpsecConn{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: IpsecConnSpec{
+			VpnGw:              "gw1",
+			Auth:               "psk",
+			IkeVersion:         "2",
+			IKEProposals:       "default",
+			LocalVIP:           "10.1.0.100",
+			LocalEIP:           "172.19.0.101",
+			LocalPrivateCidrs:  localCidrs,
+			RemoteEIP:          "172.19.0.102",
+			RemotePrivateCidrs: remoteCidrs,
+		},
+	}
+}
+
+func TestValidateIpsecConnAddrs(t *testing.T) {
+	cases := []struct {
+		name   string
+		mutate func(*IpsecConn)
+		err    string
+	}{
+		{"valid", func(*IpsecConn) {}, ""},
+		{"dual stack", func(c *IpsecConn) {
+			c.Spec.LocalVIP = "10.1.0.100,fd00::100"
+			c.Spec.LocalPrivateCidrs = "10.1.0.0/24, fd00:1::/64"
+			c.Spec.RemotePrivateCidrs = "10.2.0.0/24,fd00:2::/64"
+		}, ""},
+		{"host cidr", func(c *IpsecConn) { c.Spec.RemotePrivateCidrs = "10.2.0.1" }, ""},
+		{"invalid cidr", func(c *IpsecConn) { c.Spec.LocalPrivateCidrs = "10.1.0.0/33" }, "spec.localPrivateCidrs"},
+		{"empty cidr", func(c *IpsecConn) { c.Spec.LocalPrivateCidrs = "10.1.0.0/24," }, "invalid cidr \"\""},
+		{"invalid eip", func(c *IpsecConn) { c.Spec.RemoteEIP = "172.19.0.300" }, "spec.remoteEIP"},
+		{"eip list", func(c *IpsecConn) { c.Spec.LocalEIP = "172.19.0.101,fd00::101" }, "should be a single ip"},
+		{"eip cidr", func(c *IpsecConn) { c.Spec.LocalEIP = "172.19.0.101/32" }, "invalid ip"},
+		{"same family vip pair", func(c *IpsecConn) { c.Spec.LocalVIP = "10.1.0.100,10.1.0.101" }, "dual stack pair"},
+		{"eip families", func(c *IpsecConn) { c.Spec.RemoteEIP = "fd00::102" }, "different ip families"},
+		{"vip family", func(c *IpsecConn) {
+			c.Spec.LocalVIP = "fd00::100"
+		}, "localVIP has no IPv4 address"},
+		{"ts families", func(c *IpsecConn) { c.Spec.RemotePrivateCidrs = "10.2.0.0/24,fd00:2::/64" }, "local private cidrs are IPv4 but remote private cidrs are Dual"},
+		{"ts overlap", func(c *IpsecConn) { c.Spec.RemotePrivateCidrs = "10.1.0.128/25" }, "overlaps remote private cidr 10.1.0.128/25"},
+	}
+	for _, c := range cases {
+		conn := newTestIpsecConn("conn1", "10.1.0.0/24", "10.2.0.0/24")
+		c.mutate(conn)
+		_, err := conn.validateIpsecConn(CryptoPolicyDefault)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestValidateIpsecConnOverlaps(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	other := newTestIpsecConn("conn2", "10.1.0.0/24, 10.4.0.0/24", "10.3.0.0/24")
+	otherGw := newTestIpsecConn("conn3", "10.1.0.0/24", "10.2.0.0/24")
+	otherGw.Spec.VpnGw = "gw2"
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(other, otherGw).Build()
+
+	cases := []struct {
+		name        string
+		localCidrs  string
+		remoteCidrs string
+		err         string
+	}{
+		{"different remote", "10.1.0.0/24", "10.2.0.0/24", ""},
+		{"different local", "10.5.0.0/24", "10.3.0.0/24", ""},
+		{"same selectors", "10.4.0.0/24", "10.3.0.0/24", "10.4.0.0/24 === 10.3.0.0/24 overlap ipsecConn conn2"},
+		{"overlapped selectors", "10.1.0.0/16", "10.3.0.128/25", "overlap ipsecConn conn2 traffic selectors 10.1.0.0/24 === 10.3.0.0/24"},
+	}
+	for _, tc := range cases {
+		err := newTestIpsecConn("conn1", tc.localCidrs, tc.remoteCidrs).validateIpsecConnOverlaps(context.Background(), c)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected error %q, got %v", tc.name, tc.err, err)
+		}
+	}
+	// the connection itself is skipped on update
+	if err := other.validateIpsecConnOverlaps(context.Background(), c); err != nil {
+		t.Errorf("unexpected error on update %v", err)
+	}
+}
+
+func TestValidateIpsecConnUpdateCryptoPolicy(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	v := &IpsecConnCustomValidator{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), CryptoPolicy: CryptoPolicyStrict}
+	// the connection created before the crypto policy is tightened
+	old := newTestIpsecConn("conn1", "10.1.0.0/24", "10.2.0.0/24")
+	old.Spec.IKEProposals = "aes256-sha256-modp2048"
+	old.Spec.ESPProposals = "aes256-sha256-modp2048"
+
+	cases := []struct {
+		name   string
+		mutate func(*IpsecConn)
+		err    string
+	}{
+		{"other fields", func(c *IpsecConn) { c.Spec.RemotePrivateCidrs = "10.3.0.0/24" }, ""},
+		{"changed ike proposals", func(c *IpsecConn) { c.Spec.IKEProposals = "aes128-sha256-modp2048" }, "spec.ikeProposals"},
+		{"changed esp proposals", func(c *IpsecConn) { c.Spec.ESPProposals = "aes128-sha256-modp2048" }, "spec.espProposals"},
+		{"strong proposals", func(c *IpsecConn) {
+			c.Spec.IKEProposals = "aes256gcm16-prfsha384-ecp384"
+			c.Spec.ESPProposals = "aes256gcm16-ecp384"
+		}, ""},
+	}
+	for _, tc := range cases {
+		conn := old.DeepCopy()
+		tc.mutate(conn)
+		_, err := v.ValidateUpdate(context.Background(), old, conn)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected error %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestValidateIpsecConnUpdate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	// the connections overlapped before the webhook was enabled
+	old := newTestIpsecConn("conn1", "10.1.0.0/24", "10.2.0.0/24")
+	other := newTestIpsecConn("conn2", "10.1.0.0/24", "10.2.0.0/24")
+	v := &IpsecConnCustomValidator{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(old, other).Build(), CryptoPolicy: CryptoPolicyDefault}
+
+	cases := []struct {
+		name   string
+		mutate func(*IpsecConn)
+		err    string
+	}{
+		{"metadata only", func(c *IpsecConn) { c.Labels = map[string]string{"app": "vpn"} }, ""},
+		{"deleting", func(c *IpsecConn) {
+			now := metav1.Now()
+			c.DeletionTimestamp = &now
+			c.Spec.VpnGw = "gw2"
+		}, ""},
+		{"selectors not changed", func(c *IpsecConn) { c.Spec.RemoteEIP = "172.19.0.103" }, ""},
+		{"vpn gw changed", func(c *IpsecConn) { c.Spec.VpnGw = "gw2" }, "spec.vpnGw"},
+		{"overlapped selectors", func(c *IpsecConn) { c.Spec.RemotePrivateCidrs = "10.2.0.0/16" }, "overlap ipsecConn conn2"},
+		{"different selectors", func(c *IpsecConn) { c.Spec.RemotePrivateCidrs = "10.3.0.0/24" }, ""},
+	}
+	for _, tc := range cases {
+		conn := old.DeepCopy()
+		tc.mutate(conn)
+		_, err := v.ValidateUpdate(context.Background(), old, conn)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected error %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
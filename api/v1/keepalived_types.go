@@ -25,6 +25,7 @@ import (
 
 // KeepAlivedSpec defines the desired state of KeepAlived
 type KeepAlivedSpec struct {
+	// vipV4 and vipV6 are rendered as two vrrp instances on nic if instances is empty
 	// +kubebuilder:validation:Optional
 	VipV4 string `json:"vipV4"`
 	// +kubebuilder:validation:Optional
@@ -37,10 +38,171 @@ type KeepAlivedSpec struct {
 	// +kubebuilder:default:=eth0
 	Nic string `json:"nic"`
 
+	// vrrp instances rendered into keepalived.conf, eg. one for the public side and one for the internal side
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=name
+	Instances []KeepAlivedInstance `json:"instances,omitempty"`
+
+	// scripts tracked by all the vrrp instances, the vpn gw adds the checks of its enabled vpn services,
+	// a script named check_ssl_vpn, check_ipsec_vpn or check_wireguard replaces the added one
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=name
+	TrackScripts []KeepAlivedTrackScript `json:"trackScripts,omitempty"`
+
+	// processes tracked by all the vrrp instances, the containers of the vpn gw pod share the process namespace for them
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=name
+	TrackProcesses []KeepAlivedTrackProcess `json:"trackProcesses,omitempty"`
+
 	// +kubebuilder:validation:Required
 	Image string `json:"image"`
 }
 
+// KeepAlivedTrackScript is a vrrp script run in the keepalived container
+type KeepAlivedTrackScript struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_-]+$`
+	// +kubebuilder:validation:MaxLength=32
+	Name string `json:"name"`
+
+	// command line of the script, exit 0 means the check succeeds
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Script string `json:"script"`
+
+	// seconds between the checks
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=2
+	Interval int `json:"interval,omitempty"`
+
+	// seconds before the script is considered failed, defaults to interval
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	Timeout int `json:"timeout,omitempty"`
+
+	// failed checks before the script is down
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=2
+	Fall int `json:"fall,omitempty"`
+
+	// succeeded checks before the script is up again
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=2
+	Rise int `json:"rise,omitempty"`
+
+	// priority added when the script is up (positive) or down (negative),
+	// 0 puts the instances into the fault state to release the vips once the script is down
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=-253
+	// +kubebuilder:validation:Maximum=253
+	Weight int `json:"weight,omitempty"`
+}
+
+// KeepAlivedTrackProcess is a process tracked by keepalived
+type KeepAlivedTrackProcess struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_-]+$`
+	// +kubebuilder:validation:MaxLength=32
+	Name string `json:"name"`
+
+	// process name, eg. openvpn or charon
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_.-]+$`
+	Process string `json:"process"`
+
+	// the process is up if at least quorum processes are running
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=1
+	Quorum int `json:"quorum,omitempty"`
+
+	// seconds to wait before the process is considered down, to ride out the restarts
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	Delay int `json:"delay,omitempty"`
+
+	// priority added when the process is up (positive) or down (negative),
+	// 0 puts the instances into the fault state once the process is down
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=-253
+	// +kubebuilder:validation:Maximum=253
+	Weight int `json:"weight,omitempty"`
+}
+
+// KeepAlivedInstance is a vrrp instance, all the vips of an instance fail over together
+type KeepAlivedInstance struct {
+	// vrrp instance name, it is allocated a router id of its own
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_-]+$`
+	// +kubebuilder:validation:MaxLength=32
+	Name string `json:"name"`
+
+	// interface the vrrp adverts are sent on, defaults to spec.nic
+	// +kubebuilder:validation:Optional
+	Nic string `json:"nic,omitempty"`
+
+	// vips of the same ip family, ipv4 and ipv6 vips should be in separate instances
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Vips []KeepAlivedVip `json:"vips"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=254
+	// +kubebuilder:default:=100
+	Priority int `json:"priority,omitempty"`
+
+	// the higher priority pod takes over the vips once it is back, disabled by default to avoid flapping
+	// +kubebuilder:validation:Optional
+	Preempt bool `json:"preempt,omitempty"`
+
+	// vrrp advert interval in seconds
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=255
+	// +kubebuilder:default:=1
+	AdvertInterval int `json:"advertInterval,omitempty"`
+
+	// unicast the vrrp adverts to the peers instead of multicast, for the networks dropping multicast
+	// +kubebuilder:validation:Optional
+	UnicastPeers []string `json:"unicastPeers,omitempty"`
+
+	// vrrp v2 authentication, ipv6 instances use vrrp v3 which does not support it
+	// +kubebuilder:validation:Optional
+	Authentication *KeepAlivedAuthentication `json:"authentication,omitempty"`
+}
+
+// KeepAlivedVip is a virtual ip of a vrrp instance
+type KeepAlivedVip struct {
+	// ip or ip with prefix length, eg. 10.1.0.100 or 10.1.0.100/24
+	// +kubebuilder:validation:Required
+	IP string `json:"ip"`
+
+	// interface the vip is added to, defaults to the instance nic
+	// +kubebuilder:validation:Optional
+	Nic string `json:"nic,omitempty"`
+}
+
+// KeepAlivedAuthentication is the vrrp authentication of an instance,
+// the password is rendered into a config map and only protects against misconfigured peers
+type KeepAlivedAuthentication struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=PASS;AH
+	Type string `json:"type"`
+
+	// keepalived uses the first 8 characters only
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=8
+	Password string `json:"password"`
+}
+
 // KeepAlivedStatus defines the observed state of KeepAlived
 type KeepAlivedStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -53,6 +215,42 @@ type KeepAlivedStatus struct {
 	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 
 	RouterID int `json:"routerID"`
+
+	// router ids of the vrrp instances by instance name, routerID is the one of the first instance
+	// +kubebuilder:validation:Optional
+	RouterIDs map[string]int `json:"routerIDs,omitempty"`
+
+	// subnet the router ids are allocated in, vrrp adverts of the same router id only collide in one subnet
+	// +kubebuilder:validation:Optional
+	Subnet string `json:"subnet,omitempty"`
+}
+
+const (
+	// KeepAlivedInstanceV4 is the vrrp instance rendered from vipV4
+	KeepAlivedInstanceV4 = "ipv4"
+	// KeepAlivedInstanceV6 is the vrrp instance rendered from vipV6
+	KeepAlivedInstanceV6 = "ipv6"
+)
+
+// VrrpInstances returns spec.instances, or the instances converted from vipV4 and vipV6 if it is empty
+func (m *KeepAlived) VrrpInstances() []KeepAlivedInstance {
+	if len(m.Spec.Instances) != 0 {
+		return m.Spec.Instances
+	}
+	var instances []KeepAlivedInstance
+	for _, vip := range []struct{ name, ip string }{
+		{KeepAlivedInstanceV4, m.Spec.VipV4},
+		{KeepAlivedInstanceV6, m.Spec.VipV6},
+	} {
+		if vip.ip != "" {
+			instances = append(instances, KeepAlivedInstance{
+				Name: vip.name,
+				Nic:  m.Spec.Nic,
+				Vips: []KeepAlivedVip{{IP: vip.ip}},
+			})
+		}
+	}
+	return instances
 }
 
 func (m *KeepAlived) GetConditions() []metav1.Condition {
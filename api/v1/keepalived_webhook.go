@@ -17,76 +17,229 @@ limitations under the License.
 package v1
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 // log is for logging in this package.
 var keepalivedlog = logf.Log.WithName("keepalived-resource")
 
-func (r *KeepAlived) SetupWebhookWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewWebhookManagedBy(mgr).
-		For(r).
+// SetupKeepAlivedWebhookWithManager registers the webhook for KeepAlived in the manager.
+func SetupKeepAlivedWebhookWithManager(mgr ctrl.Manager, opts WebhookOptions) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&KeepAlived{}).
+		WithDefaulter(&KeepAlivedCustomDefaulter{Defaults: opts.Defaults}).
+		WithValidator(&KeepAlivedCustomValidator{}).
 		Complete()
 }
 
-// TODO(user): EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-
 //+kubebuilder:webhook:path=/mutate-vpn-gw-kubecombo-com-v1-keepalived,mutating=true,failurePolicy=fail,sideEffects=None,groups=vpn-gw.kubecombo.com,resources=keepaliveds,verbs=create;update,versions=v1,name=mkeepalived.kb.io,admissionReviewVersions=v1
 
-// var _ webhook.Defaulter = &KeepAlived{}
+// KeepAlivedCustomDefaulter sets the default values of the KeepAlived
+// +kubebuilder:object:generate=false
+type KeepAlivedCustomDefaulter struct {
+	Defaults DefaultOptions
+}
 
-// Default implements webhook.Defaulter so a webhook will be registered for the type
-func (r *KeepAlived) Default() {
-	keepalivedlog.Info("default", "name", r.Name)
+var _ webhook.CustomDefaulter = &KeepAlivedCustomDefaulter{}
 
-	// TODO(user): fill in your defaulting logic.
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (d *KeepAlivedCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	ka, ok := obj.(*KeepAlived)
+	if !ok {
+		return fmt.Errorf("expected a KeepAlived object but got %T", obj)
+	}
+	keepalivedlog.Info("default", "name", ka.Name)
+	ka.SetDefaults(d.Defaults)
+	return nil
 }
 
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
 //+kubebuilder:webhook:path=/validate-vpn-gw-kubecombo-com-v1-keepalived,mutating=false,failurePolicy=fail,sideEffects=None,groups=vpn-gw.kubecombo.com,resources=keepaliveds,verbs=create;update,versions=v1,name=vkeepalived.kb.io,admissionReviewVersions=v1
 
-// var _ webhook.Validator = &KeepAlived{}
+// KeepAlivedCustomValidator validates the KeepAlived
+// +kubebuilder:object:generate=false
+type KeepAlivedCustomValidator struct{}
+
+var _ webhook.CustomValidator = &KeepAlivedCustomValidator{}
 
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
-func (r *KeepAlived) ValidateCreate() error {
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *KeepAlivedCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, ok := obj.(*KeepAlived)
+	if !ok {
+		return nil, fmt.Errorf("expected a KeepAlived object but got %T", obj)
+	}
 	keepalivedlog.Info("validate create", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object creation.
-	return nil
+	if err := r.validateKeepAlived(); err != nil {
+		keepalivedlog.Error(err, "validate keepalived failed")
+		return nil, err
+	}
+	return nil, nil
 }
 
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
-func (r *KeepAlived) ValidateUpdate(old runtime.Object) error {
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *KeepAlivedCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	r, ok := newObj.(*KeepAlived)
+	if !ok {
+		return nil, fmt.Errorf("expected a KeepAlived object but got %T", newObj)
+	}
+	oldKa, ok := oldObj.(*KeepAlived)
+	if !ok {
+		return nil, fmt.Errorf("expected a KeepAlived object but got %T", oldObj)
+	}
 	keepalivedlog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
-	oldKa, _ := old.(*KeepAlived)
+	if err := r.validateKeepAlived(); err != nil {
+		keepalivedlog.Error(err, "validate keepalived failed")
+		return nil, err
+	}
 	var allErrs field.ErrorList
 	if oldKa.Spec.VipV4 != "" && oldKa.Spec.VipV4 != r.Spec.VipV4 {
 		err := errors.New("keepalived v4 ip can not be changed")
-		e := field.Invalid(field.NewPath("spec").Child("keepAlived"), r.Spec.VipV4, err.Error())
+		e := field.Invalid(field.NewPath("spec").Child("vipV4"), r.Spec.VipV4, err.Error())
 		allErrs = append(allErrs, e)
 	}
 	if oldKa.Spec.VipV6 != "" && oldKa.Spec.VipV6 != r.Spec.VipV6 {
 		err := errors.New("keepalived v6 ip can not be changed")
-		e := field.Invalid(field.NewPath("spec").Child("keepAlived"), r.Spec.VipV6, err.Error())
+		e := field.Invalid(field.NewPath("spec").Child("vipV6"), r.Spec.VipV6, err.Error())
 		allErrs = append(allErrs, e)
 	}
 	if len(allErrs) == 0 {
-		return nil
+		return nil, nil
 	}
-	return nil
+	return nil, allErrs.ToAggregate()
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
-func (r *KeepAlived) ValidateDelete() error {
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *KeepAlivedCustomValidator) ValidateDelete(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, ok := obj.(*KeepAlived)
+	if !ok {
+		return nil, fmt.Errorf("expected a KeepAlived object but got %T", obj)
+	}
 	keepalivedlog.Info("validate delete", "name", r.Name)
+	return nil, nil
+}
 
-	// TODO(user): fill in your validation logic upon object deletion.
-	return nil
+// validateKeepAlived validates the image, vips and vrrp instances
+func (r *KeepAlived) validateKeepAlived() error {
+	var allErrs field.ErrorList
+	if r.Spec.Image == "" {
+		err := errors.New("keepalived image is required")
+		e := field.Invalid(field.NewPath("spec").Child("image"), r.Spec.Image, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	if r.Spec.VipV4 == "" && r.Spec.VipV6 == "" && len(r.Spec.Instances) == 0 {
+		err := errors.New("keepalived vip v4, v6 or instances is required")
+		e := field.Invalid(field.NewPath("spec").Child("vipV4"), r.Spec.VipV4, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	if r.Spec.VipV4 != "" {
+		if ip := net.ParseIP(r.Spec.VipV4); ip == nil || ip.To4() == nil {
+			err := errors.New("keepalived vip v4 should be an ipv4 address")
+			e := field.Invalid(field.NewPath("spec").Child("vipV4"), r.Spec.VipV4, err.Error())
+			allErrs = append(allErrs, e)
+		}
+	}
+	if r.Spec.VipV6 != "" {
+		if ip := net.ParseIP(r.Spec.VipV6); ip == nil || ip.To4() != nil {
+			err := errors.New("keepalived vip v6 should be an ipv6 address")
+			e := field.Invalid(field.NewPath("spec").Child("vipV6"), r.Spec.VipV6, err.Error())
+			allErrs = append(allErrs, e)
+		}
+	}
+	allErrs = append(allErrs, r.validateKeepAlivedInstances()...)
+	allErrs = append(allErrs, r.validateKeepAlivedTracks()...)
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return allErrs.ToAggregate()
+}
+
+// validateKeepAlivedInstances checks the vips of an instance are of the same ip family,
+// keepalived runs vrrp v2 for ipv4 and vrrp v3 without authentication for ipv6
+func (r *KeepAlived) validateKeepAlivedInstances() field.ErrorList {
+	var allErrs field.ErrorList
+	names := map[string]bool{}
+	for i, instance := range r.Spec.Instances {
+		path := field.NewPath("spec").Child("instances").Index(i)
+		if names[instance.Name] {
+			allErrs = append(allErrs, field.Duplicate(path.Child("name"), instance.Name))
+		}
+		names[instance.Name] = true
+		if len(instance.Vips) == 0 {
+			err := errors.New("keepalived instance vip is required")
+			allErrs = append(allErrs, field.Invalid(path.Child("vips"), instance.Vips, err.Error()))
+			continue
+		}
+		var ipv6 bool
+		for j, vip := range instance.Vips {
+			addr, err := parseKeepAlivedVip(vip.IP)
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(path.Child("vips").Index(j).Child("ip"), vip.IP, err.Error()))
+				continue
+			}
+			if j == 0 {
+				ipv6 = addr.Is6()
+			} else if addr.Is6() != ipv6 {
+				err := errors.New("ipv4 and ipv6 vips should be in separate instances")
+				allErrs = append(allErrs, field.Invalid(path.Child("vips").Index(j).Child("ip"), vip.IP, err.Error()))
+			}
+		}
+		for j, peer := range instance.UnicastPeers {
+			if addr, err := netip.ParseAddr(peer); err != nil || addr.Is6() != ipv6 {
+				err := errors.New("keepalived unicast peer should be an ip of the vip family")
+				allErrs = append(allErrs, field.Invalid(path.Child("unicastPeers").Index(j), peer, err.Error()))
+			}
+		}
+		if instance.Authentication != nil && ipv6 {
+			err := errors.New("authentication is not supported by vrrp v3 of the ipv6 instance")
+			allErrs = append(allErrs, field.Invalid(path.Child("authentication"), instance.Authentication.Type, err.Error()))
+		}
+	}
+	return allErrs
+}
+
+// validateKeepAlivedTracks checks the track script is a single command line,
+// keepalived.conf quotes it and runs it without a shell
+func (r *KeepAlived) validateKeepAlivedTracks() field.ErrorList {
+	var allErrs field.ErrorList
+	scripts := map[string]bool{}
+	for i, script := range r.Spec.TrackScripts {
+		path := field.NewPath("spec").Child("trackScripts").Index(i)
+		if scripts[script.Name] {
+			allErrs = append(allErrs, field.Duplicate(path.Child("name"), script.Name))
+		}
+		scripts[script.Name] = true
+		if strings.TrimSpace(script.Script) == "" || strings.ContainsAny(script.Script, "\"\r\n") {
+			err := errors.New("keepalived track script should be a single line without double quotes")
+			allErrs = append(allErrs, field.Invalid(path.Child("script"), script.Script, err.Error()))
+		}
+	}
+	processes := map[string]bool{}
+	for i, process := range r.Spec.TrackProcesses {
+		if processes[process.Name] {
+			allErrs = append(allErrs, field.Duplicate(field.NewPath("spec").Child("trackProcesses").Index(i).Child("name"), process.Name))
+		}
+		processes[process.Name] = true
+	}
+	return allErrs
+}
+
+// parseKeepAlivedVip parses an ip or an ip with prefix length
+func parseKeepAlivedVip(vip string) (netip.Addr, error) {
+	if strings.Contains(vip, "/") {
+		prefix, err := netip.ParsePrefix(vip)
+		return prefix.Addr(), err
+	}
+	return netip.ParseAddr(vip)
 }
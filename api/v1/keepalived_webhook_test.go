@@ -0,0 +1,102 @@
+/*
+Copyright 2023 kubecombo.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVrrpInstances(t *testing.T) {
+	ka := &KeepAlived{Spec: KeepAlivedSpec{VipV4: "10.1.0.100", VipV6: "fd00::100", Nic: "eth0"}}
+	instances := ka.VrrpInstances()
+	if len(instances) != 2 || instances[0].Name != KeepAlivedInstanceV4 || instances[1].Name != KeepAlivedInstanceV6 ||
+		instances[0].Nic != "eth0" || instances[1].Vips[0].IP != "fd00::100" {
+		t.Errorf("unexpected instances converted from vipV4 and vipV6 %+v", instances)
+	}
+	ka.Spec.Instances = []KeepAlivedInstance{{Name: "public", Vips: []KeepAlivedVip{{IP: "172.19.0.100"}}}}
+	if instances := ka.VrrpInstances(); len(instances) != 1 || instances[0].Name != "public" {
+		t.Errorf("spec.instances should be used, got %+v", instances)
+	}
+}
+
+func TestValidateKeepAlivedInstances(t *testing.T) {
+	cases := []struct {
+		name     string
+		instance KeepAlivedInstance
+		err      string
+	}{
+		{"valid", KeepAlivedInstance{Name: "public", Vips: []KeepAlivedVip{{IP: "172.19.0.100/24"}, {IP: "172.19.1.100", Nic: "net2"}}, UnicastPeers: []string{"172.19.0.11"}, Authentication: &KeepAlivedAuthentication{Type: "PASS", Password: "secret"}}, ""},
+		{"valid ipv6", KeepAlivedInstance{Name: "public6", Vips: []KeepAlivedVip{{IP: "fd00::100"}}, UnicastPeers: []string{"fd00::11"}}, ""},
+		{"no vip", KeepAlivedInstance{Name: "public"}, "vip is required"},
+		{"invalid vip", KeepAlivedInstance{Name: "public", Vips: []KeepAlivedVip{{IP: "172.19.0.300"}}}, "spec.instances[0].vips[0].ip"},
+		{"mixed families", KeepAlivedInstance{Name: "public", Vips: []KeepAlivedVip{{IP: "172.19.0.100"}, {IP: "fd00::100"}}}, "separate instances"},
+		{"peer family", KeepAlivedInstance{Name: "public", Vips: []KeepAlivedVip{{IP: "172.19.0.100"}}, UnicastPeers: []string{"fd00::11"}}, "spec.instances[0].unicastPeers[0]"},
+		{"ipv6 auth", KeepAlivedInstance{Name: "public", Vips: []KeepAlivedVip{{IP: "fd00::100"}}, Authentication: &KeepAlivedAuthentication{Type: "AH", Password: "secret"}}, "vrrp v3"},
+	}
+	for _, c := range cases {
+		ka := &KeepAlived{Spec: KeepAlivedSpec{Image: "keepalived", Instances: []KeepAlivedInstance{c.instance}}}
+		err := ka.validateKeepAlived()
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+	}
+
+	ka := &KeepAlived{Spec: KeepAlivedSpec{Image: "keepalived", Instances: []KeepAlivedInstance{
+		{Name: "public", Vips: []KeepAlivedVip{{IP: "172.19.0.100"}}},
+		{Name: "public", Vips: []KeepAlivedVip{{IP: "10.1.0.100"}}},
+	}}}
+	if err := ka.validateKeepAlived(); err == nil || !strings.Contains(err.Error(), "Duplicate value") {
+		t.Errorf("expected duplicate instance error, got %v", err)
+	}
+}
+
+func TestValidateKeepAlivedTracks(t *testing.T) {
+	vips := []KeepAlivedInstance{{Name: "public", Vips: []KeepAlivedVip{{IP: "172.19.0.100"}}}}
+	cases := []struct {
+		name      string
+		scripts   []KeepAlivedTrackScript
+		processes []KeepAlivedTrackProcess
+		err       string
+	}{
+		{"valid", []KeepAlivedTrackScript{{Name: "check_ssl_vpn", Script: "/check.sh port tcp 443", Weight: -20}}, []KeepAlivedTrackProcess{{Name: "openvpn", Process: "openvpn"}}, ""},
+		{"empty script", []KeepAlivedTrackScript{{Name: "check", Script: " "}}, nil, "spec.trackScripts[0].script"},
+		{"multi line script", []KeepAlivedTrackScript{{Name: "check", Script: "/check.sh port tcp 443\nreboot"}}, nil, "single line"},
+		{"quoted script", []KeepAlivedTrackScript{{Name: "check", Script: `/bin/sh -c "exit 0"`}}, nil, "double quotes"},
+		{"duplicate script", []KeepAlivedTrackScript{{Name: "check", Script: "/bin/true"}, {Name: "check", Script: "/bin/false"}}, nil, "spec.trackScripts[1].name"},
+		{"duplicate process", nil, []KeepAlivedTrackProcess{{Name: "vpn", Process: "openvpn"}, {Name: "vpn", Process: "charon"}}, "spec.trackProcesses[1].name"},
+	}
+	for _, c := range cases {
+		ka := &KeepAlived{Spec: KeepAlivedSpec{Image: "keepalived", Instances: vips, TrackScripts: c.scripts, TrackProcesses: c.processes}}
+		err := ka.validateKeepAlived()
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+	}
+}
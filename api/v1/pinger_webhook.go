@@ -17,62 +17,115 @@ limitations under the License.
 package v1
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 // log is for logging in this package.
 var pingerlog = logf.Log.WithName("pinger-resource")
 
-// SetupWebhookWithManager will setup the manager to manage the webhooks
-func (r *Pinger) SetupWebhookWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewWebhookManagedBy(mgr).
-		For(r).
+// SetupPingerWebhookWithManager registers the webhook for Pinger in the manager.
+func SetupPingerWebhookWithManager(mgr ctrl.Manager, opts WebhookOptions) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&Pinger{}).
+		WithDefaulter(&PingerCustomDefaulter{Defaults: opts.Defaults}).
+		WithValidator(&PingerCustomValidator{}).
 		Complete()
 }
 
-// TODO(user): EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-
 // +kubebuilder:webhook:path=/mutate-vpn-gw-kubecombo-com-v1-pinger,mutating=true,failurePolicy=fail,sideEffects=None,groups=vpn-gw.kubecombo.com,resources=pingers,verbs=create;update,versions=v1,name=mpinger.kb.io,admissionReviewVersions=v1
 
-// var _ webhook.Defaulter = &Pinger{}
-
-// Default implements webhook.Defaulter so a webhook will be registered for the type
-func (r *Pinger) Default() {
-	pingerlog.Info("default", "name", r.Name)
+// PingerCustomDefaulter sets the default values of the Pinger
+// +kubebuilder:object:generate=false
+type PingerCustomDefaulter struct {
+	Defaults DefaultOptions
+}
 
-	// TODO(user): fill in your defaulting logic.
+var _ webhook.CustomDefaulter = &PingerCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (d *PingerCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	pinger, ok := obj.(*Pinger)
+	if !ok {
+		return fmt.Errorf("expected a Pinger object but got %T", obj)
+	}
+	pingerlog.Info("default", "name", pinger.Name)
+	pinger.SetDefaults(d.Defaults)
+	return nil
 }
 
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
 // NOTE: The 'path' attribute must follow a specific pattern and should not be modified directly here.
 // Modifying the path for an invalid path can cause API server errors; failing to locate the webhook.
 // +kubebuilder:webhook:path=/validate-vpn-gw-kubecombo-com-v1-pinger,mutating=false,failurePolicy=fail,sideEffects=None,groups=vpn-gw.kubecombo.com,resources=pingers,verbs=create;update,versions=v1,name=vpinger.kb.io,admissionReviewVersions=v1
 
-// var _ webhook.Validator = &Pinger{}
+// PingerCustomValidator validates the Pinger
+// +kubebuilder:object:generate=false
+type PingerCustomValidator struct{}
 
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
-func (r *Pinger) ValidateCreate() (admission.Warnings, error) {
+var _ webhook.CustomValidator = &PingerCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *PingerCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, ok := obj.(*Pinger)
+	if !ok {
+		return nil, fmt.Errorf("expected a Pinger object but got %T", obj)
+	}
 	pingerlog.Info("validate create", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object creation.
+	if err := r.validatePinger(); err != nil {
+		pingerlog.Error(err, "validate pinger failed")
+		return nil, err
+	}
 	return nil, nil
 }
 
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
-func (r *Pinger) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *PingerCustomValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	r, ok := newObj.(*Pinger)
+	if !ok {
+		return nil, fmt.Errorf("expected a Pinger object but got %T", newObj)
+	}
 	pingerlog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
+	if err := r.validatePinger(); err != nil {
+		pingerlog.Error(err, "validate pinger failed")
+		return nil, err
+	}
 	return nil, nil
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
-func (r *Pinger) ValidateDelete() (admission.Warnings, error) {
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *PingerCustomValidator) ValidateDelete(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, ok := obj.(*Pinger)
+	if !ok {
+		return nil, fmt.Errorf("expected a Pinger object but got %T", obj)
+	}
 	pingerlog.Info("validate delete", "name", r.Name)
-
-	// TODO(user): fill in your validation logic upon object deletion.
 	return nil, nil
 }
+
+// validatePinger validates the image and the ping targets
+func (r *Pinger) validatePinger() error {
+	var allErrs field.ErrorList
+	if r.Spec.Image == "" {
+		err := errors.New("pinger image is required")
+		e := field.Invalid(field.NewPath("spec").Child("image"), r.Spec.Image, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	if r.Spec.Ping == "" && r.Spec.TcpPing == "" && r.Spec.UdpPing == "" && r.Spec.Dns == "" {
+		err := errors.New("pinger should set at least one kind of ping target")
+		e := field.Invalid(field.NewPath("spec").Child("ping"), r.Spec.Ping, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return allErrs.ToAggregate()
+}
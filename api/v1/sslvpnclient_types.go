@@ -0,0 +1,161 @@
+/*
+Copyright 2023 kubecombo.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SslVpnClientSpec defines the desired state of SslVpnClient
+type SslVpnClientSpec struct {
+	// the client certificate is signed by the vpn gw ssl vpn ca secret
+
+	// +kubebuilder:validation:Required
+	VpnGw string `json:"vpnGw"`
+
+	// client certificate common name, use the ssl vpn client name if not set,
+	// it is also the file name of the client config in the openvpn client-config-dir and the key in the client config secret
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9][-._A-Za-z0-9]*$`
+	CommonName string `json:"commonName,omitempty"`
+
+	// client certificate duration, it is renewed in the last third of it
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="8760h"
+	Duration metav1.Duration `json:"duration,omitempty"`
+
+	// revoke the client certificate, the profile secret is deleted and the certificate is added to the vpn gw crl
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=false
+	Revoked bool `json:"revoked,omitempty"`
+
+	// fixed virtual ip of the client, it should be in the vpn gw ssl vpn static cidr
+	// +kubebuilder:validation:Optional
+	StaticIP string `json:"staticIP,omitempty"`
+
+	// cidrs routed to the vpn gw for the client, in addition to the routes pushed to all clients
+	// +kubebuilder:validation:Optional
+	Routes []string `json:"routes,omitempty"`
+
+	// dns servers pushed to the client
+	// +kubebuilder:validation:Optional
+	DNS []string `json:"dns,omitempty"`
+
+	// cidrs the client is allowed to reach through the vpn gw, all are allowed if not set,
+	// the static ip is required since the acl matches the client by it
+	// +kubebuilder:validation:Optional
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
+}
+
+const (
+	// SslVpnClientIssued means the client certificate is issued and the profile secret is ready to use
+	SslVpnClientIssued = "Issued"
+	// SslVpnClientRevoked means the client certificate is in the crl of the vpn gw
+	SslVpnClientRevoked = "Revoked"
+	// SslVpnClientConfigured means the client config is rendered into the vpn gw client-config-dir
+	SslVpnClientConfigured = "Configured"
+)
+
+// SslVpnClientStatus defines the observed state of SslVpnClient
+type SslVpnClientStatus struct {
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// serial number of the issued client certificate in hex
+	// +kubebuilder:validation:Optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	CommonName string `json:"commonName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+
+	// secret with the client.ovpn profile and the client certificate
+	// +kubebuilder:validation:Optional
+	ProfileSecret string `json:"profileSecret,omitempty"`
+
+	// certificates issued to the client which are not expired yet, including the current one,
+	// they are all revoked once the client is revoked or deleted
+	// +kubebuilder:validation:Optional
+	IssuedCertificates []SslVpnClientCertificate `json:"issuedCertificates,omitempty"`
+}
+
+// SslVpnClientCertificate is a certificate issued to the ssl vpn client
+type SslVpnClientCertificate struct {
+	// serial number in hex
+	SerialNumber string `json:"serialNumber"`
+
+	// +kubebuilder:validation:Optional
+	CommonName string `json:"commonName,omitempty"`
+
+	NotAfter metav1.Time `json:"notAfter"`
+
+	// the certificate is replaced before its renewal, eg. for a new common name or a lost profile secret,
+	// it is revoked in the vpn gw crl
+	// +kubebuilder:validation:Optional
+	Replaced bool `json:"replaced,omitempty"`
+}
+
+func (m *SslVpnClient) GetConditions() []metav1.Condition {
+	return m.Status.Conditions
+}
+
+func (m *SslVpnClient) SetConditions(conditions []metav1.Condition) {
+	m.Status.Conditions = conditions
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:resource:shortName=sslclient
+// +kubebuilder:printcolumn:name="VpnGw",type=string,JSONPath=`.spec.vpnGw`
+// +kubebuilder:printcolumn:name="CommonName",type=string,JSONPath=`.status.commonName`
+// +kubebuilder:printcolumn:name="Issued",type=string,JSONPath=`.status.conditions[?(@.type=="Issued")].status`
+// +kubebuilder:printcolumn:name="Revoked",type=string,JSONPath=`.spec.revoked`
+// +kubebuilder:printcolumn:name="Profile",type=string,JSONPath=`.status.profileSecret`
+// +kubebuilder:printcolumn:name="NotAfter",type=date,JSONPath=`.status.notAfter`
+// +kubebuilder:printcolumn:name="Serial",type=string,JSONPath=`.status.serialNumber`,priority=1
+
+// SslVpnClient is the Schema for the sslvpnclients API
+type SslVpnClient struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SslVpnClientSpec   `json:"spec,omitempty"`
+	Status SslVpnClientStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SslVpnClientList contains a list of SslVpnClient
+type SslVpnClientList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SslVpnClient `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SslVpnClient{}, &SslVpnClientList{})
+}
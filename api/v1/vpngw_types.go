@@ -18,6 +18,7 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -36,6 +37,11 @@ type VpnGwSpec struct {
 	// +kubebuilder:validation:Required
 	WorkloadType string `json:"workloadType"`
 
+	// StaticPodAutoHeal recreates the daemonset pod on the node whose static pod drifts from the vpn gw,
+	// so that the static pod manifest is copied again
+	// +optional
+	StaticPodAutoHeal bool `json:"staticPodAutoHeal,omitempty"`
+
 	// cpu, memory request
 	// cpu, memory limit
 	// 1C 1G at least
@@ -46,10 +52,28 @@ type VpnGwSpec struct {
 	// +kubebuilder:validation:Required
 	Memory string `json:"memory"`
 
-	// 1Mbps bandwidth at least
+	// ingress and egress bandwidth in Mbps, 1Mbps bandwidth at least, spec.qos overrides it
 	// +kubebuilder:validation:Optional
 	QoSBandwidth string `json:"qosBandwidth"`
 
+	// separate ingress and egress bandwidth of the vpn gw pods, and the rate limit of each ssl vpn client
+	// +kubebuilder:validation:Optional
+	QoS *VpnGwQoS `json:"qos,omitempty"`
+
+	// cni provider which attaches the vpn gw pods to the keepalived subnet and limits the bandwidth,
+	// kube-ovn uses the subnet as the logical switch, multus uses it as the network attachment definition,
+	// cni only sets the bandwidth plugin annotations. defaults to the --cni-provider flag of the controller
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=kube-ovn;multus;cni
+	CNIProvider string `json:"cniProvider,omitempty"`
+
+	// secondary interfaces of the statefulset pods attached by multus,
+	// eg: a dedicated uplink interface which separates the encrypted traffic from the cluster traffic
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=interface
+	Networks []VpnGwNetwork `json:"networks,omitempty"`
+
 	// vpn gw private vpc subnet static ip
 
 	// statefulset replicas
@@ -98,9 +122,30 @@ type VpnGwSpec struct {
 	// +kubebuilder:validation:Optional
 	SslVpnSubnetCidr string `json:"sslVpnSubnetCidr"`
 
+	// cidr in the ssl vpn subnet cidr reserved for the ssl vpn client static ips,
+	// the dynamic ips are allocated out of it
+	// +kubebuilder:validation:Optional
+	SslVpnStaticCidr string `json:"sslVpnStaticCidr,omitempty"`
+
 	// +kubebuilder:validation:Optional
 	SslVpnImage string `json:"sslVpnImage"`
 
+	// ssl vpn ca keypair secret name with tls.crt and tls.key, eg. the cert-manager ca issuer secret
+	// it should be the ca.crt of the ssl vpn secret, and have the crl sign key usage
+	// set it to issue the ssl vpn client certificates and sign the crl of the revoked clients
+	// +kubebuilder:validation:Optional
+	SslVpnCASecret string `json:"sslVpnCASecret,omitempty"`
+
+	// ssl vpn public ip or domain, the ssl vpn client profiles connect to it
+	// +kubebuilder:validation:Optional
+	SslVpnEIP string `json:"sslVpnEIP,omitempty"`
+
+	// revoke the ssl vpn client certificates by serial number or common name,
+	// eg. the leaked certificates which are not issued by an ssl vpn client,
+	// they are signed into the crl together with the revoked ssl vpn clients
+	// +kubebuilder:validation:Optional
+	SslVpnRevocations []SslVpnRevocation `json:"sslVpnRevocations,omitempty"`
+
 	// vpn gw enable ipsec vpn
 
 	// +kubebuilder:validation:Required
@@ -127,8 +172,152 @@ type VpnGwSpec struct {
 	IPSecEnablePSK bool `json:"ipsecEnablePSK"`
 
 	// only support one global default PSK is enough for most cases
+	// Deprecated: the psk is visible to anyone who can read the vpn gw, use defaultPSKSecretRef instead
 	// +kubebuilder:validation:Optional
 	DefaultPSK string `json:"defaultPSK,omitempty"`
+
+	// default pre-shared key of the ipsec connections which do not reference their own psk
+	// the secret should be in the same namespace, it takes precedence over defaultPSK
+	// +kubebuilder:validation:Optional
+	DefaultPSKSecretRef *corev1.SecretKeySelector `json:"defaultPSKSecretRef,omitempty"`
+
+	// vpn gw enable wireguard vpn
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=false
+	EnableWireGuard bool `json:"enableWireGuard"`
+
+	// wireguard server private key secret name, the secret should in the same namespace as the vpn gw
+	// the private key generated by wg genkey is stored in the private-key key
+	// +kubebuilder:validation:Optional
+	WireGuardSecret string `json:"wireGuardSecret,omitempty"`
+
+	// wireguard udp listen port
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=51820
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	WireGuardListenPort int32 `json:"wireGuardListenPort,omitempty"`
+
+	// wireguard interface address with its prefix length, eg. 10.250.0.1/24
+	// comma separated for dual stack
+	// +kubebuilder:validation:Optional
+	WireGuardAddressCidr string `json:"wireGuardAddressCidr,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	WireGuardImage string `json:"wireGuardImage,omitempty"`
+}
+
+// VpnGwQoS limits the bandwidth of the vpn gw, the bandwidth is in bits per second, eg: 100M, 1G
+type VpnGwQoS struct {
+	// bandwidth of the traffic into the vpn gw pod, 1M at least, defaults to qosBandwidth
+	// +kubebuilder:validation:Optional
+	Ingress *resource.Quantity `json:"ingress,omitempty"`
+
+	// bandwidth of the traffic out of the vpn gw pod, 1M at least, defaults to qosBandwidth
+	// +kubebuilder:validation:Optional
+	Egress *resource.Quantity `json:"egress,omitempty"`
+
+	// rate limit of each ssl vpn client in both directions, 8k at least
+	// +kubebuilder:validation:Optional
+	SslVpnClientRate *resource.Quantity `json:"sslVpnClientRate,omitempty"`
+
+	// bits each ssl vpn client may send or receive over the rate limit in a burst, defaults to the one of iptables hashlimit
+	// +kubebuilder:validation:Optional
+	SslVpnClientBurst *resource.Quantity `json:"sslVpnClientBurst,omitempty"`
+}
+
+// VpnGwNetwork is a network attachment definition attached to the vpn gw pods
+type VpnGwNetwork struct {
+	// network attachment definition in [namespace/]name, the namespace defaults to the one of the vpn gw
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// interface name in the pod, the keepalived vips in its ips are added to it
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_.-]+$`
+	// +kubebuilder:validation:MaxLength=15
+	Interface string `json:"interface"`
+
+	// static ips with prefix length, at most one of each ip family,
+	// the pods of the statefulset share them, so only one replica is allowed with static ips
+	// +kubebuilder:validation:Optional
+	IPs []string `json:"ips,omitempty"`
+
+	// the ssl vpn binds to the keepalived vip of the uplink, and the ipsec vpn disables the rp_filter of it
+	// +kubebuilder:validation:Optional
+	Uplink bool `json:"uplink,omitempty"`
+}
+
+// SslVpnRevocation revokes the ssl vpn client certificate with the serial number,
+// or all the client certificates with the common name
+type SslVpnRevocation struct {
+	// certificate serial number in hex, eg. the serial shown by openssl x509 -serial
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[0-9A-Fa-f:]+$`
+	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// certificate common name, only for the record if the serial number is set,
+	// otherwise all the certificates with it are rejected by the tls-verify script
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MaxLength=64
+	CommonName string `json:"commonName,omitempty"`
+
+	// why the certificate is revoked, only for the record
+	// +kubebuilder:validation:Optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// SslVpnConnection is a connected ssl vpn client
+type SslVpnConnection struct {
+	CommonName     string      `json:"commonName"`
+	RealAddress    string      `json:"realAddress,omitempty"`
+	VirtualAddress string      `json:"virtualAddress,omitempty"`
+	BytesReceived  int64       `json:"bytesReceived,omitempty"`
+	BytesSent      int64       `json:"bytesSent,omitempty"`
+	ConnectedSince metav1.Time `json:"connectedSince,omitempty"`
+	// Pod is the vpn gw pod the client is connected to
+	Pod string `json:"pod,omitempty"`
+}
+
+const (
+	// VpnGwReady means all vpn gw pods are updated and their vpn containers are ready
+	VpnGwReady = "Ready"
+	// VpnGwProgressing means the vpn gw workload is rolling out or waiting for its dependencies
+	VpnGwProgressing = "Progressing"
+	// VpnGwDegraded means the last reconcile failed or some vpn containers are not ready after the rollout
+	VpnGwDegraded = "Degraded"
+
+	// VpnGwWaitingForKeepalived means the keepalived router id is not allocated yet
+	VpnGwWaitingForKeepalived = "WaitingForKeepalived"
+	// VpnGwWaitingForPods means some vpn gw pods are not running yet
+	VpnGwWaitingForPods = "WaitingForPods"
+	// VpnGwWaitingForConfigSync means kubelet has not synced the rendered config to the pods yet
+	VpnGwWaitingForConfigSync = "WaitingForConfigSync"
+	// VpnGwWaitingForCleanup means the static pods are not cleaned up from all the nodes yet
+	VpnGwWaitingForCleanup = "WaitingForCleanup"
+	// VpnGwNoConnections means the ipsec vpn gw has no connections
+	VpnGwNoConnections = "NoConnections"
+)
+
+// VpnGwNodeCleanup is the teardown of the static pod manifests and the host caches on a node
+type VpnGwNodeCleanup struct {
+	Node string `json:"node"`
+	// Phase is the phase of the cleanup pod on the node
+	Phase corev1.PodPhase `json:"phase"`
+	// Message is why the cleanup failed or is skipped
+	Message string `json:"message,omitempty"`
+}
+
+// VpnGwNodeDrift is the difference between the static pod on a node and the vpn gw
+type VpnGwNodeDrift struct {
+	Node string `json:"node"`
+	// Pod is the namespaced name of the mirror pod
+	Pod string `json:"pod"`
+	// Fields are the drifted fields, eg: image, env SSL_VPN_PORT, resources
+	Fields []string `json:"fields"`
+	// LastHealTime is when the daemonset pod on the node was recreated to copy the static pod again
+	LastHealTime *metav1.Time `json:"lastHealTime,omitempty"`
 }
 
 // VpnGwStatus defines the observed state of VpnGw
@@ -139,6 +328,9 @@ type VpnGwStatus struct {
 	CPU              string              `json:"cpu" patchStrategy:"merge"`
 	Memory           string              `json:"memory" patchStrategy:"merge"`
 	QoSBandwidth     string              `json:"qosBandwidth" patchStrategy:"merge"`
+	CNIProvider      string              `json:"cniProvider,omitempty" patchStrategy:"merge"`
+	Networks         []VpnGwNetwork      `json:"networks,omitempty" patchStrategy:"merge"`
+	QoS              *VpnGwQoS           `json:"qos,omitempty" patchStrategy:"merge"`
 	Replicas         int32               `json:"replicas" patchStrategy:"merge"`
 	Selector         []string            `json:"selector,omitempty" patchStrategy:"merge"`
 	Tolerations      []corev1.Toleration `json:"tolerations,omitempty" patchStrategy:"merge"`
@@ -158,6 +350,45 @@ type VpnGwStatus struct {
 	IPSecConnections []string            `json:"ipsecConnections,omitempty" patchStrategy:"merge"`
 	Keepalived       string              `json:"keepalived" patchStrategy:"merge"`
 
+	EnableWireGuard      bool   `json:"enableWireGuard,omitempty"`
+	WireGuardImage       string `json:"wireGuardImage,omitempty"`
+	WireGuardSecret      string `json:"wireGuardSecret,omitempty"`
+	WireGuardListenPort  int32  `json:"wireGuardListenPort,omitempty"`
+	WireGuardAddressCidr string `json:"wireGuardAddressCidr,omitempty"`
+	// WireGuardPublicKey is derived from the wireguard server private key, the peers use it to connect the vpn gw
+	WireGuardPublicKey string `json:"wireGuardPublicKey,omitempty"`
+	// WireGuardPeers are the wireguard peers rendered into the vpn gw
+	WireGuardPeers []string `json:"wireGuardPeers,omitempty"`
+
+	// SslVpnCASecret is the ca secret which signs the ssl vpn client certificates and crl, empty if ssl vpn is disabled
+	SslVpnCASecret string `json:"sslVpnCASecret,omitempty"`
+	// SslVpnStaticCidr is the static cidr reserved out of the dynamic pool of the ssl vpn container, empty if the client configs are disabled
+	SslVpnStaticCidr string `json:"sslVpnStaticCidr,omitempty"`
+	// SslVpnRevoked is the number of the revoked certificates in the ssl vpn crl
+	SslVpnRevoked int32 `json:"sslVpnRevoked,omitempty"`
+	// SslVpnCRLNextUpdate is when the ssl vpn crl should be signed again at the latest
+	SslVpnCRLNextUpdate *metav1.Time `json:"sslVpnCRLNextUpdate,omitempty"`
+
+	// SslVpnConnectedClients is the number of the connected ssl vpn clients
+	SslVpnConnectedClients int32 `json:"sslVpnConnectedClients,omitempty"`
+	// SslVpnClients are the connected ssl vpn clients, at most 100 of them are listed
+	SslVpnClients []SslVpnConnection `json:"sslVpnClients,omitempty"`
+
+	// StaticPodCleanup is the teardown of the static pods on each node while the static vpn gw is being deleted
+	StaticPodCleanup []VpnGwNodeCleanup `json:"staticPodCleanup,omitempty"`
+
+	// StaticPodDrift are the nodes whose static pods drift from the vpn gw
+	StaticPodDrift []VpnGwNodeDrift `json:"staticPodDrift,omitempty"`
+
+	// StaticPodLastHealTime is when a daemonset pod was recreated to copy the static pod again,
+	// one node is healed at a time
+	StaticPodLastHealTime *metav1.Time `json:"staticPodLastHealTime,omitempty"`
+
+	// ObservedGeneration is the latest vpn gw generation which was reconciled successfully
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ReadyReplicas is the number of vpn gw pods whose vpn containers are all ready
+	ReadyReplicas int32 `json:"readyReplicas"`
+
 	// Conditions store the status conditions of the vpn gw instances
 	// +operator-sdk:csv:customresourcedefinitions:type=status
 	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
@@ -170,10 +401,15 @@ type VpnGwStatus struct {
 // +kubebuilder:printcolumn:name="Keepalived",type=string,JSONPath=`.spec.keepalived`
 // +kubebuilder:printcolumn:name="EnableSsl",type=string,JSONPath=`.spec.enableSslVpn`
 // +kubebuilder:printcolumn:name="EnableIpsec",type=string,JSONPath=`.spec.enableIpsecVpn`
+// +kubebuilder:printcolumn:name="EnableWireGuard",type=string,JSONPath=`.spec.enableWireGuard`,priority=1
 // +kubebuilder:printcolumn:name="Cpu",type=string,JSONPath=`.Spec.CPU`
 // +kubebuilder:printcolumn:name="Mem",type=string,JSONPath=`.spec.memory`
 // +kubebuilder:printcolumn:name="QoS",type=string,JSONPath=`.spec.qosBandwidth`
 // +kubebuilder:printcolumn:name="WorkloadType",type=string,JSONPath=`.spec.workloadType`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="ReadyReplicas",type=integer,JSONPath=`.status.readyReplicas`
+// +kubebuilder:printcolumn:name="SslClients",type=integer,JSONPath=`.status.sslVpnConnectedClients`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // VpnGw is the Schema for the vpngws API
 type VpnGw struct {
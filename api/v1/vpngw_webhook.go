@@ -17,63 +17,117 @@ limitations under the License.
 package v1
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 // log is for logging in this package.
 var vpngwlog = logf.Log.WithName("vpngw-resource")
 
-func (r *VpnGw) SetupWebhookWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewWebhookManagedBy(mgr).
-		For(r).
+// SetupVpnGwWebhookWithManager registers the webhook for VpnGw in the manager.
+func SetupVpnGwWebhookWithManager(mgr ctrl.Manager, opts WebhookOptions) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&VpnGw{}).
+		WithDefaulter(&VpnGwCustomDefaulter{Defaults: opts.Defaults}).
+		WithValidator(&VpnGwCustomValidator{Client: mgr.GetAPIReader(), CryptoPolicy: opts.CryptoPolicy}).
 		Complete()
 }
 
-// TODO(user): EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-
 //+kubebuilder:webhook:path=/mutate-vpn-gw-kubecombo-com-v1-vpngw,mutating=true,failurePolicy=fail,sideEffects=None,groups=vpn-gw.kubecombo.com,resources=vpngws,verbs=create;update,versions=v1,name=mvpngw.kb.io,admissionReviewVersions=v1
 
-// var _ webhook.Defaulter = &VpnGw{}
+// VpnGwCustomDefaulter sets the default values of the VpnGw
+// +kubebuilder:object:generate=false
+type VpnGwCustomDefaulter struct {
+	Defaults DefaultOptions
+}
 
-// Default implements webhook.Defaulter so a webhook will be registered for the type
-func (r *VpnGw) Default() {
-	vpngwlog.Info("default", "name", r.Name)
+var _ webhook.CustomDefaulter = &VpnGwCustomDefaulter{}
 
-	// TODO(user): fill in your defaulting logic.
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type
+func (d *VpnGwCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	gw, ok := obj.(*VpnGw)
+	if !ok {
+		return fmt.Errorf("expected a VpnGw object but got %T", obj)
+	}
+	vpngwlog.Info("default", "name", gw.Name)
+	gw.SetDefaults(d.Defaults)
+	return nil
 }
 
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
 //+kubebuilder:webhook:path=/validate-vpn-gw-kubecombo-com-v1-vpngw,mutating=false,failurePolicy=fail,sideEffects=None,groups=vpn-gw.kubecombo.com,resources=vpngws,verbs=create;update,versions=v1,name=vvpngw.kb.io,admissionReviewVersions=v1
 
-// var _ webhook.Validator = &VpnGw{}
+// VpnGwCustomValidator validates the VpnGw and the objects it references
+// +kubebuilder:object:generate=false
+type VpnGwCustomValidator struct {
+	// Client reads the referenced objects, it is the api reader of the manager,
+	// so the webhook does not start informers for the referenced kinds
+	Client       client.Reader
+	CryptoPolicy CryptoPolicy
+}
 
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
-func (r *VpnGw) ValidateCreate() error {
-	vpngwlog.Info("validate create", "name", r.Name)
+var _ webhook.CustomValidator = &VpnGwCustomValidator{}
 
-	// TODO(user): fill in your validation logic upon object creation.
-	if err := r.validateVpnGw(); err != nil {
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *VpnGwCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	gw, ok := obj.(*VpnGw)
+	if !ok {
+		return nil, fmt.Errorf("expected a VpnGw object but got %T", obj)
+	}
+	vpngwlog.Info("validate create", "name", gw.Name)
+
+	warnings, err := gw.validateVpnGw(v.CryptoPolicy)
+	if err != nil {
 		vpngwlog.Error(err, "validate vpn gw failed")
-		return err
+		return warnings, err
 	}
-	return nil
+	refWarnings, err := gw.validateVpnGwRefs(ctx, v.Client)
+	if err != nil {
+		vpngwlog.Error(err, "validate vpn gw references failed")
+	}
+	return append(warnings, refWarnings...), err
 }
 
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
-func (r *VpnGw) ValidateUpdate(old runtime.Object) error {
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *VpnGwCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	r, ok := newObj.(*VpnGw)
+	if !ok {
+		return nil, fmt.Errorf("expected a VpnGw object but got %T", newObj)
+	}
+	oldVpnGw, ok := oldObj.(*VpnGw)
+	if !ok {
+		return nil, fmt.Errorf("expected a VpnGw object but got %T", oldObj)
+	}
 	vpngwlog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
-	if err := r.validateVpnGw(); err != nil {
+	if !r.DeletionTimestamp.IsZero() || reflect.DeepEqual(oldVpnGw.Spec, r.Spec) {
+		// deletes and metadata only updates, eg. removing the finalizers, are always allowed
+		return nil, nil
+	}
+	policy := v.CryptoPolicy
+	if oldVpnGw.Spec.SslVpnCipher == r.Spec.SslVpnCipher && oldVpnGw.Spec.SslVpnAuth == r.Spec.SslVpnAuth {
+		// the crypto policy only applies to the changed algorithms, a stricter policy does not block the other updates
+		policy = CryptoPolicyLegacy
+	}
+	warnings, err := r.validateVpnGw(policy)
+	if err != nil {
 		vpngwlog.Error(err, "validate vpn gw failed")
-		return err
+		return warnings, err
 	}
-	oldVpnGw, _ := old.(*VpnGw)
 	var allErrs field.ErrorList
 	if oldVpnGw.Spec.Keepalived != "" && oldVpnGw.Spec.Keepalived != r.Spec.Keepalived {
 		err := errors.New("vpn gw keepalived not support change")
@@ -106,22 +160,47 @@ func (r *VpnGw) ValidateUpdate(old runtime.Object) error {
 		e := field.Invalid(field.NewPath("spec").Child("SslVpnSubnetCidr"), r.Spec.SslVpnSubnetCidr, err.Error())
 		allErrs = append(allErrs, e)
 	}
+	if oldVpnGw.Spec.WorkloadType != "" && oldVpnGw.Spec.WorkloadType != r.Spec.WorkloadType {
+		warnings = append(warnings, fmt.Sprintf("vpn gw workload type is changed from %s to %s, the old vpn gw pods are not cleaned up", oldVpnGw.Spec.WorkloadType, r.Spec.WorkloadType))
+	}
 	if len(allErrs) != 0 {
-		return allErrs.ToAggregate()
+		return warnings, allErrs.ToAggregate()
 	}
-	return nil
+	refWarnings, err := r.validateVpnGwRefs(ctx, v.Client)
+	if err != nil {
+		vpngwlog.Error(err, "validate vpn gw references failed")
+	}
+	return append(warnings, refWarnings...), err
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
-func (r *VpnGw) ValidateDelete() error {
-	vpngwlog.Info("validate delete", "name", r.Name)
-
-	// TODO(user): fill in your validation logic upon object deletion.
-	return nil
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *VpnGwCustomValidator) ValidateDelete(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	gw, ok := obj.(*VpnGw)
+	if !ok {
+		return nil, fmt.Errorf("expected a VpnGw object but got %T", obj)
+	}
+	vpngwlog.Info("validate delete", "name", gw.Name)
+	return nil, nil
 }
 
-func (r *VpnGw) validateVpnGw() error {
+// validateVpnGw validates the spec, the deprecated or risky settings are returned as warnings
+func (r *VpnGw) validateVpnGw(policy CryptoPolicy) (admission.Warnings, error) {
+	var warnings admission.Warnings
 	var allErrs field.ErrorList
+	if r.Spec.WorkloadType != WorkloadTypeStatefulset && r.Spec.WorkloadType != WorkloadTypeStatic {
+		err := fmt.Errorf("vpn gw workload type should be %s or %s", WorkloadTypeStatefulset, WorkloadTypeStatic)
+		e := field.Invalid(field.NewPath("spec").Child("workloadType"), r.Spec.WorkloadType, err.Error())
+		allErrs = append(allErrs, e)
+	}
+	if r.Spec.WorkloadType == WorkloadTypeStatefulset && r.Spec.Replicas == 1 {
+		warnings = append(warnings, "vpn gw statefulset has only one replica, there is no keepalived failover")
+	}
+	if r.Spec.StaticPodAutoHeal && r.Spec.WorkloadType != WorkloadTypeStatic {
+		warnings = append(warnings, "spec.staticPodAutoHeal is ignored, only the static workload runs static pods")
+	}
+	if r.Spec.DefaultPSK != "" {
+		warnings = append(warnings, "spec.defaultPSK is deprecated, the psk is visible to anyone who can read the vpn gw, use spec.defaultPSKSecretRef instead")
+	}
 	if r.Spec.CPU == "" || r.Spec.Memory == "" {
 		err := errors.New("vpn gw cpu and memory is required, 1C 1Gi at least")
 		e := field.Invalid(field.NewPath("spec").Child("cpu"), r.Spec.CPU, err.Error())
@@ -131,8 +210,8 @@ func (r *VpnGw) validateVpnGw() error {
 	// user may use its own keepalived in the host-network static pod case
 	// skip check keepalived image
 
-	if !r.Spec.EnableSslVpn && !r.Spec.EnableIPSecVpn {
-		err := errors.New("either ssl vpn or ipsec vpn should be enabled")
+	if !r.Spec.EnableSslVpn && !r.Spec.EnableIPSecVpn && !r.Spec.EnableWireGuard {
+		err := errors.New("either ssl vpn, ipsec vpn or wireguard should be enabled")
 		e := field.Invalid(field.NewPath("spec").Child("enableSslVpn"), r.Spec.EnableSslVpn, err.Error())
 		allErrs = append(allErrs, e)
 	}
@@ -150,8 +229,21 @@ func (r *VpnGw) validateVpnGw() error {
 		}
 		if r.Spec.SslVpnCipher == "" {
 			err := errors.New("ssl vpn cipher is required")
-			e := field.Invalid(field.NewPath("spec").Child("SslVpnCipher"), r.Spec.SslVpnCipher, err.Error())
+			e := field.Invalid(field.NewPath("spec").Child("sslVpnCipher"), r.Spec.SslVpnCipher, err.Error())
+			allErrs = append(allErrs, e)
+		} else if warning, err := validateSslVpnAlgorithm(policy, "cipher", r.Spec.SslVpnCipher, sslVpnCiphers); err != nil {
+			e := field.Invalid(field.NewPath("spec").Child("sslVpnCipher"), r.Spec.SslVpnCipher, err.Error())
 			allErrs = append(allErrs, e)
+		} else if warning != "" {
+			warnings = append(warnings, warning)
+		}
+		if r.Spec.SslVpnAuth != "" {
+			if warning, err := validateSslVpnAlgorithm(policy, "auth", r.Spec.SslVpnAuth, sslVpnAuths); err != nil {
+				e := field.Invalid(field.NewPath("spec").Child("sslVpnAuth"), r.Spec.SslVpnAuth, err.Error())
+				allErrs = append(allErrs, e)
+			} else if warning != "" {
+				warnings = append(warnings, warning)
+			}
 		}
 		if r.Spec.SslVpnProto == "" {
 			err := errors.New("ssl vpn proto is required")
@@ -173,6 +265,24 @@ func (r *VpnGw) validateVpnGw() error {
 			e := field.Invalid(field.NewPath("spec").Child("sslVpnImage"), r.Spec.SslVpnImage, err.Error())
 			allErrs = append(allErrs, e)
 		}
+		if len(r.Spec.SslVpnRevocations) != 0 && r.Spec.SslVpnCASecret == "" {
+			err := errors.New("ssl vpn ca secret is required to sign the crl")
+			e := field.Invalid(field.NewPath("spec").Child("sslVpnCASecret"), r.Spec.SslVpnCASecret, err.Error())
+			allErrs = append(allErrs, e)
+		}
+		for i, rev := range r.Spec.SslVpnRevocations {
+			if rev.SerialNumber == "" && rev.CommonName == "" {
+				err := errors.New("ssl vpn revocation should set serial number or common name")
+				e := field.Invalid(field.NewPath("spec").Child("sslVpnRevocations").Index(i), rev, err.Error())
+				allErrs = append(allErrs, e)
+			}
+		}
+		if r.Spec.SslVpnStaticCidr != "" {
+			if err := validateSslVpnStaticCidr(r.Spec.SslVpnSubnetCidr, r.Spec.SslVpnStaticCidr); err != nil {
+				e := field.Invalid(field.NewPath("spec").Child("sslVpnStaticCidr"), r.Spec.SslVpnStaticCidr, err.Error())
+				allErrs = append(allErrs, e)
+			}
+		}
 	}
 
 	if r.Spec.EnableIPSecVpn {
@@ -183,9 +293,198 @@ func (r *VpnGw) validateVpnGw() error {
 		}
 	}
 
+	if r.Spec.EnableWireGuard {
+		if r.Spec.WireGuardSecret == "" {
+			err := errors.New("wireguard secret is required")
+			e := field.Invalid(field.NewPath("spec").Child("wireGuardSecret"), r.Spec.WireGuardSecret, err.Error())
+			allErrs = append(allErrs, e)
+		}
+		if r.Spec.WireGuardAddressCidr == "" {
+			err := errors.New("wireguard address cidr is required")
+			e := field.Invalid(field.NewPath("spec").Child("wireGuardAddressCidr"), r.Spec.WireGuardAddressCidr, err.Error())
+			allErrs = append(allErrs, e)
+		}
+		if r.Spec.WireGuardImage == "" {
+			err := errors.New("wireguard image is required")
+			e := field.Invalid(field.NewPath("spec").Child("wireGuardImage"), r.Spec.WireGuardImage, err.Error())
+			allErrs = append(allErrs, e)
+		}
+	}
+
+	allErrs = append(allErrs, r.validateVpnGwNetworks()...)
+	qosWarnings, qosErrs := r.validateVpnGwQoS()
+	warnings = append(warnings, qosWarnings...)
+	allErrs = append(allErrs, qosErrs...)
+
+	if len(allErrs) == 0 {
+		return warnings, nil
+	}
+
+	return warnings, allErrs.ToAggregate()
+}
+
+var (
+	minBandwidth        = resource.MustParse("1M")
+	minSslVpnClientRate = resource.MustParse("8k")
+)
+
+// validateVpnGwQoS checks the bandwidth of the vpn gw pods and the rate limit of the ssl vpn clients,
+// kube-ovn limits the bandwidth in Mbps, and iptables hashlimit limits the ssl vpn clients in bytes
+func (r *VpnGw) validateVpnGwQoS() (admission.Warnings, field.ErrorList) {
+	var warnings admission.Warnings
+	var allErrs field.ErrorList
+	if r.Spec.QoSBandwidth != "" {
+		if mbps, err := strconv.ParseFloat(r.Spec.QoSBandwidth, 64); err != nil || mbps < 1 {
+			err := errors.New("vpn gw qos bandwidth should be a number of Mbps, 1 at least")
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("qosBandwidth"), r.Spec.QoSBandwidth, err.Error()))
+		}
+	}
+	qos := r.Spec.QoS
+	if qos == nil {
+		return warnings, allErrs
+	}
+	path := field.NewPath("spec").Child("qos")
+	for _, bandwidth := range []struct {
+		name     string
+		quantity *resource.Quantity
+	}{{"ingress", qos.Ingress}, {"egress", qos.Egress}} {
+		if bandwidth.quantity != nil && bandwidth.quantity.Cmp(minBandwidth) < 0 {
+			err := fmt.Errorf("vpn gw %s bandwidth should be %s at least", bandwidth.name, minBandwidth.String())
+			allErrs = append(allErrs, field.Invalid(path.Child(bandwidth.name), bandwidth.quantity.String(), err.Error()))
+		}
+	}
+	if r.Spec.QoSBandwidth != "" && qos.Ingress != nil && qos.Egress != nil {
+		warnings = append(warnings, "spec.qosBandwidth is ignored, spec.qos sets both the ingress and egress bandwidth")
+	}
+	if qos.SslVpnClientRate != nil || qos.SslVpnClientBurst != nil {
+		if !r.Spec.EnableSslVpn {
+			err := errors.New("ssl vpn client rate limit requires the ssl vpn")
+			allErrs = append(allErrs, field.Invalid(path.Child("sslVpnClientRate"), qos.SslVpnClientRate.String(), err.Error()))
+		}
+		if qos.SslVpnClientRate == nil {
+			err := errors.New("ssl vpn client burst requires the ssl vpn client rate")
+			allErrs = append(allErrs, field.Invalid(path.Child("sslVpnClientBurst"), qos.SslVpnClientBurst.String(), err.Error()))
+		} else if qos.SslVpnClientRate.Cmp(minSslVpnClientRate) < 0 {
+			err := fmt.Errorf("ssl vpn client rate should be %s at least", minSslVpnClientRate.String())
+			allErrs = append(allErrs, field.Invalid(path.Child("sslVpnClientRate"), qos.SslVpnClientRate.String(), err.Error()))
+		}
+		if qos.SslVpnClientBurst != nil && qos.SslVpnClientBurst.Sign() <= 0 {
+			err := errors.New("ssl vpn client burst should be positive")
+			allErrs = append(allErrs, field.Invalid(path.Child("sslVpnClientBurst"), qos.SslVpnClientBurst.String(), err.Error()))
+		}
+	}
+	return warnings, allErrs
+}
+
+// validateVpnGwNetworks checks the network attachment references, the static ips and the uplink,
+// multus does not attach networks to the host network pods of the static workload
+func (r *VpnGw) validateVpnGwNetworks() field.ErrorList {
+	var allErrs field.ErrorList
+	if len(r.Spec.Networks) != 0 && r.Spec.WorkloadType == WorkloadTypeStatic {
+		err := errors.New("vpn gw networks are not supported by the host network static pods")
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("networks"), len(r.Spec.Networks), err.Error()))
+		return allErrs
+	}
+	interfaces := map[string]bool{}
+	uplink := false
+	for i, network := range r.Spec.Networks {
+		path := field.NewPath("spec").Child("networks").Index(i)
+		namespace, name, found := strings.Cut(network.Name, "/")
+		if !found {
+			namespace, name = "", network.Name
+		}
+		if len(validation.IsDNS1123Subdomain(name)) != 0 || namespace != "" && len(validation.IsDNS1123Label(namespace)) != 0 {
+			err := errors.New("vpn gw network should be a network attachment definition in [namespace/]name")
+			allErrs = append(allErrs, field.Invalid(path.Child("name"), network.Name, err.Error()))
+		}
+		if interfaces[network.Interface] {
+			allErrs = append(allErrs, field.Duplicate(path.Child("interface"), network.Interface))
+		}
+		interfaces[network.Interface] = true
+		if network.Uplink {
+			if uplink {
+				err := errors.New("only one vpn gw network can be the uplink")
+				allErrs = append(allErrs, field.Invalid(path.Child("uplink"), network.Uplink, err.Error()))
+			}
+			uplink = true
+		}
+		if len(network.IPs) != 0 && r.Spec.WorkloadType == WorkloadTypeStatefulset && r.Spec.Replicas > 1 {
+			err := errors.New("vpn gw network static ips are shared by the pods of the statefulset, use one replica or the network ipam")
+			allErrs = append(allErrs, field.Invalid(path.Child("ips"), network.IPs, err.Error()))
+		}
+		families := map[bool]bool{}
+		for j, ip := range network.IPs {
+			prefix, err := netip.ParsePrefix(ip)
+			if err != nil {
+				err := errors.New("vpn gw network static ip should be an ip with prefix length")
+				allErrs = append(allErrs, field.Invalid(path.Child("ips").Index(j), ip, err.Error()))
+				continue
+			}
+			if families[prefix.Addr().Is6()] {
+				err := errors.New("vpn gw network should have at most one static ip of each ip family")
+				allErrs = append(allErrs, field.Invalid(path.Child("ips").Index(j), ip, err.Error()))
+			}
+			families[prefix.Addr().Is6()] = true
+		}
+	}
+	return allErrs
+}
+
+// validateVpnGwRefs checks the keepalived and secrets referenced by the vpn gw,
+// the missing ones are warnings, the secrets without the expected keys are denied
+func (r *VpnGw) validateVpnGwRefs(ctx context.Context, c client.Reader) (admission.Warnings, error) {
+	var warnings admission.Warnings
+	var allErrs field.ErrorList
+	if r.Spec.Keepalived != "" {
+		_, w := validateRef(ctx, c, "keepalived", r.Namespace, r.Spec.Keepalived, &KeepAlived{})
+		warnings = append(warnings, w...)
+	}
+	type secretRef struct {
+		path *field.Path
+		name string
+		keys []string
+	}
+	var secrets []secretRef
+	if r.Spec.EnableSslVpn {
+		secrets = append(secrets,
+			secretRef{field.NewPath("spec").Child("sslVpnSecret"), r.Spec.SslVpnSecret, tlsSecretKeys},
+			secretRef{field.NewPath("spec").Child("dhSecret"), r.Spec.DhSecret, dhSecretKeys},
+		)
+	}
+	if r.Spec.EnableIPSecVpn {
+		secrets = append(secrets, secretRef{field.NewPath("spec").Child("ipsecSecret"), r.Spec.IPSecSecret, tlsSecretKeys})
+	}
+	for _, ref := range secrets {
+		if ref.name == "" {
+			continue
+		}
+		w, e := validateSecretRef(ctx, c, ref.path, r.Namespace, ref.name, ref.keys)
+		warnings = append(warnings, w...)
+		if e != nil {
+			allErrs = append(allErrs, e)
+		}
+	}
 	if len(allErrs) == 0 {
-		return nil
+		return warnings, nil
 	}
+	return warnings, allErrs.ToAggregate()
+}
 
-	return allErrs.ToAggregate()
+// validateSslVpnStaticCidr makes sure the static cidr is a smaller ipv4 cidr in the ssl vpn subnet cidr,
+// the rest of the subnet is left for the dynamic ips
+func validateSslVpnStaticCidr(subnetCidr, staticCidr string) error {
+	_, subnet, err := net.ParseCIDR(subnetCidr)
+	if err != nil || subnet.IP.To4() == nil {
+		return fmt.Errorf("ssl vpn subnet cidr %q should be an ipv4 cidr", subnetCidr)
+	}
+	_, static, err := net.ParseCIDR(staticCidr)
+	if err != nil || static.IP.To4() == nil {
+		return fmt.Errorf("ssl vpn static cidr %q should be an ipv4 cidr", staticCidr)
+	}
+	subnetOnes, _ := subnet.Mask.Size()
+	staticOnes, _ := static.Mask.Size()
+	if !subnet.Contains(static.IP) || staticOnes <= subnetOnes {
+		return fmt.Errorf("ssl vpn static cidr %s should be a smaller cidr in the ssl vpn subnet cidr %s", static, subnet)
+	}
+	return nil
 }
@@ -0,0 +1,161 @@
+/*
+Copyright 2023 kubecombo.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateVpnGwNetworks(t *testing.T) {
+	uplink := VpnGwNetwork{Name: "kube-system/uplink", Interface: "net1", IPs: []string{"172.19.0.11/24", "fd00:19::11/64"}, Uplink: true}
+	cases := []struct {
+		name     string
+		workload string
+		replicas int32
+		networks []VpnGwNetwork
+		err      string
+	}{
+		{"valid", WorkloadTypeStatefulset, 1, []VpnGwNetwork{uplink, {Name: "storage", Interface: "net2"}}, ""},
+		{"ipam with replicas", WorkloadTypeStatefulset, 2, []VpnGwNetwork{{Name: "uplink", Interface: "net1", Uplink: true}}, ""},
+		{"static workload", WorkloadTypeStatic, 1, []VpnGwNetwork{uplink}, "host network static pods"},
+		{"invalid name", WorkloadTypeStatefulset, 1, []VpnGwNetwork{{Name: "kube-system/Uplink", Interface: "net1"}}, "spec.networks[0].name"},
+		{"nested name", WorkloadTypeStatefulset, 1, []VpnGwNetwork{{Name: "a/b/c", Interface: "net1"}}, "[namespace/]name"},
+		{"duplicate interface", WorkloadTypeStatefulset, 1, []VpnGwNetwork{uplink, {Name: "storage", Interface: "net1"}}, "spec.networks[1].interface"},
+		{"two uplinks", WorkloadTypeStatefulset, 1, []VpnGwNetwork{uplink, {Name: "storage", Interface: "net2", Uplink: true}}, "only one vpn gw network"},
+		{"static ips with replicas", WorkloadTypeStatefulset, 2, []VpnGwNetwork{uplink}, "use one replica"},
+		{"ip without prefix", WorkloadTypeStatefulset, 1, []VpnGwNetwork{{Name: "uplink", Interface: "net1", IPs: []string{"172.19.0.11"}}}, "spec.networks[0].ips[0]"},
+		{"two ipv4", WorkloadTypeStatefulset, 1, []VpnGwNetwork{{Name: "uplink", Interface: "net1", IPs: []string{"172.19.0.11/24", "172.19.1.11/24"}}}, "at most one static ip"},
+	}
+	for _, c := range cases {
+		gw := &VpnGw{Spec: VpnGwSpec{WorkloadType: c.workload, Replicas: c.replicas, Networks: c.networks}}
+		err := gw.validateVpnGwNetworks().ToAggregate()
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestValidateVpnGwQoS(t *testing.T) {
+	quantity := func(s string) *resource.Quantity {
+		q := resource.MustParse(s)
+		return &q
+	}
+	cases := []struct {
+		name     string
+		spec     VpnGwSpec
+		err      string
+		warnings int
+	}{
+		{"no qos", VpnGwSpec{}, "", 0},
+		{"qos bandwidth", VpnGwSpec{QoSBandwidth: "100"}, "", 0},
+		{"qos bandwidth not a number", VpnGwSpec{QoSBandwidth: "100M"}, "spec.qosBandwidth", 0},
+		{"qos bandwidth too low", VpnGwSpec{QoSBandwidth: "0.5"}, "spec.qosBandwidth", 0},
+		{"ingress and egress", VpnGwSpec{QoS: &VpnGwQoS{Ingress: quantity("100M"), Egress: quantity("1G")}}, "", 0},
+		{"egress too low", VpnGwSpec{QoS: &VpnGwQoS{Egress: quantity("100k")}}, "spec.qos.egress", 0},
+		{"qos bandwidth ignored", VpnGwSpec{QoSBandwidth: "100", QoS: &VpnGwQoS{Ingress: quantity("10M"), Egress: quantity("10M")}}, "", 1},
+		{"ssl vpn client rate", VpnGwSpec{EnableSslVpn: true, QoS: &VpnGwQoS{SslVpnClientRate: quantity("2M"), SslVpnClientBurst: quantity("4M")}}, "", 0},
+		{"client rate without ssl vpn", VpnGwSpec{QoS: &VpnGwQoS{SslVpnClientRate: quantity("2M")}}, "requires the ssl vpn", 0},
+		{"client burst without rate", VpnGwSpec{EnableSslVpn: true, QoS: &VpnGwQoS{SslVpnClientBurst: quantity("4M")}}, "spec.qos.sslVpnClientBurst", 0},
+		{"client rate too low", VpnGwSpec{EnableSslVpn: true, QoS: &VpnGwQoS{SslVpnClientRate: quantity("1k")}}, "spec.qos.sslVpnClientRate", 0},
+		{"client burst not positive", VpnGwSpec{EnableSslVpn: true, QoS: &VpnGwQoS{SslVpnClientRate: quantity("2M"), SslVpnClientBurst: quantity("0")}}, "should be positive", 0},
+	}
+	for _, c := range cases {
+		gw := &VpnGw{Spec: c.spec}
+		warnings, errs := gw.validateVpnGwQoS()
+		if len(warnings) != c.warnings {
+			t.Errorf("%s: expected %d warnings, got %v", c.name, c.warnings, warnings)
+		}
+		err := errs.ToAggregate()
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestValidateVpnGwUpdateCryptoPolicy(t *testing.T) {
+	meta := func(name string) metav1.ObjectMeta { return metav1.ObjectMeta{Name: name, Namespace: "default"} }
+	v := &VpnGwCustomValidator{
+		Client: newTestWebhookClient(t,
+			&KeepAlived{ObjectMeta: meta("ka1")},
+			&corev1.Secret{ObjectMeta: meta("ssl"), Data: map[string][]byte{"ca.crt": []byte("ca"), "tls.crt": []byte("crt"), "tls.key": []byte("key")}},
+			&corev1.Secret{ObjectMeta: meta("dh"), Data: map[string][]byte{"dh.pem": []byte("dh")}},
+		),
+		CryptoPolicy: CryptoPolicyStrict,
+	}
+	// the vpn gw created before the crypto policy is tightened
+	old := &VpnGw{ObjectMeta: meta("gw1"), Spec: VpnGwSpec{
+		Keepalived:       "ka1",
+		WorkloadType:     WorkloadTypeStatefulset,
+		CPU:              "1",
+		Memory:           "1Gi",
+		EnableSslVpn:     true,
+		SslVpnSecret:     "ssl",
+		DhSecret:         "dh",
+		SslVpnCipher:     "AES-256-CBC",
+		SslVpnAuth:       "SHA1",
+		SslVpnProto:      "udp",
+		SslVpnSubnetCidr: "10.240.0.0/16",
+		SslVpnImage:      "ssl-vpn",
+	}}
+	cases := []struct {
+		name   string
+		mutate func(*VpnGw)
+		err    string
+	}{
+		{"metadata only", func(gw *VpnGw) { gw.Labels = map[string]string{"app": "vpn"} }, ""},
+		{"deleting", func(gw *VpnGw) {
+			now := metav1.Now()
+			gw.DeletionTimestamp = &now
+			gw.Spec.SslVpnCipher = "BF-CBC"
+		}, ""},
+		{"other fields", func(gw *VpnGw) { gw.Spec.CPU = "2" }, ""},
+		{"changed cipher", func(gw *VpnGw) { gw.Spec.SslVpnCipher = "AES-128-CBC" }, "spec.sslVpnCipher"},
+		{"strong cipher", func(gw *VpnGw) { gw.Spec.SslVpnCipher = "AES-256-GCM"; gw.Spec.SslVpnAuth = "SHA256" }, ""},
+	}
+	for _, c := range cases {
+		gw := old.DeepCopy()
+		c.mutate(gw)
+		_, err := v.ValidateUpdate(context.Background(), old, gw)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2023 kubecombo.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// the keys of the referenced secrets
+var (
+	tlsSecretKeys = []string{"ca.crt", "tls.crt", "tls.key"}
+	dhSecretKeys  = []string{"dh.pem"}
+)
+
+// validateRef checks the referenced object exists in the namespace,
+// a missing object is only a warning, it may be created later, eg. by cert-manager or in a gitops sync
+func validateRef(ctx context.Context, c client.Reader, kind, namespace, name string, obj client.Object) (bool, admission.Warnings) {
+	if c == nil {
+		return false, nil
+	}
+	err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, obj)
+	switch {
+	case err == nil:
+		return true, nil
+	case apierrors.IsNotFound(err):
+		return false, admission.Warnings{fmt.Sprintf("%s %s/%s not found, it should be created before it is used", kind, namespace, name)}
+	default:
+		return false, admission.Warnings{fmt.Sprintf("failed to check %s %s/%s: %v", kind, namespace, name, err)}
+	}
+}
+
+// validateSecretRef checks the referenced secret has the expected keys
+func validateSecretRef(ctx context.Context, c client.Reader, path *field.Path, namespace, name string, keys []string) (admission.Warnings, *field.Error) {
+	secret := &corev1.Secret{}
+	found, warnings := validateRef(ctx, c, "secret", namespace, name, secret)
+	if !found {
+		return warnings, nil
+	}
+	var missing []string
+	for _, key := range keys {
+		if len(secret.Data[key]) == 0 {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) != 0 {
+		err := fmt.Errorf("secret %s/%s has no %s", namespace, name, strings.Join(missing, ", "))
+		return nil, field.Invalid(path, name, err.Error())
+	}
+	return nil, nil
+}
+
+// validateConfigMapRef checks the referenced config map is not empty
+func validateConfigMapRef(ctx context.Context, c client.Reader, path *field.Path, namespace, name string) (admission.Warnings, *field.Error) {
+	cm := &corev1.ConfigMap{}
+	found, warnings := validateRef(ctx, c, "config map", namespace, name, cm)
+	if !found {
+		return warnings, nil
+	}
+	if len(cm.Data) == 0 {
+		err := fmt.Errorf("config map %s/%s is empty", namespace, name)
+		return nil, field.Invalid(path, name, err.Error())
+	}
+	return nil, nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2023 kubecombo.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestWebhookClient(t *testing.T, objs ...client.Object) client.Reader {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func TestValidateVpnGwRefs(t *testing.T) {
+	meta := func(name string) metav1.ObjectMeta { return metav1.ObjectMeta{Name: name, Namespace: "default"} }
+	reader := newTestWebhookClient(t,
+		&KeepAlived{ObjectMeta: meta("ka1")},
+		&corev1.Secret{ObjectMeta: meta("ssl"), Data: map[string][]byte{"ca.crt": []byte("ca"), "tls.crt": []byte("crt"), "tls.key": []byte("key")}},
+		&corev1.Secret{ObjectMeta: meta("dh"), Data: map[string][]byte{"dh.pem": []byte("dh")}},
+		&corev1.Secret{ObjectMeta: meta("ipsec"), Data: map[string][]byte{"ca.crt": []byte("ca"), "tls.crt": []byte("crt")}},
+	)
+
+	cases := []struct {
+		name    string
+		spec    VpnGwSpec
+		warning string
+		err     string
+	}{
+		{"all found", VpnGwSpec{Keepalived: "ka1", EnableSslVpn: true, SslVpnSecret: "ssl", DhSecret: "dh"}, "", ""},
+		{"keepalived not found", VpnGwSpec{Keepalived: "ka2"}, "keepalived default/ka2 not found", ""},
+		{"secret not found", VpnGwSpec{Keepalived: "ka1", EnableSslVpn: true, SslVpnSecret: "ssl2", DhSecret: "dh"}, "secret default/ssl2 not found", ""},
+		{"wrong secret keys", VpnGwSpec{Keepalived: "ka1", EnableSslVpn: true, SslVpnSecret: "ssl", DhSecret: "ssl"}, "", "spec.dhSecret: Invalid value: \"ssl\": secret default/ssl has no dh.pem"},
+		{"missing secret keys", VpnGwSpec{Keepalived: "ka1", EnableIPSecVpn: true, IPSecSecret: "ipsec"}, "", "secret default/ipsec has no tls.key"},
+		{"disabled", VpnGwSpec{Keepalived: "ka1", SslVpnSecret: "dh"}, "", ""},
+	}
+	for _, c := range cases {
+		gw := &VpnGw{ObjectMeta: meta("gw1"), Spec: c.spec}
+		warnings, err := gw.validateVpnGwRefs(context.Background(), reader)
+		if got := strings.Join(warnings, "\n"); c.warning == "" && got != "" || !strings.Contains(got, c.warning) {
+			t.Errorf("%s: expected warning %q, got %q", c.name, c.warning, got)
+		}
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestValidateDebuggerRefs(t *testing.T) {
+	meta := func(name string) metav1.ObjectMeta { return metav1.ObjectMeta{Name: name, Namespace: "default"} }
+	reader := newTestWebhookClient(t,
+		&Pinger{ObjectMeta: meta("pinger1")},
+		&corev1.ConfigMap{ObjectMeta: meta("script"), Data: map[string]string{"run.sh": "echo"}},
+		&corev1.ConfigMap{ObjectMeta: meta("empty")},
+	)
+
+	cases := []struct {
+		name    string
+		spec    DebuggerSpec
+		warning string
+		err     string
+	}{
+		{"all found", DebuggerSpec{Pinger: "pinger1", EnableConfigMap: true, ConfigMap: "script", RunAt: "script", DebuggerConfig: "script"}, "", ""},
+		{"pinger not found", DebuggerSpec{Pinger: "pinger2"}, "pinger default/pinger2 not found", ""},
+		{"config map not found", DebuggerSpec{RunAt: "missing"}, "config map default/missing not found", ""},
+		{"empty config map", DebuggerSpec{DebuggerConfig: "empty"}, "", "spec.debuggerConfig: Invalid value: \"empty\": config map default/empty is empty"},
+		{"config map disabled", DebuggerSpec{ConfigMap: "empty"}, "", ""},
+	}
+	for _, c := range cases {
+		debugger := &Debugger{ObjectMeta: meta("debugger1"), Spec: c.spec}
+		warnings, err := debugger.validateDebuggerRefs(context.Background(), reader)
+		if got := strings.Join(warnings, "\n"); c.warning == "" && got != "" || !strings.Contains(got, c.warning) {
+			t.Errorf("%s: expected warning %q, got %q", c.name, c.warning, got)
+		}
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+	}
+}
@@ -97,19 +97,19 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).NotTo(HaveOccurred())
 
-	err = (&VpnGw{}).SetupWebhookWithManager(mgr)
+	err = SetupVpnGwWebhookWithManager(mgr, WebhookOptions{CryptoPolicy: CryptoPolicyDefault})
 	Expect(err).NotTo(HaveOccurred())
 
-	err = (&IpsecConn{}).SetupWebhookWithManager(mgr)
+	err = SetupIpsecConnWebhookWithManager(mgr, WebhookOptions{CryptoPolicy: CryptoPolicyDefault})
 	Expect(err).NotTo(HaveOccurred())
 
-	err = (&KeepAlived{}).SetupWebhookWithManager(mgr)
+	err = SetupKeepAlivedWebhookWithManager(mgr, WebhookOptions{CryptoPolicy: CryptoPolicyDefault})
 	Expect(err).NotTo(HaveOccurred())
 
-	err = (&Debugger{}).SetupWebhookWithManager(mgr)
+	err = SetupDebuggerWebhookWithManager(mgr, WebhookOptions{CryptoPolicy: CryptoPolicyDefault})
 	Expect(err).NotTo(HaveOccurred())
 
-	err = (&Pinger{}).SetupWebhookWithManager(mgr)
+	err = SetupPingerWebhookWithManager(mgr, WebhookOptions{CryptoPolicy: CryptoPolicyDefault})
 	Expect(err).NotTo(HaveOccurred())
 
 	//+kubebuilder:scaffold:webhook
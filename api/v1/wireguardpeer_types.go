@@ -0,0 +1,97 @@
+/*
+Copyright 2023 kubecombo.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WireGuardPeerSpec defines the desired state of WireGuardPeer
+type WireGuardPeerSpec struct {
+	// reference to: https://man7.org/linux/man-pages/man8/wg.8.html#CONFIGURATION_FILE_FORMAT
+
+	// +kubebuilder:validation:Required
+	VpnGw string `json:"vpnGw"`
+
+	// base64 encoded public key of the peer, generated by wg pubkey
+	// +kubebuilder:validation:Required
+	PublicKey string `json:"publicKey"`
+
+	// comma separated cidrs routed to the peer, traffic from the peer is only accepted from these cidrs
+	// +kubebuilder:validation:Required
+	AllowedIPs string `json:"allowedIPs"`
+
+	// peer endpoint ip:port or [ipv6]:port,
+	// leave it empty if the peer connects to the vpn gw, eg. behind nat
+	// +kubebuilder:validation:Optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// seconds between keepalive packets sent to the peer, 0 disables it
+	// set it if the vpn gw is behind nat and the peer should be able to reach it
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	PersistentKeepalive int32 `json:"persistentKeepalive,omitempty"`
+}
+
+// WireGuardPeerStatus defines the observed state of WireGuardPeer
+type WireGuardPeerStatus struct {
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+const (
+	// WireGuardPeerAccepted means the peer is rendered into the wireguard config of the vpn gw,
+	// an invalid peer is skipped without affecting the other peers
+	WireGuardPeerAccepted = "Accepted"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=wgpeer
+// +kubebuilder:printcolumn:name="VpnGw",type=string,JSONPath=`.spec.vpnGw`
+// +kubebuilder:printcolumn:name="PublicKey",type=string,JSONPath=`.spec.publicKey`
+// +kubebuilder:printcolumn:name="AllowedIPs",type=string,JSONPath=`.spec.allowedIPs`
+// +kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.spec.endpoint`
+// +kubebuilder:printcolumn:name="Accepted",type=string,JSONPath=`.status.conditions[?(@.type=="Accepted")].status`
+// +kubebuilder:printcolumn:name="Keepalive",type=integer,JSONPath=`.spec.persistentKeepalive`,priority=1
+
+// WireGuardPeer is the Schema for the wireguardpeers API
+type WireGuardPeer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WireGuardPeerSpec   `json:"spec,omitempty"`
+	Status WireGuardPeerStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// WireGuardPeerList contains a list of WireGuardPeer
+type WireGuardPeerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WireGuardPeer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WireGuardPeer{}, &WireGuardPeerList{})
+}
@@ -153,7 +153,8 @@ func (in *IpsecConn) DeepCopyInto(out *IpsecConn) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecConn.
@@ -209,6 +210,11 @@ func (in *IpsecConnList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IpsecConnSpec) DeepCopyInto(out *IpsecConnSpec) {
 	*out = *in
+	if in.PSKSecretRef != nil {
+		in, out := &in.PSKSecretRef, &out.PSKSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecConnSpec.
@@ -221,12 +227,38 @@ func (in *IpsecConnSpec) DeepCopy() *IpsecConnSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecConnStatus) DeepCopyInto(out *IpsecConnStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastRekeyTime != nil {
+		in, out := &in.LastRekeyTime, &out.LastRekeyTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecConnStatus.
+func (in *IpsecConnStatus) DeepCopy() *IpsecConnStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecConnStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KeepAlived) DeepCopyInto(out *KeepAlived) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -248,6 +280,51 @@ func (in *KeepAlived) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeepAlivedAuthentication) DeepCopyInto(out *KeepAlivedAuthentication) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeepAlivedAuthentication.
+func (in *KeepAlivedAuthentication) DeepCopy() *KeepAlivedAuthentication {
+	if in == nil {
+		return nil
+	}
+	out := new(KeepAlivedAuthentication)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeepAlivedInstance) DeepCopyInto(out *KeepAlivedInstance) {
+	*out = *in
+	if in.Vips != nil {
+		in, out := &in.Vips, &out.Vips
+		*out = make([]KeepAlivedVip, len(*in))
+		copy(*out, *in)
+	}
+	if in.UnicastPeers != nil {
+		in, out := &in.UnicastPeers, &out.UnicastPeers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Authentication != nil {
+		in, out := &in.Authentication, &out.Authentication
+		*out = new(KeepAlivedAuthentication)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeepAlivedInstance.
+func (in *KeepAlivedInstance) DeepCopy() *KeepAlivedInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(KeepAlivedInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KeepAlivedList) DeepCopyInto(out *KeepAlivedList) {
 	*out = *in
@@ -283,6 +360,23 @@ func (in *KeepAlivedList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KeepAlivedSpec) DeepCopyInto(out *KeepAlivedSpec) {
 	*out = *in
+	if in.Instances != nil {
+		in, out := &in.Instances, &out.Instances
+		*out = make([]KeepAlivedInstance, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TrackScripts != nil {
+		in, out := &in.TrackScripts, &out.TrackScripts
+		*out = make([]KeepAlivedTrackScript, len(*in))
+		copy(*out, *in)
+	}
+	if in.TrackProcesses != nil {
+		in, out := &in.TrackProcesses, &out.TrackProcesses
+		*out = make([]KeepAlivedTrackProcess, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeepAlivedSpec.
@@ -305,6 +399,13 @@ func (in *KeepAlivedStatus) DeepCopyInto(out *KeepAlivedStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RouterIDs != nil {
+		in, out := &in.RouterIDs, &out.RouterIDs
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeepAlivedStatus.
@@ -317,6 +418,51 @@ func (in *KeepAlivedStatus) DeepCopy() *KeepAlivedStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeepAlivedTrackProcess) DeepCopyInto(out *KeepAlivedTrackProcess) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeepAlivedTrackProcess.
+func (in *KeepAlivedTrackProcess) DeepCopy() *KeepAlivedTrackProcess {
+	if in == nil {
+		return nil
+	}
+	out := new(KeepAlivedTrackProcess)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeepAlivedTrackScript) DeepCopyInto(out *KeepAlivedTrackScript) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeepAlivedTrackScript.
+func (in *KeepAlivedTrackScript) DeepCopy() *KeepAlivedTrackScript {
+	if in == nil {
+		return nil
+	}
+	out := new(KeepAlivedTrackScript)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeepAlivedVip) DeepCopyInto(out *KeepAlivedVip) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeepAlivedVip.
+func (in *KeepAlivedVip) DeepCopy() *KeepAlivedVip {
+	if in == nil {
+		return nil
+	}
+	out := new(KeepAlivedVip)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Pinger) DeepCopyInto(out *Pinger) {
 	*out = *in
@@ -413,6 +559,180 @@ func (in *PingerStatus) DeepCopy() *PingerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnClient) DeepCopyInto(out *SslVpnClient) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnClient.
+func (in *SslVpnClient) DeepCopy() *SslVpnClient {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnClient)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SslVpnClient) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnClientCertificate) DeepCopyInto(out *SslVpnClientCertificate) {
+	*out = *in
+	in.NotAfter.DeepCopyInto(&out.NotAfter)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnClientCertificate.
+func (in *SslVpnClientCertificate) DeepCopy() *SslVpnClientCertificate {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnClientCertificate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnClientList) DeepCopyInto(out *SslVpnClientList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SslVpnClient, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnClientList.
+func (in *SslVpnClientList) DeepCopy() *SslVpnClientList {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnClientList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SslVpnClientList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnClientSpec) DeepCopyInto(out *SslVpnClientSpec) {
+	*out = *in
+	out.Duration = in.Duration
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedCidrs != nil {
+		in, out := &in.AllowedCidrs, &out.AllowedCidrs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnClientSpec.
+func (in *SslVpnClientSpec) DeepCopy() *SslVpnClientSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnClientSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnClientStatus) DeepCopyInto(out *SslVpnClientStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NotBefore != nil {
+		in, out := &in.NotBefore, &out.NotBefore
+		*out = (*in).DeepCopy()
+	}
+	if in.NotAfter != nil {
+		in, out := &in.NotAfter, &out.NotAfter
+		*out = (*in).DeepCopy()
+	}
+	if in.IssuedCertificates != nil {
+		in, out := &in.IssuedCertificates, &out.IssuedCertificates
+		*out = make([]SslVpnClientCertificate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnClientStatus.
+func (in *SslVpnClientStatus) DeepCopy() *SslVpnClientStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnClientStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnConnection) DeepCopyInto(out *SslVpnConnection) {
+	*out = *in
+	in.ConnectedSince.DeepCopyInto(&out.ConnectedSince)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnConnection.
+func (in *SslVpnConnection) DeepCopy() *SslVpnConnection {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnConnection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnRevocation) DeepCopyInto(out *SslVpnRevocation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnRevocation.
+func (in *SslVpnRevocation) DeepCopy() *SslVpnRevocation {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnRevocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VpnGw) DeepCopyInto(out *VpnGw) {
 	*out = *in
@@ -472,9 +792,115 @@ func (in *VpnGwList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnGwNetwork) DeepCopyInto(out *VpnGwNetwork) {
+	*out = *in
+	if in.IPs != nil {
+		in, out := &in.IPs, &out.IPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnGwNetwork.
+func (in *VpnGwNetwork) DeepCopy() *VpnGwNetwork {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnGwNetwork)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnGwNodeCleanup) DeepCopyInto(out *VpnGwNodeCleanup) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnGwNodeCleanup.
+func (in *VpnGwNodeCleanup) DeepCopy() *VpnGwNodeCleanup {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnGwNodeCleanup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnGwNodeDrift) DeepCopyInto(out *VpnGwNodeDrift) {
+	*out = *in
+	if in.Fields != nil {
+		in, out := &in.Fields, &out.Fields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastHealTime != nil {
+		in, out := &in.LastHealTime, &out.LastHealTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnGwNodeDrift.
+func (in *VpnGwNodeDrift) DeepCopy() *VpnGwNodeDrift {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnGwNodeDrift)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnGwQoS) DeepCopyInto(out *VpnGwQoS) {
+	*out = *in
+	if in.Ingress != nil {
+		in, out := &in.Ingress, &out.Ingress
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Egress != nil {
+		in, out := &in.Egress, &out.Egress
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.SslVpnClientRate != nil {
+		in, out := &in.SslVpnClientRate, &out.SslVpnClientRate
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.SslVpnClientBurst != nil {
+		in, out := &in.SslVpnClientBurst, &out.SslVpnClientBurst
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnGwQoS.
+func (in *VpnGwQoS) DeepCopy() *VpnGwQoS {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnGwQoS)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VpnGwSpec) DeepCopyInto(out *VpnGwSpec) {
 	*out = *in
+	if in.QoS != nil {
+		in, out := &in.QoS, &out.QoS
+		*out = new(VpnGwQoS)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make([]VpnGwNetwork, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Selector != nil {
 		in, out := &in.Selector, &out.Selector
 		*out = make([]string, len(*in))
@@ -488,11 +914,21 @@ func (in *VpnGwSpec) DeepCopyInto(out *VpnGwSpec) {
 		}
 	}
 	in.Affinity.DeepCopyInto(&out.Affinity)
+	if in.SslVpnRevocations != nil {
+		in, out := &in.SslVpnRevocations, &out.SslVpnRevocations
+		*out = make([]SslVpnRevocation, len(*in))
+		copy(*out, *in)
+	}
 	if in.IPSecConnections != nil {
 		in, out := &in.IPSecConnections, &out.IPSecConnections
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.DefaultPSKSecretRef != nil {
+		in, out := &in.DefaultPSKSecretRef, &out.DefaultPSKSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnGwSpec.
@@ -508,6 +944,18 @@ func (in *VpnGwSpec) DeepCopy() *VpnGwSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VpnGwStatus) DeepCopyInto(out *VpnGwStatus) {
 	*out = *in
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make([]VpnGwNetwork, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.QoS != nil {
+		in, out := &in.QoS, &out.QoS
+		*out = new(VpnGwQoS)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Selector != nil {
 		in, out := &in.Selector, &out.Selector
 		*out = make([]string, len(*in))
@@ -526,6 +974,38 @@ func (in *VpnGwStatus) DeepCopyInto(out *VpnGwStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.WireGuardPeers != nil {
+		in, out := &in.WireGuardPeers, &out.WireGuardPeers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SslVpnCRLNextUpdate != nil {
+		in, out := &in.SslVpnCRLNextUpdate, &out.SslVpnCRLNextUpdate
+		*out = (*in).DeepCopy()
+	}
+	if in.SslVpnClients != nil {
+		in, out := &in.SslVpnClients, &out.SslVpnClients
+		*out = make([]SslVpnConnection, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.StaticPodCleanup != nil {
+		in, out := &in.StaticPodCleanup, &out.StaticPodCleanup
+		*out = make([]VpnGwNodeCleanup, len(*in))
+		copy(*out, *in)
+	}
+	if in.StaticPodDrift != nil {
+		in, out := &in.StaticPodDrift, &out.StaticPodDrift
+		*out = make([]VpnGwNodeDrift, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.StaticPodLastHealTime != nil {
+		in, out := &in.StaticPodLastHealTime, &out.StaticPodLastHealTime
+		*out = (*in).DeepCopy()
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]metav1.Condition, len(*in))
@@ -544,3 +1024,99 @@ func (in *VpnGwStatus) DeepCopy() *VpnGwStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WireGuardPeer) DeepCopyInto(out *WireGuardPeer) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WireGuardPeer.
+func (in *WireGuardPeer) DeepCopy() *WireGuardPeer {
+	if in == nil {
+		return nil
+	}
+	out := new(WireGuardPeer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WireGuardPeer) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WireGuardPeerList) DeepCopyInto(out *WireGuardPeerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]WireGuardPeer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WireGuardPeerList.
+func (in *WireGuardPeerList) DeepCopy() *WireGuardPeerList {
+	if in == nil {
+		return nil
+	}
+	out := new(WireGuardPeerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WireGuardPeerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WireGuardPeerSpec) DeepCopyInto(out *WireGuardPeerSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WireGuardPeerSpec.
+func (in *WireGuardPeerSpec) DeepCopy() *WireGuardPeerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WireGuardPeerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WireGuardPeerStatus) DeepCopyInto(out *WireGuardPeerStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WireGuardPeerStatus.
+func (in *WireGuardPeerStatus) DeepCopy() *WireGuardPeerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WireGuardPeerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
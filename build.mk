@@ -20,6 +20,7 @@ KUBE_OVN_BASE_IMG ?= kubeovn/kube-ovn-base:v1.12.9-mc
 SSL_VPN_IMG_BASE ?= ${IMAGE_TAG_BASE}-openvpn
 IPSEC_VPN_IMG_BASE ?= ${IMAGE_TAG_BASE}-strongswan
 KEEPALIVED_IMG_BASE ?= ${IMAGE_TAG_BASE}-keepalived
+WIREGUARD_IMG_BASE ?= ${IMAGE_TAG_BASE}-wireguard
 DEBUGGER_IMG_BASE ?= ${IMAGE_TAG_BASE}-debugger
 PINGER_IMG_BASE ?= ${IMAGE_TAG_BASE}-pinger
 
@@ -28,6 +29,7 @@ IMG ?= $(IMAGE_TAG_BASE)-controller:v$(VERSION)
 SSL_VPN_IMG ?= $(SSL_VPN_IMG_BASE):v$(VERSION)
 IPSEC_VPN_IMG ?= $(IPSEC_VPN_IMG_BASE):v$(VERSION)
 KEEPALIVED_IMG ?= $(KEEPALIVED_IMG_BASE):v$(VERSION)
+WIREGUARD_IMG ?= $(WIREGUARD_IMG_BASE):v$(VERSION)
 DEBUGGER_IMG ?= $(DEBUGGER_IMG_BASE):v$(VERSION)
 PINGER_IMG ?= $(PINGER_IMG_BASE):v$(VERSION)
 
@@ -91,6 +93,18 @@ docker-build-ipsec-vpn-arm64: ## Build docker ipsec-vpn image for arm64.
 docker-push-ipsec-vpn: ## Push docker ipsec-vpn image
 	docker push ${IPSEC_VPN_IMG}
 
+.PHONY: docker-build-wireguard-amd64
+docker-build-wireguard-amd64: ## Build docker wireguard image for amd64.
+	docker buildx build --network host --load --platform linux/amd64 -f ./dist/Dockerfile.wireguard -t ${WIREGUARD_IMG} --build-arg BASE_TAG=v${VERSION} .
+
+.PHONY: docker-build-wireguard-arm64
+docker-build-wireguard-arm64: ## Build docker wireguard image for arm64.
+	docker buildx build --network host --load --platform linux/arm64 -f ./dist/Dockerfile.wireguard -t ${WIREGUARD_IMG} --build-arg BASE_TAG=v${VERSION} .
+
+.PHONY: docker-push-wireguard
+docker-push-wireguard: ## Push docker wireguard image
+	docker push ${WIREGUARD_IMG}
+
 .PHONY: docker-build-keepalived-amd64
 docker-build-keepalived-amd64: ## Build docker keepalived image for amd64.
 	docker buildx build --network host --load --platform linux/amd64 -f ./dist/Dockerfile.keepalived -t ${KEEPALIVED_IMG} --build-arg BASE_TAG=v${VERSION} .
@@ -128,16 +142,17 @@ docker-push-pinger: ## Push docker pinger image
 	docker push ${PINGER_IMG}
 
 .PHONY: docker-build-all-amd64
-docker-build-all-amd64: docker-build-amd64 docker-build-base-amd64 docker-build-ssl-vpn-amd64 docker-build-ipsec-vpn-amd64 docker-build-keepalived-amd64 docker-build-debugger-amd64 docker-build-pinger-amd64 ## Build all images for amd64.
+docker-build-all-amd64: docker-build-amd64 docker-build-base-amd64 docker-build-ssl-vpn-amd64 docker-build-ipsec-vpn-amd64 docker-build-wireguard-amd64 docker-build-keepalived-amd64 docker-build-debugger-amd64 docker-build-pinger-amd64 ## Build all images for amd64.
 
 .PHONY: docker-build-all-arm64
-docker-build-all-arm64: docker-build-arm64 docker-build-base-arm64 docker-build-ssl-vpn-arm64 docker-build-ipsec-vpn-arm64 docker-build-keepalived-arm64 docker-build-debugger-arm64 docker-build-pinger-arm64 ## Build all images for arm64.
+docker-build-all-arm64: docker-build-arm64 docker-build-base-arm64 docker-build-ssl-vpn-arm64 docker-build-ipsec-vpn-arm64 docker-build-wireguard-arm64 docker-build-keepalived-arm64 docker-build-debugger-arm64 docker-build-pinger-arm64 ## Build all images for arm64.
 
 .PHONY: docker-push-all 
 docker-push-all: ## Push all docker images
 	docker pull ${IMG} && \
 	docker push ${SSL_VPN_IMG} && \
 	docker push ${IPSEC_VPN_IMG} && \
+	docker push ${WIREGUARD_IMG} && \
 	docker push ${KEEPALIVED_IMG} && \
 	docker push ${DEBUGGER_IMG} && \
 	docker push ${PINGER_IMG}
@@ -147,6 +162,7 @@ docker-pull-all:
 	docker pull ${IMG} && \
 	docker pull ${SSL_VPN_IMG} && \
 	docker pull ${IPSEC_VPN_IMG} && \
+	docker pull ${WIREGUARD_IMG} && \
 	docker pull ${KEEPALIVED_IMG} && \
 	docker pull ${DEBUGGER_IMG} && \
 	docker pull ${PINGER_IMG} 
@@ -19,6 +19,7 @@ package controller
 import (
 	"flag"
 	"os"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -52,11 +53,26 @@ func CmdMain() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var enableWebhooks bool
+	var cryptoPolicy string
+	var defaults myv1.DefaultOptions
+	var routerIDNamespace string
+	var cniProvider string
 	var k8sManifestsPath string
 	var sslVpnSecretPath, dhSecretPath string
 	var sslVpnTCP, sslVpnUDP string
 	var ipSecBootPcPort, ipSecIsakmpPort, ipSecNatPort, ipSecVpnSecretPath string
+	var ipSecStatusInterval, sslVpnStatusInterval time.Duration
 	flag.BoolVar(&enableWebhooks, "enable-webhooks", os.Getenv("ENABLE_WEBHOOKS") == "true", "Enable webhooks")
+	flag.StringVar(&cryptoPolicy, "crypto-policy", string(myv1.CryptoPolicyDefault), "The policy the webhooks validate the ssl vpn ciphers and ip sec proposals against, strict, default or legacy.")
+	// images of the objects which do not set their own
+	flag.StringVar(&defaults.SslVpnImage, "ssl-vpn-image", "", "The default ssl vpn image of the vpn gw.")
+	flag.StringVar(&defaults.IPSecVpnImage, "ip-sec-vpn-image", "", "The default ip sec vpn image of the vpn gw.")
+	flag.StringVar(&defaults.WireGuardImage, "wireguard-image", "", "The default wireguard image of the vpn gw.")
+	flag.StringVar(&defaults.KeepalivedImage, "keepalived-image", "", "The default image of the keepalived.")
+	flag.StringVar(&defaults.DebuggerImage, "debugger-image", "", "The default image of the debugger.")
+	flag.StringVar(&defaults.PingerImage, "pinger-image", "", "The default image of the pinger.")
+	flag.StringVar(&cniProvider, "cni-provider", myv1.CNIProviderKubeOVN, "The cni provider of the vpn gw pods which do not set one, kube-ovn, multus or cni.")
+	flag.StringVar(&routerIDNamespace, "keepalived-router-id-namespace", "kube-system", "The namespace the keepalived router ids of each subnet are allocated in.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "127.0.0.1", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":38081", "The address the probe endpoint binds to.")
 	// vpn gw server pod need those config to start
@@ -67,10 +83,12 @@ func CmdMain() {
 	flag.StringVar(&ipSecVpnSecretPath, "ip-sec-vpn-secret-path", "/etc/ipsec/certs", "The path the ip sec vpn pod will copy to.")
 	flag.StringVar(&sslVpnTCP, "ssl-vpn-tcp-port", "443", "The port the ssl vpn server binds to.")
 	flag.StringVar(&sslVpnUDP, "ssl-vpn-udp-port", "1194", "The port the ssl vpn server binds to.")
+	flag.DurationVar(&sslVpnStatusInterval, "ssl-vpn-status-interval", 30*time.Second, "The interval to refresh the connected ssl vpn clients from the vpn gw pods, 0 to disable.")
 	// ipsec vpn
 	flag.StringVar(&ipSecBootPcPort, "ip-sec-boot-pc-port", "68", "The port the ip sec vpn server binds to.")
 	flag.StringVar(&ipSecIsakmpPort, "ip-sec-isakmp-pc-port", "500", "The port the ip sec vpn server binds to.")
 	flag.StringVar(&ipSecNatPort, "ip-sec-nat-port", "4500", "The port the ip sec vpn server binds to.")
+	flag.DurationVar(&ipSecStatusInterval, "ip-sec-status-interval", 30*time.Second, "The interval to refresh ip sec connection status from the vpn gw pods, 0 to disable.")
 
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
@@ -121,6 +139,11 @@ func CmdMain() {
 	}
 
 	// vpn gw controllers
+	provider, err := controller.NewCNIProvider(cniProvider)
+	if err != nil {
+		setupLog.Error(err, "unable to parse cni provider")
+		os.Exit(1)
+	}
 	if err = (&controller.VpnGwReconciler{
 		Client:     mgr.GetClient(),
 		KubeClient: kubeClient,
@@ -128,33 +151,51 @@ func CmdMain() {
 		RestConfig: restConfig,
 		Log:        ctrl.Log.WithName("vpngw"),
 		// vpn gw
-		SslVpnTCP:          sslVpnTCP,
-		SslVpnUDP:          sslVpnUDP,
-		IPSecBootPcPort:    ipSecBootPcPort,
-		IPSecIsakmpPort:    ipSecIsakmpPort,
-		IPSecNatPort:       ipSecNatPort,
-		SslVpnSecretPath:   sslVpnSecretPath,
-		DhSecretPath:       dhSecretPath,
-		K8sManifestsPath:   k8sManifestsPath,
-		IPSecVpnSecretPath: ipSecVpnSecretPath,
+		SslVpnTCP:            sslVpnTCP,
+		SslVpnUDP:            sslVpnUDP,
+		IPSecBootPcPort:      ipSecBootPcPort,
+		IPSecIsakmpPort:      ipSecIsakmpPort,
+		IPSecNatPort:         ipSecNatPort,
+		SslVpnSecretPath:     sslVpnSecretPath,
+		DhSecretPath:         dhSecretPath,
+		K8sManifestsPath:     k8sManifestsPath,
+		IPSecVpnSecretPath:   ipSecVpnSecretPath,
+		IPSecStatusInterval:  ipSecStatusInterval,
+		SslVpnStatusInterval: sslVpnStatusInterval,
+		Defaults:             defaults,
+		CNIProvider:          provider,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "VpnGw")
 		os.Exit(1)
 	}
 
 	if err = (&controller.IpsecConnReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Log:    ctrl.Log.WithName("ipsecconn"),
+		Client:     mgr.GetClient(),
+		KubeClient: kubeClient,
+		Scheme:     mgr.GetScheme(),
+		RestConfig: restConfig,
+		Log:        ctrl.Log.WithName("ipsecconn"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "IpsecConn")
 		os.Exit(1)
 	}
 
+	if err = (&controller.SslVpnClientReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Log:       ctrl.Log.WithName("sslvpnclient"),
+		SslVpnTCP: sslVpnTCP,
+		SslVpnUDP: sslVpnUDP,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SslVpnClient")
+		os.Exit(1)
+	}
+
 	if err = (&controller.KeepAlivedReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Log:    ctrl.Log.WithName("keepalived"),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Log:       ctrl.Log.WithName("keepalived"),
+		Namespace: routerIDNamespace,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KeepAlived")
 		os.Exit(1)
@@ -167,6 +208,7 @@ func CmdMain() {
 		Scheme:     mgr.GetScheme(),
 		RestConfig: restConfig,
 		Log:        ctrl.Log.WithName("debugger"),
+		Defaults:   defaults,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Debugger")
 		os.Exit(1)
@@ -183,25 +225,31 @@ func CmdMain() {
 
 	if enableWebhooks {
 		setupLog.Info("enabling webhooks")
-		if err = (&myv1.VpnGw{}).SetupWebhookWithManager(mgr); err != nil {
+		policy, err := myv1.ParseCryptoPolicy(cryptoPolicy)
+		if err != nil {
+			setupLog.Error(err, "unable to parse crypto policy")
+			os.Exit(1)
+		}
+		webhookOpts := myv1.WebhookOptions{Defaults: defaults, CryptoPolicy: policy}
+		if err = myv1.SetupVpnGwWebhookWithManager(mgr, webhookOpts); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "VpnGw")
 			os.Exit(1)
 		}
 
-		if err = (&myv1.IpsecConn{}).SetupWebhookWithManager(mgr); err != nil {
+		if err = myv1.SetupIpsecConnWebhookWithManager(mgr, webhookOpts); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "IpsecConn")
 			os.Exit(1)
 		}
 
-		if err = (&myv1.KeepAlived{}).SetupWebhookWithManager(mgr); err != nil {
+		if err = myv1.SetupKeepAlivedWebhookWithManager(mgr, webhookOpts); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "KeepAlived")
 			os.Exit(1)
 		}
-		if err = (&myv1.Debugger{}).SetupWebhookWithManager(mgr); err != nil {
+		if err = myv1.SetupDebuggerWebhookWithManager(mgr, webhookOpts); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "Debugger")
 			os.Exit(1)
 		}
-		if err = (&myv1.Pinger{}).SetupWebhookWithManager(mgr); err != nil {
+		if err = myv1.SetupPingerWebhookWithManager(mgr, webhookOpts); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "Pinger")
 			os.Exit(1)
 		}
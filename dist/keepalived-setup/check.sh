@@ -0,0 +1,40 @@
+#!/bin/bash
+set -eu
+# track scripts of the vpn services added by the kube-combo controller, exit 0 means the service is up
+# usage example:
+# the ssl vpn or ipsec vpn port is listening in the pod or host network
+# /check.sh port udp 1194
+# the wireguard interface is up
+# /check.sh link wg0
+
+function port() {
+	proto=$1
+	port=$2
+	case $proto in
+	tcp) flag=t ;;
+	udp) flag=u ;;
+	*)
+		echo "unknown proto: $proto"
+		exit 1
+		;;
+	esac
+	[ -n "$(ss -Hln${flag} "sport = :${port}")" ]
+}
+
+function link() {
+	ip link show "$1" up | grep -q .
+}
+
+opt=${1:-}
+case $opt in
+port)
+	port "$2" "$3"
+	;;
+link)
+	link "$2"
+	;;
+*)
+	echo "unknown option: $opt"
+	exit 1
+	;;
+esac
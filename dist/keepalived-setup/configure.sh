@@ -1,69 +1,68 @@
 #!/bin/bash
-set -eux
-echo "setup keepalived..."
+set -eu
+# usage example:
+# the kube-combo controller renders keepalived.conf into a config map mounted to ${RENDERED_HOME}
+# start keepalived with the rendered config
+# /configure.sh
+# reload keepalived once the mounted keepalived.conf matches the given sha256, it is skipped if the config is not changed
+# /configure.sh reload 5f0c...e3a1
 
-TEMPLATE_CONF=temp-keepalived.conf.j2
+RENDERED_HOME=${RENDERED_HOME:-/etc/keepalived.d/rendered}
 CONF=/etc/keepalived.d/keepalived.conf
-VALUES_YAML=values.yaml
+LOADED_HASH=/etc/keepalived.d/keepalived.conf.sha256
+PID_FILE=/run/keepalived.pid
 
-# load values
-if [ -z "$KEEPALIVED_VIP" ]; then
-    echo "KEEPALIVED_VIP is empty."
-    exit 1
-fi
-if [ -z "$KEEPALIVED_VIRTUAL_ROUTER_ID" ]; then
-    echo "KEEPALIVED_VIRTUAL_ROUTER_ID is empty."
-    exit 1
-fi
-if [ -z "$KEEPALIVED_NIC" ]; then
-    echo "KEEPALIVED_NIC is empty."
-    exit 1
-fi
+function hash() {
+	sha256sum "$1" | awk '{print $1}'
+}
 
-# prepare values.yaml
-printf "instances: \n" >"${VALUES_YAML}"
+function install_conf() {
+	cp "${RENDERED_HOME}/keepalived.conf" "${CONF}"
+	hash "${CONF}" >"${LOADED_HASH}"
+	echo "keepalived.conf:"
+	cat "${CONF}"
+}
 
-# This priority value must be within the range of 0 to 255
-# random generate a priority value
-priority=$(shuf -i 0-255 -n 1)
+function start() {
+	until [ -s "${RENDERED_HOME}/keepalived.conf" ]; do
+		echo "waiting for ${RENDERED_HOME}/keepalived.conf"
+		sleep 2
+	done
+	install_conf
+	echo "start keepalived..."
+	host=$(hostname)
+	exec /usr/sbin/keepalived --log-console --log-detail --dont-fork --config-id="${host}" --use-file="${CONF}" --pid="${PID_FILE}"
+}
 
-# example KEEPALIVED_NIC="eth0,eth1"
-# example KEEPALIVED_VIP="192.168.0.100,192.168.1.100"
-read nic1 nic2 <<< $(echo "${KEEPALIVED_NIC}" | tr "," " ")
-read vip1 vip2 <<< $(echo "${KEEPALIVED_VIP}" | tr "," " ")
-read router_id1 <<< $(echo "${KEEPALIVED_VIRTUAL_ROUTER_ID}" | tr "," " ")
-router_id2=$((router_id1 + 1))
-
-if [ ! -z "$vip1" ]; then
-    echo "prepare vip ${vip1} nic ${nic1} ..."
-    printf "  - name: %s\n" "${nic1}" >>"${VALUES_YAML}"
-    printf "    vip: %s\n" "${vip1}" >>"${VALUES_YAML}"
-    printf "    nic: %s\n" "${nic1}" >>"${VALUES_YAML}"
-    printf "    router_id: %s\n" "${router_id1}" >>"${VALUES_YAML}"
-    printf "    priority: %s\n" "${priority}" >>"${VALUES_YAML}"
-fi
+function reload() {
+	expected=$1
+	# kubelet syncs the config map volume periodically, make sure it is the latest one
+	actual=$(hash "${RENDERED_HOME}/keepalived.conf")
+	if [ "${actual}" != "${expected}" ]; then
+		echo "${RENDERED_HOME}/keepalived.conf is not synced yet, expected ${expected}, got ${actual}"
+		exit 2
+	fi
+	if [ "$(cat "${LOADED_HASH}" 2>/dev/null)" = "${expected}" ]; then
+		echo "keepalived.conf is not changed"
+		exit 0
+	fi
+	install_conf
+	kill -HUP "$(cat "${PID_FILE}")"
+	echo "keepalived reloaded"
+}
 
-if [ ! -z "$vip2" ]; then
-    echo "prepare vip ${vip2} nic ${nic2} ..."
-    printf "  - name: %s\n" "${nic2}" >>"${VALUES_YAML}"
-    printf "    vip: %s\n" "${vip2}" >>"${VALUES_YAML}"
-    printf "    nic: %s\n" "${nic2}" >>"${VALUES_YAML}"
-    printf "    router_id: %s\n" "${router_id2}" >>"${VALUES_YAML}"
-    printf "    priority: %s\n" "${priority}" >>"${VALUES_YAML}"
+if [ $# -eq 0 ]; then
+	start
+	exit 0
 fi
 
-echo "cat ${VALUES_YAML}..."
-cat "${VALUES_YAML}"
-
-echo "prepare keepalived.conf..."
-cp "${TEMPLATE_CONF}" keepalived.conf.j2
-
-# use j2 to generate keepalived.conf
-j2 keepalived.conf.j2 "${VALUES_YAML}" -o "${CONF}"
-
-echo "keepalived.conf:"
-cat "${CONF}"
-
-echo "start keepalived..."
-host=$(hostname)
-/usr/sbin/keepalived --log-console --log-detail --dont-fork --config-id="${host}" --use-file="${CONF}"
+opt=$1
+case $opt in
+reload)
+	reload "$2"
+	;;
+*)
+	echo "unknown option: $opt"
+	exit 1
+	;;
+esac
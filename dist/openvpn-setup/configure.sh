@@ -56,6 +56,23 @@ echo "NETWORK ${NETWORK} NETMASK ${NETMASK}"
 
 iptables -t nat -A POSTROUTING -s "${SSL_VPN_NETWORK}/${SSL_VPN_SUBNET_MASK}" -o eth0 -j MASQUERADE
 
+# limit the traffic of each ssl vpn client, the chain is flushed to drop the limits of the previous run
+QOS_CHAIN="SSL_VPN_CLIENT_QOS"
+iptables -N "${QOS_CHAIN}" 2>/dev/null || iptables -F "${QOS_CHAIN}"
+if ! iptables -C FORWARD -j "${QOS_CHAIN}" 2>/dev/null; then
+    iptables -I FORWARD -j "${QOS_CHAIN}"
+fi
+if [ -n "${SSL_VPN_CLIENT_RATE:-}" ]; then
+    BURST=()
+    if [ -n "${SSL_VPN_CLIENT_BURST:-}" ]; then
+        BURST=(--hashlimit-burst "${SSL_VPN_CLIENT_BURST}")
+    fi
+    iptables -A "${QOS_CHAIN}" -i tun0 -m hashlimit --hashlimit-name ssl-vpn-up --hashlimit-mode srcip \
+        --hashlimit-above "${SSL_VPN_CLIENT_RATE}" "${BURST[@]}" -j DROP
+    iptables -A "${QOS_CHAIN}" -o tun0 -m hashlimit --hashlimit-name ssl-vpn-down --hashlimit-mode dstip \
+        --hashlimit-above "${SSL_VPN_CLIENT_RATE}" "${BURST[@]}" -j DROP
+fi
+
 mkdir -p /dev/net
 if [ ! -c /dev/net/tun ]; then
     mknod /dev/net/tun c 10 200
@@ -85,6 +102,42 @@ sed 's|AUTH|'"${SSL_VPN_AUTH}"'|' -i "${CONF}"
 # DNS
 sed 's|SSL_VPN_K8S_SEARCH|'"${FORMATTED_SEARCH}"'|' -i "${CONF}"
 
+# bind to the keepalived vip of the uplink interface, the backup pods do not hold the vip yet
+if [ -n "${SSL_VPN_LOCAL:-}" ]; then
+    sysctl -w net.ipv4.ip_nonlocal_bind=1
+    echo "local ${SSL_VPN_LOCAL}" >>"${CONF}"
+fi
+
+# reject the revoked ssl vpn clients, the crl is signed by the controller
+if [ "${SSL_VPN_CRL_ENABLED:-false}" = "true" ]; then
+    while [ ! -f "${CONF_HOME}/crl/crl.pem" ]; do
+        sleep 1
+        echo "waiting for ${CONF_HOME}/crl/crl.pem ............"
+    done
+    echo "crl-verify ${CONF_HOME}/crl/crl.pem" >>"${CONF}"
+    # reject the common names revoked in the vpn gw spec,
+    # the static pod runs the script copied to the host cache by the daemonset pod
+    VERIFY_CN="${SETUP_HOME}/verify-cn.sh"
+    if [ -d "/etc/host-init-openvpn" ]; then
+        VERIFY_CN="/etc/host-init-openvpn/verify-cn.sh"
+    fi
+    echo "script-security 2" >>"${CONF}"
+    echo "tls-verify ${VERIFY_CN}" >>"${CONF}"
+fi
+
+# push the client configs of the ssl vpn clients, the static pod links the ccd to the host cache
+if [ "${SSL_VPN_CCD_ENABLED:-false}" = "true" ]; then
+    echo "topology subnet" >>"${CONF}"
+    echo "client-config-dir ${CONF_HOME}/ccd" >>"${CONF}"
+    # the static ips are reserved out of the dynamic pool
+    if [ -n "${SSL_VPN_POOL:-}" ]; then
+        sed 's|^server .*|& nopool|' -i "${CONF}"
+        echo "ifconfig-pool ${SSL_VPN_POOL} ${SSL_VPN_SUBNET_MASK}" >>"${CONF}"
+    fi
+    # apply the acl of the allowed cidrs before any client connects
+    bash "${SETUP_HOME}/reload-ccd.sh"
+fi
+
 # debug openvpn.conf
 echo "cat ${CONF} start .............."
 cat "${CONF}"
@@ -38,6 +38,12 @@ rm -fr "/etc/host-init-openvpn/*"
 \cp "${CONF_HOME}/openvpn.conf" "/etc/host-init-openvpn"
 \cp -r "${CONF_HOME}/certs" "/etc/host-init-openvpn"
 \cp -L "${CONF_HOME}/dh/dh.pem" "/etc/host-init-openvpn"
+if [ "${SSL_VPN_CRL_ENABLED:-false}" = "true" ]; then
+	# the controller runs reload-crl.sh to copy the crl again once it changes
+	mkdir -p "/etc/host-init-openvpn/crl"
+	\cp -L "${CONF_HOME}/crl/crl.pem" "${CONF_HOME}/crl/revoked.json" "${CONF_HOME}/crl/revoked-cns" "/etc/host-init-openvpn/crl"
+	\cp "${SETUP_HOME}/verify-cn.sh" "/etc/host-init-openvpn"
+fi
 
 echo "show /etc/host-init-openvpn files .............."
 ls -lR "/etc/host-init-openvpn"
@@ -45,6 +51,14 @@ ls -lR "/etc/host-init-openvpn"
 echo "deploy static pod ${K8S_MANIFESTS_PATH} .............."
 # format openvpn static pod yaml
 sed 's|SSL_VPN_IMAGE|'"${SSL_VPN_IMAGE}"'|' -i "${SETUP_HOME}/static-openvpn.yaml"
+sed -e 's|STATIC_SSL_VPN_PROTO|'"${SSL_VPN_PROTO}"'|' \
+	-e 's|STATIC_SSL_VPN_PORT|'"${SSL_VPN_PORT}"'|' \
+	-e 's|STATIC_SSL_VPN_CIPHER|'"${SSL_VPN_CIPHER}"'|' \
+	-e 's|STATIC_POD_CPU|'"${STATIC_POD_CPU:-1000}m"'|' \
+	-e 's|STATIC_POD_MEMORY|'"${STATIC_POD_MEMORY:-1024M}"'|' \
+	-e 's|STATIC_POD_VPN_GW_NAMESPACE|'"${STATIC_POD_VPN_GW_NAMESPACE}"'|' \
+	-e 's|STATIC_POD_VPN_GW|'"${STATIC_POD_VPN_GW}"'|' \
+	-i "${SETUP_HOME}/static-openvpn.yaml"
 \cp "${SETUP_HOME}/static-openvpn.yaml" "${K8S_MANIFESTS_PATH}"
 
 # copy probe.sh to /etc/host-init-openvpn
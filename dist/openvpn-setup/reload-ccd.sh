@@ -0,0 +1,65 @@
+#!/bin/bash
+set -eu
+# the controller runs this script once it renders the client configs of the ssl vpn clients
+# $1 is the sha256 of the client config files, exit 2 if the mounted client config secret is not synced yet
+# openvpn reads the client config once the client connects, the acl is applied here
+# run it without the sha256 to apply the mounted acl once the pod starts
+
+CONF_HOME=${CONF_HOME:-/etc/openvpn}
+CCD="${CONF_HOME}/ccd"
+ACL="${CCD}/_acl"
+HOST_CACHE="/etc/host-init-openvpn"
+CHAIN="SSL_VPN_ACL"
+
+# the controller hashes the file names and contents in the same order
+files() {
+    (cd "$CCD" && ls -1 | LC_ALL=C sort)
+}
+
+want=${1:-}
+if [ -n "$want" ]; then
+    if [ ! -f "$ACL" ]; then
+        echo "waiting for ${ACL} ............"
+        exit 2
+    fi
+    got=$(for f in $(files); do printf '%s\n' "$f"; cat "${CCD}/${f}"; done | sha256sum | awk '{print $1}')
+    if [ "$got" != "$want" ]; then
+        echo "${CCD} sha256 is ${got}, waiting for ${want} ............"
+        exit 2
+    fi
+fi
+
+# the static pod reads the client configs from the host cache
+if [ -d "$HOST_CACHE" ]; then
+    mkdir -p "${HOST_CACHE}/ccd"
+    for f in $(files); do
+        \cp -L "${CCD}/${f}" "${HOST_CACHE}/ccd/${f}.tmp"
+        mv -f "${HOST_CACHE}/ccd/${f}.tmp" "${HOST_CACHE}/ccd/${f}"
+    done
+    for f in $(cd "${HOST_CACHE}/ccd" && ls -1); do
+        if [ ! -f "${CCD}/${f}" ]; then
+            rm -f "${HOST_CACHE}/ccd/${f}"
+        fi
+    done
+fi
+
+# allow the forwarded traffic from the static ip of the client to its allowed cidrs only,
+# the chain is replaced at once so the clients are never left without their acl
+{
+    echo "*filter"
+    echo ":${CHAIN} - [0:0]"
+    if [ -f "$ACL" ]; then
+        while read -r ip cidrs; do
+            [ -n "$ip" ] || continue
+            for cidr in $cidrs; do
+                echo "-A ${CHAIN} -s ${ip}/32 -d ${cidr} -j ACCEPT"
+            done
+            echo "-A ${CHAIN} -s ${ip}/32 -j DROP"
+        done <"$ACL"
+    fi
+    echo "COMMIT"
+} | iptables-restore --noflush
+if ! iptables -C FORWARD -i tun0 -j "${CHAIN}" 2>/dev/null; then
+    iptables -I FORWARD -i tun0 -j "${CHAIN}"
+fi
+echo "client config ${want} is ready .............."
@@ -0,0 +1,65 @@
+#!/bin/bash
+set -eu
+# the controller runs this script once it signs the crl of the revoked ssl vpn clients
+# $1 is the sha256 of the crl files, exit 2 if the mounted crl secret is not synced yet
+# openvpn crl-verify reads the crl again once it changes, the other connected clients are kept,
+# the sessions of the newly revoked clients are killed by the openvpn management interface
+
+CONF_HOME=${CONF_HOME:-/etc/openvpn}
+CRL_DIR="${CONF_HOME}/crl"
+CRL="${CRL_DIR}/crl.pem"
+REVOKED="${CRL_DIR}/revoked.json"
+REVOKED_CNS="${CRL_DIR}/revoked-cns"
+HOST_CACHE="/etc/host-init-openvpn"
+MANAGEMENT_PORT=${SSL_VPN_MANAGEMENT_PORT:-7505}
+
+want=${1:-}
+if [ -z "$want" ]; then
+    echo "usage: $0 <crl files sha256>"
+    exit 1
+fi
+
+for f in "$CRL" "$REVOKED" "$REVOKED_CNS"; do
+    if [ ! -f "$f" ]; then
+        echo "waiting for ${f} ............"
+        exit 2
+    fi
+done
+# the controller hashes the files in the same order
+got=$(cat "$CRL" "$REVOKED" "$REVOKED_CNS" | sha256sum | awk '{print $1}')
+if [ "$got" != "$want" ]; then
+    echo "${CRL_DIR} sha256 is ${got}, waiting for ${want} ............"
+    exit 2
+fi
+
+# the static pod reads the crl from the host cache
+KILLED="${CONF_HOME}/killed-cns"
+if [ -d "$HOST_CACHE" ]; then
+    mkdir -p "${HOST_CACHE}/crl"
+    for f in "$CRL" "$REVOKED" "$REVOKED_CNS"; do
+        name=$(basename "$f")
+        \cp -L "$f" "${HOST_CACHE}/crl/${name}.tmp"
+        mv -f "${HOST_CACHE}/crl/${name}.tmp" "${HOST_CACHE}/crl/${name}"
+    done
+    KILLED="${HOST_CACHE}/crl/killed-cns"
+fi
+
+# kill the sessions of the revoked common names only once,
+# openvpn rejects them when they reconnect
+touch "$KILLED"
+{
+    cat "$REVOKED_CNS"
+    jq -r '.[].commonName | select(. != null and . != "")' "$REVOKED"
+} | sort -u >"${KILLED}.want"
+comm -13 "$KILLED" "${KILLED}.want" | while read -r cn; do
+    [ -n "$cn" ] || continue
+    echo "kill ssl vpn client ${cn} sessions .............."
+    # the openvpn may be not started yet, it rejects the client anyway
+    if { exec 3<>"/dev/tcp/127.0.0.1/${MANAGEMENT_PORT}"; } 2>/dev/null; then
+        printf 'kill %s\nquit\n' "$cn" >&3
+        timeout 5 cat <&3 || true
+        exec 3<&-
+    fi
+done
+mv -f "${KILLED}.want" "$KILLED"
+echo "crl ${want} is ready .............."
@@ -28,6 +28,14 @@ rm -fr /etc/openvpn/*
 \cp -r /etc/host-init-openvpn/certs /etc/openvpn/
 mkdir -p /etc/openvpn/dh
 \cp /etc/host-init-openvpn/dh.pem /etc/openvpn/dh
+# link the crl so that openvpn reads the one updated by the daemonset pod
+if [ -d "/etc/host-init-openvpn/crl" ]; then
+    ln -sfn /etc/host-init-openvpn/crl /etc/openvpn/crl
+fi
+# link the client configs updated by the daemonset pod
+if [ -d "/etc/host-init-openvpn/ccd" ]; then
+    ln -sfn /etc/host-init-openvpn/ccd /etc/openvpn/ccd
+fi
 
 # start openvpn server
 echo "Running openvpn with config .............."
@@ -0,0 +1,18 @@
+#!/bin/bash
+set -eu
+# the controller runs this script to list the connected ssl vpn clients
+# print the openvpn management "status 3" output, the static pod shares the host network with the daemonset pod
+
+MANAGEMENT_PORT=${SSL_VPN_MANAGEMENT_PORT:-7505}
+
+exec 3<>"/dev/tcp/127.0.0.1/${MANAGEMENT_PORT}"
+printf 'status 3\nquit\n' >&3
+while IFS= read -r -t 5 line <&3; do
+    line=${line%$'\r'}
+    case "$line" in
+    ">INFO:"*) continue ;;
+    END) echo "$line"; break ;;
+    *) echo "$line" ;;
+    esac
+done
+exec 3<&-
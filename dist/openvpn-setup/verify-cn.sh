@@ -0,0 +1,18 @@
+#!/bin/bash
+# openvpn tls-verify script, $1 is the certificate depth
+# reject the client certificate whose common name is revoked in the vpn gw spec,
+# the revoked serial numbers are rejected by crl-verify
+
+CONF_HOME=${CONF_HOME:-/etc/openvpn}
+REVOKED_CNS="${CONF_HOME}/crl/revoked-cns"
+
+depth=${1:-}
+if [ "$depth" != "0" ]; then
+    exit 0
+fi
+cn=${X509_0_CN:-}
+if [ -n "$cn" ] && [ -f "$REVOKED_CNS" ] && grep -Fxq -- "$cn" "$REVOKED_CNS"; then
+    echo "reject revoked ssl vpn client ${cn}"
+    exit 1
+fi
+exit 0
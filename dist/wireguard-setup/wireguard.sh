@@ -0,0 +1,88 @@
+#!/bin/bash
+# do not trace, the private key is added to the runtime config
+set -eu
+# usage example:
+# the kube-combo controller renders wg0.conf without the private key into a secret mounted to ${RENDERED_HOME},
+# the private key secret is mounted to ${KEY_HOME}
+# bring up the interface and keep running
+# /wireguard.sh
+# reload the interface once the mounted wg0.conf matches the given sha256
+# /wireguard.sh reload 5f0c...e3a1
+
+RENDERED_HOME=${RENDERED_HOME:-/etc/wireguard/rendered}
+KEY_HOME=${KEY_HOME:-/etc/wireguard/key}
+IFACE=${IFACE:-wg0}
+CONF=/etc/wireguard/${IFACE}.conf
+
+function render() {
+	# add the private key to the rendered config
+	umask 077
+	sed "/^\[Interface\]$/a PrivateKey = $(cat "${KEY_HOME}/private-key")" "${RENDERED_HOME}/${IFACE}.conf" >"${CONF}"
+}
+
+function routes() {
+	# wg syncconf does not route the allowed ips of new peers
+	for cidr in $(wg show "${IFACE}" allowed-ips | cut -f2-); do
+		ip route replace "${cidr}" dev "${IFACE}"
+	done
+}
+
+function addresses() {
+	# wg syncconf keeps the addresses of the interface left by the previous host network pod
+	[ -n "${WIREGUARD_ADDRESS_CIDR:-}" ] || return 0
+	ip address flush dev "${IFACE}"
+	for cidr in ${WIREGUARD_ADDRESS_CIDR//,/ }; do
+		ip address add "${cidr}" dev "${IFACE}"
+	done
+}
+
+function up() {
+	render
+	if ip link show "${IFACE}" >/dev/null 2>&1; then
+		# daemonset pod runs in host network, the interface may be left by the previous pod
+		wg syncconf "${IFACE}" <(wg-quick strip "${IFACE}")
+		routes
+		return
+	fi
+	wg-quick up "${IFACE}"
+}
+
+function start() {
+	until [ -s "${RENDERED_HOME}/${IFACE}.conf" ] && [ -s "${KEY_HOME}/private-key" ]; do
+		echo "waiting for ${RENDERED_HOME}/${IFACE}.conf and ${KEY_HOME}/private-key"
+		sleep 2
+	done
+	up
+	addresses
+	trap 'wg-quick down "${IFACE}"; exit 0' TERM INT
+	sleep infinity &
+	wait $!
+}
+
+function reload() {
+	expected=$1
+	# kubelet syncs the secret volume periodically, make sure it is the latest one
+	actual=$(sha256sum "${RENDERED_HOME}/${IFACE}.conf" | awk '{print $1}')
+	if [ "${actual}" != "${expected}" ]; then
+		echo "${RENDERED_HOME}/${IFACE}.conf is not synced yet, expected ${expected}, got ${actual}"
+		exit 2
+	fi
+	up
+	wg show "${IFACE}"
+}
+
+if [ $# -eq 0 ]; then
+	start
+	exit 0
+fi
+
+opt=$1
+case $opt in
+reload)
+	reload "$2"
+	;;
+*)
+	echo "unknown option: $opt"
+	exit 1
+	;;
+esac
@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+// PodNetwork is the network of the vpn gw pods
+type PodNetwork struct {
+	// kube-ovn logical switch, or the network attachment definition of multus in [namespace/]name
+	Subnet string
+	// bandwidth of the traffic into and out of the pod in bits per second, nil means unlimited
+	Ingress *resource.Quantity
+	Egress  *resource.Quantity
+	// secondary interfaces attached by multus along with the subnet
+	Networks []myv1.VpnGwNetwork
+}
+
+// CNIProvider attaches the vpn gw pods to the network of the cni the cluster runs
+type CNIProvider interface {
+	// Name is the provider name of the vpn gw spec and the controller flag
+	Name() string
+	// PodAnnotations returns the pod annotations which attach the pod to the subnet and limit its bandwidth
+	PodAnnotations(network PodNetwork) map[string]string
+}
+
+// kubeOVNProvider attaches the pod to the kube-ovn logical switch and limits the bandwidth with ovs qos
+type kubeOVNProvider struct{}
+
+func (kubeOVNProvider) Name() string {
+	return myv1.CNIProviderKubeOVN
+}
+
+func (kubeOVNProvider) PodAnnotations(network PodNetwork) map[string]string {
+	annotations := map[string]string{
+		util.KubeovnLogicalSwitchAnnotation: network.Subnet,
+		util.KubeovnIngressRateAnnotation:   bandwidthMbps(network.Ingress),
+		util.KubeovnEgressRateAnnotation:    bandwidthMbps(network.Egress),
+	}
+	if networks := multusNetworks("", network.Networks); networks != "" {
+		annotations[util.MultusNetworksAnnotation] = networks
+	}
+	return annotations
+}
+
+// multusProvider attaches the network attachment definition as the secondary network of the pod,
+// the bandwidth is limited by the bandwidth plugin chained in the default network
+type multusProvider struct{}
+
+func (multusProvider) Name() string {
+	return myv1.CNIProviderMultus
+}
+
+func (multusProvider) PodAnnotations(network PodNetwork) map[string]string {
+	annotations := bandwidthAnnotations(network)
+	if networks := multusNetworks(network.Subnet, network.Networks); networks != "" {
+		annotations[util.MultusNetworksAnnotation] = networks
+	}
+	return annotations
+}
+
+// cniProvider only limits the bandwidth with the bandwidth plugin annotations,
+// the pod stays in the default network of the cni, eg: cilium, calico or flannel
+type cniProvider struct{}
+
+func (cniProvider) Name() string {
+	return myv1.CNIProviderCNI
+}
+
+func (cniProvider) PodAnnotations(network PodNetwork) map[string]string {
+	annotations := bandwidthAnnotations(network)
+	if networks := multusNetworks("", network.Networks); networks != "" {
+		annotations[util.MultusNetworksAnnotation] = networks
+	}
+	return annotations
+}
+
+// multusNetwork is the network selection element of the multus networks annotation
+type multusNetwork struct {
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace,omitempty"`
+	Interface string   `json:"interface,omitempty"`
+	IPs       []string `json:"ips,omitempty"`
+}
+
+// multusNetworks returns the multus networks annotation of the subnet and the secondary interfaces,
+// the subnet alone keeps the short form of [namespace/]name
+func multusNetworks(subnet string, networks []myv1.VpnGwNetwork) string {
+	if len(networks) == 0 {
+		return subnet
+	}
+	elements := make([]multusNetwork, 0, len(networks)+1)
+	if subnet != "" {
+		elements = append(elements, newMultusNetwork(subnet))
+	}
+	for _, network := range networks {
+		element := newMultusNetwork(network.Name)
+		element.Interface = network.Interface
+		element.IPs = network.IPs
+		elements = append(elements, element)
+	}
+	// the elements only hold strings, marshal never fails
+	buf, _ := json.Marshal(elements)
+	return string(buf)
+}
+
+func newMultusNetwork(name string) multusNetwork {
+	if namespace, name, found := strings.Cut(name, "/"); found {
+		return multusNetwork{Name: name, Namespace: namespace}
+	}
+	return multusNetwork{Name: name}
+}
+
+// bandwidthAnnotations returns the bandwidth plugin annotations in bits per second
+func bandwidthAnnotations(network PodNetwork) map[string]string {
+	annotations := map[string]string{}
+	if network.Ingress != nil {
+		annotations[util.BandwidthIngressAnnotation] = network.Ingress.String()
+	}
+	if network.Egress != nil {
+		annotations[util.BandwidthEgressAnnotation] = network.Egress.String()
+	}
+	return annotations
+}
+
+// bandwidthMbps returns the bandwidth in Mbps rounded up, kube-ovn takes an empty one as unlimited
+func bandwidthMbps(bandwidth *resource.Quantity) string {
+	if bandwidth == nil {
+		return ""
+	}
+	mbps := (bandwidth.Value() + 999999) / 1000000
+	return strconv.FormatInt(mbps, 10)
+}
+
+// podNetworkForVpnGw returns the network of the vpn gw pods in the subnet,
+// spec.qos overrides the bandwidth of qosBandwidth in each direction
+func podNetworkForVpnGw(gw *myv1.VpnGw, subnet string) PodNetwork {
+	network := PodNetwork{Subnet: subnet, Networks: gw.Spec.Networks}
+	if gw.Spec.QoSBandwidth != "" {
+		if bandwidth, err := resource.ParseQuantity(gw.Spec.QoSBandwidth + "M"); err == nil {
+			network.Ingress, network.Egress = &bandwidth, &bandwidth
+		}
+	}
+	if gw.Spec.QoS != nil {
+		if gw.Spec.QoS.Ingress != nil {
+			network.Ingress = gw.Spec.QoS.Ingress
+		}
+		if gw.Spec.QoS.Egress != nil {
+			network.Egress = gw.Spec.QoS.Egress
+		}
+	}
+	return network
+}
+
+var cniProviders = map[string]CNIProvider{
+	myv1.CNIProviderKubeOVN: kubeOVNProvider{},
+	myv1.CNIProviderMultus:  multusProvider{},
+	myv1.CNIProviderCNI:     cniProvider{},
+}
+
+// NewCNIProvider returns the cni provider of the name
+func NewCNIProvider(name string) (CNIProvider, error) {
+	provider, ok := cniProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown cni provider %q, should be %s, %s or %s", name, myv1.CNIProviderKubeOVN, myv1.CNIProviderMultus, myv1.CNIProviderCNI)
+	}
+	return provider, nil
+}
+
+// cniProviderForVpnGw returns the cni provider of the vpn gw, it defaults to the one of the controller flag
+func (r *VpnGwReconciler) cniProviderForVpnGw(gw *myv1.VpnGw) CNIProvider {
+	if provider, ok := cniProviders[gw.Spec.CNIProvider]; ok {
+		return provider
+	}
+	if r.CNIProvider != nil {
+		return r.CNIProvider
+	}
+	return kubeOVNProvider{}
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"maps"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+func TestCNIProviderPodAnnotations(t *testing.T) {
+	bandwidth := resource.MustParse("100M")
+	network := PodNetwork{Subnet: "vpn-gw-subnet", Ingress: &bandwidth, Egress: &bandwidth}
+	cases := []struct {
+		provider string
+		want     map[string]string
+	}{
+		{myv1.CNIProviderKubeOVN, map[string]string{
+			util.KubeovnLogicalSwitchAnnotation: "vpn-gw-subnet",
+			util.KubeovnIngressRateAnnotation:   "100",
+			util.KubeovnEgressRateAnnotation:    "100",
+		}},
+		{myv1.CNIProviderMultus, map[string]string{
+			util.MultusNetworksAnnotation:   "vpn-gw-subnet",
+			util.BandwidthIngressAnnotation: "100M",
+			util.BandwidthEgressAnnotation:  "100M",
+		}},
+		{myv1.CNIProviderCNI, map[string]string{
+			util.BandwidthIngressAnnotation: "100M",
+			util.BandwidthEgressAnnotation:  "100M",
+		}},
+	}
+	for _, c := range cases {
+		provider, err := NewCNIProvider(c.provider)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.provider, err)
+		}
+		if provider.Name() != c.provider {
+			t.Errorf("%s: unexpected name %s", c.provider, provider.Name())
+		}
+		if got := provider.PodAnnotations(network); !maps.Equal(got, c.want) {
+			t.Errorf("%s: expected annotations %v, got %v", c.provider, c.want, got)
+		}
+	}
+
+	if _, err := NewCNIProvider("calico"); err == nil {
+		t.Error("expected error for unknown cni provider")
+	}
+	if got := bandwidthAnnotations(PodNetwork{}); len(got) != 0 {
+		t.Errorf("expected no bandwidth annotations without qos, got %v", got)
+	}
+	egress := resource.MustParse("1G")
+	if got := bandwidthAnnotations(PodNetwork{Egress: &egress}); len(got) != 1 || got[util.BandwidthEgressAnnotation] != "1G" {
+		t.Errorf("expected the egress quantity only, got %v", got)
+	}
+
+	networks := []myv1.VpnGwNetwork{{Name: "kube-system/uplink", Interface: "net1", IPs: []string{"172.19.0.11/24"}}}
+	want := `[{"name":"vpn-gw-subnet"},{"name":"uplink","namespace":"kube-system","interface":"net1","ips":["172.19.0.11/24"]}]`
+	if got := multusNetworks("vpn-gw-subnet", networks); got != want {
+		t.Errorf("expected multus networks %s, got %s", want, got)
+	}
+	kubeOVN := kubeOVNProvider{}.PodAnnotations(PodNetwork{Subnet: "vpn-gw-subnet", Networks: networks})
+	if got := kubeOVN[util.MultusNetworksAnnotation]; got != `[{"name":"uplink","namespace":"kube-system","interface":"net1","ips":["172.19.0.11/24"]}]` {
+		t.Errorf("kube-ovn should attach the secondary interfaces only, got %s", got)
+	}
+
+	r := &VpnGwReconciler{CNIProvider: cniProvider{}}
+	if name := r.cniProviderForVpnGw(&myv1.VpnGw{}).Name(); name != myv1.CNIProviderCNI {
+		t.Errorf("expected the provider of the controller flag, got %s", name)
+	}
+	gw := &myv1.VpnGw{Spec: myv1.VpnGwSpec{CNIProvider: myv1.CNIProviderMultus}}
+	if name := r.cniProviderForVpnGw(gw).Name(); name != myv1.CNIProviderMultus {
+		t.Errorf("expected the provider of the vpn gw, got %s", name)
+	}
+}
+
+func TestPodNetworkForVpnGw(t *testing.T) {
+	quantity := func(s string) *resource.Quantity {
+		q := resource.MustParse(s)
+		return &q
+	}
+	cases := []struct {
+		name    string
+		spec    myv1.VpnGwSpec
+		ingress string
+		egress  string
+	}{
+		{name: "unlimited"},
+		{name: "qos bandwidth", spec: myv1.VpnGwSpec{QoSBandwidth: "100"}, ingress: "100", egress: "100"},
+		{name: "ingress only", spec: myv1.VpnGwSpec{QoS: &myv1.VpnGwQoS{Ingress: quantity("20M")}}, ingress: "20"},
+		{name: "override one direction", spec: myv1.VpnGwSpec{QoSBandwidth: "100", QoS: &myv1.VpnGwQoS{Egress: quantity("1500k")}}, ingress: "100", egress: "2"},
+	}
+	for _, c := range cases {
+		network := podNetworkForVpnGw(&myv1.VpnGw{Spec: c.spec}, "vpn-gw-subnet")
+		if network.Subnet != "vpn-gw-subnet" {
+			t.Errorf("%s: unexpected subnet %s", c.name, network.Subnet)
+		}
+		if got := bandwidthMbps(network.Ingress); got != c.ingress {
+			t.Errorf("%s: expected ingress %q Mbps, got %q", c.name, c.ingress, got)
+		}
+		if got := bandwidthMbps(network.Egress); got != c.egress {
+			t.Errorf("%s: expected egress %q Mbps, got %q", c.name, c.egress, got)
+		}
+	}
+}
+
+func TestSslVpnClientQoSEnv(t *testing.T) {
+	rate, burst := resource.MustParse("2M"), resource.MustParse("4M")
+	gw := &myv1.VpnGw{Spec: myv1.VpnGwSpec{QoS: &myv1.VpnGwQoS{SslVpnClientRate: &rate, SslVpnClientBurst: &burst}}}
+	if env := sslVpnClientQoSEnv(gw); len(env) != 0 {
+		t.Errorf("expected no env without the ssl vpn, got %v", env)
+	}
+	gw.Spec.EnableSslVpn = true
+	env := sslVpnClientQoSEnv(gw)
+	if len(env) != 2 || env[0].Name != util.SslVpnClientRateKey || env[0].Value != "250000b/s" ||
+		env[1].Name != util.SslVpnClientBurstKey || env[1].Value != "500000" {
+		t.Errorf("unexpected ssl vpn client qos env %v", env)
+	}
+}
@@ -58,6 +58,9 @@ type DebuggerReconciler struct {
 	Log        logr.Logger
 	Namespace  string
 	Reload     chan event.GenericEvent
+
+	// defaults of the objects created while the webhooks are disabled
+	Defaults myv1.DefaultOptions
 }
 
 // +kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=debuggers,verbs=get;list;watch;create;update;patch;delete
@@ -78,6 +81,7 @@ type DebuggerReconciler struct {
 // +kubebuilder:rbac:groups=core,resources=pods/exec,verbs=create
 // +kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
 // +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -130,6 +134,7 @@ func (r *DebuggerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		).
 		Owns(&appsv1.DaemonSet{}).  // for all node pod case
 		Owns(&appsv1.Deployment{}). // for single pod case
+		Owns(&corev1.Pod{}).        // the single pod is created without a deployment
 		Owns(&myv1.Pinger{}).
 		Complete(r)
 }
@@ -151,6 +156,7 @@ func (r *DebuggerReconciler) handleAddOrUpdateDebugger(ctx context.Context, req
 		// debugger deleted
 		return SyncStateSuccess, nil
 	}
+	debugger.SetDefaults(r.Defaults)
 	if err := r.validateDebugger(debugger); err != nil {
 		r.Log.Error(err, "failed to validate debugger")
 		// invalid spec, no retry
@@ -188,6 +194,7 @@ func (r *DebuggerReconciler) handleAddOrUpdateDebugger(ctx context.Context, req
 			r.Log.Error(err, "failed to get pinger")
 			return SyncStateError, err
 		}
+		pinger.SetDefaults(r.Defaults)
 		if err := r.validatePinger(pinger, debugger.Spec.EnablePinger); err != nil {
 			r.Log.Error(err, "failed to validate pinger")
 			// invalid spec no retry
@@ -459,7 +466,6 @@ func (r *DebuggerReconciler) handleAddOrUpdatePod(req ctrl.Request, debugger *my
 			r.Log.Error(err, "failed to create the new pod")
 			return err
 		}
-		time.Sleep(5 * time.Second)
 		return nil
 	}
 	// update
@@ -471,7 +477,6 @@ func (r *DebuggerReconciler) handleAddOrUpdatePod(req ctrl.Request, debugger *my
 			r.Log.Error(err, "failed to update the pod")
 			return err
 		}
-		time.Sleep(5 * time.Second)
 		return nil
 	}
 	// no change
@@ -502,7 +507,6 @@ func (r *DebuggerReconciler) handleAddOrUpdateDaemonset(req ctrl.Request, debugg
 			r.Log.Error(err, "failed to create the new daemonset")
 			return err
 		}
-		time.Sleep(5 * time.Second)
 		return nil
 	}
 	// update
@@ -514,7 +518,6 @@ func (r *DebuggerReconciler) handleAddOrUpdateDaemonset(req ctrl.Request, debugg
 			r.Log.Error(err, "failed to update the daemonset")
 			return err
 		}
-		time.Sleep(5 * time.Second)
 		return nil
 	}
 	// no change
@@ -3,34 +3,45 @@ package controller
 import (
 	"context"
 	"errors"
+	"reflect"
 
 	"github.com/go-logr/logr"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/ipsec"
 	"github.com/kubecombo/kube-combo/internal/util"
+	"github.com/kubecombo/kube-combo/internal/vici"
 )
 
 // IpsecConnReconciler reconciles a IpsecConn object
 type IpsecConnReconciler struct {
 	client.Client
-	Scheme    *runtime.Scheme
-	Log       logr.Logger
-	Namespace string
-	Reload    chan event.GenericEvent
+	Scheme     *runtime.Scheme
+	KubeClient kubernetes.Interface
+	RestConfig *rest.Config
+	Log        logr.Logger
+	Namespace  string
+	Reload     chan event.GenericEvent
 }
 
 //+kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=ipsecconns,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=ipsecconns/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=ipsecconns/finalizers,verbs=update
+//+kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=vpngws,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=pods/exec,verbs=create
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -124,9 +135,11 @@ func (r *IpsecConnReconciler) handleAddOrUpdateIpsecConnection(ctx context.Conte
 	}
 	if ipsecConn == nil {
 		// ipsecConn is deleted
-		// onwner reference will trigger vpn gw update ipsec connections
 		return SyncStateSuccess, nil
 	}
+	if !ipsecConn.DeletionTimestamp.IsZero() {
+		return r.handleDelIpsecConnection(ctx, ipsecConn)
+	}
 
 	// validate ipsecConn spec
 	if err := r.validateIpsecConnection(ipsecConn); err != nil {
@@ -136,9 +149,14 @@ func (r *IpsecConnReconciler) handleAddOrUpdateIpsecConnection(ctx context.Conte
 	}
 
 	// patch lable so that vpn gw can find its ipsec conns
+	// and finalizer to unload the connection from vpn gw pods before it is deleted
 	newConn := ipsecConn.DeepCopy()
 	labels := labelsForIpsecConnection(newConn)
 	newConn.SetLabels(labels)
+	controllerutil.AddFinalizer(newConn, util.IpsecConnFinalizer)
+	if reflect.DeepEqual(newConn.Labels, ipsecConn.Labels) && reflect.DeepEqual(newConn.Finalizers, ipsecConn.Finalizers) {
+		return SyncStateSuccess, nil
+	}
 	err = r.Patch(context.Background(), newConn, client.MergeFrom(ipsecConn))
 	if err != nil {
 		r.Log.Error(err, "failed to update the ipsecConn")
@@ -147,6 +165,61 @@ func (r *IpsecConnReconciler) handleAddOrUpdateIpsecConnection(ctx context.Conte
 	return SyncStateSuccess, err
 }
 
+// handleDelIpsecConnection terminates the sas and unloads the connection in every vpn gw pod,
+// the vpn gw renders its config without the deleting connection, so it will not be loaded again
+func (r *IpsecConnReconciler) handleDelIpsecConnection(ctx context.Context, ipsecConn *myv1.IpsecConn) (SyncState, error) {
+	if !controllerutil.ContainsFinalizer(ipsecConn, util.IpsecConnFinalizer) {
+		return SyncStateSuccess, nil
+	}
+	r.Log.Info("start handleDelIpsecConnection", "ipsecConn", ipsecConn.Name)
+	gw := &myv1.VpnGw{}
+	err := r.Get(ctx, types.NamespacedName{Name: ipsecConn.Spec.VpnGw, Namespace: ipsecConn.Namespace}, gw)
+	if err != nil && !apierrors.IsNotFound(err) {
+		r.Log.Error(err, "failed to get vpn gw", "vpn gw", ipsecConn.Spec.VpnGw)
+		return SyncStateError, err
+	}
+	// nothing to unload if vpn gw is gone or its ipsec vpn is disabled
+	if err == nil && gw.Spec.EnableIPSecVpn {
+		pods, err := getRunningIPSecPods(ctx, r.Client, gw)
+		if err != nil {
+			r.Log.Error(err, "failed to list vpn gw pods", "vpn gw", gw.Name)
+			return SyncStateError, err
+		}
+		ikeName := ipsec.Connection{Name: ipsecConn.Name, Auth: ipsecConn.Spec.Auth}.IkeName()
+		for _, pod := range pods {
+			if err := r.unloadIpsecConnection(ctx, pod.Namespace, pod.Name, ikeName); err != nil {
+				r.Log.Error(err, "failed to unload ipsec connection", "pod", pod.Name, "ike", ikeName)
+				return SyncStateError, err
+			}
+			r.Log.Info("unload ipsec connection ok", "pod", pod.Name, "ike", ikeName)
+		}
+	}
+
+	newConn := ipsecConn.DeepCopy()
+	controllerutil.RemoveFinalizer(newConn, util.IpsecConnFinalizer)
+	if err := r.Patch(ctx, newConn, client.MergeFromWithOptions(ipsecConn, client.MergeFromWithOptimisticLock{})); err != nil {
+		r.Log.Error(err, "failed to remove ipsecConn finalizer")
+		return SyncStateError, err
+	}
+	return SyncStateSuccess, nil
+}
+
+func (r *IpsecConnReconciler) unloadIpsecConnection(ctx context.Context, namespace, pod, ikeName string) error {
+	session, err := dialVici(ctx, r.KubeClient, r.RestConfig, namespace, pod)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	// do not wait for the peer to confirm the delete
+	if err := session.Terminate(ikeName, "", -1); err != nil && !vici.IsNotFound(err) {
+		return err
+	}
+	if err := session.UnloadConn(ikeName); err != nil && !vici.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
 func (r *IpsecConnReconciler) getIpsecConnection(ctx context.Context, name types.NamespacedName) (*myv1.IpsecConn, error) {
 	var res myv1.IpsecConn
 	err := r.Get(ctx, name, &res)
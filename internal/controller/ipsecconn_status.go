@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/ipsec"
+	"github.com/kubecombo/kube-combo/internal/vici"
+)
+
+// ipsecPodState is the strongswan state queried from one ipsec vpn gw pod
+type ipsecPodState struct {
+	pod   string
+	conns map[string]bool
+	sas   []vici.IkeSA
+}
+
+// pollIPSecConnStatus refreshes the status of all ipsec connections until the manager stops
+func (r *VpnGwReconciler) pollIPSecConnStatus(ctx context.Context) error {
+	wait.UntilWithContext(ctx, r.syncIPSecConnStatus, r.IPSecStatusInterval)
+	return nil
+}
+
+func (r *VpnGwReconciler) syncIPSecConnStatus(ctx context.Context) {
+	gws := &myv1.VpnGwList{}
+	if err := r.List(ctx, gws); err != nil {
+		r.Log.Error(err, "failed to list vpn gw")
+		return
+	}
+	for i := range gws.Items {
+		gw := &gws.Items[i]
+		if !gw.Spec.EnableIPSecVpn {
+			continue
+		}
+		if err := r.syncVpnGwIPSecConnStatus(ctx, gw); err != nil {
+			r.Log.Error(err, "failed to sync ipsec connection status", "vpn gw", gw.Name)
+		}
+	}
+}
+
+func (r *VpnGwReconciler) syncVpnGwIPSecConnStatus(ctx context.Context, gw *myv1.VpnGw) error {
+	conns, err := r.getIpsecConnections(ctx, gw)
+	if err != nil {
+		return err
+	}
+	if len(*conns) == 0 {
+		return nil
+	}
+	states, err := r.getIPSecPodStates(ctx, gw)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range *conns {
+		conn := &(*conns)[i]
+		newConn := conn.DeepCopy()
+		setIpsecConnStatus(newConn, states, now)
+		if reflect.DeepEqual(conn.Status, newConn.Status) {
+			continue
+		}
+		if err := r.Status().Update(ctx, newConn); err != nil {
+			r.Log.Error(err, "failed to update ipsec connection status", "ipsecConn", conn.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+// getIPSecPodStates queries loaded connections and sas in every running ipsec vpn gw pod
+func (r *VpnGwReconciler) getIPSecPodStates(ctx context.Context, gw *myv1.VpnGw) ([]ipsecPodState, error) {
+	pods, err := getRunningIPSecPods(ctx, r.Client, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to list pods", "namespace", gw.Namespace)
+		return nil, err
+	}
+	states := []ipsecPodState{}
+	for _, pod := range pods {
+		state, err := r.getIPSecPodState(ctx, pod.Namespace, pod.Name)
+		if err != nil {
+			r.Log.Error(err, "skip pod", "pod", pod.Name)
+			continue
+		}
+		states = append(states, *state)
+	}
+	return states, nil
+}
+
+func (r *VpnGwReconciler) getIPSecPodState(ctx context.Context, namespace, pod string) (*ipsecPodState, error) {
+	session, err := dialVici(ctx, r.KubeClient, r.RestConfig, namespace, pod)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	conns, err := session.GetConns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ipsec conns: %w", err)
+	}
+	sas, err := session.ListSas("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ipsec sas: %w", err)
+	}
+	state := &ipsecPodState{
+		pod:   pod,
+		conns: map[string]bool{},
+		sas:   sas,
+	}
+	for _, name := range conns {
+		state.conns[name] = true
+	}
+	return state, nil
+}
+
+// setIpsecConnStatus reports the state of the pod which has the best view of the connection,
+// with keepalived only the pod holding the vip establishes the tunnel
+func setIpsecConnStatus(conn *myv1.IpsecConn, states []ipsecPodState, now time.Time) {
+	ikeName := ipsec.Connection{Name: conn.Name, Auth: conn.Spec.Auth}.IkeName()
+	var (
+		pod        string
+		configured bool
+		ike        *vici.IkeSA
+		child      *vici.ChildSA
+		best       = -1
+	)
+	for _, state := range states {
+		score := 0
+		var stateIke *vici.IkeSA
+		var stateChild *vici.ChildSA
+		if state.conns[ikeName] {
+			score = 1
+		}
+		for i := range state.sas {
+			sa := &state.sas[i]
+			if sa.Name != ikeName {
+				continue
+			}
+			if stateIke == nil || sa.Established() {
+				stateIke = sa
+			}
+			if sa.Established() {
+				score = max(score, 2)
+				if c := sa.InstalledChild(); c != nil {
+					score = 3
+					stateChild = c
+					stateIke = sa
+					break
+				}
+			}
+		}
+		if score > best {
+			best = score
+			pod = state.pod
+			configured = state.conns[ikeName]
+			ike = stateIke
+			child = stateChild
+		}
+	}
+
+	conn.Status.Pod = pod
+	configuredCond := metav1.Condition{
+		Type:               myv1.IpsecConnConfigured,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: conn.Generation,
+		Reason:             "Loaded",
+		Message:            fmt.Sprintf("connection %s is loaded", ikeName),
+	}
+	if !configured {
+		configuredCond.Status = metav1.ConditionFalse
+		configuredCond.Reason = "NotLoaded"
+		configuredCond.Message = fmt.Sprintf("connection %s is not loaded", ikeName)
+		if len(states) == 0 {
+			configuredCond.Reason = "NoRunningPod"
+			configuredCond.Message = "no running ipsec vpn gw pod"
+		}
+	}
+	meta.SetStatusCondition(&conn.Status.Conditions, configuredCond)
+
+	ikeCond := metav1.Condition{
+		Type:               myv1.IpsecConnIKEEstablished,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: conn.Generation,
+		Reason:             "NotFound",
+		Message:            "ike sa not found",
+	}
+	if ike != nil {
+		ikeCond.Reason = "NotEstablished"
+		ikeCond.Message = fmt.Sprintf("ike sa is %s", ike.State)
+		if ike.Established() {
+			ikeCond.Status = metav1.ConditionTrue
+			ikeCond.Reason = "Established"
+		}
+	}
+	meta.SetStatusCondition(&conn.Status.Conditions, ikeCond)
+
+	childCond := metav1.Condition{
+		Type:               myv1.IpsecConnChildSAInstalled,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: conn.Generation,
+		Reason:             "NotInstalled",
+		Message:            "child sa is not installed",
+	}
+	if child != nil {
+		childCond.Status = metav1.ConditionTrue
+		childCond.Reason = "Installed"
+		childCond.Message = fmt.Sprintf("child sa %s is installed", child.Name)
+		rekeyTime := metav1.NewTime(now.Add(-child.InstallTime).Truncate(time.Second))
+		// the installed time is reported in seconds, ignore the jitter between two queries
+		if last := conn.Status.LastRekeyTime; last == nil || rekeyTime.Sub(last.Time).Abs() > 2*time.Second {
+			conn.Status.LastRekeyTime = &rekeyTime
+		}
+		conn.Status.BytesIn = child.BytesIn
+		conn.Status.BytesOut = child.BytesOut
+	} else {
+		conn.Status.BytesIn = 0
+		conn.Status.BytesOut = 0
+	}
+	meta.SetStatusCondition(&conn.Status.Conditions, childCond)
+}
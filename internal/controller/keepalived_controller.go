@@ -19,20 +19,23 @@ package controller
 import (
 	"context"
 	"errors"
+	"maps"
+	"reflect"
 
 	"github.com/go-logr/logr"
-	"github.com/scylladb/go-set/iset"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/util"
 )
 
 // KeepAlivedReconciler reconciles a KeepAlived object
@@ -47,6 +50,7 @@ type KeepAlivedReconciler struct {
 //+kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=keepaliveds,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=keepaliveds/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=keepaliveds/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -121,56 +125,84 @@ func (r *KeepAlivedReconciler) handleAddOrUpdateKeepAlived(ctx context.Context,
 		// ka is deleted
 		return SyncStateSuccess, nil
 	}
-	if ka.Status.RouterID != 0 {
-		// ka is already handled
-		return SyncStateSuccess, nil
+	if !ka.DeletionTimestamp.IsZero() {
+		return r.handleDelKeepAlived(ctx, ka)
 	}
 
-	if err = r.setRouterID(ctx, ka); err != nil {
-		r.Log.Error(err, "failed to set router id")
-		return SyncStateErrorNoRetry, err
+	// the keepalived without the finalizer is created before the router ids are reserved in the config map
+	if !routerIDsAllocated(ka) || !controllerutil.ContainsFinalizer(ka, util.KeepAlivedFinalizer) {
+		if err = r.setRouterID(ctx, ka); err != nil {
+			r.Log.Error(err, "failed to set router id")
+			if errors.Is(err, errRouterIDsExhausted) {
+				return SyncStateErrorNoRetry, err
+			}
+			// the conflicts and the other api errors are transient, allocate again with the latest config map
+			return SyncStateError, err
+		}
 	}
 
+	// patch the subnet label so that the keepalived of a subnet can be listed,
+	// and finalizer to release the router ids before it is deleted
+	newKa := ka.DeepCopy()
+	labels := maps.Clone(newKa.Labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[util.SubnetLabel] = ka.Spec.Subnet
+	newKa.SetLabels(labels)
+	controllerutil.AddFinalizer(newKa, util.KeepAlivedFinalizer)
+	if reflect.DeepEqual(newKa.Labels, ka.Labels) && reflect.DeepEqual(newKa.Finalizers, ka.Finalizers) {
+		return SyncStateSuccess, nil
+	}
+	if err = r.Patch(ctx, newKa, client.MergeFrom(ka)); err != nil {
+		r.Log.Error(err, "failed to patch keepalived labels and finalizer")
+		return SyncStateError, err
+	}
 	return SyncStateSuccess, nil
 }
 
-func (r *KeepAlivedReconciler) setRouterID(ctx context.Context, ka *myv1.KeepAlived) error {
-	assignedIDs := []int{}
-	kas, err := r.listKeepAlived(ctx, ka.Namespace)
-	if err != nil {
-		r.Log.Error(err, "failed to list keepaliveds")
-		return err
+// handleDelKeepAlived releases the router ids of the keepalived before it is deleted
+func (r *KeepAlivedReconciler) handleDelKeepAlived(ctx context.Context, ka *myv1.KeepAlived) (SyncState, error) {
+	if !controllerutil.ContainsFinalizer(ka, util.KeepAlivedFinalizer) {
+		return SyncStateSuccess, nil
 	}
-	for _, ka := range *kas {
-		if ka.Status.RouterID != 0 {
-			assignedIDs = append(assignedIDs, ka.Status.RouterID)
-		}
+	r.Log.Info("start handleDelKeepAlived", "keepalived", ka.Name)
+	subnets := []string{ka.Spec.Subnet}
+	if ka.Status.Subnet != ka.Spec.Subnet {
+		subnets = append(subnets, ka.Status.Subnet)
 	}
-	id, err := findNextAvailableID(assignedIDs)
-	if err != nil {
-		r.Log.Error(err, "failed to find next available id")
-		return err
+	for _, subnet := range subnets {
+		if err := r.releaseRouterIDs(ctx, ka, subnet); err != nil {
+			return SyncStateError, err
+		}
 	}
-	ka.Status.RouterID = id
-	err = r.Update(ctx, ka)
-	if err != nil {
-		r.Log.Error(err, "failed to update keepalived router id")
-		return err
+
+	newKa := ka.DeepCopy()
+	controllerutil.RemoveFinalizer(newKa, util.KeepAlivedFinalizer)
+	if err := r.Patch(ctx, newKa, client.MergeFromWithOptions(ka, client.MergeFromWithOptimisticLock{})); err != nil {
+		r.Log.Error(err, "failed to remove keepalived finalizer")
+		return SyncStateError, err
 	}
-	return nil
+	return SyncStateSuccess, nil
 }
 
-func findNextAvailableID(usedIDs []int) (int, error) {
-	if len(usedIDs) == 0 {
-		return 1, nil
+// routerIDsAllocated reports whether every vrrp instance has a router id in the subnet
+// and the ids of the removed instances are released
+func routerIDsAllocated(ka *myv1.KeepAlived) bool {
+	instances := ka.VrrpInstances()
+	if len(instances) == 0 {
+		// nothing to allocate for the invalid keepalived without vips
+		return true
+	}
+	if ka.Status.Subnet != ka.Spec.Subnet || ka.Status.RouterID == 0 || len(ka.Status.RouterIDs) != len(instances) {
+		return false
 	}
-	usedSet := iset.New(usedIDs...)
-	for i := 1; i <= 255; i++ {
-		if !usedSet.Has(i) {
-			return i, nil
+	for _, instance := range instances {
+		if ka.Status.RouterIDs[instance.Name] == 0 {
+			return false
 		}
 	}
-	return 0, errors.New("cannot allocate more than 255 ids in one keepalived group")
+	return true
 }
 
 func (r *KeepAlivedReconciler) getKeepAlived(ctx context.Context, name types.NamespacedName) (*myv1.KeepAlived, error) {
@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/scylladb/go-set/iset"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+const maxRouterID = 255
+
+// errRouterIDsExhausted is not retried, the keepalived is reconciled again once it is updated
+var errRouterIDsExhausted = errors.New("cannot allocate more than 255 ids in one subnet")
+
+// routerIDConfigMapName returns the config map the router ids of the subnet are allocated in,
+// the keepalived without subnet runs in the host network and shares the one without suffix
+func routerIDConfigMapName(subnet string) string {
+	if subnet == "" {
+		return util.KeepAlivedRouterIDConfigMapPrefix
+	}
+	return util.KeepAlivedRouterIDConfigMapPrefix + "-" + subnet
+}
+
+// routerIDOwner returns the value of the allocated router id, the instance name never contains a slash
+func routerIDOwner(ka *myv1.KeepAlived, instance string) string {
+	return fmt.Sprintf("%s/%s/%s", ka.Namespace, ka.Name, instance)
+}
+
+// routerIDOwnerKeepAlived returns the namespaced name of the keepalived which owns the router id
+func routerIDOwnerKeepAlived(owner string) string {
+	i := strings.LastIndex(owner, "/")
+	if i < 0 {
+		return owner
+	}
+	return owner[:i]
+}
+
+// allocateRouterIDs allocates the router ids of the keepalived instances in the subnet allocation,
+// the allocation is keyed by the router id and valued by the owner instance, it is modified in place.
+// the current ids are kept if they are free in the subnet to avoid moving the vips,
+// the ids of the removed instances and of the keepalived which no longer exist are released
+func allocateRouterIDs(allocation map[string]string, ka *myv1.KeepAlived, current map[string]int, exist func(keepalived string) bool) (map[string]int, error) {
+	instances := ka.VrrpInstances()
+	owners := make(map[string]string, len(instances))
+	for _, instance := range instances {
+		owners[routerIDOwner(ka, instance.Name)] = instance.Name
+	}
+	prefix := fmt.Sprintf("%s/%s/", ka.Namespace, ka.Name)
+	for id, owner := range allocation {
+		if strings.HasPrefix(owner, prefix) {
+			if _, ok := owners[owner]; !ok {
+				delete(allocation, id)
+			}
+			continue
+		}
+		if !exist(routerIDOwnerKeepAlived(owner)) {
+			delete(allocation, id)
+		}
+	}
+
+	allocated := make(map[string]int, len(instances))
+	// the ids reserved in the allocation win, the status may be lost before it is updated
+	for id, owner := range allocation {
+		instance, ok := owners[owner]
+		n, err := strconv.Atoi(id)
+		if !ok || err != nil {
+			continue
+		}
+		if prev := allocated[instance]; prev == 0 || n == current[instance] || prev != current[instance] && n < prev {
+			allocated[instance] = n
+		}
+	}
+	for _, instance := range instances {
+		id := current[instance.Name]
+		if allocated[instance.Name] != 0 || id < 1 || id > maxRouterID {
+			continue
+		}
+		if _, used := allocation[strconv.Itoa(id)]; !used {
+			allocated[instance.Name] = id
+		}
+	}
+	for _, instance := range instances {
+		if allocated[instance.Name] != 0 {
+			allocation[strconv.Itoa(allocated[instance.Name])] = routerIDOwner(ka, instance.Name)
+		}
+	}
+	for _, instance := range instances {
+		if allocated[instance.Name] != 0 {
+			continue
+		}
+		usedIDs := make([]int, 0, len(allocation))
+		for id := range allocation {
+			if n, err := strconv.Atoi(id); err == nil {
+				usedIDs = append(usedIDs, n)
+			}
+		}
+		id, err := findNextAvailableID(usedIDs)
+		if err != nil {
+			return nil, err
+		}
+		allocated[instance.Name] = id
+		allocation[strconv.Itoa(id)] = routerIDOwner(ka, instance.Name)
+	}
+	// release the stale ids of the instances which got another one
+	for id, owner := range allocation {
+		if instance, ok := owners[owner]; ok && strconv.Itoa(allocated[instance]) != id {
+			delete(allocation, id)
+		}
+	}
+	return allocated, nil
+}
+
+func findNextAvailableID(usedIDs []int) (int, error) {
+	if len(usedIDs) == 0 {
+		return 1, nil
+	}
+	usedSet := iset.New(usedIDs...)
+	for i := 1; i <= maxRouterID; i++ {
+		if !usedSet.Has(i) {
+			return i, nil
+		}
+	}
+	return 0, errRouterIDsExhausted
+}
+
+// getRouterIDConfigMap returns the router id allocation of the subnet, it is created if not found,
+// the creation of the same config map by another reconcile fails and the keepalived is requeued
+func (r *KeepAlivedReconciler) getRouterIDConfigMap(ctx context.Context, subnet string, create bool) (*corev1.ConfigMap, error) {
+	cm := &corev1.ConfigMap{}
+	name := types.NamespacedName{Name: routerIDConfigMapName(subnet), Namespace: r.Namespace}
+	err := r.Get(ctx, name, cm)
+	if err == nil {
+		return cm, nil
+	}
+	if !apierrors.IsNotFound(err) || !create {
+		return nil, err
+	}
+	cm = &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.Name,
+			Namespace: name.Namespace,
+			Labels:    map[string]string{util.SubnetLabel: subnet},
+		},
+	}
+	if err = r.Create(ctx, cm); err != nil {
+		return nil, err
+	}
+	return cm, nil
+}
+
+// setRouterID allocates a router id for each vrrp instance in the config map of the subnet,
+// the config map is updated with its resource version, a conflict requeues the keepalived to allocate again.
+// the allocated ids are written through the status subresource after they are reserved in the config map
+func (r *KeepAlivedReconciler) setRouterID(ctx context.Context, ka *myv1.KeepAlived) error {
+	kas, err := r.listKeepAlived(ctx, "")
+	if err != nil {
+		r.Log.Error(err, "failed to list keepaliveds")
+		return err
+	}
+	exist := make(map[string]bool, len(*kas))
+	for _, other := range *kas {
+		exist[types.NamespacedName{Namespace: other.Namespace, Name: other.Name}.String()] = true
+	}
+	cm, err := r.getRouterIDConfigMap(ctx, ka.Spec.Subnet, true)
+	if err != nil {
+		r.Log.Error(err, "failed to get router id config map", "subnet", ka.Spec.Subnet)
+		return err
+	}
+	allocation := maps.Clone(cm.Data)
+	if allocation == nil {
+		allocation = make(map[string]string)
+	}
+	routerIDs, err := allocateRouterIDs(allocation, ka, ka.Status.RouterIDs, func(keepalived string) bool { return exist[keepalived] })
+	if err != nil {
+		r.Log.Error(err, "failed to allocate router ids", "subnet", ka.Spec.Subnet)
+		return err
+	}
+	if !maps.Equal(allocation, cm.Data) {
+		cm.Data = allocation
+		if err = r.Update(ctx, cm); err != nil {
+			r.Log.Error(err, "failed to reserve router ids", "subnet", ka.Spec.Subnet)
+			return err
+		}
+	}
+	if ka.Status.Subnet != ka.Spec.Subnet && len(ka.Status.RouterIDs) != 0 {
+		// the ids in the old subnet are released once the ones in the new subnet are reserved
+		if err = r.releaseRouterIDs(ctx, ka, ka.Status.Subnet); err != nil {
+			return err
+		}
+	}
+
+	instances := ka.VrrpInstances()
+	newKa := ka.DeepCopy()
+	newKa.Status.RouterIDs = routerIDs
+	newKa.Status.Subnet = ka.Spec.Subnet
+	newKa.Status.RouterID = 0
+	if len(instances) != 0 {
+		newKa.Status.RouterID = routerIDs[instances[0].Name]
+	}
+	if err = r.Status().Update(ctx, newKa); err != nil {
+		r.Log.Error(err, "failed to update keepalived router id")
+		return err
+	}
+	return nil
+}
+
+// releaseRouterIDs releases all the router ids of the keepalived in the subnet
+func (r *KeepAlivedReconciler) releaseRouterIDs(ctx context.Context, ka *myv1.KeepAlived, subnet string) error {
+	cm, err := r.getRouterIDConfigMap(ctx, subnet, false)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		r.Log.Error(err, "failed to get router id config map", "subnet", subnet)
+		return err
+	}
+	prefix := fmt.Sprintf("%s/%s/", ka.Namespace, ka.Name)
+	allocation := maps.Clone(cm.Data)
+	maps.DeleteFunc(allocation, func(_, owner string) bool { return strings.HasPrefix(owner, prefix) })
+	if maps.Equal(allocation, cm.Data) {
+		return nil
+	}
+	cm.Data = allocation
+	if err = r.Update(ctx, cm); err != nil {
+		r.Log.Error(err, "failed to release router ids", "subnet", subnet)
+		return err
+	}
+	r.Log.Info("released router ids", "keepalived", ka.Name, "subnet", subnet)
+	return nil
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"errors"
+	"maps"
+	"strconv"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+)
+
+func TestAllocateRouterIDs(t *testing.T) {
+	keepalived := func(name string, instances ...string) *myv1.KeepAlived {
+		ka := &myv1.KeepAlived{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+		for _, instance := range instances {
+			ka.Spec.Instances = append(ka.Spec.Instances, myv1.KeepAlivedInstance{Name: instance, Vips: []myv1.KeepAlivedVip{{IP: "10.1.0.100"}}})
+		}
+		return ka
+	}
+	exist := func(kas ...string) func(string) bool {
+		return func(ka string) bool {
+			for _, k := range kas {
+				if k == ka {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	cases := []struct {
+		name       string
+		ka         *myv1.KeepAlived
+		allocation map[string]string
+		current    map[string]int
+		exist      []string
+		want       map[string]int
+		wantAlloc  map[string]string
+	}{
+		{
+			name:       "first free ids",
+			ka:         keepalived("ka1", "public", "internal"),
+			allocation: map[string]string{"1": "default/ka0/public"},
+			exist:      []string{"default/ka0"},
+			want:       map[string]int{"public": 2, "internal": 3},
+			wantAlloc:  map[string]string{"1": "default/ka0/public", "2": "default/ka1/public", "3": "default/ka1/internal"},
+		},
+		{
+			name:       "keep the current free id",
+			ka:         keepalived("ka1", "public"),
+			allocation: map[string]string{"1": "default/ka0/public"},
+			current:    map[string]int{"public": 7},
+			exist:      []string{"default/ka0"},
+			want:       map[string]int{"public": 7},
+			wantAlloc:  map[string]string{"1": "default/ka0/public", "7": "default/ka1/public"},
+		},
+		{
+			name:       "current id taken by another keepalived",
+			ka:         keepalived("ka1", "public"),
+			allocation: map[string]string{"1": "default/ka0/public"},
+			current:    map[string]int{"public": 1},
+			exist:      []string{"default/ka0"},
+			want:       map[string]int{"public": 2},
+			wantAlloc:  map[string]string{"1": "default/ka0/public", "2": "default/ka1/public"},
+		},
+		{
+			name:       "reserved id wins over the lost status",
+			ka:         keepalived("ka1", "public"),
+			allocation: map[string]string{"5": "default/ka1/public"},
+			want:       map[string]int{"public": 5},
+			wantAlloc:  map[string]string{"5": "default/ka1/public"},
+		},
+		{
+			name:       "release removed instances and deleted keepalived",
+			ka:         keepalived("ka1", "public"),
+			allocation: map[string]string{"1": "default/ka0/public", "2": "default/ka1/public", "3": "default/ka1/internal"},
+			current:    map[string]int{"public": 2, "internal": 3},
+			want:       map[string]int{"public": 2},
+			wantAlloc:  map[string]string{"2": "default/ka1/public"},
+		},
+		{
+			name:       "same name in another namespace",
+			ka:         keepalived("ka1", "public"),
+			allocation: map[string]string{"1": "other/ka1/public"},
+			exist:      []string{"other/ka1"},
+			want:       map[string]int{"public": 2},
+			wantAlloc:  map[string]string{"1": "other/ka1/public", "2": "default/ka1/public"},
+		},
+	}
+	for _, c := range cases {
+		allocation := maps.Clone(c.allocation)
+		got, err := allocateRouterIDs(allocation, c.ka, c.current, exist(c.exist...))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if !maps.Equal(got, c.want) {
+			t.Errorf("%s: expected router ids %v, got %v", c.name, c.want, got)
+		}
+		if !maps.Equal(allocation, c.wantAlloc) {
+			t.Errorf("%s: expected allocation %v, got %v", c.name, c.wantAlloc, allocation)
+		}
+	}
+
+	full := make(map[string]string)
+	for id := 1; id <= maxRouterID; id++ {
+		full[strconv.Itoa(id)] = "default/ka0/public"
+	}
+	if _, err := allocateRouterIDs(full, keepalived("ka1", "public"), nil, exist("default/ka0")); !errors.Is(err, errRouterIDsExhausted) {
+		t.Errorf("expected error when the subnet runs out of router ids, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net/url"
 	"strings"
@@ -80,3 +81,69 @@ func execute(method string, url *url.URL, cfg *rest.Config, stdin io.Reader, std
 		Tty:    tty,
 	})
 }
+
+// execConn is a stream to a command running in a container, its stdin and stdout are used as the connection
+type execConn struct {
+	stdin  *io.PipeWriter
+	stdout *io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (c *execConn) Read(p []byte) (int, error) {
+	return c.stdout.Read(p)
+}
+
+func (c *execConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+func (c *execConn) Close() error {
+	err := c.stdin.Close()
+	c.cancel()
+	return err
+}
+
+// DialInContainer runs a relay command in the container, and returns a connection to its stdin and stdout
+func DialInContainer(ctx context.Context, client kubernetes.Interface, cfg *rest.Config, namespace, podName, containerName string, cmd ...string) (io.ReadWriteCloser, error) {
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec").
+		Param("container", containerName)
+
+	req.VersionedParams(&corev1.PodExecOptions{
+		Stdin:     true,
+		Stdout:    true,
+		Stderr:    true,
+		TTY:       false,
+		Container: containerName,
+		Command:   cmd,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(cfg, "POST", req.URL())
+	if err != nil {
+		klog.Errorf("remotecommand.NewSPDYExecutor error: %v", err)
+		return nil, err
+	}
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		var stderr bytes.Buffer
+		err := exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+			Stdin:  stdinReader,
+			Stdout: stdoutWriter,
+			Stderr: &stderr,
+		})
+		if err == nil {
+			err = io.EOF
+		} else if stderr.Len() > 0 {
+			err = fmt.Errorf("%w, errOutput: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		_ = stdoutWriter.CloseWithError(err)
+		_ = stdinReader.CloseWithError(err)
+		cancel()
+	}()
+	return &execConn{stdin: stdinWriter, stdout: stdoutReader, cancel: cancel}, nil
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/metrics"
+	"github.com/kubecombo/kube-combo/internal/sslvpn"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+// pollSslVpnClientStatus refreshes the connected ssl vpn clients until the manager stops
+func (r *VpnGwReconciler) pollSslVpnClientStatus(ctx context.Context) error {
+	metrics.InitSslVpnMetrics()
+	// the vpn gws whose clients were exported last time
+	exported := map[types.NamespacedName]bool{}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		exported = r.syncSslVpnClientStatus(ctx, exported)
+	}, r.SslVpnStatusInterval)
+	return nil
+}
+
+func (r *VpnGwReconciler) syncSslVpnClientStatus(ctx context.Context, exported map[types.NamespacedName]bool) map[types.NamespacedName]bool {
+	gws := &myv1.VpnGwList{}
+	if err := r.List(ctx, gws); err != nil {
+		r.Log.Error(err, "failed to list vpn gw")
+		return exported
+	}
+	synced := map[types.NamespacedName]bool{}
+	for i := range gws.Items {
+		gw := &gws.Items[i]
+		if !gw.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if !gw.Spec.EnableSslVpn {
+			if gw.Status.SslVpnConnectedClients != 0 || len(gw.Status.SslVpnClients) != 0 {
+				newGw := gw.DeepCopy()
+				setSslVpnClientStatus(&newGw.Status, nil)
+				if err := r.Status().Update(ctx, newGw); err != nil {
+					r.Log.Error(err, "failed to clear ssl vpn client status", "vpn gw", gw.Name)
+				}
+			}
+			continue
+		}
+		name := types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace}
+		synced[name] = true
+		if err := r.syncVpnGwSslVpnClientStatus(ctx, gw); err != nil {
+			r.Log.Error(err, "failed to sync ssl vpn client status", "vpn gw", gw.Name)
+		}
+	}
+	for name := range exported {
+		if !synced[name] {
+			metrics.DeleteSslVpnClients(name.Namespace, name.Name)
+		}
+	}
+	return synced
+}
+
+func (r *VpnGwReconciler) syncVpnGwSslVpnClientStatus(ctx context.Context, gw *myv1.VpnGw) error {
+	podNames, err := r.getContainerPodNames(ctx, gw, util.SslVpnServer)
+	if err != nil {
+		// keep the last known clients until all pods are running
+		r.Log.Info("skip ssl vpn client status", "vpn gw", gw.Name, "reason", err.Error())
+		return nil
+	}
+	clients := []metrics.SslVpnClient{}
+	for _, podName := range podNames {
+		stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, gw.Namespace, podName, util.SslVpnServer, []string{"/bin/bash", "-c", util.SslVpnStatusCmd}...)
+		if err != nil {
+			// openvpn may be not started yet, eg. the static pod is starting
+			r.Log.Error(fmt.Errorf("%w, stdout: %s, stderr: %s", err, stdOutput, errOutput), "skip pod", "pod", podName)
+			continue
+		}
+		connected, err := sslvpn.ParseStatus(stdOutput)
+		if err != nil {
+			r.Log.Error(err, "failed to parse ssl vpn status", "pod", podName)
+			continue
+		}
+		for _, c := range connected {
+			clients = append(clients, metrics.SslVpnClient{
+				Pod:            podName,
+				CommonName:     c.CommonName,
+				RealAddress:    c.RealAddress,
+				VirtualAddress: c.VirtualAddress,
+				BytesReceived:  c.BytesReceived,
+				BytesSent:      c.BytesSent,
+				ConnectedSince: c.ConnectedSince,
+			})
+		}
+	}
+	metrics.SetSslVpnClients(gw.Namespace, gw.Name, clients)
+
+	latest, err := r.getVpnGw(ctx, types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace})
+	if err != nil || latest == nil {
+		return err
+	}
+	newGw := latest.DeepCopy()
+	setSslVpnClientStatus(&newGw.Status, clients)
+	if reflect.DeepEqual(latest.Status, newGw.Status) {
+		return nil
+	}
+	return r.Status().Update(ctx, newGw)
+}
+
+// setSslVpnClientStatus lists the longest connected clients first, the list is capped
+func setSslVpnClientStatus(status *myv1.VpnGwStatus, clients []metrics.SslVpnClient) {
+	sort.SliceStable(clients, func(i, j int) bool {
+		if !clients[i].ConnectedSince.Equal(clients[j].ConnectedSince) {
+			return clients[i].ConnectedSince.Before(clients[j].ConnectedSince)
+		}
+		return clients[i].CommonName < clients[j].CommonName
+	})
+	status.SslVpnConnectedClients = int32(len(clients))
+	status.SslVpnClients = nil
+	for _, c := range clients[:min(len(clients), util.SslVpnStatusMaxClients)] {
+		status.SslVpnClients = append(status.SslVpnClients, myv1.SslVpnConnection{
+			CommonName:     c.CommonName,
+			RealAddress:    c.RealAddress,
+			VirtualAddress: c.VirtualAddress,
+			BytesReceived:  c.BytesReceived,
+			BytesSent:      c.BytesSent,
+			ConnectedSince: metav1.NewTime(c.ConnectedSince),
+			Pod:            c.Pod,
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/sslvpn"
+)
+
+func TestIssuedSslVpnClientCertificates(t *testing.T) {
+	now := time.Now()
+	cert := func(serial int64, cn string) *x509.Certificate {
+		return &x509.Certificate{SerialNumber: big.NewInt(serial), Subject: pkix.Name{CommonName: cn}, NotAfter: now.Add(time.Hour)}
+	}
+	issue := func(status *myv1.SslVpnClientStatus, c *x509.Certificate, renewed bool) {
+		status.IssuedCertificates = issuedSslVpnClientCertificates(status, c, renewed, now)
+		status.SerialNumber = sslvpn.SerialNumber(c)
+		status.CommonName = c.Subject.CommonName
+		status.NotAfter = &metav1.Time{Time: c.NotAfter}
+	}
+	replaced := func(status *myv1.SslVpnClientStatus) map[string]bool {
+		res := map[string]bool{}
+		for _, c := range status.IssuedCertificates {
+			res[c.SerialNumber] = c.Replaced
+		}
+		return res
+	}
+
+	status := &myv1.SslVpnClientStatus{}
+	issue(status, cert(0xA, "alice"), false)
+	if got := replaced(status); len(got) != 1 || got["A"] {
+		t.Fatalf("expected the first certificate, got %v", got)
+	}
+	// reconciling the same certificate again changes nothing
+	issue(status, cert(0xA, "alice"), false)
+	if got := replaced(status); len(got) != 1 || got["A"] {
+		t.Fatalf("expected the same certificate, got %v", got)
+	}
+	issue(status, cert(0xB, "alice"), true)
+	if got := replaced(status); len(got) != 2 || got["A"] || got["B"] {
+		t.Errorf("expected the renewed certificate not to be replaced, got %v", got)
+	}
+	issue(status, cert(0xC, "bob"), false)
+	if got := replaced(status); len(got) != 3 || got["A"] || !got["B"] || got["C"] {
+		t.Errorf("expected the certificate of the old common name to be replaced, got %v", got)
+	}
+
+	// the certificate issued before the history is kept
+	legacy := &myv1.SslVpnClientStatus{SerialNumber: "D", CommonName: "alice", NotAfter: &metav1.Time{Time: now.Add(time.Hour)}}
+	issue(legacy, cert(0xE, "alice"), false)
+	if got := replaced(legacy); len(got) != 2 || !got["D"] || got["E"] {
+		t.Errorf("expected the previous certificate to be replaced, got %v", got)
+	}
+
+	expired := &myv1.SslVpnClientStatus{IssuedCertificates: []myv1.SslVpnClientCertificate{
+		{SerialNumber: "F", NotAfter: metav1.Time{Time: now.Add(-time.Hour)}, Replaced: true},
+	}}
+	issue(expired, cert(0x10, "alice"), false)
+	if got := replaced(expired); len(got) != 1 || got["10"] {
+		t.Errorf("expected the expired certificate to be pruned, got %v", got)
+	}
+}
+
+func newTestSslVpnCA(t *testing.T) *sslvpn.CA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ca key: %v", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ssl-vpn-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create ca: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal ca key: %v", err)
+	}
+	ca, err := sslvpn.ParseCA(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	)
+	if err != nil {
+		t.Fatalf("failed to parse ca: %v", err)
+	}
+	return ca
+}
+
+func TestRevokeReissuedSslVpnClient(t *testing.T) {
+	ca := newTestSslVpnCA(t)
+	now := time.Now()
+	c := &myv1.SslVpnClient{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "alice"}}
+	issue := func(cn string, renewed bool) string {
+		issued, err := ca.IssueClient(cn, time.Hour, now)
+		if err != nil {
+			t.Fatalf("failed to issue client certificate: %v", err)
+		}
+		c.Status.IssuedCertificates = issuedSslVpnClientCertificates(&c.Status, issued.Cert, renewed, now)
+		c.Status.SerialNumber = sslvpn.SerialNumber(issued.Cert)
+		c.Status.CommonName = cn
+		c.Status.NotAfter = &metav1.Time{Time: issued.Cert.NotAfter}
+		return c.Status.SerialNumber
+	}
+	first := issue("alice", false)
+	second := issue("alice", true)
+	if revoked := sslVpnClientsRevoked([]myv1.SslVpnClient{*c}, nil, now); len(revoked) != 0 {
+		t.Fatalf("expected the renewed certificate not to be revoked, got %v", revoked)
+	}
+
+	c.Spec.Revoked = true
+	revoked := sslVpnClientsRevoked([]myv1.SslVpnClient{*c}, nil, now)
+	crlPEM, err := ca.CreateCRL(revoked, now)
+	if err != nil {
+		t.Fatalf("failed to sign crl: %v", err)
+	}
+	block, _ := pem.Decode(crlPEM)
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse crl: %v", err)
+	}
+	inCRL := map[string]bool{}
+	for _, entry := range crl.RevokedCertificateEntries {
+		inCRL[fmt.Sprintf("%X", entry.SerialNumber)] = true
+	}
+	if len(inCRL) != 2 || !inCRL[first] || !inCRL[second] {
+		t.Errorf("expected both %s and %s in the crl, got %v", first, second, inCRL)
+	}
+
+	// only the replaced certificate of a client which is not revoked
+	c.Spec.Revoked = false
+	third := issue("bob", false)
+	revoked = sslVpnClientsRevoked([]myv1.SslVpnClient{*c}, nil, now)
+	if len(revoked) != 1 || revoked[0].SerialNumber != second || revoked[0].Client != c.Name {
+		t.Errorf("expected only %s to be revoked, got %v", second, revoked)
+	}
+	revoked = sslVpnClientsRevoked([]myv1.SslVpnClient{*c}, map[string]bool{"bob": true}, now)
+	if len(revoked) != 3 || !sslvpn.ContainsSerial(revoked, third) {
+		t.Errorf("expected all certificates of the revoked common name, got %v", revoked)
+	}
+}
@@ -0,0 +1,530 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/sslvpn"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+// wait for the vpn gw to sign the crl of the revoked client
+const sslVpnRevokeRequeue = 5 * time.Second
+
+// SslVpnClientReconciler reconciles a SslVpnClient object
+type SslVpnClientReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Log    logr.Logger
+
+	// ssl vpn openvpn port, the same as the vpn gw
+	SslVpnTCP string
+	SslVpnUDP string
+}
+
+//+kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=sslvpnclients,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=sslvpnclients/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=sslvpnclients/finalizers,verbs=update
+//+kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=vpngws,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile issues the client certificate of the ssl vpn client from the vpn gw ca,
+// and publishes the openvpn client profile in a secret
+func (r *SslVpnClientReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	namespacedName := req.NamespacedName.String()
+	r.Log.Info("start reconcile", "sslVpnClient", namespacedName)
+	defer r.Log.Info("end reconcile", "sslVpnClient", namespacedName)
+
+	updates.Inc()
+	res, requeueAfter, err := r.handleAddOrUpdateSslVpnClient(ctx, req)
+	switch res {
+	case SyncStateError:
+		updateErrors.Inc()
+		r.Log.Error(err, "failed to handle sslVpnClient, will retry")
+		return ctrl.Result{}, errRetry
+	case SyncStateErrorNoRetry:
+		updateErrors.Inc()
+		r.Log.Error(err, "failed to handle sslVpnClient, not retry")
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SslVpnClientReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&myv1.SslVpnClient{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&corev1.Secret{}).
+		// the profile is rendered from the vpn gw ssl vpn spec
+		Watches(&myv1.VpnGw{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueSslVpnClientsForVpnGw),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		// ca rotation and the crl signed by the vpn gw
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.enqueueSslVpnClientsForSecret)).
+		Complete(r)
+}
+
+func sslVpnProfileSecretName(c *myv1.SslVpnClient) string {
+	return c.Name + util.SslVpnProfileSecretSuffix
+}
+
+func sslVpnClientCommonName(c *myv1.SslVpnClient) string {
+	if c.Spec.CommonName != "" {
+		return c.Spec.CommonName
+	}
+	return c.Name
+}
+
+func (r *SslVpnClientReconciler) handleAddOrUpdateSslVpnClient(ctx context.Context, req ctrl.Request) (SyncState, time.Duration, error) {
+	namespacedName := req.NamespacedName.String()
+	r.Log.Info("start handleAddOrUpdateSslVpnClient", "sslVpnClient", namespacedName)
+	defer r.Log.Info("end handleAddOrUpdateSslVpnClient", "sslVpnClient", namespacedName)
+
+	c := &myv1.SslVpnClient{}
+	if err := r.Get(ctx, req.NamespacedName, c); err != nil {
+		if apierrors.IsNotFound(err) {
+			return SyncStateSuccess, 0, nil
+		}
+		r.Log.Error(err, "failed to get sslVpnClient", "sslVpnClient", namespacedName)
+		return SyncStateError, 0, err
+	}
+	gw := &myv1.VpnGw{}
+	err := r.Get(ctx, types.NamespacedName{Name: c.Spec.VpnGw, Namespace: c.Namespace}, gw)
+	if err != nil && !apierrors.IsNotFound(err) {
+		r.Log.Error(err, "failed to get vpn gw", "vpn gw", c.Spec.VpnGw)
+		return SyncStateError, 0, err
+	}
+	if apierrors.IsNotFound(err) {
+		gw = nil
+	}
+	if !c.DeletionTimestamp.IsZero() {
+		return r.handleDelSslVpnClient(ctx, c, gw)
+	}
+
+	if !controllerutil.ContainsFinalizer(c, util.SslVpnClientFinalizer) {
+		newClient := c.DeepCopy()
+		controllerutil.AddFinalizer(newClient, util.SslVpnClientFinalizer)
+		if err := r.Patch(ctx, newClient, client.MergeFrom(c)); err != nil {
+			r.Log.Error(err, "failed to add sslVpnClient finalizer")
+			return SyncStateError, 0, err
+		}
+		c = newClient
+	}
+
+	if gw == nil {
+		err := fmt.Errorf("vpn gw %s not found", c.Spec.VpnGw)
+		return r.notIssued(ctx, c, "VpnGwNotFound", err)
+	}
+	if !sslVpnCRLEnabled(gw) {
+		err := fmt.Errorf("vpn gw %s should enable ssl vpn and set ssl vpn ca secret", gw.Name)
+		return r.notIssued(ctx, c, "SslVpnCANotSet", err)
+	}
+	if c.Spec.Revoked || sslVpnRevokedCNs(gw)[sslVpnClientCommonName(c)] {
+		return r.handleRevokeSslVpnClient(ctx, c, gw)
+	}
+	if gw.Spec.SslVpnEIP == "" {
+		err := fmt.Errorf("vpn gw %s should set ssl vpn eip", gw.Name)
+		return r.notIssued(ctx, c, "SslVpnEIPNotSet", err)
+	}
+
+	ca, state, err := getSslVpnCA(ctx, r.Client, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to get ssl vpn ca")
+		if state == SyncStateErrorNoRetry {
+			return r.notIssued(ctx, c, "InvalidCA", err)
+		}
+		return state, 0, err
+	}
+	serverSecret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: gw.Spec.SslVpnSecret, Namespace: gw.Namespace}, serverSecret); err != nil {
+		r.Log.Error(err, "failed to get ssl vpn secret", "secret", gw.Spec.SslVpnSecret)
+		return SyncStateError, 0, err
+	}
+	serverCert, err := sslvpn.ParseCert(serverSecret.Data[sslvpn.ServerCertKey])
+	if err != nil {
+		err = fmt.Errorf("invalid %s in ssl vpn secret %s: %w", sslvpn.ServerCertKey, gw.Spec.SslVpnSecret, err)
+		return r.notIssued(ctx, c, "InvalidServerCert", err)
+	}
+
+	// reuse the issued certificate unless it is signed by another ca, for another common name or to be renewed
+	now := time.Now()
+	commonName := sslVpnClientCommonName(c)
+	secretName := types.NamespacedName{Name: sslVpnProfileSecretName(c), Namespace: c.Namespace}
+	oldSecret := &corev1.Secret{}
+	if err := r.Get(ctx, secretName, oldSecret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			r.Log.Error(err, "failed to get ssl vpn profile secret", "secret", secretName.String())
+			return SyncStateError, 0, err
+		}
+		oldSecret = nil
+	}
+	var issued *sslvpn.ClientCert
+	// the previous certificate is replaced unless it is renewed
+	var renewed bool
+	if oldSecret != nil {
+		if cert, err := sslvpn.ParseCert(oldSecret.Data[sslvpn.ProfileCertKey]); err == nil &&
+			ca.Signed(cert) && cert.Subject.CommonName == commonName {
+			if !sslvpn.NeedsRenewal(cert, now) {
+				issued = &sslvpn.ClientCert{
+					Cert:    cert,
+					CertPEM: oldSecret.Data[sslvpn.ProfileCertKey],
+					KeyPEM:  oldSecret.Data[sslvpn.ProfileKeyKey],
+				}
+			} else {
+				renewed = true
+			}
+		}
+	}
+	if issued == nil {
+		duration := c.Spec.Duration.Duration
+		if duration == 0 {
+			duration = 365 * 24 * time.Hour
+		}
+		if issued, err = ca.IssueClient(commonName, duration, now); err != nil {
+			r.Log.Error(err, "failed to issue ssl vpn client certificate")
+			return r.notIssued(ctx, c, "IssueFailed", err)
+		}
+		r.Log.Info("issue ssl vpn client certificate", "sslVpnClient", namespacedName, "serial", sslvpn.SerialNumber(issued.Cert))
+	}
+
+	port := r.SslVpnUDP
+	if gw.Spec.SslVpnProto == "tcp" {
+		port = r.SslVpnTCP
+	}
+	profile := &sslvpn.Profile{
+		CommonName:    commonName,
+		Remote:        gw.Spec.SslVpnEIP,
+		Port:          port,
+		Proto:         gw.Spec.SslVpnProto,
+		Cipher:        gw.Spec.SslVpnCipher,
+		Auth:          gw.Spec.SslVpnAuth,
+		RemoteCertTLS: sslvpn.ServerAuth(serverCert),
+		CA:            string(ca.CertPEM),
+		Cert:          string(issued.CertPEM),
+		Key:           string(issued.KeyPEM),
+	}
+	ovpn, err := profile.Render()
+	if err != nil {
+		r.Log.Error(err, "failed to render ssl vpn client profile")
+		return r.notIssued(ctx, c, "InvalidProfile", err)
+	}
+	files := map[string]string{
+		sslvpn.ProfileKey:     ovpn,
+		sslvpn.ProfileCertKey: string(issued.CertPEM),
+		sslvpn.ProfileKeyKey:  string(issued.KeyPEM),
+		sslvpn.ProfileCAKey:   string(ca.CertPEM),
+	}
+	if err := r.handleAddOrUpdateProfileSecret(ctx, c, oldSecret, files); err != nil {
+		r.Log.Error(err, "failed to handleAddOrUpdateProfileSecret")
+		return SyncStateError, 0, err
+	}
+
+	configured, err := r.sslVpnClientConfiguredCondition(ctx, c, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to list vpn gw ssl vpn clients")
+		return SyncStateError, 0, err
+	}
+	err = r.updateSslVpnClientStatus(ctx, c, func(status *myv1.SslVpnClientStatus) {
+		status.IssuedCertificates = issuedSslVpnClientCertificates(status, issued.Cert, renewed, now)
+		status.SerialNumber = sslvpn.SerialNumber(issued.Cert)
+		status.CommonName = commonName
+		status.NotBefore = &metav1.Time{Time: issued.Cert.NotBefore}
+		status.NotAfter = &metav1.Time{Time: issued.Cert.NotAfter}
+		status.ProfileSecret = secretName.Name
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myv1.SslVpnClientIssued,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: c.Generation,
+			Reason:             "Issued",
+			Message:            fmt.Sprintf("profile is published in secret %s", secretName.Name),
+		})
+		meta.SetStatusCondition(&status.Conditions, configured)
+		meta.RemoveStatusCondition(&status.Conditions, myv1.SslVpnClientRevoked)
+	})
+	if err != nil {
+		r.Log.Error(err, "failed to update sslVpnClient status")
+		return SyncStateError, 0, err
+	}
+	// renew the certificate in the last third of its lifetime
+	lifetime := issued.Cert.NotAfter.Sub(issued.Cert.NotBefore)
+	return SyncStateSuccess, time.Until(issued.Cert.NotAfter.Add(-lifetime / 3)), nil
+}
+
+// issuedSslVpnClientCertificates adds the issued certificate to the certificates of the client,
+// the current one in the status is marked replaced if the issued one is not its renewal,
+// the expired certificates are pruned
+func issuedSslVpnClientCertificates(status *myv1.SslVpnClientStatus, cert *x509.Certificate, renewed bool, now time.Time) []myv1.SslVpnClientCertificate {
+	serial := sslvpn.SerialNumber(cert)
+	var certs []myv1.SslVpnClientCertificate
+	for _, issued := range status.IssuedCertificates {
+		if issued.NotAfter.Time.After(now) {
+			certs = append(certs, issued)
+		}
+	}
+	if status.SerialNumber != "" && status.SerialNumber != serial && status.NotAfter != nil && status.NotAfter.Time.After(now) {
+		// the certificates issued before the history is kept are not in it
+		i := slices.IndexFunc(certs, func(issued myv1.SslVpnClientCertificate) bool { return issued.SerialNumber == status.SerialNumber })
+		if i < 0 {
+			certs = append(certs, myv1.SslVpnClientCertificate{SerialNumber: status.SerialNumber, CommonName: status.CommonName, NotAfter: *status.NotAfter})
+			i = len(certs) - 1
+		}
+		certs[i].Replaced = !renewed
+	}
+	if !slices.ContainsFunc(certs, func(issued myv1.SslVpnClientCertificate) bool { return issued.SerialNumber == serial }) {
+		certs = append(certs, myv1.SslVpnClientCertificate{
+			SerialNumber: serial,
+			CommonName:   cert.Subject.CommonName,
+			NotAfter:     metav1.Time{Time: cert.NotAfter},
+		})
+	}
+	return certs
+}
+
+// sslVpnClientConfiguredCondition reports whether the client config is valid and rendered by the vpn gw,
+// the clients of the vpn gw are checked together for the common name and static ip conflicts
+func (r *SslVpnClientReconciler) sslVpnClientConfiguredCondition(ctx context.Context, c *myv1.SslVpnClient, gw *myv1.VpnGw) (metav1.Condition, error) {
+	cond := metav1.Condition{
+		Type:               myv1.SslVpnClientConfigured,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: c.Generation,
+		Reason:             "NoClientConfig",
+		Message:            "client uses the config pushed to all clients",
+	}
+	if sslVpnClientConfigSpec(c).Empty() {
+		return cond, nil
+	}
+	clients := &myv1.SslVpnClientList{}
+	if err := r.List(ctx, clients, client.InNamespace(gw.Namespace), client.MatchingFields{sslVpnClientVpnGwField: gw.Name}); err != nil {
+		return cond, err
+	}
+	_, errs := sslVpnClientConfigs(gw, clients.Items)
+	if err := errs[c.Name]; err != nil {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "InvalidClientConfig"
+		cond.Message = err.Error()
+		return cond, nil
+	}
+	cond.Reason = "Rendered"
+	cond.Message = fmt.Sprintf("client config is rendered into secret %s", sslVpnCCDSecretName(gw))
+	return cond, nil
+}
+
+// handleRevokeSslVpnClient deletes the profile secret and waits for the vpn gw to sign the certificate into the crl
+func (r *SslVpnClientReconciler) handleRevokeSslVpnClient(ctx context.Context, c *myv1.SslVpnClient, gw *myv1.VpnGw) (SyncState, time.Duration, error) {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: sslVpnProfileSecretName(c), Namespace: c.Namespace}}
+	if err := r.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+		r.Log.Error(err, "failed to delete ssl vpn profile secret", "secret", secret.Name)
+		return SyncStateError, 0, err
+	}
+	revoked, requeueAfter, err := r.isSslVpnClientRevoked(ctx, c, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to get ssl vpn revoked clients")
+		return SyncStateError, 0, err
+	}
+	err = r.updateSslVpnClientStatus(ctx, c, func(status *myv1.SslVpnClientStatus) {
+		status.ProfileSecret = ""
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myv1.SslVpnClientIssued,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: c.Generation,
+			Reason:             "Revoked",
+			Message:            "client certificate is revoked",
+		})
+		revokedCond := metav1.Condition{
+			Type:               myv1.SslVpnClientRevoked,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: c.Generation,
+			Reason:             "InCRL",
+			Message:            fmt.Sprintf("client certificate is in the crl of vpn gw %s", gw.Name),
+		}
+		if !revoked {
+			revokedCond.Status = metav1.ConditionFalse
+			revokedCond.Reason = "Pending"
+			revokedCond.Message = fmt.Sprintf("waiting for vpn gw %s to sign the crl", gw.Name)
+		}
+		meta.SetStatusCondition(&status.Conditions, revokedCond)
+		meta.RemoveStatusCondition(&status.Conditions, myv1.SslVpnClientConfigured)
+	})
+	if err != nil {
+		r.Log.Error(err, "failed to update sslVpnClient status")
+		return SyncStateError, 0, err
+	}
+	return SyncStateSuccess, requeueAfter, nil
+}
+
+// handleDelSslVpnClient keeps the deleting client until its certificate is in the vpn gw crl,
+// the crl secret keeps the revoked certificate after the client is gone
+func (r *SslVpnClientReconciler) handleDelSslVpnClient(ctx context.Context, c *myv1.SslVpnClient, gw *myv1.VpnGw) (SyncState, time.Duration, error) {
+	if !controllerutil.ContainsFinalizer(c, util.SslVpnClientFinalizer) {
+		return SyncStateSuccess, 0, nil
+	}
+	r.Log.Info("start handleDelSslVpnClient", "sslVpnClient", c.Name)
+	// nothing to revoke if the vpn gw is gone or it does not sign the crl any more
+	if gw != nil && sslVpnCRLEnabled(gw) {
+		revoked, requeueAfter, err := r.isSslVpnClientRevoked(ctx, c, gw)
+		if err != nil {
+			r.Log.Error(err, "failed to get ssl vpn revoked clients")
+			return SyncStateError, 0, err
+		}
+		if !revoked {
+			r.Log.Info("wait for vpn gw to revoke the client certificate", "sslVpnClient", c.Name, "vpn gw", gw.Name)
+			return SyncStateSuccess, requeueAfter, nil
+		}
+	}
+	newClient := c.DeepCopy()
+	controllerutil.RemoveFinalizer(newClient, util.SslVpnClientFinalizer)
+	if err := r.Patch(ctx, newClient, client.MergeFromWithOptions(c, client.MergeFromWithOptimisticLock{})); err != nil {
+		r.Log.Error(err, "failed to remove sslVpnClient finalizer")
+		return SyncStateError, 0, err
+	}
+	return SyncStateSuccess, 0, nil
+}
+
+// isSslVpnClientRevoked reports whether all the certificates issued to the client are in the vpn gw crl,
+// it returns how long to wait for the crl if they are not
+func (r *SslVpnClientReconciler) isSslVpnClientRevoked(ctx context.Context, c *myv1.SslVpnClient, gw *myv1.VpnGw) (bool, time.Duration, error) {
+	now := time.Now()
+	var serials []string
+	for _, cert := range sslVpnClientRevokedCerts(c, true) {
+		if cert.NotAfter.Time.After(now) {
+			serials = append(serials, cert.SerialNumber)
+		}
+	}
+	if len(serials) == 0 {
+		// never issued or already expired
+		return true, 0, nil
+	}
+	revoked, _, err := getSslVpnRevoked(ctx, r.Client, gw)
+	if err != nil {
+		return false, 0, err
+	}
+	for _, serial := range serials {
+		if !sslvpn.ContainsSerial(revoked, serial) {
+			return false, sslVpnRevokeRequeue, nil
+		}
+	}
+	return true, 0, nil
+}
+
+// notIssued reports why the client certificate is not issued, retrying will not help until the spec changes
+func (r *SslVpnClientReconciler) notIssued(ctx context.Context, c *myv1.SslVpnClient, reason string, err error) (SyncState, time.Duration, error) {
+	if updateErr := r.updateSslVpnClientStatus(ctx, c, func(status *myv1.SslVpnClientStatus) {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myv1.SslVpnClientIssued,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: c.Generation,
+			Reason:             reason,
+			Message:            err.Error(),
+		})
+	}); updateErr != nil {
+		r.Log.Error(updateErr, "failed to update sslVpnClient status")
+		return SyncStateError, 0, updateErr
+	}
+	return SyncStateErrorNoRetry, 0, err
+}
+
+func (r *SslVpnClientReconciler) updateSslVpnClientStatus(ctx context.Context, c *myv1.SslVpnClient, mutate func(status *myv1.SslVpnClientStatus)) error {
+	latest := &myv1.SslVpnClient{}
+	if err := r.Get(ctx, types.NamespacedName{Name: c.Name, Namespace: c.Namespace}, latest); err != nil {
+		return err
+	}
+	newClient := latest.DeepCopy()
+	mutate(&newClient.Status)
+	if reflect.DeepEqual(latest.Status, newClient.Status) {
+		return nil
+	}
+	return r.Status().Update(ctx, newClient)
+}
+
+// handleAddOrUpdateProfileSecret keeps the client profile in a secret owned by the ssl vpn client
+func (r *SslVpnClientReconciler) handleAddOrUpdateProfileSecret(ctx context.Context, c *myv1.SslVpnClient, oldSecret *corev1.Secret, files map[string]string) error {
+	if oldSecret == nil {
+		newSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      sslVpnProfileSecretName(c),
+				Namespace: c.Namespace,
+				Labels:    map[string]string{util.VpnGwLabel: c.Spec.VpnGw},
+			},
+			StringData: files,
+		}
+		// set ssl vpn client as the owner and controller
+		if err := controllerutil.SetControllerReference(c, newSecret, r.Scheme); err != nil {
+			r.Log.Error(err, "failed to set ssl vpn client as the owner and controller")
+			return err
+		}
+		return r.Create(ctx, newSecret)
+	}
+	changed := len(oldSecret.Data) != len(files)
+	for key, value := range files {
+		if string(oldSecret.Data[key]) != value {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+	newSecret := oldSecret.DeepCopy()
+	newSecret.Data = nil
+	newSecret.StringData = files
+	return r.Update(ctx, newSecret)
+}
+
+func (r *SslVpnClientReconciler) enqueueSslVpnClientsForVpnGw(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.enqueueSslVpnClients(ctx, obj.GetNamespace(), func(gw string) bool { return gw == obj.GetName() })
+}
+
+// enqueueSslVpnClientsForSecret enqueues the clients of the vpn gws using the secret as the ssl vpn ca or crl
+func (r *SslVpnClientReconciler) enqueueSslVpnClientsForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	gws := &myv1.VpnGwList{}
+	if err := r.List(ctx, gws, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "failed to list vpn gw", "namespace", obj.GetNamespace())
+		return nil
+	}
+	matched := map[string]bool{}
+	for _, gw := range gws.Items {
+		if isSslVpnCASecret(&gw, obj.GetName()) || sslVpnCRLSecretName(&gw) == obj.GetName() {
+			matched[gw.Name] = true
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	return r.enqueueSslVpnClients(ctx, obj.GetNamespace(), func(gw string) bool { return matched[gw] })
+}
+
+func (r *SslVpnClientReconciler) enqueueSslVpnClients(ctx context.Context, namespace string, match func(gw string) bool) []reconcile.Request {
+	clients := &myv1.SslVpnClientList{}
+	if err := r.List(ctx, clients, client.InNamespace(namespace)); err != nil {
+		r.Log.Error(err, "failed to list ssl vpn clients", "namespace", namespace)
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, c := range clients.Items {
+		if match(c.Spec.VpnGw) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: c.Name, Namespace: c.Namespace}})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/ipsec"
+	"github.com/kubecombo/kube-combo/internal/util"
+	"github.com/kubecombo/kube-combo/internal/vici"
+)
+
+// dialVici opens a vici session with charon in the ipsec vpn gw pod
+func dialVici(ctx context.Context, kubeClient kubernetes.Interface, cfg *rest.Config, namespace, pod string) (*vici.Client, error) {
+	conn, err := DialInContainer(ctx, kubeClient, cfg, namespace, pod, util.IPSecVpnServer, []string{"/bin/bash", "-c", util.IPSecViciAgentCMD}...)
+	if err != nil {
+		return nil, err
+	}
+	return vici.NewClient(conn), nil
+}
+
+// getRunningIPSecPods returns the running ipsec vpn gw pods, only they have charon to talk to
+func getRunningIPSecPods(ctx context.Context, c client.Client, gw *myv1.VpnGw) ([]corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	err := c.List(ctx, podList, client.InNamespace(gw.Namespace), client.MatchingLabels{util.EnableIPSecVpnLabel: "true", util.VpnGwLabel: gw.Name})
+	if err != nil {
+		return nil, err
+	}
+	pods := []corev1.Pod{}
+	for _, pod := range podList.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// loadIPSecConns loads the ipsec connections into charon in the vpn gw pod and unloads the ones not in conns any more,
+// charon keeps a connection and its sas if the loaded config is unchanged, so only the new connections are initiated
+func loadIPSecConns(ctx context.Context, kubeClient kubernetes.Interface, cfg *rest.Config, namespace, pod string, conns map[string]vici.Message) error {
+	session, err := dialVici(ctx, kubeClient, cfg, namespace, pod)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	loaded, err := session.GetConns()
+	if err != nil {
+		return err
+	}
+	exist := make(map[string]bool, len(loaded))
+	for _, name := range loaded {
+		exist[name] = true
+		if _, ok := conns[name]; ok {
+			continue
+		}
+		if err := session.Terminate(name, "", -1); err != nil && !vici.IsNotFound(err) {
+			return err
+		}
+		if err := session.UnloadConn(name); err != nil && !vici.IsNotFound(err) {
+			return err
+		}
+	}
+	names := make([]string, 0, len(conns))
+	for name := range conns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := session.LoadConn(name, conns[name]); err != nil {
+			return err
+		}
+		if exist[name] {
+			continue
+		}
+		// do not wait for the peer, the tunnel state is reported by the ipsec conn status
+		if err := session.Initiate(name, ipsec.ChildName, -1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
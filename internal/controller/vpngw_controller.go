@@ -18,9 +18,11 @@ package controller
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -29,24 +31,40 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	utilexec "k8s.io/utils/exec"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/ipsec"
+	"github.com/kubecombo/kube-combo/internal/sslvpn"
 	"github.com/kubecombo/kube-combo/internal/util"
 )
 
+// ipsecConnVpnGwField indexes ipsec connections by spec.vpnGw
+const ipsecConnVpnGwField = "spec.vpnGw"
+
+// ipsecConnPSKSecretField indexes ipsec connections by spec.pskSecretRef.name
+const ipsecConnPSKSecretField = "spec.pskSecretRef.name"
+
+// vpnGwSecretField indexes vpn gws by the secrets they read in the reconcile
+const vpnGwSecretField = "spec.secrets"
+
 // VpnGwReconciler reconciles a VpnGw object
 type VpnGwReconciler struct {
 	client.Client
@@ -66,6 +84,8 @@ type VpnGwReconciler struct {
 	// ssl vpn mount path
 	SslVpnSecretPath string
 	DhSecretPath     string
+	// interval to refresh the connected ssl vpn clients from openvpn, 0 disables it
+	SslVpnStatusInterval time.Duration
 
 	// ipsec vpn strongswan
 	IPSecBootPcPort string
@@ -73,6 +93,13 @@ type VpnGwReconciler struct {
 	IPSecNatPort    string
 	// ipsec vpn mount path
 	IPSecVpnSecretPath string
+	// interval to refresh ipsec connection status from strongswan, 0 disables it
+	IPSecStatusInterval time.Duration
+
+	// defaults of the objects created while the webhooks are disabled
+	Defaults myv1.DefaultOptions
+	// cni provider of the vpn gw which does not set one
+	CNIProvider CNIProvider
 }
 
 // Note: you need a blank line after this list in order for the controller to pick this up.
@@ -84,6 +111,7 @@ type VpnGwReconciler struct {
 // +kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=ipsecconns/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=ipsecconns/finalizers,verbs=update
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=statefulsets/scale,verbs=get;watch;update
 // +kubebuilder:rbac:groups=apps,resources=statefulsets/status,verbs=get;update;patch
@@ -92,6 +120,10 @@ type VpnGwReconciler struct {
 // +kubebuilder:rbac:groups=apps,resources=daemonsets/scale,verbs=get;watch;update
 // +kubebuilder:rbac:groups=apps,resources=daemonsets/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps,resources=daemonsets/finalizers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch
+// +kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=wireguardpeers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=wireguardpeers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=vpn-gw.kubecombo.com,resources=sslvpnclients,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods/exec,verbs=create
 // +kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
@@ -115,7 +147,14 @@ func (r *VpnGwReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	r.Log.Info("start reconcile", "vpn gw", namespacedName)
 	defer r.Log.Info("end reconcile", "vpn gw", namespacedName)
 	updates.Inc()
-	res, err := r.handleAddOrUpdateVpnGw(ctx, req)
+	res, wait, err := r.handleAddOrUpdateVpnGw(ctx, req)
+	var syncErr error
+	if res != SyncStateSuccess {
+		syncErr = err
+	}
+	if readyErr := r.syncVpnGwReadiness(ctx, req.NamespacedName, wait, syncErr); readyErr != nil && res == SyncStateSuccess {
+		res, err = SyncStateError, readyErr
+	}
 	switch res {
 	case SyncStateError:
 		updateErrors.Inc()
@@ -126,11 +165,80 @@ func (r *VpnGwReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		r.Log.Error(err, "failed to handle vpn gw, not retry")
 		return ctrl.Result{}, nil
 	}
-	return ctrl.Result{}, nil
+	if wait != waitNone {
+		r.Log.Info("vpn gw is waiting", "vpn gw", namespacedName, "reason", wait)
+		return ctrl.Result{RequeueAfter: wait.requeueAfter()}, nil
+	}
+	gw, err := r.getVpnGw(ctx, req.NamespacedName)
+	if err != nil {
+		return ctrl.Result{RequeueAfter: 3 * time.Second}, errRetry
+	}
+	if gw == nil {
+		return ctrl.Result{}, nil
+	}
+	// the resyncs are filtered out, sign the crl again before it expires
+	return ctrl.Result{RequeueAfter: sslVpnCRLRequeueAfter(gw, time.Now())}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *VpnGwReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &myv1.IpsecConn{}, ipsecConnVpnGwField, func(obj client.Object) []string {
+		conn, ok := obj.(*myv1.IpsecConn)
+		if !ok || conn.Spec.VpnGw == "" {
+			return nil
+		}
+		return []string{conn.Spec.VpnGw}
+	}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &myv1.IpsecConn{}, ipsecConnPSKSecretField, func(obj client.Object) []string {
+		conn, ok := obj.(*myv1.IpsecConn)
+		if !ok || conn.Spec.PSKSecretRef == nil {
+			return nil
+		}
+		return []string{conn.Spec.PSKSecretRef.Name}
+	}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &myv1.VpnGw{}, vpnGwSecretField, func(obj client.Object) []string {
+		gw, ok := obj.(*myv1.VpnGw)
+		if !ok {
+			return nil
+		}
+		return vpnGwSecrets(gw)
+	}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &myv1.WireGuardPeer{}, wireGuardPeerVpnGwField, func(obj client.Object) []string {
+		peer, ok := obj.(*myv1.WireGuardPeer)
+		if !ok || peer.Spec.VpnGw == "" {
+			return nil
+		}
+		return []string{peer.Spec.VpnGw}
+	}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &myv1.SslVpnClient{}, sslVpnClientVpnGwField, func(obj client.Object) []string {
+		c, ok := obj.(*myv1.SslVpnClient)
+		if !ok || c.Spec.VpnGw == "" {
+			return nil
+		}
+		return []string{c.Spec.VpnGw}
+	}); err != nil {
+		return err
+	}
+	if r.SslVpnStatusInterval > 0 {
+		// only the leader refreshes the connected ssl vpn clients
+		if err := mgr.Add(manager.RunnableFunc(r.pollSslVpnClientStatus)); err != nil {
+			return err
+		}
+	}
+	if r.IPSecStatusInterval > 0 {
+		// only the leader refreshes ipsec connection status
+		if err := mgr.Add(manager.RunnableFunc(r.pollIPSecConnStatus)); err != nil {
+			return err
+		}
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&myv1.VpnGw{},
 			builder.WithPredicates(
@@ -145,12 +253,40 @@ func (r *VpnGwReconciler) SetupWithManager(mgr ctrl.Manager) error {
 						return true
 					},
 				),
+				// ignore status updates, eg. the ssl vpn client inventory refreshed every poll
+				predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}, predicate.LabelChangedPredicate{}),
 			),
 		).
 		Owns(&appsv1.StatefulSet{}). // for vpc case
 		Owns(&appsv1.DaemonSet{}).   // for node static pod case
-		Owns(&myv1.IpsecConn{}).
-		Owns(&myv1.KeepAlived{}).
+		Owns(&corev1.Pod{}).         // static pod cleanup pods of the deleting vpn gw
+		// ipsec connections are not owned by the vpn gw, map them by spec.vpnGw and the vpn-gw label
+		Watches(&myv1.IpsecConn{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueVpnGwForIpsecConn),
+			// ignore status updates
+			builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{})),
+		).
+		Watches(&myv1.WireGuardPeer{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueVpnGwForWireGuardPeer),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		// revoked and deleting ssl vpn clients and the replaced certificates are signed into the crl
+		Watches(&myv1.SslVpnClient{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueVpnGwForSslVpnClient),
+			builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, sslVpnClientReplacedChanged)),
+		).
+		// keepalived is referenced by spec.keepalived, the vrrp instances and router ids are rendered into the vpn gw config map
+		Watches(&myv1.KeepAlived{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueVpnGwForKeepalived),
+		).
+		Owns(&corev1.ConfigMap{}).
+		// the static mirror pods are compared with the static vpn gws to detect the drift
+		Watches(&corev1.Pod{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueVpnGwForStaticPod),
+			builder.WithPredicates(predicate.NewPredicateFuncs(isStaticMirrorPod)),
+		).
+		// psk, wireguard key and ssl vpn ca secrets referenced by the vpn gw and its ipsec connections
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.enqueueVpnGwForSecret)).
 		Complete(r)
 }
 
@@ -160,8 +296,8 @@ func (r *VpnGwReconciler) validateKeepalived(ka *myv1.KeepAlived) error {
 		r.Log.Error(err, "should set keepalived image")
 		return err
 	}
-	if ka.Spec.VipV4 == "" && ka.Spec.VipV6 == "" {
-		err := errors.New("keepalived vip v4 or v6 ip is required")
+	if len(ka.VrrpInstances()) == 0 {
+		err := errors.New("keepalived vip v4, v6 or instances is required")
 		r.Log.Error(err, "should set keepalived vip")
 		return err
 	}
@@ -182,9 +318,9 @@ func (r *VpnGwReconciler) validateVpnGw(gw *myv1.VpnGw) error {
 		return err
 	}
 
-	if !gw.Spec.EnableSslVpn && !gw.Spec.EnableIPSecVpn {
-		err := errors.New("vpn gw spec should enable ssl vpn or ipsec vpn at least one")
-		r.Log.Error(err, "vpn gw spec should enable ssl vpn or ipsec vpn at least one")
+	if !gw.Spec.EnableSslVpn && !gw.Spec.EnableIPSecVpn && !gw.Spec.EnableWireGuard {
+		err := errors.New("vpn gw spec should enable ssl vpn, ipsec vpn or wireguard at least one")
+		r.Log.Error(err, "vpn gw spec should enable ssl vpn, ipsec vpn or wireguard at least one")
 		return err
 	}
 
@@ -224,6 +360,19 @@ func (r *VpnGwReconciler) validateVpnGw(gw *myv1.VpnGw) error {
 			r.Log.Error(err, "should set ssl vpn image")
 			return err
 		}
+		for _, rev := range gw.Spec.SslVpnRevocations {
+			if rev.SerialNumber == "" && rev.CommonName == "" {
+				err := errors.New("ssl vpn revocation should set serial number or common name")
+				r.Log.Error(err, "should set reasonable ssl vpn revocation")
+				return err
+			}
+		}
+		if gw.Spec.SslVpnStaticCidr != "" {
+			if _, _, err := sslvpn.DynamicPool(gw.Spec.SslVpnSubnetCidr, gw.Spec.SslVpnStaticCidr); err != nil {
+				r.Log.Error(err, "should set reasonable ssl vpn static cidr")
+				return err
+			}
+		}
 	}
 
 	if gw.Spec.EnableIPSecVpn {
@@ -233,6 +382,29 @@ func (r *VpnGwReconciler) validateVpnGw(gw *myv1.VpnGw) error {
 			return err
 		}
 	}
+
+	if gw.Spec.EnableWireGuard {
+		if gw.Spec.WireGuardSecret == "" {
+			err := errors.New("wireguard secret is required")
+			r.Log.Error(err, "should set wireguard private key secret")
+			return err
+		}
+		if gw.Spec.WireGuardAddressCidr == "" {
+			err := errors.New("wireguard address cidr is required")
+			r.Log.Error(err, "should set wireguard interface address")
+			return err
+		}
+		if gw.Spec.WireGuardListenPort <= 0 || gw.Spec.WireGuardListenPort > 65535 {
+			err := fmt.Errorf("invalid wireguard listen port %d", gw.Spec.WireGuardListenPort)
+			r.Log.Error(err, "should set reasonable wireguard listen port")
+			return err
+		}
+		if gw.Spec.WireGuardImage == "" {
+			err := errors.New("wireguard image is required")
+			r.Log.Error(err, "should set wireguard image")
+			return err
+		}
+	}
 	return nil
 }
 
@@ -249,6 +421,9 @@ func (r *VpnGwReconciler) isChanged(gw *myv1.VpnGw, ipsecConnections []string) b
 	if gw.Status.QoSBandwidth != gw.Spec.QoSBandwidth {
 		return true
 	}
+	if gw.Status.CNIProvider != r.cniProviderForVpnGw(gw).Name() {
+		return true
+	}
 	if gw.Status.Replicas != gw.Spec.Replicas {
 		return true
 	}
@@ -267,12 +442,35 @@ func (r *VpnGwReconciler) isChanged(gw *myv1.VpnGw, ipsecConnections []string) b
 	if gw.Status.SslVpnImage != gw.Spec.SslVpnImage {
 		return true
 	}
+	if gw.Status.SslVpnCASecret != sslVpnCASecret(gw) {
+		return true
+	}
+	if gw.Status.SslVpnStaticCidr != sslVpnStaticCidr(gw) {
+		return true
+	}
 	if gw.Status.EnableIPSecVpn != gw.Spec.EnableIPSecVpn {
 		return true
 	}
 	if gw.Status.IPSecVpnImage != gw.Spec.IPSecVpnImage {
 		return true
 	}
+	if gw.Status.EnableWireGuard != gw.Spec.EnableWireGuard {
+		return true
+	}
+	if gw.Spec.EnableWireGuard {
+		if gw.Status.WireGuardImage != gw.Spec.WireGuardImage {
+			return true
+		}
+		if gw.Status.WireGuardSecret != gw.Spec.WireGuardSecret {
+			return true
+		}
+		if gw.Status.WireGuardListenPort != gw.Spec.WireGuardListenPort {
+			return true
+		}
+		if gw.Status.WireGuardAddressCidr != gw.Spec.WireGuardAddressCidr {
+			return true
+		}
+	}
 	if gw.Status.EnableIPSecVpn && ipsecConnections != nil {
 		return true
 	}
@@ -282,6 +480,12 @@ func (r *VpnGwReconciler) isChanged(gw *myv1.VpnGw, ipsecConnections []string) b
 	if !reflect.DeepEqual(gw.Spec.Selector, gw.Status.Selector) {
 		return true
 	}
+	if !reflect.DeepEqual(gw.Spec.Networks, gw.Status.Networks) {
+		return true
+	}
+	if !reflect.DeepEqual(gw.Spec.QoS, gw.Status.QoS) {
+		return true
+	}
 	if !reflect.DeepEqual(gw.Spec.Tolerations, gw.Status.Tolerations) {
 		return true
 	}
@@ -302,6 +506,8 @@ func (r *VpnGwReconciler) UpdateVpnGW(ctx context.Context, req ctrl.Request, ips
 		// vpn gw deleted
 		return nil
 	}
+	// record the same defaulted spec which the workload is rendered from
+	gw.SetDefaults(r.Defaults)
 	changed := false
 	newGw := gw.DeepCopy()
 	if gw.Status.Keepalived == "" && gw.Spec.Keepalived != "" {
@@ -320,6 +526,10 @@ func (r *VpnGwReconciler) UpdateVpnGW(ctx context.Context, req ctrl.Request, ips
 		newGw.Status.QoSBandwidth = gw.Spec.QoSBandwidth
 		changed = true
 	}
+	if provider := r.cniProviderForVpnGw(gw).Name(); gw.Status.CNIProvider != provider {
+		newGw.Status.CNIProvider = provider
+		changed = true
+	}
 	if gw.Status.Replicas != gw.Spec.Replicas {
 		newGw.Status.Replicas = gw.Spec.Replicas
 		changed = true
@@ -342,6 +552,15 @@ func (r *VpnGwReconciler) UpdateVpnGW(ctx context.Context, req ctrl.Request, ips
 		changed = true
 	}
 
+	if caSecret := sslVpnCASecret(gw); gw.Status.SslVpnCASecret != caSecret {
+		newGw.Status.SslVpnCASecret = caSecret
+		changed = true
+	}
+	if staticCidr := sslVpnStaticCidr(gw); gw.Status.SslVpnStaticCidr != staticCidr {
+		newGw.Status.SslVpnStaticCidr = staticCidr
+		changed = true
+	}
+
 	if gw.Status.EnableIPSecVpn != gw.Spec.EnableIPSecVpn {
 		newGw.Status.EnableIPSecVpn = gw.Spec.EnableIPSecVpn
 		if gw.Status.IPSecVpnImage != gw.Spec.IPSecVpnImage {
@@ -350,6 +569,32 @@ func (r *VpnGwReconciler) UpdateVpnGW(ctx context.Context, req ctrl.Request, ips
 		changed = true
 	}
 
+	if gw.Status.EnableWireGuard != gw.Spec.EnableWireGuard {
+		newGw.Status.EnableWireGuard = gw.Spec.EnableWireGuard
+		changed = true
+	}
+	// the wireguard fields are cleared once wireguard is disabled
+	var wireGuard myv1.VpnGwSpec
+	if gw.Spec.EnableWireGuard {
+		wireGuard = gw.Spec
+	}
+	if gw.Status.WireGuardImage != wireGuard.WireGuardImage {
+		newGw.Status.WireGuardImage = wireGuard.WireGuardImage
+		changed = true
+	}
+	if gw.Status.WireGuardSecret != wireGuard.WireGuardSecret {
+		newGw.Status.WireGuardSecret = wireGuard.WireGuardSecret
+		changed = true
+	}
+	if gw.Status.WireGuardListenPort != wireGuard.WireGuardListenPort {
+		newGw.Status.WireGuardListenPort = wireGuard.WireGuardListenPort
+		changed = true
+	}
+	if gw.Status.WireGuardAddressCidr != wireGuard.WireGuardAddressCidr {
+		newGw.Status.WireGuardAddressCidr = wireGuard.WireGuardAddressCidr
+		changed = true
+	}
+
 	if gw.Status.EnableIPSecVpn && ipsecConnections != nil {
 		if !reflect.DeepEqual(gw.Spec.IPSecConnections, ipsecConnections) {
 			newGw.Spec.IPSecConnections = ipsecConnections
@@ -362,6 +607,14 @@ func (r *VpnGwReconciler) UpdateVpnGW(ctx context.Context, req ctrl.Request, ips
 		newGw.Status.Selector = gw.Spec.Selector
 		changed = true
 	}
+	if !reflect.DeepEqual(gw.Spec.Networks, gw.Status.Networks) {
+		newGw.Status.Networks = gw.Spec.Networks
+		changed = true
+	}
+	if !reflect.DeepEqual(gw.Spec.QoS, gw.Status.QoS) {
+		newGw.Status.QoS = gw.Spec.QoS
+		changed = true
+	}
 	if !reflect.DeepEqual(gw.Spec.Tolerations, gw.Status.Tolerations) {
 		newGw.Status.Tolerations = gw.Spec.Tolerations
 		changed = true
@@ -394,11 +647,7 @@ func (r *VpnGwReconciler) statefulSetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlive
 	if oldSts != nil && len(oldSts.Annotations) != 0 {
 		newPodAnnotations = oldSts.Annotations
 	}
-	podAnnotations := map[string]string{
-		util.KubeovnLogicalSwitchAnnotation: ka.Spec.Subnet,
-		util.KubeovnIngressRateAnnotation:   gw.Spec.QoSBandwidth,
-		util.KubeovnEgressRateAnnotation:    gw.Spec.QoSBandwidth,
-	}
+	podAnnotations := r.cniProviderForVpnGw(gw).PodAnnotations(podNetworkForVpnGw(gw, ka.Spec.Subnet))
 	for key, value := range podAnnotations {
 		newPodAnnotations[key] = value
 	}
@@ -407,36 +656,8 @@ func (r *VpnGwReconciler) statefulSetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlive
 	volumes := []corev1.Volume{}
 
 	// keepalived
-	keepalivedContainer := corev1.Container{
-		Name:  util.KeepAlivedServer,
-		Image: ka.Spec.Image,
-		Resources: corev1.ResourceRequirements{
-			Limits: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse(gw.Spec.CPU),
-				corev1.ResourceMemory: resource.MustParse(gw.Spec.Memory),
-			},
-		},
-		Command: []string{util.KeepalivedStartUpCMD},
-		Env: []corev1.EnvVar{
-			{
-				Name:  util.KeepalivedVipKey,
-				Value: ka.Spec.VipV4,
-			},
-			{
-				Name:  util.KeepalivedVirtualRouterID,
-				Value: strconv.Itoa(ka.Status.RouterID),
-			},
-			{
-				Name:  util.KeepalivedNicKey,
-				Value: ka.Spec.Nic,
-			},
-		},
-		ImagePullPolicy: corev1.PullIfNotPresent,
-		SecurityContext: &corev1.SecurityContext{
-			Privileged:               &privileged,
-			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
-		},
-	}
+	keepalivedContainer, keepalivedVolumes := keepalivedContainerForVpnGw(gw, ka)
+	volumes = append(volumes, keepalivedVolumes...)
 
 	if gw.Spec.EnableSslVpn {
 		// config ssl vpn openvpn pod：
@@ -507,7 +728,11 @@ func (r *VpnGwReconciler) statefulSetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlive
 				},
 				{
 					Name:  util.KeepalivedVipKey,
-					Value: ka.Spec.VipV4,
+					Value: keepalivedVipV4(ka),
+				},
+				{
+					Name:  util.SslVpnLocalKey,
+					Value: sslVpnLocal(gw, ka),
 				},
 				{
 					Name:  util.K8sManifestsPathKey,
@@ -546,6 +771,17 @@ func (r *VpnGwReconciler) statefulSetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlive
 			},
 		}
 		volumes = append(volumes, dhSecretVolume)
+		sslContainer.Env = append(sslContainer.Env, sslVpnClientQoSEnv(gw)...)
+		if sslVpnCRLEnabled(gw) {
+			crlEnv, crlMount, crlVolume := sslVpnCRLForVpnGw(gw)
+			sslContainer.Env = append(sslContainer.Env, crlEnv)
+			sslContainer.VolumeMounts = append(sslContainer.VolumeMounts, crlMount)
+			volumes = append(volumes, crlVolume)
+			ccdEnv, ccdMount, ccdVolume := sslVpnCCDForVpnGw(gw)
+			sslContainer.Env = append(sslContainer.Env, ccdEnv...)
+			sslContainer.VolumeMounts = append(sslContainer.VolumeMounts, ccdMount)
+			volumes = append(volumes, ccdVolume)
+		}
 		containers = append(containers, sslContainer)
 	}
 	if gw.Spec.EnableIPSecVpn {
@@ -603,6 +839,23 @@ func (r *VpnGwReconciler) statefulSetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlive
 				AllowPrivilegeEscalation: &allowPrivilegeEscalation,
 			},
 		}
+		// controller rendered swanctl config
+		ipsecConfVolumeMount := corev1.VolumeMount{
+			Name:      util.IPSecVpnConfName,
+			MountPath: util.IPSecVpnConfPath,
+			ReadOnly:  true,
+		}
+		ipsecContainer.VolumeMounts = append(ipsecContainer.VolumeMounts, ipsecConfVolumeMount)
+		ipsecConfVolume := corev1.Volume{
+			Name: util.IPSecVpnConfName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: ipsecConfSecretName(gw),
+					Optional:   &[]bool{true}[0],
+				},
+			},
+		}
+		volumes = append(volumes, ipsecConfVolume)
 		if !gw.Spec.IPSecEnablePSK {
 			// psk or x.509 secret
 			ipsecSecretVolumeMount := corev1.VolumeMount{
@@ -625,6 +878,11 @@ func (r *VpnGwReconciler) statefulSetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlive
 		}
 		containers = append(containers, ipsecContainer)
 	}
+	if gw.Spec.EnableWireGuard {
+		wireGuardContainer, wireGuardVolumes := wireGuardContainerForVpnGw(gw)
+		containers = append(containers, wireGuardContainer)
+		volumes = append(volumes, wireGuardVolumes...)
+	}
 	containers = append(containers, keepalivedContainer)
 	newSts = &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
@@ -643,8 +901,9 @@ func (r *VpnGwReconciler) statefulSetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlive
 					Annotations: newPodAnnotations,
 				},
 				Spec: corev1.PodSpec{
-					Containers: containers,
-					Volumes:    volumes,
+					Containers:            containers,
+					Volumes:               volumes,
+					ShareProcessNamespace: keepalivedSharesProcessNamespace(ka),
 				},
 			},
 			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
@@ -696,16 +955,11 @@ func (r *VpnGwReconciler) daemonsetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlived,
 		newPodAnnotations = oldDs.Annotations
 	}
 	subnet := ""
-	v4Vip := ""
+	v4Vip := keepalivedVipV4(ka)
 	if ka != nil {
 		subnet = ka.Spec.Subnet
-		v4Vip = ka.Spec.VipV4
-	}
-	podAnnotations := map[string]string{
-		util.KubeovnLogicalSwitchAnnotation: subnet,
-		util.KubeovnIngressRateAnnotation:   gw.Spec.QoSBandwidth,
-		util.KubeovnEgressRateAnnotation:    gw.Spec.QoSBandwidth,
 	}
+	podAnnotations := r.cniProviderForVpnGw(gw).PodAnnotations(podNetworkForVpnGw(gw, subnet))
 	for key, value := range podAnnotations {
 		newPodAnnotations[key] = value
 	}
@@ -844,6 +1098,18 @@ func (r *VpnGwReconciler) daemonsetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlived,
 			},
 		}
 		volumes = append(volumes, dhSecretVolume)
+		sslContainer.Env = append(sslContainer.Env, sslVpnClientQoSEnv(gw)...)
+		sslContainer.Env = append(sslContainer.Env, staticPodEnv(gw)...)
+		if sslVpnCRLEnabled(gw) {
+			crlEnv, crlMount, crlVolume := sslVpnCRLForVpnGw(gw)
+			sslContainer.Env = append(sslContainer.Env, crlEnv)
+			sslContainer.VolumeMounts = append(sslContainer.VolumeMounts, crlMount)
+			volumes = append(volumes, crlVolume)
+			ccdEnv, ccdMount, ccdVolume := sslVpnCCDForVpnGw(gw)
+			sslContainer.Env = append(sslContainer.Env, ccdEnv...)
+			sslContainer.VolumeMounts = append(sslContainer.VolumeMounts, ccdMount)
+			volumes = append(volumes, ccdVolume)
+		}
 		containers = append(containers, sslContainer)
 	}
 	if gw.Spec.EnableIPSecVpn {
@@ -918,6 +1184,7 @@ func (r *VpnGwReconciler) daemonsetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlived,
 				AllowPrivilegeEscalation: &allowPrivilegeEscalation,
 			},
 		}
+		ipsecContainer.Env = append(ipsecContainer.Env, staticPodEnv(gw)...)
 		ipsecConfHostVolume := corev1.Volume{
 			Name: util.IPSecVpnCacheName,
 			VolumeSource: corev1.VolumeSource{
@@ -929,6 +1196,23 @@ func (r *VpnGwReconciler) daemonsetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlived,
 			},
 		}
 		volumes = append(volumes, ipsecConfHostVolume)
+		// controller rendered swanctl config
+		ipsecConfVolumeMount := corev1.VolumeMount{
+			Name:      util.IPSecVpnConfName,
+			MountPath: util.IPSecVpnConfPath,
+			ReadOnly:  true,
+		}
+		ipsecContainer.VolumeMounts = append(ipsecContainer.VolumeMounts, ipsecConfVolumeMount)
+		ipsecConfVolume := corev1.Volume{
+			Name: util.IPSecVpnConfName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: ipsecConfSecretName(gw),
+					Optional:   &[]bool{true}[0],
+				},
+			},
+		}
+		volumes = append(volumes, ipsecConfVolume)
 		if !gw.Spec.IPSecEnablePSK {
 			// psk or x.509 secret
 			ipsecSecretVolumeMount := corev1.VolumeMount{
@@ -951,6 +1235,12 @@ func (r *VpnGwReconciler) daemonsetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlived,
 		}
 		containers = append(containers, ipsecContainer)
 	}
+	if gw.Spec.EnableWireGuard {
+		// wireguard runs in the host network daemonset pod directly, no static pod is needed
+		wireGuardContainer, wireGuardVolumes := wireGuardContainerForVpnGw(gw)
+		containers = append(containers, wireGuardContainer)
+		volumes = append(volumes, wireGuardVolumes...)
+	}
 	k8sManifestsVolume := corev1.Volume{
 		Name: util.K8sManifests,
 		VolumeSource: corev1.VolumeSource{
@@ -964,36 +1254,8 @@ func (r *VpnGwReconciler) daemonsetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlived,
 	volumes = append(volumes, k8sManifestsVolume)
 	// need keepalived
 	if ka != nil {
-		keepalivedContainer := corev1.Container{
-			Name:  util.KeepAlivedServer,
-			Image: ka.Spec.Image,
-			Resources: corev1.ResourceRequirements{
-				Limits: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse(gw.Spec.CPU),
-					corev1.ResourceMemory: resource.MustParse(gw.Spec.Memory),
-				},
-			},
-			Command: []string{util.KeepalivedStartUpCMD},
-			Env: []corev1.EnvVar{
-				{
-					Name:  util.KeepalivedVipKey,
-					Value: ka.Spec.VipV4,
-				},
-				{
-					Name:  util.KeepalivedVirtualRouterID,
-					Value: strconv.Itoa(ka.Status.RouterID),
-				},
-				{
-					Name:  util.KeepalivedNicKey,
-					Value: ka.Spec.Nic,
-				},
-			},
-			ImagePullPolicy: corev1.PullIfNotPresent,
-			SecurityContext: &corev1.SecurityContext{
-				Privileged:               &privileged,
-				AllowPrivilegeEscalation: &allowPrivilegeEscalation,
-			},
-		}
+		keepalivedContainer, keepalivedVolumes := keepalivedContainerForVpnGw(gw, ka)
+		volumes = append(volumes, keepalivedVolumes...)
 		containers = append(containers, keepalivedContainer)
 	}
 	newDs = &appsv1.DaemonSet{
@@ -1012,8 +1274,9 @@ func (r *VpnGwReconciler) daemonsetForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlived,
 					Annotations: newPodAnnotations,
 				},
 				Spec: corev1.PodSpec{
-					Containers: containers,
-					Volumes:    volumes,
+					Containers:            containers,
+					Volumes:               volumes,
+					ShareProcessNamespace: keepalivedSharesProcessNamespace(ka),
 					// host network
 					HostNetwork: true,
 				},
@@ -1086,11 +1349,10 @@ func (r *VpnGwReconciler) handleAddOrUpdateVpnStatefulset(req ctrl.Request, gw *
 			r.Log.Error(err, "failed to create the new statefulset")
 			return err
 		}
-		time.Sleep(5 * time.Second)
 		return nil
 	}
 	// update
-	if r.isChanged(newGw, nil) {
+	if r.isChanged(newGw, nil) || keepalivedProcessNamespaceChanged(&oldSts.Spec.Template.Spec, ka) {
 		// update statefulset
 		newSts := r.statefulSetForVpnGw(gw, ka, oldSts.DeepCopy())
 		err = r.Update(context.Background(), newSts)
@@ -1098,7 +1360,6 @@ func (r *VpnGwReconciler) handleAddOrUpdateVpnStatefulset(req ctrl.Request, gw *
 			r.Log.Error(err, "failed to update the statefulset")
 			return err
 		}
-		time.Sleep(5 * time.Second)
 		return nil
 	}
 	// no change
@@ -1129,18 +1390,16 @@ func (r *VpnGwReconciler) handleAddOrUpdateVpnDaemonset(req ctrl.Request, gw *my
 			r.Log.Error(err, "failed to create the new daemonset")
 			return err
 		}
-		time.Sleep(5 * time.Second)
 		return nil
 	}
 	// update daemonset
-	if r.isChanged(newGw, nil) {
+	if r.isChanged(newGw, nil) || keepalivedProcessNamespaceChanged(&oldDs.Spec.Template.Spec, ka) {
 		newSts := r.daemonsetForVpnGw(gw, ka, oldDs.DeepCopy())
 		err = r.Update(context.Background(), newSts)
 		if err != nil {
 			r.Log.Error(err, "failed to update the daemonset")
 			return err
 		}
-		time.Sleep(5 * time.Second)
 		return nil
 	}
 	// no change
@@ -1148,89 +1407,91 @@ func (r *VpnGwReconciler) handleAddOrUpdateVpnDaemonset(req ctrl.Request, gw *my
 	return nil
 }
 
-func (r *VpnGwReconciler) validateIPSecConns(gw *myv1.VpnGw, conns *[]myv1.IpsecConn) (string, SyncState, error) {
-	if gw.Spec.IPSecEnablePSK && gw.Spec.DefaultPSK == "" {
-		err := fmt.Errorf("vpn gw %s should have one default psk", gw.Name)
-		r.Log.Error(err, "invalid ipsec connection")
-		return "", SyncStateError, err
-	}
-	connections := ""
+func (r *VpnGwReconciler) validateIPSecConns(ctx context.Context, gw *myv1.VpnGw, conns *[]myv1.IpsecConn) (*ipsec.Config, SyncState, error) {
+	conf := &ipsec.Config{EnablePSK: gw.Spec.IPSecEnablePSK}
 	for _, con := range *conns {
+		con.SetDefaults()
 		if gw.Spec.IPSecEnablePSK {
 			if con.Spec.ESPProposals == "" {
 				err := fmt.Errorf("vpn gw %s ipsec connection should have esp proposals", gw.Name)
 				r.Log.Error(err, "invalid ipsec connection")
-				return "", SyncStateError, err
+				return nil, SyncStateError, err
 			}
 			if con.Spec.IKEProposals == "" {
 				err := fmt.Errorf("vpn gw %s ipsec connection should have ike proposals", gw.Name)
 				r.Log.Error(err, "invalid ipsec connection")
-				return "", SyncStateError, err
+				return nil, SyncStateError, err
 			}
 		}
 		if con.Spec.VpnGw == "" || con.Spec.VpnGw != gw.Name {
 			err := fmt.Errorf("vpn gw %s ipsec connection %s not belong to vpn gw", gw.Name, con.Name)
 			r.Log.Error(err, "ignore invalid ipsec connection")
-			return "", SyncStateError, err
+			return nil, SyncStateError, err
 		}
 		if con.Spec.Auth == "" {
 			err := fmt.Errorf("vpn gw %s ipsec connection %s should have auth", gw.Name, con.Name)
 			r.Log.Error(err, "invalid ipsec connection")
-			return "", SyncStateError, err
+			return nil, SyncStateError, err
 		}
 		if con.Spec.IkeVersion == "" {
 			err := fmt.Errorf("vpn gw %s ipsec connection %s should have ikeVersion", gw.Name, con.Name)
 			r.Log.Error(err, "invalid ipsec connection")
-			return "", SyncStateError, err
+			return nil, SyncStateError, err
 		}
 		if con.Spec.IKEProposals == "" {
 			err := fmt.Errorf("vpn gw %s ipsec connection %s should have proposals", gw.Name, con.Name)
 			r.Log.Error(err, "invalid ipsec connection")
-			return "", SyncStateError, err
+			return nil, SyncStateError, err
 		}
 		if con.Spec.LocalVIP == "" {
 			err := fmt.Errorf("vpn gw %s ipsec connection %s should have LocalVIP", gw.Name, con.Name)
 			r.Log.Error(err, "invalid ipsec connection")
-			return "", SyncStateError, err
+			return nil, SyncStateError, err
 		}
 		if con.Spec.LocalEIP == "" {
 			err := fmt.Errorf("vpn gw %s ipsec connection %s should have localEIP", gw.Name, con.Name)
 			r.Log.Error(err, "invalid ipsec connection")
-			return "", SyncStateError, err
+			return nil, SyncStateError, err
 		}
 		if con.Spec.LocalPrivateCidrs == "" {
 			err := fmt.Errorf("vpn gw %s ipsec connection %s should have localPrivateCidrs", gw.Name, con.Name)
 			r.Log.Error(err, "invalid ipsec connection")
-			return "", SyncStateError, err
+			return nil, SyncStateError, err
 		}
 		if con.Spec.RemoteEIP == "" {
 			err := fmt.Errorf("vpn gw %s ipsec connection %s should have remoteEIP", gw.Name, con.Name)
 			r.Log.Error(err, "invalid ipsec connection")
-			return "", SyncStateError, err
+			return nil, SyncStateError, err
 		}
 		if con.Spec.RemotePrivateCidrs == "" {
 			err := fmt.Errorf("vpn gw %s ipsec connection %s should have remotePrivateCidrs", gw.Name, con.Name)
 			r.Log.Error(err, "invalid ipsec connection")
-			return "", SyncStateError, err
+			return nil, SyncStateError, err
 		}
 
 		if con.Spec.Auth == "pubkey" {
 			if con.Spec.RemoteCN == "" || con.Spec.LocalCN == "" {
 				err := fmt.Errorf("vpn gw %s ipsec connection %s should have remoteCN, localCN", gw.Name, con.Name)
 				r.Log.Error(err, "invalid ipsec connection")
-				return "", SyncStateError, err
+				return nil, SyncStateError, err
 			}
 		}
-		// use ":" to split connection
-		if con.Spec.Auth == "pubkey" {
-			connections += fmt.Sprintf("%s %s %s %s %s %s %s %s %s %s:",
-				con.Name, con.Spec.Auth, con.Spec.IkeVersion, con.Spec.IKEProposals,
-				con.Spec.LocalCN, con.Spec.LocalEIP, con.Spec.LocalPrivateCidrs,
-				con.Spec.RemoteCN, con.Spec.RemoteEIP, con.Spec.RemotePrivateCidrs,
-			)
-		}
-		if con.Spec.Auth == "psk" {
-			if gw.Spec.WorkloadType == "static" {
+		connection := ipsec.Connection{
+			Name:               con.Name,
+			Auth:               con.Spec.Auth,
+			IkeVersion:         con.Spec.IkeVersion,
+			IKEProposals:       con.Spec.IKEProposals,
+			ESPProposals:       con.Spec.ESPProposals,
+			LocalCN:            con.Spec.LocalCN,
+			LocalVIP:           con.Spec.LocalVIP,
+			LocalEIP:           con.Spec.LocalEIP,
+			LocalPrivateCidrs:  util.SplitCidrs(con.Spec.LocalPrivateCidrs),
+			RemoteCN:           con.Spec.RemoteCN,
+			RemoteEIP:          con.Spec.RemoteEIP,
+			RemotePrivateCidrs: util.SplitCidrs(con.Spec.RemotePrivateCidrs),
+		}
+		if con.Spec.Auth == ipsec.AuthPSK {
+			if gw.Spec.WorkloadType == myv1.WorkloadTypeStatic {
 				// host network static pod may use keepalived out of kubecombo
 				// should set local vip and gateway
 				if con.Spec.LocalGateway == "" && con.Spec.LocalGatewayNic != "" {
@@ -1240,31 +1501,31 @@ func (r *VpnGwReconciler) validateIPSecConns(gw *myv1.VpnGw, conns *[]myv1.Ipsec
 				if con.Spec.LocalGateway != "" && con.Spec.LocalGatewayNic == "" {
 					err := fmt.Errorf("vpn gw %s ipsec connection %s should have localGatewayNic", gw.Name, con.Name)
 					r.Log.Error(err, "invalid ipsec connection")
-					return "", SyncStateError, err
+					return nil, SyncStateError, err
 				}
 			}
-			connections += fmt.Sprintf("%s %s %s %s %s %s %s %s %s %s %s",
-				con.Name, con.Spec.Auth, con.Spec.IkeVersion, con.Spec.IKEProposals,
-				con.Spec.LocalVIP, con.Spec.LocalEIP, con.Spec.LocalPrivateCidrs,
-				con.Spec.RemoteEIP, con.Spec.RemotePrivateCidrs,
-				gw.Spec.DefaultPSK, con.Spec.ESPProposals,
-			)
 			if con.Spec.LocalGateway != "" && con.Spec.LocalGatewayNic != "" {
-				connections += fmt.Sprintf(" %s %s:", con.Spec.LocalGateway, con.Spec.LocalGatewayNic)
-			} else {
-				connections += ":"
+				connection.LocalGateway = con.Spec.LocalGateway
+				connection.LocalGatewayNic = con.Spec.LocalGatewayNic
 			}
+			psk, err := r.resolvePSK(ctx, gw, &con)
+			if err != nil {
+				r.Log.Error(err, "failed to resolve ipsec connection psk", "ipsecConn", con.Name)
+				// the secret may be created later, which triggers the vpn gw again
+				return nil, SyncStateError, err
+			}
+			connection.PSK = psk
 		}
+		if connection.LocalGatewayNic == "" {
+			// the encrypted traffic goes through the secondary interface which holds the local vip
+			connection.LocalGatewayNic = ipsecLocalGatewayNic(gw, con.Spec.LocalVIP)
+		}
+		conf.Connections = append(conf.Connections, connection)
 	}
-	if connections == "" {
-		err := fmt.Errorf("vpn gw %s ipsec connection should have connections", gw.Name)
-		r.Log.Error(err, "invalid ipsec connection")
-		return "", SyncStateError, err
-	}
-	return connections, SyncStateSuccess, nil
+	return conf, SyncStateSuccess, nil
 }
 
-func (r *VpnGwReconciler) handleAddOrUpdateVpnGw(ctx context.Context, req ctrl.Request) (SyncState, error) {
+func (r *VpnGwReconciler) handleAddOrUpdateVpnGw(ctx context.Context, req ctrl.Request) (SyncState, waitReason, error) {
 	// create vpn gw statefulset
 	namespacedName := req.NamespacedName.String()
 	r.Log.Info("start handleAddOrUpdateVpnGw", "vpn gw", namespacedName)
@@ -1274,18 +1535,29 @@ func (r *VpnGwReconciler) handleAddOrUpdateVpnGw(ctx context.Context, req ctrl.R
 	gw, err := r.getVpnGw(ctx, req.NamespacedName)
 	if err != nil {
 		r.Log.Error(err, "failed to get vpn gw")
-		return SyncStateErrorNoRetry, err
+		return SyncStateErrorNoRetry, waitNone, err
 	}
 	if gw == nil {
 		// vpn gw deleted
-		return SyncStateSuccess, nil
+		return SyncStateSuccess, waitNone, nil
+	}
+	gw.SetDefaults(r.Defaults)
+	if !gw.DeletionTimestamp.IsZero() {
+		return r.handleDelVpnGw(ctx, gw)
 	}
 	if err := r.validateVpnGw(gw); err != nil {
 		r.Log.Error(err, "failed to validate vpn gw")
 		// invalid spec, no retry
-		return SyncStateErrorNoRetry, err
+		return SyncStateErrorNoRetry, waitNone, err
+	}
+	if staticPodsEnabled(gw) {
+		// the static pods copied by the daemonset are left on the nodes once the daemonset is deleted
+		if err := r.addStaticPodFinalizer(ctx, gw); err != nil {
+			return SyncStateError, waitNone, err
+		}
 	}
 	var ka *myv1.KeepAlived
+	var keepalivedFiles map[string]string
 	if gw.Spec.Keepalived != "" {
 		ka = &myv1.KeepAlived{
 			ObjectMeta: metav1.ObjectMeta{
@@ -1296,95 +1568,451 @@ func (r *VpnGwReconciler) handleAddOrUpdateVpnGw(ctx context.Context, req ctrl.R
 		ka, err = r.getKeepalived(ctx, ka)
 		if err != nil {
 			r.Log.Error(err, "failed to get keepalived")
-			return SyncStateError, err
+			return SyncStateError, waitNone, err
 		}
+		ka.SetDefaults(r.Defaults)
 		if err := r.validateKeepalived(ka); err != nil {
 			r.Log.Error(err, "failed to validate keepalived")
 			// invalid spec no retry
-			return SyncStateErrorNoRetry, err
+			return SyncStateErrorNoRetry, waitNone, err
 		}
-		if ka.Status.RouterID == 0 {
-			r.Log.Error(err, "keepalived router id not ready to use, please wait a while")
-			time.Sleep(1 * time.Second)
-			return SyncStateError, err
+		if !routerIDsAllocated(ka) {
+			r.Log.Info("keepalived router id not ready to use, please wait a while", "keepalived", ka.Name)
+			return r.waitFor(ctx, gw, waitForKeepalived, fmt.Sprintf("keepalived %s router id is not allocated yet", ka.Name))
+		}
+		var state SyncState
+		keepalivedFiles, state, err = r.renderKeepalived(ctx, gw, ka)
+		if err != nil {
+			r.Log.Error(err, "failed to render keepalived config")
+			return state, waitNone, err
 		}
 	}
 	// create vpn gw or update
 	// statefulset for vpc case
 	// daemonset for static pod case
-	if gw.Spec.WorkloadType == "statefulset" {
+	if gw.Spec.WorkloadType == myv1.WorkloadTypeStatefulset {
 		if err := r.handleAddOrUpdateVpnStatefulset(req, gw, ka); err != nil {
 			r.Log.Error(err, "failed to handleAddOrUpdateVpnStatefulset")
-			return SyncStateError, err
+			return SyncStateError, waitNone, err
 		}
 	} else {
 		if err := r.handleAddOrUpdateVpnDaemonset(req, gw, ka); err != nil {
 			r.Log.Error(err, "failed to handleAddOrUpdateVpnDaemonset")
-			return SyncStateError, err
+			return SyncStateError, waitNone, err
+		}
+	}
+	if keepalivedFiles != nil {
+		if state, wait, err := r.reloadKeepalived(ctx, gw, keepalivedFiles); err != nil || wait != waitNone {
+			return state, wait, err
 		}
 	}
 
 	var conns []string
+	connCount := 0
 	if gw.Spec.EnableIPSecVpn {
 		// refresh ipsec connections
 		res, err := r.getIpsecConnections(context.Background(), gw)
 		if err != nil {
 			r.Log.Error(err, "failed to list vpn gw ipsec connections")
-			return SyncStateError, err
-		}
-		if len(*res) == 0 {
-			err := fmt.Errorf("vpn gw %s has no ipsec connections", gw.Name)
-			r.Log.Error(err, "no ipsec connections, wait a while to refresh")
-			time.Sleep(5 * time.Second)
-			return SyncStateError, err
+			return SyncStateError, waitNone, err
 		}
+		// no ipsec connections is valid, render an empty config to unload all of them
+		connCount = len(*res)
 
-		// format ipsec connections
-		connections, state, err := r.validateIPSecConns(gw, res)
+		// render ipsec connections
+		conf, state, err := r.validateIPSecConns(ctx, gw, res)
 		if err != nil {
 			r.Log.Error(err, "failed to validate ipsec connections")
-			return state, err
+			return state, waitNone, err
 		}
-
-		// exec pod to run cmd to refresh ipsec connections
-		cmd := fmt.Sprintf(util.IPSecRefreshConnectionX509Template, connections)
-		if gw.Spec.IPSecEnablePSK {
-			cmd = fmt.Sprintf(util.IPSecRefreshConnectionPSKTemplate, connections)
+		files, err := conf.Render()
+		if err != nil {
+			r.Log.Error(err, "failed to render ipsec connections")
+			return SyncStateErrorNoRetry, waitNone, err
+		}
+		if err := r.handleAddOrUpdateConfSecret(ctx, gw, ipsecConfSecretName(gw), files); err != nil {
+			r.Log.Error(err, "failed to handleAddOrUpdateConfSecret")
+			return SyncStateError, waitNone, err
 		}
+
+		// exec pod to reload the mounted swanctl config
+		cmd := fmt.Sprintf(util.IPSecReloadConnectionTemplate, util.Hash(files[ipsec.SwanctlConfKey]))
 		// get pods
 		podNames, podNotRunErr := r.getVpnGwPodNames(context.Background(), req.NamespacedName, gw)
 		for _, podName := range podNames {
-			r.Log.Info("refresh ipsec connections start", "pod", podName, "cmd", cmd)
-			// refresh ipsec connections by exec pod
+			r.Log.Info("reload ipsec connections start", "pod", podName, "cmd", cmd)
+			// reload ipsec connections by exec pod
 			stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, gw.Namespace, podName, util.IPSecVpnServer, []string{"/bin/bash", "-c", cmd}...)
 			if err != nil {
+				var exitErr utilexec.ExitError
+				if errors.As(err, &exitErr) && exitErr.ExitStatus() == util.ReloadNotSyncedCode {
+					r.Log.Info("swanctl config is not synced to the pod yet", "pod", podName)
+					return r.waitFor(ctx, gw, waitForConfigSync, fmt.Sprintf("swanctl config is not synced to pod %s yet", podName))
+				}
 				if len(errOutput) > 0 {
 					err = fmt.Errorf("failed to ExecuteCommandInContainer, errOutput: %v", errOutput)
-					r.Log.Error(err, "failed to refresh vpn gw ipsec connections")
+					r.Log.Error(err, "failed to reload vpn gw ipsec connections")
 				}
 				if len(stdOutput) > 0 {
-					err = fmt.Errorf("failed to ExecuteCommandInContainer, errOutput: %v", errOutput)
-					r.Log.Error(err, "failed to refresh vpn gw ipsec connections")
+					err = fmt.Errorf("failed to ExecuteCommandInContainer, stdOutput: %v", stdOutput)
+					r.Log.Error(err, "failed to reload vpn gw ipsec connections")
+				}
+				return SyncStateError, waitNone, err
+			}
+			if gw.Spec.WorkloadType == myv1.WorkloadTypeStatefulset {
+				// the static pods load the connections by the check script
+				if err := loadIPSecConns(ctx, r.KubeClient, r.RestConfig, gw.Namespace, podName, conf.ViciConns()); err != nil {
+					r.Log.Error(err, "failed to load vpn gw ipsec connections", "pod", podName)
+					return SyncStateError, waitNone, err
 				}
-				time.Sleep(5 * time.Second)
-				return SyncStateError, err
 			}
-			r.Log.Info("refresh ipsec connections ok", "pod", podName, "output", stdOutput)
+			r.Log.Info("reload ipsec connections ok", "pod", podName, "output", stdOutput)
 		}
 		if podNotRunErr != nil {
-			r.Log.Error(podNotRunErr, "pod not running now")
-			time.Sleep(5 * time.Second)
-			return SyncStateError, podNotRunErr
+			r.Log.Info("pod not running now", "reason", podNotRunErr.Error())
+			return r.waitFor(ctx, gw, waitForPods, podNotRunErr.Error())
 		}
 		for _, conn := range *res {
 			conns = append(conns, conn.Name)
 		}
 	}
+	if sslVpnCRLEnabled(gw) {
+		if state, wait, err := r.handleSslVpnCRL(ctx, gw); err != nil || wait != waitNone {
+			return state, wait, err
+		}
+		if state, wait, err := r.handleSslVpnCCD(ctx, gw); err != nil || wait != waitNone {
+			return state, wait, err
+		}
+	} else if err := r.updateSslVpnCRLStatus(ctx, gw, 0, nil); err != nil {
+		r.Log.Error(err, "failed to update vpn gw ssl vpn crl status")
+		return SyncStateError, waitNone, err
+	}
+	if gw.Spec.EnableWireGuard {
+		if state, wait, err := r.handleWireGuard(ctx, gw); err != nil || wait != waitNone {
+			return state, wait, err
+		}
+	} else if err := r.updateWireGuardStatus(ctx, gw, nil, ""); err != nil {
+		r.Log.Error(err, "failed to update vpn gw wireguard status")
+		return SyncStateError, waitNone, err
+	}
+	if err := r.syncStaticPodDrift(ctx, gw); err != nil {
+		r.Log.Error(err, "failed to sync vpn gw static pod drift")
+		return SyncStateError, waitNone, err
+	}
 	if err := r.UpdateVpnGW(ctx, req, conns); err != nil {
 		r.Log.Error(err, "failed to update vpn gw status")
-		return SyncStateError, err
+		return SyncStateError, waitNone, err
 	}
-	return SyncStateSuccess, nil
+	conditions := append(waitConditions(gw, waitNone, ""), noConnectionsCondition(gw, connCount))
+	if err := r.updateVpnGwConditions(ctx, gw, conditions...); err != nil {
+		r.Log.Error(err, "failed to update vpn gw conditions")
+		return SyncStateError, waitNone, err
+	}
+	return SyncStateSuccess, waitNone, nil
+}
+
+// waitReason is why the vpn gw reconcile has to wait before going on,
+// it is reported as the vpn gw condition of the same type
+type waitReason string
+
+const (
+	waitNone          waitReason = ""
+	waitForKeepalived waitReason = myv1.VpnGwWaitingForKeepalived
+	waitForPods       waitReason = myv1.VpnGwWaitingForPods
+	waitForConfigSync waitReason = myv1.VpnGwWaitingForConfigSync
+	waitForCleanup    waitReason = myv1.VpnGwWaitingForCleanup
+)
+
+var waitReasons = []waitReason{waitForKeepalived, waitForPods, waitForConfigSync, waitForCleanup}
+
+// requeueAfter is how long to wait before reconciling the vpn gw again
+func (w waitReason) requeueAfter() time.Duration {
+	switch w {
+	case waitForKeepalived:
+		return 2 * time.Second
+	case waitForPods, waitForConfigSync, waitForCleanup:
+		return 5 * time.Second
+	}
+	return 0
+}
+
+// conditionReason is the condition reason while waiting
+func (w waitReason) conditionReason() string {
+	switch w {
+	case waitForKeepalived:
+		return "RouterIDNotAllocated"
+	case waitForPods:
+		return "PodNotRunning"
+	case waitForConfigSync:
+		return "ConfigNotSynced"
+	case waitForCleanup:
+		return "StaticPodsNotCleaned"
+	}
+	return ""
+}
+
+// waitFor records why the vpn gw is waiting in its conditions, the reconcile is requeued after a while
+func (r *VpnGwReconciler) waitFor(ctx context.Context, gw *myv1.VpnGw, reason waitReason, message string) (SyncState, waitReason, error) {
+	if err := r.updateVpnGwConditions(ctx, gw, waitConditions(gw, reason, message)...); err != nil {
+		r.Log.Error(err, "failed to update vpn gw conditions")
+		return SyncStateError, waitNone, err
+	}
+	return SyncStateSuccess, reason, nil
+}
+
+// waitConditions marks the waiting reason true and the others false
+func waitConditions(gw *myv1.VpnGw, reason waitReason, message string) []metav1.Condition {
+	conditions := make([]metav1.Condition, 0, len(waitReasons))
+	for _, w := range waitReasons {
+		condition := metav1.Condition{
+			Type:               string(w),
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: gw.Generation,
+			Reason:             "NotWaiting",
+		}
+		if w == reason {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = w.conditionReason()
+			condition.Message = message
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions
+}
+
+func noConnectionsCondition(gw *myv1.VpnGw, count int) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               myv1.VpnGwNoConnections,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: gw.Generation,
+		Reason:             "ConnectionsFound",
+		Message:            fmt.Sprintf("%d ipsec connections", count),
+	}
+	if !gw.Spec.EnableIPSecVpn {
+		condition.Reason = "IPSecVpnDisabled"
+		condition.Message = "ipsec vpn is not enabled"
+		return condition
+	}
+	if count == 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "NoIpsecConnections"
+		condition.Message = "vpn gw has no ipsec connections"
+	}
+	return condition
+}
+
+// updateVpnGwConditions sets the conditions on the latest vpn gw status
+func (r *VpnGwReconciler) updateVpnGwConditions(ctx context.Context, gw *myv1.VpnGw, conditions ...metav1.Condition) error {
+	latest, err := r.getVpnGw(ctx, types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace})
+	if err != nil || latest == nil {
+		return err
+	}
+	newGw := latest.DeepCopy()
+	for _, condition := range conditions {
+		meta.SetStatusCondition(&newGw.Status.Conditions, condition)
+	}
+	if reflect.DeepEqual(latest.Status.Conditions, newGw.Status.Conditions) {
+		return nil
+	}
+	return r.Status().Update(ctx, newGw)
+}
+
+// resolvePSK returns the base64 encoded psk of the ipsec connection,
+// its own secret takes precedence over the vpn gw default psk
+func (r *VpnGwReconciler) resolvePSK(ctx context.Context, gw *myv1.VpnGw, conn *myv1.IpsecConn) (string, error) {
+	if conn.Spec.PSKSecretRef != nil {
+		psk, err := r.getSecretKey(ctx, conn.Namespace, conn.Spec.PSKSecretRef)
+		if err != nil || psk != "" {
+			return psk, err
+		}
+	}
+	if gw.Spec.DefaultPSKSecretRef != nil {
+		psk, err := r.getSecretKey(ctx, gw.Namespace, gw.Spec.DefaultPSKSecretRef)
+		if err != nil || psk != "" {
+			return psk, err
+		}
+	}
+	if gw.Spec.DefaultPSK != "" {
+		return gw.Spec.DefaultPSK, nil
+	}
+	return "", fmt.Errorf("ipsec connection %s has no psk, and vpn gw %s has no default psk", conn.Name, gw.Name)
+}
+
+// getSecretKey returns the base64 encoded value of the secret key, empty if an optional key is missing
+func (r *VpnGwReconciler) getSecretKey(ctx context.Context, namespace string, ref *corev1.SecretKeySelector) (string, error) {
+	optional := ref.Optional != nil && *ref.Optional
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+		if apierrors.IsNotFound(err) && optional {
+			return "", nil
+		}
+		return "", err
+	}
+	value := secret.Data[ref.Key]
+	if len(value) == 0 {
+		if optional {
+			return "", nil
+		}
+		return "", fmt.Errorf("secret %s/%s has no key %s", namespace, ref.Name, ref.Key)
+	}
+	return base64.StdEncoding.EncodeToString(value), nil
+}
+
+// enqueueVpnGwForIpsecConn enqueues the vpn gw of the ipsec connection,
+// and the one in its vpn-gw label which may be the previous vpn gw before spec.vpnGw changed
+func (r *VpnGwReconciler) enqueueVpnGwForIpsecConn(_ context.Context, obj client.Object) []reconcile.Request {
+	conn, ok := obj.(*myv1.IpsecConn)
+	if !ok {
+		return nil
+	}
+	var requests []reconcile.Request
+	if conn.Spec.VpnGw != "" {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: conn.Spec.VpnGw, Namespace: conn.Namespace}})
+	}
+	if name := conn.Labels[util.VpnGwLabel]; name != "" && name != conn.Spec.VpnGw {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: conn.Namespace}})
+	}
+	return requests
+}
+
+// vpnGwSecrets returns the secrets the vpn gw reads in the reconcile, the mounted ones are synced by kubelet
+func vpnGwSecrets(gw *myv1.VpnGw) []string {
+	var secrets []string
+	if gw.Spec.DefaultPSKSecretRef != nil {
+		secrets = append(secrets, gw.Spec.DefaultPSKSecretRef.Name)
+	}
+	if gw.Spec.EnableWireGuard && gw.Spec.WireGuardSecret != "" {
+		secrets = append(secrets, gw.Spec.WireGuardSecret)
+	}
+	if sslVpnCRLEnabled(gw) {
+		secrets = append(secrets, gw.Spec.SslVpnCASecret, gw.Spec.SslVpnSecret)
+	}
+	slices.Sort(secrets)
+	return slices.Compact(secrets)
+}
+
+// enqueueVpnGwForSecret enqueues the vpn gws which read the secret, and the ones whose ipsec connections use it as the psk
+func (r *VpnGwReconciler) enqueueVpnGwForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+	seen := map[string]bool{}
+	enqueue := func(name string) {
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: obj.GetNamespace()}})
+	}
+	gws := &myv1.VpnGwList{}
+	if err := r.List(ctx, gws, client.InNamespace(obj.GetNamespace()), client.MatchingFields{vpnGwSecretField: obj.GetName()}); err != nil {
+		r.Log.Error(err, "failed to list vpn gw", "namespace", obj.GetNamespace())
+		return nil
+	}
+	for _, gw := range gws.Items {
+		enqueue(gw.Name)
+	}
+	conns := &myv1.IpsecConnList{}
+	if err := r.List(ctx, conns, client.InNamespace(obj.GetNamespace()), client.MatchingFields{ipsecConnPSKSecretField: obj.GetName()}); err != nil {
+		r.Log.Error(err, "failed to list ipsec connections", "namespace", obj.GetNamespace())
+		return nil
+	}
+	for _, conn := range conns.Items {
+		enqueue(conn.Spec.VpnGw)
+	}
+	return requests
+}
+
+func ipsecConfSecretName(gw *myv1.VpnGw) string {
+	return gw.Name + util.IPSecVpnConfSecretSuffix
+}
+
+// handleAddOrUpdateConfSecret keeps the rendered config in a secret mounted by the vpn container
+func (r *VpnGwReconciler) handleAddOrUpdateConfSecret(ctx context.Context, gw *myv1.VpnGw, secretName string, files map[string]string) error {
+	name := types.NamespacedName{Name: secretName, Namespace: gw.Namespace}
+	oldSecret := &corev1.Secret{}
+	err := r.Get(ctx, name, oldSecret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		r.Log.Error(err, "failed to get conf secret", "secret", name.String())
+		return err
+	}
+	if apierrors.IsNotFound(err) {
+		newSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name.Name,
+				Namespace: name.Namespace,
+				Labels:    labelsForVpnGw(gw),
+			},
+			StringData: files,
+		}
+		// set gw instance as the owner and controller
+		if err := controllerutil.SetControllerReference(gw, newSecret, r.Scheme); err != nil {
+			r.Log.Error(err, "failed to set vpn gw as the owner and controller")
+			return err
+		}
+		if err := r.Create(ctx, newSecret); err != nil {
+			r.Log.Error(err, "failed to create conf secret", "secret", name.String())
+			return err
+		}
+		return nil
+	}
+	changed := len(oldSecret.Data) != len(files)
+	for key, value := range files {
+		if string(oldSecret.Data[key]) != value {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+	newSecret := oldSecret.DeepCopy()
+	newSecret.Data = nil
+	newSecret.StringData = files
+	if err := r.Update(ctx, newSecret); err != nil {
+		r.Log.Error(err, "failed to update conf secret", "secret", name.String())
+		return err
+	}
+	return nil
+}
+
+// getContainerPodNames returns the vpn gw pods running the container,
+// the static pods copied by the daemonset are skipped
+func (r *VpnGwReconciler) getContainerPodNames(ctx context.Context, gw *myv1.VpnGw, containerName string) ([]string, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(gw.Namespace), client.MatchingLabels{util.VpnGwLabel: gw.Name}); err != nil {
+		r.Log.Error(err, "failed to list pods", "namespace", gw.Namespace)
+		return nil, err
+	}
+	podNames := []string{}
+	badPodNames := []string{}
+	for _, pod := range pods.Items {
+		if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+			continue
+		}
+		hasContainer := false
+		for _, container := range pod.Spec.Containers {
+			if container.Name == containerName {
+				hasContainer = true
+				break
+			}
+		}
+		if !hasContainer {
+			// the pod is not rolled out yet
+			badPodNames = append(badPodNames, pod.Name)
+			continue
+		}
+		if pod.Status.Phase != corev1.PodRunning {
+			badPodNames = append(badPodNames, pod.Name)
+			continue
+		}
+		podNames = append(podNames, pod.Name)
+	}
+	if len(badPodNames) != 0 {
+		return nil, fmt.Errorf("pod %v is not running %s now", badPodNames, containerName)
+	}
+	if len(podNames) == 0 {
+		return nil, fmt.Errorf("gw %s has no running %s pod", gw.Name, containerName)
+	}
+	return podNames, nil
 }
 
 func (r *VpnGwReconciler) getVpnGwPodNames(ctx context.Context, name types.NamespacedName, gw *myv1.VpnGw) ([]string, error) {
@@ -1432,15 +2060,22 @@ func (r *VpnGwReconciler) getVpnGw(ctx context.Context, name types.NamespacedNam
 	return &res, nil
 }
 
-// returns all ipsec connections who has labels about the vpn gw
+// returns all ipsec connections of the vpn gw by the spec.vpnGw index
+// the deleting ones are skipped, they are unloaded by the ipsec connection finalizer
 func (r *VpnGwReconciler) getIpsecConnections(ctx context.Context, gw *myv1.VpnGw) (*[]myv1.IpsecConn, error) {
 	var res myv1.IpsecConnList
-	err := r.List(ctx, &res, client.MatchingLabels{util.VpnGwLabel: gw.Name})
+	err := r.List(ctx, &res, client.InNamespace(gw.Namespace), client.MatchingFields{ipsecConnVpnGwField: gw.Name})
 	if err != nil {
 		r.Log.Error(err, "failed to list vpn gw ipsec connections")
 		return nil, err
 	}
-	return &res.Items, nil
+	conns := []myv1.IpsecConn{}
+	for _, conn := range res.Items {
+		if conn.DeletionTimestamp.IsZero() {
+			conns = append(conns, conn)
+		}
+	}
+	return &conns, nil
 }
 
 func (r *VpnGwReconciler) getKeepalived(ctx context.Context, ka *myv1.KeepAlived) (*myv1.KeepAlived, error) {
@@ -0,0 +1,324 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilexec "k8s.io/utils/exec"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/keepalived"
+	"github.com/kubecombo/kube-combo/internal/util"
+	"github.com/kubecombo/kube-combo/internal/wireguard"
+)
+
+func keepalivedConfConfigMapName(gw *myv1.VpnGw) string {
+	return gw.Name + util.KeepalivedConfConfigMapSuffix
+}
+
+// keepalivedContainerForVpnGw returns the keepalived container and its volumes,
+// it is the same in the statefulset and the host network daemonset
+func keepalivedContainerForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlived) (corev1.Container, []corev1.Volume) {
+	allowPrivilegeEscalation := true
+	privileged := true
+	container := corev1.Container{
+		Name:  util.KeepAlivedServer,
+		Image: ka.Spec.Image,
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(gw.Spec.CPU),
+				corev1.ResourceMemory: resource.MustParse(gw.Spec.Memory),
+			},
+		},
+		Command: []string{util.KeepalivedStartUpCMD},
+		VolumeMounts: []corev1.VolumeMount{
+			// controller rendered keepalived.conf
+			{
+				Name:      util.KeepalivedConfName,
+				MountPath: util.KeepalivedConfPath,
+				ReadOnly:  true,
+			},
+		},
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		SecurityContext: &corev1.SecurityContext{
+			Privileged:               &privileged,
+			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		},
+	}
+	volumes := []corev1.Volume{
+		{
+			Name: util.KeepalivedConfName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: keepalivedConfConfigMapName(gw)},
+					Optional:             &[]bool{true}[0],
+				},
+			},
+		},
+	}
+	return container, volumes
+}
+
+// keepalivedSharesProcessNamespace reports whether the vpn gw pod containers share the process namespace,
+// so keepalived sees the processes it tracks
+func keepalivedSharesProcessNamespace(ka *myv1.KeepAlived) *bool {
+	if ka == nil || len(ka.Spec.TrackProcesses) == 0 {
+		return nil
+	}
+	return &[]bool{true}[0]
+}
+
+// keepalivedProcessNamespaceChanged reports whether the keepalived track processes are added or removed
+// since the vpn gw pod template is rendered, nothing in the vpn gw spec changes with them
+func keepalivedProcessNamespaceChanged(podSpec *corev1.PodSpec, ka *myv1.KeepAlived) bool {
+	return ptr.Deref(podSpec.ShareProcessNamespace, false) != ptr.Deref(keepalivedSharesProcessNamespace(ka), false)
+}
+
+// keepalivedVipV4 returns the first ipv4 vip of the keepalived, the ssl vpn binds to it
+func keepalivedVipV4(ka *myv1.KeepAlived) string {
+	if ka == nil {
+		return ""
+	}
+	for _, instance := range ka.VrrpInstances() {
+		for _, vip := range instance.Vips {
+			if addr, err := keepalived.ParseVIP(vip.IP); err == nil && addr.Is4() {
+				return addr.String()
+			}
+		}
+	}
+	return ""
+}
+
+// keepalivedConfigForVpnGw converts the vrrp instances of the keepalived with their allocated router ids,
+// and tracks the enabled vpn services of the vpn gw along with the track scripts and processes of the keepalived
+func (r *VpnGwReconciler) keepalivedConfigForVpnGw(gw *myv1.VpnGw, ka *myv1.KeepAlived) *keepalived.Config {
+	conf := &keepalived.Config{}
+	scripts := map[string]bool{}
+	for _, script := range ka.Spec.TrackScripts {
+		conf.Scripts = append(conf.Scripts, keepalivedScript(script))
+		scripts[script.Name] = true
+	}
+	for _, script := range r.keepalivedVpnChecks(gw) {
+		if !scripts[script.Name] {
+			conf.Scripts = append(conf.Scripts, keepalivedScript(script))
+		}
+	}
+	for _, process := range ka.Spec.TrackProcesses {
+		quorum := process.Quorum
+		if quorum == 0 {
+			quorum = keepalived.DefaultProcessQuorum
+		}
+		conf.Processes = append(conf.Processes, keepalived.Process{
+			Name:    process.Name,
+			Process: process.Process,
+			Quorum:  quorum,
+			Delay:   process.Delay,
+			Weight:  process.Weight,
+		})
+	}
+	for _, instance := range ka.VrrpInstances() {
+		nic := keepalivedInstanceNic(gw, ka, instance)
+		priority := instance.Priority
+		if priority == 0 {
+			priority = keepalived.DefaultPriority
+		}
+		advertInterval := instance.AdvertInterval
+		if advertInterval == 0 {
+			advertInterval = keepalived.DefaultAdvertInterval
+		}
+		vrrp := keepalived.Instance{
+			Name:           instance.Name,
+			Interface:      nic,
+			RouterID:       ka.Status.RouterIDs[instance.Name],
+			Priority:       priority,
+			Preempt:        instance.Preempt,
+			AdvertInterval: advertInterval,
+			UnicastPeers:   instance.UnicastPeers,
+		}
+		if instance.Authentication != nil {
+			vrrp.AuthType = instance.Authentication.Type
+			vrrp.AuthPass = instance.Authentication.Password
+		}
+		for _, vip := range instance.Vips {
+			vrrp.VIPs = append(vrrp.VIPs, keepalived.VIP{Address: vip.IP, Interface: vip.Nic})
+		}
+		conf.Instances = append(conf.Instances, vrrp)
+	}
+	return conf
+}
+
+// keepalivedVpnChecks returns the track scripts of the enabled vpn services,
+// the vips are released from the pod once its vpn service is down
+func (r *VpnGwReconciler) keepalivedVpnChecks(gw *myv1.VpnGw) []myv1.KeepAlivedTrackScript {
+	var checks []myv1.KeepAlivedTrackScript
+	if gw.Spec.EnableSslVpn {
+		port := r.SslVpnUDP
+		if gw.Spec.SslVpnProto == "tcp" {
+			port = r.SslVpnTCP
+		}
+		checks = append(checks, myv1.KeepAlivedTrackScript{
+			Name:   util.KeepalivedSslVpnCheck,
+			Script: fmt.Sprintf(util.KeepalivedPortCheckTemplate, gw.Spec.SslVpnProto, port),
+		})
+	}
+	if gw.Spec.EnableIPSecVpn {
+		// charon binds the isakmp port once it is up
+		checks = append(checks, myv1.KeepAlivedTrackScript{
+			Name:   util.KeepalivedIPSecVpnCheck,
+			Script: fmt.Sprintf(util.KeepalivedPortCheckTemplate, strings.ToLower(util.IPSecProto), r.IPSecIsakmpPort),
+		})
+	}
+	if gw.Spec.EnableWireGuard {
+		checks = append(checks, myv1.KeepAlivedTrackScript{
+			Name:   util.KeepalivedWireGuardCheck,
+			Script: fmt.Sprintf(util.KeepalivedLinkCheckTemplate, wireguard.Interface),
+		})
+	}
+	return checks
+}
+
+func keepalivedScript(script myv1.KeepAlivedTrackScript) keepalived.Script {
+	interval := script.Interval
+	if interval == 0 {
+		interval = keepalived.DefaultScriptInterval
+	}
+	fall := script.Fall
+	if fall == 0 {
+		fall = keepalived.DefaultScriptFall
+	}
+	rise := script.Rise
+	if rise == 0 {
+		rise = keepalived.DefaultScriptRise
+	}
+	return keepalived.Script{
+		Name:     script.Name,
+		Script:   script.Script,
+		Interval: interval,
+		Timeout:  script.Timeout,
+		Fall:     fall,
+		Rise:     rise,
+		Weight:   script.Weight,
+	}
+}
+
+// renderKeepalived renders keepalived.conf into the config map mounted by the keepalived container,
+// it is done before the vpn gw pods are created, so they start with the latest config
+func (r *VpnGwReconciler) renderKeepalived(ctx context.Context, gw *myv1.VpnGw, ka *myv1.KeepAlived) (map[string]string, SyncState, error) {
+	files, err := r.keepalivedConfigForVpnGw(gw, ka).Render()
+	if err != nil {
+		err = fmt.Errorf("invalid keepalived %s: %w", ka.Name, err)
+		r.Log.Error(err, "failed to render keepalived config")
+		// invalid spec no retry
+		return nil, SyncStateErrorNoRetry, err
+	}
+	if err := r.handleAddOrUpdateConfConfigMap(ctx, gw, keepalivedConfConfigMapName(gw), files); err != nil {
+		r.Log.Error(err, "failed to handleAddOrUpdateConfConfigMap")
+		return nil, SyncStateError, err
+	}
+	return files, SyncStateSuccess, nil
+}
+
+// reloadKeepalived reloads the rendered keepalived.conf in the vpn gw pods,
+// the keepalived container only reloads it when the file is changed
+func (r *VpnGwReconciler) reloadKeepalived(ctx context.Context, gw *myv1.VpnGw, files map[string]string) (SyncState, waitReason, error) {
+	podNames, err := r.getContainerPodNames(ctx, gw, util.KeepAlivedServer)
+	if err != nil {
+		r.Log.Info("keepalived pods not ready", "reason", err.Error())
+		return r.waitFor(ctx, gw, waitForPods, err.Error())
+	}
+	cmd := fmt.Sprintf(util.KeepalivedReloadTemplate, util.Hash(files[keepalived.ConfKey]))
+	for _, podName := range podNames {
+		stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, gw.Namespace, podName, util.KeepAlivedServer, []string{"/bin/bash", "-c", cmd}...)
+		if err != nil {
+			var exitErr utilexec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitStatus() == util.ReloadNotSyncedCode {
+				r.Log.Info("keepalived config is not synced to the pod yet", "pod", podName)
+				return r.waitFor(ctx, gw, waitForConfigSync, fmt.Sprintf("keepalived config is not synced to pod %s yet", podName))
+			}
+			err = fmt.Errorf("failed to reload keepalived in pod %s: %w, stdout: %s, stderr: %s", podName, err, stdOutput, errOutput)
+			r.Log.Error(err, "failed to reload vpn gw keepalived")
+			return SyncStateError, waitNone, err
+		}
+		r.Log.V(3).Info("reload keepalived ok", "pod", podName, "output", stdOutput)
+	}
+	return SyncStateSuccess, waitNone, nil
+}
+
+// enqueueVpnGwForKeepalived enqueues the vpn gws using the keepalived
+func (r *VpnGwReconciler) enqueueVpnGwForKeepalived(ctx context.Context, obj client.Object) []reconcile.Request {
+	ka, ok := obj.(*myv1.KeepAlived)
+	if !ok {
+		return nil
+	}
+	gws := &myv1.VpnGwList{}
+	if err := r.List(ctx, gws, client.InNamespace(ka.Namespace)); err != nil {
+		r.Log.Error(err, "failed to list vpn gws", "keepalived", ka.Name)
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, gw := range gws.Items {
+		if gw.Spec.Keepalived == ka.Name {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace}})
+		}
+	}
+	return requests
+}
+
+// handleAddOrUpdateConfConfigMap keeps the rendered config without secrets in a config map mounted by the vpn gw container
+func (r *VpnGwReconciler) handleAddOrUpdateConfConfigMap(ctx context.Context, gw *myv1.VpnGw, name string, files map[string]string) error {
+	key := types.NamespacedName{Name: name, Namespace: gw.Namespace}
+	oldCm := &corev1.ConfigMap{}
+	err := r.Get(ctx, key, oldCm)
+	if err != nil && !apierrors.IsNotFound(err) {
+		r.Log.Error(err, "failed to get conf config map", "config map", key.String())
+		return err
+	}
+	if apierrors.IsNotFound(err) {
+		newCm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				Labels:    labelsForVpnGw(gw),
+			},
+			Data: files,
+		}
+		// set gw instance as the owner and controller
+		if err := controllerutil.SetControllerReference(gw, newCm, r.Scheme); err != nil {
+			r.Log.Error(err, "failed to set vpn gw as the owner and controller")
+			return err
+		}
+		if err := r.Create(ctx, newCm); err != nil {
+			r.Log.Error(err, "failed to create conf config map", "config map", key.String())
+			return err
+		}
+		return nil
+	}
+	changed := len(oldCm.Data) != len(files)
+	for k, v := range files {
+		if oldCm.Data[k] != v {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+	newCm := oldCm.DeepCopy()
+	newCm.Data = files
+	if err := r.Update(ctx, newCm); err != nil {
+		r.Log.Error(err, "failed to update conf config map", "config map", key.String())
+		return err
+	}
+	return nil
+}
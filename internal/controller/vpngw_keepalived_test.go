@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+)
+
+func TestKeepalivedTrackProcessesRollWorkload(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = myv1.AddToScheme(scheme)
+	gw := &myv1.VpnGw{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gw1"},
+		Spec: myv1.VpnGwSpec{
+			CPU:                  "1",
+			Memory:               "1Gi",
+			Replicas:             1,
+			Keepalived:           "ka1",
+			WorkloadType:         myv1.WorkloadTypeStatefulset,
+			EnableWireGuard:      true,
+			WireGuardImage:       "kubecombo/wireguard:latest",
+			WireGuardSecret:      "wg-key",
+			WireGuardListenPort:  myv1.DefaultWireGuardListenPort,
+			WireGuardAddressCidr: "10.250.0.1/24",
+		},
+	}
+	ka := &myv1.KeepAlived{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ka1"},
+		Spec:       myv1.KeepAlivedSpec{Image: "kubecombo/keepalived:latest"},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(gw).WithStatusSubresource(gw).Build()
+	r := &VpnGwReconciler{Client: c, Scheme: scheme}
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: gw.Namespace, Name: gw.Name}
+	req := ctrl.Request{NamespacedName: key}
+	if err := r.handleAddOrUpdateVpnStatefulset(req, gw, ka); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UpdateVpnGW(ctx, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	latest := &myv1.VpnGw{}
+	if err := c.Get(ctx, key, latest); err != nil {
+		t.Fatal(err)
+	}
+	if r.isChanged(latest, nil) {
+		t.Fatal("expected the recorded vpn gw to be up to date")
+	}
+	sharesProcessNamespace := func() bool {
+		t.Helper()
+		sts := &appsv1.StatefulSet{}
+		if err := c.Get(ctx, key, sts); err != nil {
+			t.Fatal(err)
+		}
+		share := sts.Spec.Template.Spec.ShareProcessNamespace
+		return share != nil && *share
+	}
+	if sharesProcessNamespace() {
+		t.Fatal("expected no shared process namespace without track processes")
+	}
+
+	// the vpn gw spec is unchanged, the keepalived watch reconciles the vpn gw
+	ka.Spec.TrackProcesses = []myv1.KeepAlivedTrackProcess{{Name: "wg", Process: "wg-quick", Quorum: 1}}
+	if err := r.handleAddOrUpdateVpnStatefulset(req, latest, ka); err != nil {
+		t.Fatal(err)
+	}
+	if !sharesProcessNamespace() {
+		t.Fatal("expected adding track processes to share the process namespace")
+	}
+	ka.Spec.TrackProcesses = nil
+	if err := r.handleAddOrUpdateVpnStatefulset(req, latest, ka); err != nil {
+		t.Fatal(err)
+	}
+	if sharesProcessNamespace() {
+		t.Fatal("expected removing track processes to stop sharing the process namespace")
+	}
+}
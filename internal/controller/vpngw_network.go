@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"net/netip"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/keepalived"
+)
+
+// networkForVip returns the secondary interface of the vpn gw whose static ips contain the vip
+func networkForVip(gw *myv1.VpnGw, vip string) *myv1.VpnGwNetwork {
+	addr, err := keepalived.ParseVIP(vip)
+	if err != nil {
+		return nil
+	}
+	for i, network := range gw.Spec.Networks {
+		for _, ip := range network.IPs {
+			if prefix, err := netip.ParsePrefix(ip); err == nil && prefix.Masked().Contains(addr) {
+				return &gw.Spec.Networks[i]
+			}
+		}
+	}
+	return nil
+}
+
+// uplinkNetwork returns the uplink interface of the vpn gw
+func uplinkNetwork(gw *myv1.VpnGw) *myv1.VpnGwNetwork {
+	for i, network := range gw.Spec.Networks {
+		if network.Uplink {
+			return &gw.Spec.Networks[i]
+		}
+	}
+	return nil
+}
+
+// keepalivedInstanceNic returns the interface the vrrp instance runs on,
+// the one of the instance, then the secondary interface which holds its vips, then the one of the keepalived
+func keepalivedInstanceNic(gw *myv1.VpnGw, ka *myv1.KeepAlived, instance myv1.KeepAlivedInstance) string {
+	if instance.Nic != "" {
+		return instance.Nic
+	}
+	if len(instance.Vips) != 0 {
+		if network := networkForVip(gw, instance.Vips[0].IP); network != nil {
+			return network.Interface
+		}
+	}
+	return ka.Spec.Nic
+}
+
+// sslVpnLocal returns the first ipv4 keepalived vip on the uplink interface, the ssl vpn binds to it,
+// empty means the ssl vpn listens on all the interfaces as before
+func sslVpnLocal(gw *myv1.VpnGw, ka *myv1.KeepAlived) string {
+	uplink := uplinkNetwork(gw)
+	if uplink == nil || ka == nil {
+		return ""
+	}
+	for _, instance := range ka.VrrpInstances() {
+		nic := keepalivedInstanceNic(gw, ka, instance)
+		for _, vip := range instance.Vips {
+			vipNic := nic
+			if vip.Nic != "" {
+				vipNic = vip.Nic
+			}
+			if vipNic != uplink.Interface {
+				continue
+			}
+			if addr, err := keepalived.ParseVIP(vip.IP); err == nil && addr.Is4() {
+				return addr.String()
+			}
+		}
+	}
+	return ""
+}
+
+// ipsecLocalGatewayNic returns the interface which holds the local vip of the ipsec connection,
+// its rp_filter is disabled as the encrypted traffic and the decrypted traffic go through different interfaces
+func ipsecLocalGatewayNic(gw *myv1.VpnGw, localVIP string) string {
+	if network := networkForVip(gw, localVIP); network != nil {
+		return network.Interface
+	}
+	if uplink := uplinkNetwork(gw); uplink != nil && len(uplink.IPs) == 0 {
+		// the ips of the uplink are allocated by the network ipam
+		return uplink.Interface
+	}
+	return ""
+}
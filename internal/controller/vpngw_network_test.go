@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"testing"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+)
+
+func TestVpnGwNetworks(t *testing.T) {
+	gw := &myv1.VpnGw{Spec: myv1.VpnGwSpec{Networks: []myv1.VpnGwNetwork{
+		{Name: "kube-system/uplink", Interface: "net1", IPs: []string{"172.19.0.11/24"}, Uplink: true},
+		{Name: "storage", Interface: "net2", IPs: []string{"10.10.0.11/24"}},
+	}}}
+	ka := &myv1.KeepAlived{Spec: myv1.KeepAlivedSpec{Nic: "eth0", Instances: []myv1.KeepAlivedInstance{
+		{Name: "internal", Vips: []myv1.KeepAlivedVip{{IP: "10.1.0.100"}}},
+		{Name: "storage", Vips: []myv1.KeepAlivedVip{{IP: "10.10.0.100"}}},
+		{Name: "public", Vips: []myv1.KeepAlivedVip{{IP: "172.19.0.100/24"}}},
+	}}}
+
+	for instance, want := range map[int]string{0: "eth0", 1: "net2", 2: "net1"} {
+		if nic := keepalivedInstanceNic(gw, ka, ka.Spec.Instances[instance]); nic != want {
+			t.Errorf("instance %s should run on %s, got %s", ka.Spec.Instances[instance].Name, want, nic)
+		}
+	}
+	if local := sslVpnLocal(gw, ka); local != "172.19.0.100" {
+		t.Errorf("ssl vpn should bind to the uplink vip, got %q", local)
+	}
+	if nic := ipsecLocalGatewayNic(gw, "172.19.0.100"); nic != "net1" {
+		t.Errorf("ipsec local gateway nic should be the uplink, got %q", nic)
+	}
+	if nic := ipsecLocalGatewayNic(gw, "10.1.0.100"); nic != "" {
+		t.Errorf("ipsec local vip out of the networks should keep the default nic, got %q", nic)
+	}
+
+	// the instance nic wins, the vips out of the uplink are not bound
+	ka.Spec.Instances[2].Nic = "eth1"
+	if local := sslVpnLocal(gw, ka); local != "" {
+		t.Errorf("ssl vpn should listen on all the interfaces without the uplink vip, got %q", local)
+	}
+	if local := sslVpnLocal(&myv1.VpnGw{}, ka); local != "" {
+		t.Errorf("ssl vpn should listen on all the interfaces without the uplink, got %q", local)
+	}
+
+	// the uplink ips are allocated by the network ipam
+	gw.Spec.Networks[0].IPs = nil
+	if nic := ipsecLocalGatewayNic(gw, "172.19.0.100"); nic != "net1" {
+		t.Errorf("ipsec local gateway nic should be the uplink, got %q", nic)
+	}
+}
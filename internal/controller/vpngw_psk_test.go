@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+)
+
+func newTestPSKReconciler(objs ...client.Object) *VpnGwReconciler {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = myv1.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).
+		WithIndex(&myv1.VpnGw{}, vpnGwSecretField, func(obj client.Object) []string {
+			return vpnGwSecrets(obj.(*myv1.VpnGw))
+		}).
+		WithIndex(&myv1.IpsecConn{}, ipsecConnPSKSecretField, func(obj client.Object) []string {
+			conn := obj.(*myv1.IpsecConn)
+			if conn.Spec.PSKSecretRef == nil {
+				return nil
+			}
+			return []string{conn.Spec.PSKSecretRef.Name}
+		}).Build()
+	return &VpnGwReconciler{Client: c, Scheme: scheme}
+}
+
+func pskSecret(name, key, value string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Data:       map[string][]byte{key: []byte(value)},
+	}
+}
+
+func TestGetSecretKey(t *testing.T) {
+	ctx := context.Background()
+	r := newTestPSKReconciler(pskSecret("psk", "psk", "secret"))
+	ref := &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "psk"}, Key: "psk"}
+	psk, err := r.getSecretKey(ctx, "default", ref)
+	if err != nil || psk != base64.StdEncoding.EncodeToString([]byte("secret")) {
+		t.Errorf("expected the base64 encoded psk, got %q, %v", psk, err)
+	}
+
+	missingKey := ref.DeepCopy()
+	missingKey.Key = "other"
+	if _, err := r.getSecretKey(ctx, "default", missingKey); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+	missingKey.Optional = ptr.To(true)
+	if psk, err := r.getSecretKey(ctx, "default", missingKey); err != nil || psk != "" {
+		t.Errorf("expected no psk for an optional missing key, got %q, %v", psk, err)
+	}
+
+	missingSecret := ref.DeepCopy()
+	missingSecret.Name = "other"
+	if _, err := r.getSecretKey(ctx, "default", missingSecret); err == nil {
+		t.Error("expected an error for a missing secret")
+	}
+	missingSecret.Optional = ptr.To(true)
+	if psk, err := r.getSecretKey(ctx, "default", missingSecret); err != nil || psk != "" {
+		t.Errorf("expected no psk for an optional missing secret, got %q, %v", psk, err)
+	}
+}
+
+func TestResolvePSK(t *testing.T) {
+	ctx := context.Background()
+	r := newTestPSKReconciler(pskSecret("conn-psk", "psk", "conn"), pskSecret("gw-psk", "psk", "gw"))
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	ref := func(name string) *corev1.SecretKeySelector {
+		return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: "psk", Optional: ptr.To(true)}
+	}
+	gw := &myv1.VpnGw{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gw1"}}
+	conn := &myv1.IpsecConn{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "conn1"}}
+
+	if _, err := r.resolvePSK(ctx, gw, conn); err == nil {
+		t.Error("expected an error without any psk")
+	}
+
+	gw.Spec.DefaultPSK = "default"
+	if psk, err := r.resolvePSK(ctx, gw, conn); err != nil || psk != "default" {
+		t.Errorf("expected the default psk, got %q, %v", psk, err)
+	}
+
+	gw.Spec.DefaultPSKSecretRef = ref("gw-psk")
+	if psk, err := r.resolvePSK(ctx, gw, conn); err != nil || psk != encode("gw") {
+		t.Errorf("expected the vpn gw secret psk, got %q, %v", psk, err)
+	}
+
+	conn.Spec.PSKSecretRef = ref("conn-psk")
+	if psk, err := r.resolvePSK(ctx, gw, conn); err != nil || psk != encode("conn") {
+		t.Errorf("expected the connection secret psk, got %q, %v", psk, err)
+	}
+
+	// an optional missing secret falls back to the vpn gw
+	conn.Spec.PSKSecretRef = ref("missing")
+	if psk, err := r.resolvePSK(ctx, gw, conn); err != nil || psk != encode("gw") {
+		t.Errorf("expected to fall back to the vpn gw secret psk, got %q, %v", psk, err)
+	}
+
+	conn.Spec.PSKSecretRef.Optional = nil
+	if _, err := r.resolvePSK(ctx, gw, conn); err == nil {
+		t.Error("expected an error for a required missing secret")
+	}
+}
+
+func TestEnqueueVpnGwForSecret(t *testing.T) {
+	ref := &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "psk"}, Key: "psk"}
+	r := newTestPSKReconciler(
+		&myv1.VpnGw{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gw1"}, Spec: myv1.VpnGwSpec{DefaultPSKSecretRef: ref}},
+		&myv1.VpnGw{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gw2"}},
+		&myv1.VpnGw{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "gw3"}, Spec: myv1.VpnGwSpec{DefaultPSKSecretRef: ref}},
+		&myv1.IpsecConn{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "conn1"}, Spec: myv1.IpsecConnSpec{VpnGw: "gw1", PSKSecretRef: ref}},
+		&myv1.IpsecConn{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "conn2"}, Spec: myv1.IpsecConnSpec{VpnGw: "gw2", PSKSecretRef: ref}},
+		&myv1.IpsecConn{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "conn3"}, Spec: myv1.IpsecConnSpec{VpnGw: "gw3"}},
+	)
+	requests := r.enqueueVpnGwForSecret(context.Background(), pskSecret("psk", "psk", "secret"))
+	if len(requests) != 2 || requests[0].Name != "gw1" || requests[1].Name != "gw2" {
+		t.Errorf("expected gw1 and gw2 to be enqueued once, got %v", requests)
+	}
+}
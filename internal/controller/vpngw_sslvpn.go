@@ -0,0 +1,354 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilexec "k8s.io/utils/exec"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/sslvpn"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+// sslVpnClientVpnGwField indexes ssl vpn clients by spec.vpnGw
+const sslVpnClientVpnGwField = "spec.vpnGw"
+
+func sslVpnCRLSecretName(gw *myv1.VpnGw) string {
+	return gw.Name + util.SslVpnCRLSecretSuffix
+}
+
+// sslVpnCRLEnabled reports whether the vpn gw issues ssl vpn client certificates and signs their crl
+func sslVpnCRLEnabled(gw *myv1.VpnGw) bool {
+	return gw.Spec.EnableSslVpn && gw.Spec.SslVpnCASecret != ""
+}
+
+// sslVpnCASecret returns the ca secret recorded in the vpn gw status, the crl and the client configs
+// are mounted into the ssl vpn container only if it is set
+func sslVpnCASecret(gw *myv1.VpnGw) string {
+	if !gw.Spec.EnableSslVpn {
+		return ""
+	}
+	return gw.Spec.SslVpnCASecret
+}
+
+// sslVpnCRLRequeueAfter returns when the vpn gw should be reconciled to sign the crl again,
+// nothing else reconciles the vpn gw before the crl expires
+func sslVpnCRLRequeueAfter(gw *myv1.VpnGw, now time.Time) time.Duration {
+	if !sslVpnCRLEnabled(gw) || gw.Status.SslVpnCRLNextUpdate == nil {
+		return 0
+	}
+	return max(sslvpn.CRLResignTime(gw.Status.SslVpnCRLNextUpdate.Time).Sub(now), time.Second)
+}
+
+// sslVpnCRLForVpnGw returns the crl env, volume mount and volume of the ssl vpn container
+func sslVpnCRLForVpnGw(gw *myv1.VpnGw) (corev1.EnvVar, corev1.VolumeMount, corev1.Volume) {
+	env := corev1.EnvVar{
+		Name:  util.SslVpnCRLEnabledKey,
+		Value: "true",
+	}
+	mount := corev1.VolumeMount{
+		Name:      util.SslVpnCRLName,
+		MountPath: util.SslVpnCRLPath,
+		ReadOnly:  true,
+	}
+	volume := corev1.Volume{
+		Name: util.SslVpnCRLName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: sslVpnCRLSecretName(gw),
+				Optional:   &[]bool{true}[0],
+			},
+		},
+	}
+	return env, mount, volume
+}
+
+// sslVpnClientQoSEnv returns the rate limit env of each ssl vpn client,
+// the rate in bits per second is converted to the bytes per second of iptables hashlimit
+func sslVpnClientQoSEnv(gw *myv1.VpnGw) []corev1.EnvVar {
+	qos := gw.Spec.QoS
+	if !gw.Spec.EnableSslVpn || qos == nil || qos.SslVpnClientRate == nil {
+		return nil
+	}
+	env := []corev1.EnvVar{{
+		Name:  util.SslVpnClientRateKey,
+		Value: fmt.Sprintf("%db/s", bitsToBytes(qos.SslVpnClientRate.Value())),
+	}}
+	if qos.SslVpnClientBurst != nil {
+		env = append(env, corev1.EnvVar{
+			Name:  util.SslVpnClientBurstKey,
+			Value: strconv.FormatInt(bitsToBytes(qos.SslVpnClientBurst.Value()), 10),
+		})
+	}
+	return env
+}
+
+func bitsToBytes(bits int64) int64 {
+	return max((bits+7)/8, 1)
+}
+
+// getSslVpnCA loads the ca keypair of the vpn gw and makes sure the ssl vpn server trusts it,
+// an invalid ca will not be fixed by retrying
+func getSslVpnCA(ctx context.Context, c client.Reader, gw *myv1.VpnGw) (*sslvpn.CA, SyncState, error) {
+	caSecret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: gw.Spec.SslVpnCASecret, Namespace: gw.Namespace}, caSecret); err != nil {
+		return nil, SyncStateError, fmt.Errorf("failed to get ssl vpn ca secret %s: %w", gw.Spec.SslVpnCASecret, err)
+	}
+	ca, err := sslvpn.ParseCA(caSecret.Data[sslvpn.CACertKey], caSecret.Data[sslvpn.CAKeyKey])
+	if err != nil {
+		return nil, SyncStateErrorNoRetry, fmt.Errorf("invalid ssl vpn ca secret %s: %w", gw.Spec.SslVpnCASecret, err)
+	}
+	serverSecret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: gw.Spec.SslVpnSecret, Namespace: gw.Namespace}, serverSecret); err != nil {
+		return nil, SyncStateError, fmt.Errorf("failed to get ssl vpn secret %s: %w", gw.Spec.SslVpnSecret, err)
+	}
+	if !ca.SameAs(serverSecret.Data[sslvpn.ServerCAKey]) {
+		err := fmt.Errorf("ssl vpn ca secret %s is not the %s of ssl vpn secret %s", gw.Spec.SslVpnCASecret, sslvpn.ServerCAKey, gw.Spec.SslVpnSecret)
+		return nil, SyncStateErrorNoRetry, err
+	}
+	return ca, SyncStateSuccess, nil
+}
+
+// getSslVpnRevoked returns the revoked client certificates kept in the vpn gw crl secret
+func getSslVpnRevoked(ctx context.Context, c client.Reader, gw *myv1.VpnGw) ([]sslvpn.Revoked, *corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: sslVpnCRLSecretName(gw), Namespace: gw.Namespace}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	revoked, err := sslvpn.ParseRevoked(secret.Data[sslvpn.RevokedKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s in secret %s: %w", sslvpn.RevokedKey, secret.Name, err)
+	}
+	return revoked, secret, nil
+}
+
+// handleSslVpnCRL signs the crl of the revoked and deleting ssl vpn clients,
+// and copies it for the static pods in the daemonset case
+func (r *VpnGwReconciler) handleSslVpnCRL(ctx context.Context, gw *myv1.VpnGw) (SyncState, waitReason, error) {
+	ca, state, err := getSslVpnCA(ctx, r.Client, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to get ssl vpn ca")
+		return state, waitNone, err
+	}
+	clients := &myv1.SslVpnClientList{}
+	if err := r.List(ctx, clients, client.InNamespace(gw.Namespace), client.MatchingFields{sslVpnClientVpnGwField: gw.Name}); err != nil {
+		r.Log.Error(err, "failed to list vpn gw ssl vpn clients")
+		return SyncStateError, waitNone, err
+	}
+	now := time.Now()
+	revokedCNs := sslVpnRevokedCNs(gw)
+	revoked := sslVpnClientsRevoked(clients.Items, revokedCNs, now)
+	manual := map[string]bool{}
+	for _, rev := range gw.Spec.SslVpnRevocations {
+		if rev.SerialNumber == "" {
+			continue
+		}
+		serial, err := sslvpn.NormalizeSerial(rev.SerialNumber)
+		if err != nil {
+			r.Log.Error(err, "invalid ssl vpn revocation")
+			return SyncStateErrorNoRetry, waitNone, err
+		}
+		manual[serial] = true
+		revoked = append(revoked, sslvpn.Revoked{
+			SerialNumber:   serial,
+			CommonName:     rev.CommonName,
+			RevocationTime: now,
+			Manual:         true,
+		})
+	}
+	existing, secret, err := getSslVpnRevoked(ctx, r.Client, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to get ssl vpn revoked clients")
+		return SyncStateError, waitNone, err
+	}
+	// the serial numbers removed from the vpn gw spec are not revoked any more
+	kept := make([]sslvpn.Revoked, 0, len(existing))
+	for _, rev := range existing {
+		if !rev.Manual || manual[rev.SerialNumber] {
+			kept = append(kept, rev)
+		}
+	}
+	revoked = sslvpn.MergeRevoked(kept, revoked, now)
+	revokedJSON, err := sslvpn.MarshalRevoked(revoked)
+	if err != nil {
+		return SyncStateError, waitNone, err
+	}
+	cns := make([]string, 0, len(revokedCNs))
+	for cn := range revokedCNs {
+		cns = append(cns, cn)
+	}
+	files := map[string]string{
+		sslvpn.RevokedKey:    revokedJSON,
+		sslvpn.RevokedCNsKey: sslvpn.RenderRevokedCNs(cns),
+	}
+	if secret != nil && ca.CRLUpToDate(secret.Data[sslvpn.CRLKey], revoked, now) {
+		files[sslvpn.CRLKey] = string(secret.Data[sslvpn.CRLKey])
+	} else {
+		crl, err := ca.CreateCRL(revoked, now)
+		if err != nil {
+			r.Log.Error(err, "failed to sign ssl vpn crl")
+			return SyncStateErrorNoRetry, waitNone, err
+		}
+		files[sslvpn.CRLKey] = string(crl)
+		r.Log.Info("sign ssl vpn crl", "vpn gw", gw.Name, "revoked", len(revoked))
+	}
+	if err := r.handleAddOrUpdateConfSecret(ctx, gw, sslVpnCRLSecretName(gw), files); err != nil {
+		r.Log.Error(err, "failed to handleAddOrUpdateConfSecret")
+		return SyncStateError, waitNone, err
+	}
+
+	podNames, err := r.getContainerPodNames(ctx, gw, util.SslVpnServer)
+	if err != nil {
+		r.Log.Info("ssl vpn pods not ready", "reason", err.Error())
+		return r.waitFor(ctx, gw, waitForPods, err.Error())
+	}
+	// reload-crl.sh hashes the files in the same order
+	cmd := fmt.Sprintf(util.SslVpnReloadCRLTemplate, util.Hash(files[sslvpn.CRLKey]+files[sslvpn.RevokedKey]+files[sslvpn.RevokedCNsKey]))
+	for _, podName := range podNames {
+		stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, gw.Namespace, podName, util.SslVpnServer, []string{"/bin/bash", "-c", cmd}...)
+		if err != nil {
+			var exitErr utilexec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitStatus() == util.ReloadNotSyncedCode {
+				r.Log.Info("ssl vpn crl is not synced to the pod yet", "pod", podName)
+				return r.waitFor(ctx, gw, waitForConfigSync, fmt.Sprintf("ssl vpn crl is not synced to pod %s yet", podName))
+			}
+			err = fmt.Errorf("failed to reload ssl vpn crl in pod %s: %w, stdout: %s, stderr: %s", podName, err, stdOutput, errOutput)
+			r.Log.Error(err, "failed to reload vpn gw ssl vpn crl")
+			return SyncStateError, waitNone, err
+		}
+		r.Log.Info("reload ssl vpn crl ok", "pod", podName, "output", stdOutput)
+	}
+	nextUpdate, err := sslvpn.CRLNextUpdate([]byte(files[sslvpn.CRLKey]))
+	if err != nil {
+		r.Log.Error(err, "failed to parse ssl vpn crl")
+		return SyncStateError, waitNone, err
+	}
+	if err := r.updateSslVpnCRLStatus(ctx, gw, int32(len(revoked)), &metav1.Time{Time: nextUpdate}); err != nil {
+		r.Log.Error(err, "failed to update vpn gw ssl vpn crl status")
+		return SyncStateError, waitNone, err
+	}
+	return SyncStateSuccess, waitNone, nil
+}
+
+// sslVpnRevokedCNs returns the common names revoked in the vpn gw spec
+func sslVpnRevokedCNs(gw *myv1.VpnGw) map[string]bool {
+	cns := map[string]bool{}
+	for _, rev := range gw.Spec.SslVpnRevocations {
+		if rev.CommonName != "" && rev.SerialNumber == "" {
+			cns[rev.CommonName] = true
+		}
+	}
+	return cns
+}
+
+// updateSslVpnCRLStatus records the revoked certificates count and the crl next update,
+// they are cleared once the crl is disabled
+func (r *VpnGwReconciler) updateSslVpnCRLStatus(ctx context.Context, gw *myv1.VpnGw, revoked int32, nextUpdate *metav1.Time) error {
+	latest, err := r.getVpnGw(ctx, types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace})
+	if err != nil || latest == nil {
+		return err
+	}
+	newGw := latest.DeepCopy()
+	newGw.Status.SslVpnRevoked = revoked
+	newGw.Status.SslVpnCRLNextUpdate = nextUpdate
+	if reflect.DeepEqual(latest.Status, newGw.Status) {
+		return nil
+	}
+	return r.Status().Update(ctx, newGw)
+}
+
+// enqueueVpnGwForSslVpnClient enqueues the vpn gw to sign the crl once the client is revoked or deleted
+func (r *VpnGwReconciler) enqueueVpnGwForSslVpnClient(_ context.Context, obj client.Object) []reconcile.Request {
+	c, ok := obj.(*myv1.SslVpnClient)
+	if !ok || c.Spec.VpnGw == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: c.Spec.VpnGw, Namespace: c.Namespace}}}
+}
+
+// sslVpnClientRevokedCerts returns the certificates of the client to be revoked,
+// all the issued ones if the client is revoked, otherwise only the replaced ones
+func sslVpnClientRevokedCerts(c *myv1.SslVpnClient, all bool) []myv1.SslVpnClientCertificate {
+	var certs []myv1.SslVpnClientCertificate
+	for _, cert := range c.Status.IssuedCertificates {
+		if all || cert.Replaced {
+			certs = append(certs, cert)
+		}
+	}
+	if !all || c.Status.SerialNumber == "" || c.Status.NotAfter == nil {
+		return certs
+	}
+	if !slices.ContainsFunc(certs, func(cert myv1.SslVpnClientCertificate) bool { return cert.SerialNumber == c.Status.SerialNumber }) {
+		// issued before the history is kept
+		certs = append(certs, myv1.SslVpnClientCertificate{SerialNumber: c.Status.SerialNumber, CommonName: c.Status.CommonName, NotAfter: *c.Status.NotAfter})
+	}
+	return certs
+}
+
+// sslVpnClientsRevoked returns the certificates of the ssl vpn clients to be signed into the crl,
+// every certificate issued to a revoked or deleting client is revoked, not only the current one
+func sslVpnClientsRevoked(clients []myv1.SslVpnClient, revokedCNs map[string]bool, now time.Time) []sslvpn.Revoked {
+	var revoked []sslvpn.Revoked
+	for _, c := range clients {
+		all := c.Spec.Revoked || !c.DeletionTimestamp.IsZero() || revokedCNs[c.Status.CommonName]
+		for _, cert := range sslVpnClientRevokedCerts(&c, all) {
+			revoked = append(revoked, sslvpn.Revoked{
+				SerialNumber:   cert.SerialNumber,
+				CommonName:     cert.CommonName,
+				Client:         c.Name,
+				RevocationTime: now,
+				NotAfter:       cert.NotAfter.Time,
+			})
+		}
+	}
+	return revoked
+}
+
+// sslVpnClientReplacedSerials returns the serial numbers of the replaced certificates of the client
+func sslVpnClientReplacedSerials(c *myv1.SslVpnClient) []string {
+	var serials []string
+	for _, cert := range c.Status.IssuedCertificates {
+		if cert.Replaced {
+			serials = append(serials, cert.SerialNumber)
+		}
+	}
+	return serials
+}
+
+// sslVpnClientReplacedChanged passes the ssl vpn client updates which replace a certificate,
+// the certificate may be replaced without a spec change, eg. the profile secret is lost
+var sslVpnClientReplacedChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldClient, ok := e.ObjectOld.(*myv1.SslVpnClient)
+		if !ok {
+			return false
+		}
+		newClient, ok := e.ObjectNew.(*myv1.SslVpnClient)
+		if !ok {
+			return false
+		}
+		return !slices.Equal(sslVpnClientReplacedSerials(oldClient), sslVpnClientReplacedSerials(newClient))
+	},
+}
+
+// isSslVpnCASecret reports whether the secret is the ssl vpn ca or server secret which signs the crl
+func isSslVpnCASecret(gw *myv1.VpnGw, secret string) bool {
+	return sslVpnCRLEnabled(gw) && (gw.Spec.SslVpnCASecret == secret || gw.Spec.SslVpnSecret == secret)
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	utilexec "k8s.io/utils/exec"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/sslvpn"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+func sslVpnCCDSecretName(gw *myv1.VpnGw) string {
+	return gw.Name + util.SslVpnCCDSecretSuffix
+}
+
+// sslVpnCCDForVpnGw returns the client-config-dir env, volume mount and volume of the ssl vpn container,
+// the dynamic pool is set out of the static cidr if the vpn gw reserves one, it is checked in validateVpnGw
+func sslVpnCCDForVpnGw(gw *myv1.VpnGw) ([]corev1.EnvVar, corev1.VolumeMount, corev1.Volume) {
+	env := []corev1.EnvVar{{
+		Name:  util.SslVpnCCDEnabledKey,
+		Value: "true",
+	}}
+	if start, end, err := sslvpn.DynamicPool(gw.Spec.SslVpnSubnetCidr, gw.Spec.SslVpnStaticCidr); err == nil {
+		env = append(env, corev1.EnvVar{
+			Name:  util.SslVpnPoolKey,
+			Value: fmt.Sprintf("%s %s", start, end),
+		})
+	}
+	mount := corev1.VolumeMount{
+		Name:      util.SslVpnCCDName,
+		MountPath: util.SslVpnCCDPath,
+		ReadOnly:  true,
+	}
+	volume := corev1.Volume{
+		Name: util.SslVpnCCDName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: sslVpnCCDSecretName(gw),
+				Optional:   &[]bool{true}[0],
+			},
+		},
+	}
+	return env, mount, volume
+}
+
+// sslVpnStaticCidr returns the static cidr recorded in the vpn gw status, the dynamic pool is set out of it
+// only if the client configs are mounted into the ssl vpn container
+func sslVpnStaticCidr(gw *myv1.VpnGw) string {
+	if !sslVpnCRLEnabled(gw) {
+		return ""
+	}
+	return gw.Spec.SslVpnStaticCidr
+}
+
+// sslVpnClientConfigSpec returns the client config declared on the ssl vpn client
+func sslVpnClientConfigSpec(c *myv1.SslVpnClient) sslvpn.ClientConfigSpec {
+	return sslvpn.ClientConfigSpec{
+		CommonName:   sslVpnClientCommonName(c),
+		StaticIP:     c.Spec.StaticIP,
+		Routes:       c.Spec.Routes,
+		DNS:          c.Spec.DNS,
+		AllowedCidrs: c.Spec.AllowedCidrs,
+	}
+}
+
+// sslVpnClientConfigs validates the client configs of the ssl vpn clients of the vpn gw by the client name,
+// the revoked and deleting clients are skipped, the first client by name wins the common name and the static ip
+func sslVpnClientConfigs(gw *myv1.VpnGw, clients []myv1.SslVpnClient) (map[string]*sslvpn.ClientConfig, map[string]error) {
+	sorted := append([]myv1.SslVpnClient{}, clients...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	revokedCNs := sslVpnRevokedCNs(gw)
+	configs := map[string]*sslvpn.ClientConfig{}
+	errs := map[string]error{}
+	commonNames := map[string]string{}
+	staticIPs := map[string]string{}
+	for i := range sorted {
+		c := &sorted[i]
+		spec := sslVpnClientConfigSpec(c)
+		if c.Spec.Revoked || !c.DeletionTimestamp.IsZero() || revokedCNs[spec.CommonName] || spec.Empty() {
+			continue
+		}
+		config, err := spec.Parse(gw.Spec.SslVpnSubnetCidr, gw.Spec.SslVpnStaticCidr)
+		if err != nil {
+			errs[c.Name] = err
+			continue
+		}
+		if owner, ok := commonNames[spec.CommonName]; ok {
+			errs[c.Name] = fmt.Errorf("common name %s is configured by ssl vpn client %s", spec.CommonName, owner)
+			continue
+		}
+		if config.StaticIP != nil {
+			if owner, ok := staticIPs[config.StaticIP.String()]; ok {
+				errs[c.Name] = fmt.Errorf("static ip %s is used by ssl vpn client %s", config.StaticIP, owner)
+				continue
+			}
+			staticIPs[config.StaticIP.String()] = c.Name
+		}
+		commonNames[spec.CommonName] = c.Name
+		configs[c.Name] = config
+	}
+	return configs, errs
+}
+
+// handleSslVpnCCD renders the client configs of the ssl vpn clients into the client-config-dir secret,
+// openvpn reads them once the clients connect, the acl of the allowed cidrs is applied in the pods
+func (r *VpnGwReconciler) handleSslVpnCCD(ctx context.Context, gw *myv1.VpnGw) (SyncState, waitReason, error) {
+	clients := &myv1.SslVpnClientList{}
+	if err := r.List(ctx, clients, client.InNamespace(gw.Namespace), client.MatchingFields{sslVpnClientVpnGwField: gw.Name}); err != nil {
+		r.Log.Error(err, "failed to list vpn gw ssl vpn clients")
+		return SyncStateError, waitNone, err
+	}
+	configs, errs := sslVpnClientConfigs(gw, clients.Items)
+	for name, err := range errs {
+		// reported in the ssl vpn client status
+		r.Log.Info("skip invalid ssl vpn client config", "client", name, "reason", err.Error())
+	}
+	files := map[string]string{}
+	list := make([]*sslvpn.ClientConfig, 0, len(configs))
+	for _, config := range configs {
+		files[config.CommonName] = config.Render()
+		list = append(list, config)
+	}
+	files[sslvpn.ACLKey] = sslvpn.RenderACL(list)
+	if err := r.handleAddOrUpdateConfSecret(ctx, gw, sslVpnCCDSecretName(gw), files); err != nil {
+		r.Log.Error(err, "failed to handleAddOrUpdateConfSecret")
+		return SyncStateError, waitNone, err
+	}
+
+	podNames, err := r.getContainerPodNames(ctx, gw, util.SslVpnServer)
+	if err != nil {
+		r.Log.Info("ssl vpn pods not ready", "reason", err.Error())
+		return r.waitFor(ctx, gw, waitForPods, err.Error())
+	}
+	cmd := fmt.Sprintf(util.SslVpnReloadCCDTemplate, sslvpn.ConfigHash(files))
+	for _, podName := range podNames {
+		stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, gw.Namespace, podName, util.SslVpnServer, []string{"/bin/bash", "-c", cmd}...)
+		if err != nil {
+			var exitErr utilexec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitStatus() == util.ReloadNotSyncedCode {
+				r.Log.Info("ssl vpn client config is not synced to the pod yet", "pod", podName)
+				return r.waitFor(ctx, gw, waitForConfigSync, fmt.Sprintf("ssl vpn client config is not synced to pod %s yet", podName))
+			}
+			err = fmt.Errorf("failed to reload ssl vpn client config in pod %s: %w, stdout: %s, stderr: %s", podName, err, stdOutput, errOutput)
+			r.Log.Error(err, "failed to reload vpn gw ssl vpn client config")
+			return SyncStateError, waitNone, err
+		}
+	}
+	return SyncStateSuccess, waitNone, nil
+}
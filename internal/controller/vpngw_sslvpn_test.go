@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/sslvpn"
+)
+
+func TestSslVpnCRLRequeueAfter(t *testing.T) {
+	now := time.Now()
+	nextUpdate := now.Add(180 * 24 * time.Hour)
+	resign := sslvpn.CRLResignTime(nextUpdate).Sub(now)
+	tests := []struct {
+		name       string
+		enabled    bool
+		nextUpdate *time.Time
+		want       time.Duration
+	}{
+		{"crl disabled", false, &nextUpdate, 0},
+		{"crl not signed yet", true, nil, 0},
+		{"resign in the last third", true, &nextUpdate, resign},
+		{"resign overdue", true, &now, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &myv1.VpnGw{Spec: myv1.VpnGwSpec{EnableSslVpn: true}}
+			if tt.enabled {
+				gw.Spec.SslVpnCASecret = "ca"
+			}
+			if tt.nextUpdate != nil {
+				gw.Status.SslVpnCRLNextUpdate = &metav1.Time{Time: *tt.nextUpdate}
+			}
+			if got := sslVpnCRLRequeueAfter(gw, now); got != tt.want {
+				t.Errorf("expected requeue after %v, got %v", tt.want, got)
+			}
+		})
+	}
+	if resign <= 0 || resign >= 180*24*time.Hour {
+		t.Errorf("expected the crl to be signed again before the next update, got %v", resign)
+	}
+}
+
+func TestVpnGwSslVpnCASecretChanged(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = myv1.AddToScheme(scheme)
+	gw := &myv1.VpnGw{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gw1"},
+		Spec: myv1.VpnGwSpec{
+			CPU:          "1",
+			Memory:       "1Gi",
+			Replicas:     1,
+			EnableSslVpn: true,
+			SslVpnImage:  "kubecombo/openvpn:latest",
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(gw).WithStatusSubresource(gw).Build()
+	r := &VpnGwReconciler{Client: c, Scheme: scheme}
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: gw.Namespace, Name: gw.Name}
+	latest := func() *myv1.VpnGw {
+		t.Helper()
+		res := &myv1.VpnGw{}
+		if err := c.Get(ctx, key, res); err != nil {
+			t.Fatal(err)
+		}
+		res.SetDefaults(r.Defaults)
+		return res
+	}
+	if err := r.UpdateVpnGW(ctx, ctrl.Request{NamespacedName: key}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if r.isChanged(latest(), nil) {
+		t.Fatal("expected the recorded vpn gw to be up to date")
+	}
+
+	// setting the ca secret mounts the crl and the client configs into the ssl vpn container
+	current := latest()
+	current.Spec.SslVpnCASecret = "ssl-vpn-ca"
+	if err := c.Update(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	if !r.isChanged(latest(), nil) {
+		t.Fatal("expected setting the ssl vpn ca secret to roll the workload")
+	}
+	if err := r.UpdateVpnGW(ctx, ctrl.Request{NamespacedName: key}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := latest(); got.Status.SslVpnCASecret != "ssl-vpn-ca" || r.isChanged(got, nil) {
+		t.Fatalf("expected the ssl vpn ca secret to be recorded, got %q", got.Status.SslVpnCASecret)
+	}
+}
+
+func TestVpnGwSslVpnStaticCidrChanged(t *testing.T) {
+	gw := &myv1.VpnGw{
+		Spec: myv1.VpnGwSpec{
+			EnableSslVpn:     true,
+			SslVpnCASecret:   "ssl-vpn-ca",
+			SslVpnSubnetCidr: "10.240.0.0/16",
+		},
+	}
+	gw.Status.EnableSslVpn = true
+	gw.Status.SslVpnSubnetCidr = gw.Spec.SslVpnSubnetCidr
+	gw.Status.SslVpnCASecret = gw.Spec.SslVpnCASecret
+	r := &VpnGwReconciler{}
+	gw.Status.CNIProvider = r.cniProviderForVpnGw(gw).Name()
+	if r.isChanged(gw, nil) {
+		t.Fatal("expected the recorded vpn gw to be up to date")
+	}
+	// reserving a static cidr moves the dynamic pool of the ssl vpn container
+	gw.Spec.SslVpnStaticCidr = "10.240.255.0/24"
+	if !r.isChanged(gw, nil) {
+		t.Fatal("expected changing the ssl vpn static cidr to roll the workload")
+	}
+	gw.Status.SslVpnStaticCidr = gw.Spec.SslVpnStaticCidr
+	if r.isChanged(gw, nil) {
+		t.Fatal("expected the recorded static cidr to be up to date")
+	}
+}
+
+func TestSslVpnClientConfigsCommonName(t *testing.T) {
+	gw := &myv1.VpnGw{
+		Spec: myv1.VpnGwSpec{
+			SslVpnSubnetCidr: "10.240.0.0/16",
+			SslVpnStaticCidr: "10.240.255.0/24",
+		},
+	}
+	clients := []myv1.SslVpnClient{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice"},
+			Spec:       myv1.SslVpnClientSpec{CommonName: "alice@example.com", StaticIP: "10.240.255.10"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "bob"},
+			Spec:       myv1.SslVpnClientSpec{StaticIP: "10.240.255.11"},
+		},
+	}
+	configs, errs := sslVpnClientConfigs(gw, clients)
+	// the common name is the key of the client config secret, the other clients are rendered anyway
+	if errs["alice"] == nil || configs["alice"] != nil {
+		t.Errorf("expected the common name with @ to be rejected, got config %v, err %v", configs["alice"], errs["alice"])
+	}
+	if configs["bob"] == nil || errs["bob"] != nil {
+		t.Errorf("expected the client config of bob, got err %v", errs["bob"])
+	}
+}
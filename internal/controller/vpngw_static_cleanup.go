@@ -0,0 +1,325 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"path"
+	"slices"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+const (
+	staticPodCleanupContainer = "cleanup"
+	// the kubelet manifests path and the parent of the host caches are mounted into the cleanup pod
+	staticPodCleanupManifestsPath = "/host/manifests"
+	staticPodCleanupCachePath     = "/host/cache"
+)
+
+// staticPodsEnabled reports whether the daemonset pods of the vpn gw copy static pods to the nodes,
+// wireguard runs in the daemonset pod directly
+func staticPodsEnabled(gw *myv1.VpnGw) bool {
+	return gw.Spec.WorkloadType == myv1.WorkloadTypeStatic && (gw.Spec.EnableSslVpn || gw.Spec.EnableIPSecVpn)
+}
+
+// listStaticMirrorPods lists the mirror pods of the static pods which the daemonset pods of the vpn gw copied to the nodes,
+// they are named <name>-<node> in kube-system and labeled with the vpn gw
+func (r *VpnGwReconciler) listStaticMirrorPods(ctx context.Context, gw *myv1.VpnGw) ([]corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	labels := client.MatchingLabels{util.VpnGwLabel: gw.Name, util.VpnGwNamespaceLabel: gw.Namespace}
+	if err := r.List(ctx, pods, client.InNamespace(util.StaticPodNamespace), labels); err != nil {
+		return nil, err
+	}
+	var mirrors []corev1.Pod
+	for _, pod := range pods.Items {
+		if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok && pod.Spec.NodeName != "" {
+			mirrors = append(mirrors, pod)
+		}
+	}
+	return mirrors, nil
+}
+
+// staticPodCleanupPodName returns the cleanup pod of the node, the node name is hashed to keep the pod name short
+func staticPodCleanupPodName(gw *myv1.VpnGw, node string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(node))
+	return fmt.Sprintf("%s-cleanup-%08x", gw.Name, h.Sum32())
+}
+
+// staticPodCleanupScript removes the static pod manifests first so that kubelet stops the static pods,
+// then the host caches they mount. only the ones of the enabled vpn are removed
+func staticPodCleanupScript(gw *myv1.VpnGw) string {
+	var manifests, caches []string
+	if gw.Spec.EnableSslVpn {
+		manifests = append(manifests, path.Join(staticPodCleanupManifestsPath, util.SslVpnStaticPodManifest))
+		caches = append(caches, path.Join(staticPodCleanupCachePath, path.Base(util.SslVpnHostCachePath)))
+	}
+	if gw.Spec.EnableIPSecVpn {
+		manifests = append(manifests, path.Join(staticPodCleanupManifestsPath, util.IPSecVpnStaticPodManifest))
+		caches = append(caches, path.Join(staticPodCleanupCachePath, path.Base(util.IPSecVpnHostCachePath)))
+	}
+	return fmt.Sprintf("rm -fv %s && rm -rfv %s", strings.Join(manifests, " "), strings.Join(caches, " "))
+}
+
+// staticPodCleanupPod returns the pod which cleans up the static pods of the vpn gw on the node
+func (r *VpnGwReconciler) staticPodCleanupPod(gw *myv1.VpnGw, node string) (*corev1.Pod, error) {
+	image := gw.Spec.SslVpnImage
+	if !gw.Spec.EnableSslVpn {
+		image = gw.Spec.IPSecVpnImage
+	}
+	privileged := true
+	hostPathDirectory := corev1.HostPathDirectory
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      staticPodCleanupPodName(gw, node),
+			Namespace: gw.Namespace,
+			Labels:    map[string]string{util.VpnGwCleanupLabel: gw.Name},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      node,
+			RestartPolicy: corev1.RestartPolicyNever,
+			// the static pods may run on the tainted nodes as well
+			Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Containers: []corev1.Container{
+				{
+					Name:    staticPodCleanupContainer,
+					Image:   image,
+					Command: []string{"/bin/bash", "-c", staticPodCleanupScript(gw)},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      util.K8sManifests,
+							MountPath: staticPodCleanupManifestsPath,
+						},
+						{
+							Name:      "host-cache",
+							MountPath: staticPodCleanupCachePath,
+						},
+					},
+					SecurityContext: &corev1.SecurityContext{
+						Privileged: &privileged,
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: util.K8sManifests,
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{
+							Path: r.K8sManifestsPath,
+							Type: &hostPathDirectory,
+						},
+					},
+				},
+				{
+					// the cache directories are removed along with themselves, so their parent is mounted
+					Name: "host-cache",
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{
+							Path: path.Dir(util.SslVpnHostCachePath),
+							Type: &hostPathDirectory,
+						},
+					},
+				},
+			},
+		},
+	}
+	if err := controllerutil.SetControllerReference(gw, pod, r.Scheme); err != nil {
+		return nil, err
+	}
+	return pod, nil
+}
+
+// staticPodCleanupMessage returns why the cleanup pod failed
+func staticPodCleanupMessage(pod *corev1.Pod) string {
+	if pod.Status.Phase != corev1.PodFailed {
+		return ""
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if terminated := status.State.Terminated; terminated != nil {
+			return fmt.Sprintf("cleanup exited with code %d: %s", terminated.ExitCode, terminated.Reason)
+		}
+	}
+	return pod.Status.Message
+}
+
+// addStaticPodFinalizer adds the finalizer to clean up the static pods before the vpn gw is deleted
+func (r *VpnGwReconciler) addStaticPodFinalizer(ctx context.Context, gw *myv1.VpnGw) error {
+	if controllerutil.ContainsFinalizer(gw, util.VpnGwStaticPodFinalizer) {
+		return nil
+	}
+	newGw := gw.DeepCopy()
+	controllerutil.AddFinalizer(newGw, util.VpnGwStaticPodFinalizer)
+	if err := r.Patch(ctx, newGw, client.MergeFrom(gw)); err != nil {
+		r.Log.Error(err, "failed to add vpn gw static pod finalizer")
+		return err
+	}
+	return nil
+}
+
+// handleDelVpnGw cleans up the static pod manifests and the host caches on each node before the static vpn gw is deleted.
+// the nodes of the daemonset pods and the static mirror pods are recorded in the status first, then the daemonset is deleted so that its pods do not copy the manifests again,
+// at last a cleanup pod runs on each node, the failed one is deleted and created again
+func (r *VpnGwReconciler) handleDelVpnGw(ctx context.Context, gw *myv1.VpnGw) (SyncState, waitReason, error) {
+	if !controllerutil.ContainsFinalizer(gw, util.VpnGwStaticPodFinalizer) {
+		return SyncStateSuccess, waitNone, nil
+	}
+	r.Log.Info("start handleDelVpnGw", "vpn gw", gw.Name)
+	defer r.Log.Info("end handleDelVpnGw", "vpn gw", gw.Name)
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(gw.Namespace), client.MatchingLabels{util.VpnGwLabel: gw.Name}); err != nil {
+		r.Log.Error(err, "failed to list vpn gw pods")
+		return SyncStateError, waitNone, err
+	}
+	// the static pods keep running on the nodes the daemonset pods left, eg. the node selector is changed
+	mirrors, err := r.listStaticMirrorPods(ctx, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to list vpn gw static mirror pods")
+		return SyncStateError, waitNone, err
+	}
+	var nodes, dsPods []string
+	for _, pod := range pods.Items {
+		if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+			continue
+		}
+		dsPods = append(dsPods, pod.Name)
+		if pod.Spec.NodeName != "" && !slices.Contains(nodes, pod.Spec.NodeName) {
+			nodes = append(nodes, pod.Spec.NodeName)
+		}
+	}
+	for _, pod := range mirrors {
+		if !slices.Contains(nodes, pod.Spec.NodeName) {
+			nodes = append(nodes, pod.Spec.NodeName)
+		}
+	}
+	cleanup := slices.Clone(gw.Status.StaticPodCleanup)
+	if cleanup == nil {
+		if len(nodes) == 0 || !staticPodsEnabled(gw) {
+			return r.removeStaticPodFinalizer(ctx, gw)
+		}
+		slices.Sort(nodes)
+		for _, node := range nodes {
+			cleanup = append(cleanup, myv1.VpnGwNodeCleanup{Node: node, Phase: corev1.PodPending})
+		}
+		if err := r.updateStaticPodCleanupStatus(ctx, gw, cleanup); err != nil {
+			r.Log.Error(err, "failed to record the nodes to clean up")
+			return SyncStateError, waitNone, err
+		}
+	}
+
+	ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: gw.Name, Namespace: gw.Namespace}}
+	if err := r.Delete(ctx, ds); err != nil && !apierrors.IsNotFound(err) {
+		r.Log.Error(err, "failed to delete vpn gw daemonset")
+		return SyncStateError, waitNone, err
+	}
+	if len(dsPods) != 0 {
+		return r.waitFor(ctx, gw, waitForCleanup, fmt.Sprintf("daemonset pods %v are terminating", dsPods))
+	}
+
+	var pending []string
+	for i := range cleanup {
+		if cleanup[i].Phase != corev1.PodSucceeded {
+			if err := r.syncStaticPodCleanup(ctx, gw, &cleanup[i]); err != nil {
+				return SyncStateError, waitNone, err
+			}
+		}
+		if cleanup[i].Phase != corev1.PodSucceeded {
+			pending = append(pending, cleanup[i].Node)
+		}
+	}
+	if err := r.updateStaticPodCleanupStatus(ctx, gw, cleanup); err != nil {
+		r.Log.Error(err, "failed to update vpn gw static pod cleanup status")
+		return SyncStateError, waitNone, err
+	}
+	if len(pending) != 0 {
+		return r.waitFor(ctx, gw, waitForCleanup, fmt.Sprintf("static pods are not cleaned up on nodes %v", pending))
+	}
+	// the cleanup pods are owned by the vpn gw and deleted along with it
+	return r.removeStaticPodFinalizer(ctx, gw)
+}
+
+// syncStaticPodCleanup creates the cleanup pod on the node and records its phase,
+// the node which is deleted has nothing to clean up
+func (r *VpnGwReconciler) syncStaticPodCleanup(ctx context.Context, gw *myv1.VpnGw, cleanup *myv1.VpnGwNodeCleanup) error {
+	if _, err := r.KubeClient.CoreV1().Nodes().Get(ctx, cleanup.Node, metav1.GetOptions{}); err != nil {
+		if !apierrors.IsNotFound(err) {
+			r.Log.Error(err, "failed to get node", "node", cleanup.Node)
+			return err
+		}
+		cleanup.Phase, cleanup.Message = corev1.PodSucceeded, "node is deleted"
+		return nil
+	}
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: staticPodCleanupPodName(gw, cleanup.Node), Namespace: gw.Namespace}, pod)
+	if apierrors.IsNotFound(err) {
+		if pod, err = r.staticPodCleanupPod(gw, cleanup.Node); err == nil {
+			err = r.Create(ctx, pod)
+		}
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			r.Log.Error(err, "failed to create static pod cleanup pod", "node", cleanup.Node)
+			return err
+		}
+		r.Log.Info("created static pod cleanup pod", "node", cleanup.Node, "pod", pod.Name)
+		cleanup.Phase = corev1.PodPending
+		return nil
+	}
+	if err != nil {
+		r.Log.Error(err, "failed to get static pod cleanup pod", "node", cleanup.Node)
+		return err
+	}
+	cleanup.Phase, cleanup.Message = pod.Status.Phase, staticPodCleanupMessage(pod)
+	if pod.Status.Phase == corev1.PodFailed {
+		// clean up again with a new pod
+		r.Log.Info("static pod cleanup failed, retry", "node", cleanup.Node, "message", cleanup.Message)
+		if err := r.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
+			r.Log.Error(err, "failed to delete static pod cleanup pod", "node", cleanup.Node)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeStaticPodFinalizer lets the vpn gw go once its static pods are cleaned up from all the nodes
+func (r *VpnGwReconciler) removeStaticPodFinalizer(ctx context.Context, gw *myv1.VpnGw) (SyncState, waitReason, error) {
+	// the status may be updated in this reconcile
+	latest, err := r.getVpnGw(ctx, types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace})
+	if err != nil {
+		return SyncStateError, waitNone, err
+	}
+	if latest == nil {
+		// the vpn gw is gone already
+		return SyncStateSuccess, waitNone, nil
+	}
+	newGw := latest.DeepCopy()
+	controllerutil.RemoveFinalizer(newGw, util.VpnGwStaticPodFinalizer)
+	if err := r.Patch(ctx, newGw, client.MergeFromWithOptions(latest, client.MergeFromWithOptimisticLock{})); err != nil {
+		r.Log.Error(err, "failed to remove vpn gw static pod finalizer")
+		return SyncStateError, waitNone, err
+	}
+	return SyncStateSuccess, waitNone, nil
+}
+
+// updateStaticPodCleanupStatus records the cleanup of each node on the latest vpn gw status
+func (r *VpnGwReconciler) updateStaticPodCleanupStatus(ctx context.Context, gw *myv1.VpnGw, cleanup []myv1.VpnGwNodeCleanup) error {
+	latest, err := r.getVpnGw(ctx, types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace})
+	if err != nil || latest == nil {
+		return err
+	}
+	newGw := latest.DeepCopy()
+	newGw.Status.StaticPodCleanup = cleanup
+	if slices.Equal(latest.Status.StaticPodCleanup, newGw.Status.StaticPodCleanup) {
+		return nil
+	}
+	return r.Status().Update(ctx, newGw)
+}
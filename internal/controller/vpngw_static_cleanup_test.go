@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+func TestStaticPodCleanup(t *testing.T) {
+	gw := &myv1.VpnGw{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "gw1", UID: "uid"},
+		Spec: myv1.VpnGwSpec{
+			WorkloadType:  myv1.WorkloadTypeStatic,
+			EnableSslVpn:  true,
+			SslVpnImage:   "openvpn:latest",
+			IPSecVpnImage: "strongswan:latest",
+		},
+	}
+	if !staticPodsEnabled(gw) {
+		t.Error("expected the static ssl vpn gw to copy static pods")
+	}
+	want := "rm -fv /host/manifests/static-openvpn.yaml && rm -rfv /host/cache/host-init-openvpn"
+	if got := staticPodCleanupScript(gw); got != want {
+		t.Errorf("expected cleanup script %q, got %q", want, got)
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = myv1.AddToScheme(scheme)
+	r := &VpnGwReconciler{Scheme: scheme, K8sManifestsPath: "/etc/kubernetes/manifests"}
+	node := strings.Repeat("node", 60)
+	pod, err := r.staticPodCleanupPod(gw, node)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(pod.Name) > 63 || pod.Name != staticPodCleanupPodName(gw, node) || pod.Name == staticPodCleanupPodName(gw, "node1") {
+		t.Errorf("unexpected cleanup pod name %s", pod.Name)
+	}
+	if pod.Spec.NodeName != node || pod.Spec.RestartPolicy != corev1.RestartPolicyNever || pod.Labels[util.VpnGwCleanupLabel] != gw.Name {
+		t.Errorf("unexpected cleanup pod %+v", pod)
+	}
+	if image := pod.Spec.Containers[0].Image; image != gw.Spec.SslVpnImage {
+		t.Errorf("expected the ssl vpn image, got %s", image)
+	}
+	if path := pod.Spec.Volumes[0].HostPath.Path; path != r.K8sManifestsPath {
+		t.Errorf("expected the kubelet manifests path, got %s", path)
+	}
+	if path := pod.Spec.Volumes[1].HostPath.Path; path != "/etc" {
+		t.Errorf("expected the parent of the host caches, got %s", path)
+	}
+	if owner := metav1.GetControllerOf(pod); owner == nil || owner.Name != gw.Name {
+		t.Errorf("expected the cleanup pod to be owned by the vpn gw, got %v", owner)
+	}
+
+	gw.Spec.EnableSslVpn, gw.Spec.EnableIPSecVpn = false, true
+	want = "rm -fv /host/manifests/static-strongswan.yaml && rm -rfv /host/cache/host-init-strongswan"
+	if got := staticPodCleanupScript(gw); got != want {
+		t.Errorf("expected cleanup script %q, got %q", want, got)
+	}
+	if pod, _ = r.staticPodCleanupPod(gw, node); pod.Spec.Containers[0].Image != gw.Spec.IPSecVpnImage {
+		t.Errorf("expected the ipsec vpn image, got %s", pod.Spec.Containers[0].Image)
+	}
+
+	gw.Spec.EnableIPSecVpn, gw.Spec.EnableWireGuard = false, true
+	if staticPodsEnabled(gw) {
+		t.Error("wireguard runs in the daemonset pod, no static pod to clean up")
+	}
+
+	failed := &corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodFailed,
+		ContainerStatuses: []corev1.ContainerStatus{{
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}},
+		}},
+	}}
+	if got := staticPodCleanupMessage(failed); got != "cleanup exited with code 1: Error" {
+		t.Errorf("unexpected cleanup message %q", got)
+	}
+}
+
+func TestStaticPodCleanupNodes(t *testing.T) {
+	now := metav1.Now()
+	gw := &myv1.VpnGw{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "gw1",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{util.VpnGwStaticPodFinalizer},
+		},
+		Spec: myv1.VpnGwSpec{WorkloadType: myv1.WorkloadTypeStatic, EnableSslVpn: true},
+	}
+	mirror := func(gwNamespace, gwName, node string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   util.StaticPodNamespace,
+				Name:        util.SslVpnStaticPodName + "-" + node,
+				Labels:      map[string]string{util.VpnGwLabel: gwName, util.VpnGwNamespaceLabel: gwNamespace},
+				Annotations: map[string]string{corev1.MirrorPodAnnotationKey: "hash"},
+			},
+			Spec: corev1.PodSpec{NodeName: node},
+		}
+	}
+	dsPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: gw.Namespace, Name: "gw1-a", Labels: map[string]string{util.VpnGwLabel: gw.Name}},
+		Spec:       corev1.PodSpec{NodeName: "node1"},
+	}
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = myv1.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(gw).
+		WithObjects(gw, dsPod, mirror("default", "gw1", "node1"), mirror("default", "gw1", "node2"), mirror("other", "gw1", "node3")).Build()
+	r := &VpnGwReconciler{Client: c, Scheme: scheme}
+	ctx := context.Background()
+
+	// the static pod keeps running on node2 which the daemonset pod left, the one on node3 belongs to another vpn gw
+	if _, wait, err := r.handleDelVpnGw(ctx, gw); err != nil || wait != waitForCleanup {
+		t.Fatalf("expected to wait for the daemonset pods, got %q, %v", wait, err)
+	}
+	latest := &myv1.VpnGw{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(gw), latest); err != nil {
+		t.Fatal(err)
+	}
+	var nodes []string
+	for _, cleanup := range latest.Status.StaticPodCleanup {
+		nodes = append(nodes, cleanup.Node)
+	}
+	if strings.Join(nodes, ",") != "node1,node2" {
+		t.Errorf("expected to clean up node1 and node2, got %v", nodes)
+	}
+
+	// the vpn gw which is gone has no finalizer to remove
+	gone := &myv1.VpnGw{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gw2"}}
+	if state, _, err := r.removeStaticPodFinalizer(ctx, gone); state != SyncStateSuccess || err != nil {
+		t.Errorf("expected success for the deleted vpn gw, got %v, %v", state, err)
+	}
+}
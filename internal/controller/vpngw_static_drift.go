@@ -0,0 +1,303 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+// staticPodHealInterval is the least interval to recreate a daemonset pod, so that the static pods are not restarted
+// on all the nodes at once. the drift which is not fixed by copying the manifest again is only reported
+const staticPodHealInterval = 10 * time.Minute
+
+// staticPodContainer is the desired state of a static pod container
+type staticPodContainer struct {
+	name   string
+	image  string
+	env    []corev1.EnvVar
+	limits corev1.ResourceList
+}
+
+// staticPodEnv passes the resource limits of the daemonset container to format the static pod manifest,
+// the cpu is in millicores and the memory is in bytes. the static pods are labeled with the vpn gw
+// so that their mirror pods can be told apart from the ones of the other vpn gws
+func staticPodEnv(gw *myv1.VpnGw) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{Name: util.StaticPodVpnGwKey, Value: gw.Name},
+		{Name: util.StaticPodVpnGwNamespaceKey, Value: gw.Namespace},
+		{
+			Name: util.StaticPodCPUKey,
+			ValueFrom: &corev1.EnvVarSource{
+				ResourceFieldRef: &corev1.ResourceFieldSelector{Resource: "limits.cpu", Divisor: resource.MustParse("1m")},
+			},
+		},
+		{
+			Name: util.StaticPodMemoryKey,
+			ValueFrom: &corev1.EnvVarSource{
+				ResourceFieldRef: &corev1.ResourceFieldSelector{Resource: "limits.memory"},
+			},
+		},
+	}
+}
+
+// desiredStaticPods returns the desired containers of the static pods of the vpn gw keyed by the static pod name,
+// they are formatted by the daemonset pod from the same spec
+func (r *VpnGwReconciler) desiredStaticPods(gw *myv1.VpnGw) map[string][]staticPodContainer {
+	limits := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(gw.Spec.CPU),
+		corev1.ResourceMemory: resource.MustParse(gw.Spec.Memory),
+	}
+	pods := map[string][]staticPodContainer{}
+	if gw.Spec.EnableSslVpn {
+		sslVpnPort := r.SslVpnUDP
+		if gw.Spec.SslVpnProto == "tcp" {
+			sslVpnPort = r.SslVpnTCP
+		}
+		pods[util.SslVpnStaticPodName] = []staticPodContainer{{
+			name:  util.SslVpnStaticPodName,
+			image: gw.Spec.SslVpnImage,
+			env: []corev1.EnvVar{
+				{Name: util.SslVpnProtoKey, Value: gw.Spec.SslVpnProto},
+				{Name: util.SslVpnPortKey, Value: sslVpnPort},
+				{Name: util.SslVpnCipherKey, Value: gw.Spec.SslVpnCipher},
+			},
+			limits: limits,
+		}}
+	}
+	if gw.Spec.EnableIPSecVpn {
+		// the load container loads the connections into the strongswan container
+		pods[util.IPSecVpnStaticPodName] = []staticPodContainer{
+			{name: util.IPSecVpnStaticPodName, image: gw.Spec.IPSecVpnImage, limits: limits},
+			{name: "load", image: gw.Spec.IPSecVpnImage, limits: limits},
+		}
+	}
+	return pods
+}
+
+// staticPodDriftFields returns the fields of the mirror pod which differ from the desired containers
+func staticPodDriftFields(want []staticPodContainer, pod *corev1.Pod) []string {
+	var fields []string
+	add := func(field string) {
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	for _, w := range want {
+		i := slices.IndexFunc(pod.Spec.Containers, func(c corev1.Container) bool { return c.Name == w.name })
+		if i < 0 {
+			add("container " + w.name)
+			continue
+		}
+		c := pod.Spec.Containers[i]
+		if c.Image != w.image {
+			add("image")
+		}
+		for _, env := range w.env {
+			j := slices.IndexFunc(c.Env, func(e corev1.EnvVar) bool { return e.Name == env.Name })
+			if j < 0 || c.Env[j].Value != env.Value {
+				add("env " + env.Name)
+			}
+		}
+		for name, quantity := range w.limits {
+			if got, ok := c.Resources.Limits[name]; !ok || got.Cmp(quantity) != 0 {
+				add("resources")
+			}
+		}
+	}
+	return fields
+}
+
+// daemonSetUpdateRevision returns the controller revision hash of the latest daemonset template of the vpn gw,
+// it is empty if the daemonset or its revision is not found
+func (r *VpnGwReconciler) daemonSetUpdateRevision(ctx context.Context, gw *myv1.VpnGw) (string, error) {
+	ds := &appsv1.DaemonSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace}, ds); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+	if err != nil {
+		return "", err
+	}
+	revisions := &appsv1.ControllerRevisionList{}
+	if err := r.List(ctx, revisions, client.InNamespace(ds.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return "", err
+	}
+	var latest *appsv1.ControllerRevision
+	for i := range revisions.Items {
+		revision := &revisions.Items[i]
+		if metav1.IsControlledBy(revision, ds) && (latest == nil || revision.Revision > latest.Revision) {
+			latest = revision
+		}
+	}
+	if latest == nil {
+		return "", nil
+	}
+	return latest.Labels[appsv1.DefaultDaemonSetUniqueLabelKey], nil
+}
+
+// staticMirrorPodOwner returns the namespaced name of the vpn gw the mirror pod is labeled with,
+// it is empty for the static pods copied before they were labeled
+func staticMirrorPodOwner(pod *corev1.Pod) string {
+	name := pod.Labels[util.VpnGwLabel]
+	if name == "" {
+		return ""
+	}
+	return types.NamespacedName{Namespace: pod.Labels[util.VpnGwNamespaceLabel], Name: name}.String()
+}
+
+// syncStaticPodDrift compares the mirror pods of the static pods on each node with the vpn gw and records the drift,
+// the nodes whose daemonset pods are not updated yet are skipped as they copied the manifests of the old template.
+// the daemonset pod on a drifted node is recreated to copy the static pod manifest again if auto heal is enabled,
+// at most one node in each heal interval. the static pods copied by another vpn gw on the same node are only reported
+func (r *VpnGwReconciler) syncStaticPodDrift(ctx context.Context, gw *myv1.VpnGw) error {
+	var drifts []myv1.VpnGwNodeDrift
+	var dsPods []corev1.Pod
+	conflicts := map[string]bool{}
+	if gw.Spec.WorkloadType == myv1.WorkloadTypeStatic {
+		revision, err := r.daemonSetUpdateRevision(ctx, gw)
+		if err != nil {
+			r.Log.Error(err, "failed to get vpn gw daemonset revision")
+			return err
+		}
+		pods := &corev1.PodList{}
+		if err := r.List(ctx, pods, client.InNamespace(gw.Namespace), client.MatchingLabels{util.VpnGwLabel: gw.Name}); err != nil {
+			r.Log.Error(err, "failed to list vpn gw pods")
+			return err
+		}
+		desired := r.desiredStaticPods(gw)
+		names := make([]string, 0, len(desired))
+		for name := range desired {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		owner := types.NamespacedName{Namespace: gw.Namespace, Name: gw.Name}.String()
+		for _, pod := range pods.Items {
+			if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok || pod.Spec.NodeName == "" {
+				continue
+			}
+			if revision == "" || pod.Labels[appsv1.DefaultDaemonSetUniqueLabelKey] != revision {
+				// the daemonset is rolling out, the static pod is copied again by the updated pod
+				continue
+			}
+			dsPods = append(dsPods, pod)
+			for _, name := range names {
+				mirror := &corev1.Pod{}
+				key := types.NamespacedName{Namespace: util.StaticPodNamespace, Name: name + "-" + pod.Spec.NodeName}
+				if err := r.Get(ctx, key, mirror); err != nil {
+					if apierrors.IsNotFound(err) {
+						// the static pod is not copied yet
+						continue
+					}
+					r.Log.Error(err, "failed to get static mirror pod", "pod", key.String())
+					return err
+				}
+				if _, ok := mirror.Annotations[corev1.MirrorPodAnnotationKey]; !ok {
+					continue
+				}
+				var fields []string
+				if other := staticMirrorPodOwner(mirror); other != "" && other != owner {
+					// the static pods of the same name overwrite each other, recreating the daemonset pod does not help
+					fields = []string{"vpn gw " + other}
+					conflicts[pod.Spec.NodeName] = true
+				} else {
+					fields = staticPodDriftFields(desired[name], mirror)
+				}
+				if len(fields) != 0 {
+					drift := myv1.VpnGwNodeDrift{Node: pod.Spec.NodeName, Pod: key.String(), Fields: fields}
+					if i := slices.IndexFunc(gw.Status.StaticPodDrift, func(d myv1.VpnGwNodeDrift) bool { return d.Node == drift.Node }); i >= 0 {
+						drift.LastHealTime = gw.Status.StaticPodDrift[i].LastHealTime
+					}
+					drifts = append(drifts, drift)
+				}
+			}
+		}
+	}
+	lastHealTime := gw.Status.StaticPodLastHealTime
+	healed := ""
+	for i, drift := range drifts {
+		r.Log.Info("static pod drifts from the vpn gw", "node", drift.Node, "pod", drift.Pod, "fields", drift.Fields)
+		if drift.Node == healed {
+			// the daemonset pod on the node is recreated already
+			drifts[i].LastHealTime = lastHealTime
+			continue
+		}
+		if !gw.Spec.StaticPodAutoHeal || conflicts[drift.Node] || lastHealTime != nil && time.Since(lastHealTime.Time) < staticPodHealInterval {
+			continue
+		}
+		for _, pod := range dsPods {
+			if pod.Spec.NodeName != drift.Node {
+				continue
+			}
+			r.Log.Info("recreate daemonset pod to copy the static pod again", "node", drift.Node, "pod", pod.Name)
+			if err := r.Delete(ctx, &pod); err != nil && !apierrors.IsNotFound(err) {
+				r.Log.Error(err, "failed to delete daemonset pod", "pod", pod.Name)
+				return err
+			}
+		}
+		now := metav1.Now()
+		lastHealTime, healed = &now, drift.Node
+		drifts[i].LastHealTime = lastHealTime
+	}
+
+	latest, err := r.getVpnGw(ctx, types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace})
+	if err != nil || latest == nil {
+		return err
+	}
+	newGw := latest.DeepCopy()
+	newGw.Status.StaticPodDrift = drifts
+	newGw.Status.StaticPodLastHealTime = lastHealTime
+	if reflect.DeepEqual(latest.Status, newGw.Status) {
+		return nil
+	}
+	return r.Status().Update(ctx, newGw)
+}
+
+// isStaticMirrorPod reports whether the pod is the mirror pod of a static pod copied by the static vpn gws
+func isStaticMirrorPod(obj client.Object) bool {
+	if obj.GetNamespace() != util.StaticPodNamespace {
+		return false
+	}
+	if _, ok := obj.GetAnnotations()[corev1.MirrorPodAnnotationKey]; !ok {
+		return false
+	}
+	name := obj.GetName()
+	return strings.HasPrefix(name, util.SslVpnStaticPodName+"-") || strings.HasPrefix(name, util.IPSecVpnStaticPodName+"-")
+}
+
+// enqueueVpnGwForStaticPod enqueues the vpn gw the mirror pod is labeled with to compare its static pods once the mirror pod changes,
+// the mirror pods copied before they were labeled enqueue all the static vpn gws
+func (r *VpnGwReconciler) enqueueVpnGwForStaticPod(ctx context.Context, obj client.Object) []reconcile.Request {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || !isStaticMirrorPod(pod) {
+		return nil
+	}
+	if name := pod.Labels[util.VpnGwLabel]; name != "" {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: pod.Labels[util.VpnGwNamespaceLabel]}}}
+	}
+	gws := &myv1.VpnGwList{}
+	if err := r.List(ctx, gws); err != nil {
+		r.Log.Error(err, "failed to list vpn gws")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, gw := range gws.Items {
+		if gw.Spec.WorkloadType == myv1.WorkloadTypeStatic {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace}})
+		}
+	}
+	return requests
+}
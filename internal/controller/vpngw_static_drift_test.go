@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+func TestStaticPodDriftFields(t *testing.T) {
+	r := &VpnGwReconciler{SslVpnUDP: "1194", SslVpnTCP: "443"}
+	gw := &myv1.VpnGw{Spec: myv1.VpnGwSpec{
+		WorkloadType:   myv1.WorkloadTypeStatic,
+		CPU:            "1",
+		Memory:         "1Gi",
+		EnableSslVpn:   true,
+		SslVpnProto:    "udp",
+		SslVpnCipher:   "AES-256-GCM",
+		SslVpnImage:    "openvpn:v2",
+		EnableIPSecVpn: true,
+		IPSecVpnImage:  "strongswan:v2",
+	}}
+	desired := r.desiredStaticPods(gw)
+	if len(desired) != 2 || len(desired[util.IPSecVpnStaticPodName]) != 2 {
+		t.Fatalf("unexpected desired static pods %v", desired)
+	}
+
+	// the manifest formatted by the daemonset pod from the same spec
+	mirror := func() *corev1.Pod {
+		return &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  util.SslVpnStaticPodName,
+			Image: "openvpn:v2",
+			Env: []corev1.EnvVar{
+				{Name: "POD_IP"},
+				{Name: util.SslVpnProtoKey, Value: "udp"},
+				{Name: util.SslVpnPortKey, Value: "1194"},
+				{Name: util.SslVpnCipherKey, Value: "AES-256-GCM"},
+			},
+			Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("1000m"),
+				corev1.ResourceMemory: resource.MustParse("1073741824"),
+			}},
+		}}}}
+	}
+	if fields := staticPodDriftFields(desired[util.SslVpnStaticPodName], mirror()); len(fields) != 0 {
+		t.Errorf("expected no drift, got %v", fields)
+	}
+
+	drifted := mirror()
+	drifted.Spec.Containers[0].Image = "openvpn:v1"
+	drifted.Spec.Containers[0].Env[2].Value = "443"
+	drifted.Spec.Containers[0].Env = drifted.Spec.Containers[0].Env[:3]
+	drifted.Spec.Containers[0].Resources.Limits[corev1.ResourceMemory] = resource.MustParse("1024M")
+	want := []string{"image", "env SSL_VPN_PORT", "env SSL_VPN_CIPHER", "resources"}
+	if fields := staticPodDriftFields(desired[util.SslVpnStaticPodName], drifted); !slices.Equal(fields, want) {
+		t.Errorf("expected drift %v, got %v", want, fields)
+	}
+
+	strongswan := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+		Name:      util.IPSecVpnStaticPodName,
+		Image:     "strongswan:v1",
+		Resources: corev1.ResourceRequirements{Limits: desired[util.IPSecVpnStaticPodName][0].limits},
+	}}}}
+	want = []string{"image", "container load"}
+	if fields := staticPodDriftFields(desired[util.IPSecVpnStaticPodName], strongswan); !slices.Equal(fields, want) {
+		t.Errorf("expected drift %v, got %v", want, fields)
+	}
+
+	gw.Spec.SslVpnProto = "tcp"
+	if env := r.desiredStaticPods(gw)[util.SslVpnStaticPodName][0].env; env[1].Value != "443" {
+		t.Errorf("expected the tcp port, got %v", env)
+	}
+}
+
+func TestSyncStaticPodDrift(t *testing.T) {
+	gw := &myv1.VpnGw{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gw1"},
+		Spec: myv1.VpnGwSpec{
+			WorkloadType:      myv1.WorkloadTypeStatic,
+			StaticPodAutoHeal: true,
+			CPU:               "1",
+			Memory:            "1Gi",
+			EnableSslVpn:      true,
+			SslVpnProto:       "udp",
+			SslVpnImage:       "openvpn:v2",
+		},
+	}
+	labels := map[string]string{util.VpnGwLabel: gw.Name}
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: gw.Namespace, Name: gw.Name, UID: "ds"},
+		Spec:       appsv1.DaemonSetSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+	}
+	revision := func(name string, n int64) *appsv1.ControllerRevision {
+		return &appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       gw.Namespace,
+				Name:            "gw1-" + name,
+				Labels:          map[string]string{util.VpnGwLabel: gw.Name, appsv1.DefaultDaemonSetUniqueLabelKey: name},
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: ds.Name, UID: ds.UID, Controller: ptr.To(true)}},
+			},
+			Revision: n,
+		}
+	}
+	dsPod := func(node, hash string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: gw.Namespace,
+				Name:      "gw1-" + node,
+				Labels:    map[string]string{util.VpnGwLabel: gw.Name, appsv1.DefaultDaemonSetUniqueLabelKey: hash},
+			},
+			Spec: corev1.PodSpec{NodeName: node},
+		}
+	}
+	// the mirror pods have no containers, so all of them drift
+	mirror := func(node, gwNamespace, gwName string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   util.StaticPodNamespace,
+			Name:        util.SslVpnStaticPodName + "-" + node,
+			Labels:      map[string]string{util.VpnGwLabel: gwName, util.VpnGwNamespaceLabel: gwNamespace},
+			Annotations: map[string]string{corev1.MirrorPodAnnotationKey: "hash"},
+		}}
+	}
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = myv1.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(gw).WithObjects(
+		gw, ds, revision("old", 1), revision("new", 2),
+		dsPod("node1", "old"), mirror("node1", "default", "gw1"),
+		dsPod("node2", "new"), mirror("node2", "other", "gw2"),
+		dsPod("node3", "new"), mirror("node3", "default", "gw1"),
+		dsPod("node4", "new"), mirror("node4", "default", "gw1"),
+	).Build()
+	r := &VpnGwReconciler{Client: c, Scheme: scheme, SslVpnUDP: "1194"}
+	ctx := context.Background()
+
+	sync := func() *myv1.VpnGw {
+		t.Helper()
+		latest := &myv1.VpnGw{}
+		if err := c.Get(ctx, client.ObjectKeyFromObject(gw), latest); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.syncStaticPodDrift(ctx, latest); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if err := c.Get(ctx, client.ObjectKeyFromObject(gw), latest); err != nil {
+			t.Fatal(err)
+		}
+		return latest
+	}
+	pods := func() []string {
+		t.Helper()
+		list := &corev1.PodList{}
+		if err := c.List(ctx, list, client.InNamespace(gw.Namespace)); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, pod := range list.Items {
+			names = append(names, pod.Name)
+		}
+		return names
+	}
+
+	// node1 is rolling out, the static pod on node2 is copied by another vpn gw
+	latest := sync()
+	var nodes []string
+	for _, drift := range latest.Status.StaticPodDrift {
+		nodes = append(nodes, drift.Node)
+		if drift.Node == "node2" && !slices.Equal(drift.Fields, []string{"vpn gw other/gw2"}) {
+			t.Errorf("expected the conflicted vpn gw, got %v", drift.Fields)
+		}
+	}
+	if !slices.Equal(nodes, []string{"node2", "node3", "node4"}) {
+		t.Errorf("expected the drift on node2, node3 and node4, got %v", nodes)
+	}
+	if latest.Status.StaticPodLastHealTime == nil {
+		t.Fatal("expected the heal time to be recorded")
+	}
+	// only one node is healed, the conflicted one is skipped
+	if got := pods(); !slices.Equal(got, []string{"gw1-node1", "gw1-node2", "gw1-node4"}) {
+		t.Errorf("expected only the daemonset pod on node3 to be recreated, got %v", got)
+	}
+	// node4 waits for the next heal interval
+	sync()
+	if got := pods(); !slices.Equal(got, []string{"gw1-node1", "gw1-node2", "gw1-node4"}) {
+		t.Errorf("expected no daemonset pod to be recreated in the heal interval, got %v", got)
+	}
+
+	if reqs := r.enqueueVpnGwForStaticPod(ctx, mirror("node2", "other", "gw2")); len(reqs) != 1 || reqs[0].Namespace != "other" || reqs[0].Name != "gw2" {
+		t.Errorf("expected the labeled vpn gw to be enqueued, got %v", reqs)
+	}
+	if isStaticMirrorPod(dsPod("node1", "new")) || !isStaticMirrorPod(mirror("node1", "default", "gw1")) {
+		t.Error("expected only the static mirror pods to be watched")
+	}
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+// vpnGwRollout is the rollout progress of the vpn gw statefulset or daemonset
+type vpnGwRollout struct {
+	kind  string
+	found bool
+	// the workload controller has observed the latest workload spec
+	observed bool
+	desired  int32
+	updated  int32
+}
+
+func (r *vpnGwRollout) done() bool {
+	return r.found && r.observed && r.updated >= r.desired
+}
+
+func (r *VpnGwReconciler) getVpnGwRollout(ctx context.Context, gw *myv1.VpnGw) (*vpnGwRollout, error) {
+	name := types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace}
+	if gw.Spec.WorkloadType == "statefulset" {
+		rollout := &vpnGwRollout{kind: "statefulset"}
+		sts := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, name, sts); err != nil {
+			if apierrors.IsNotFound(err) {
+				return rollout, nil
+			}
+			return nil, err
+		}
+		rollout.found = true
+		rollout.observed = sts.Status.ObservedGeneration >= sts.Generation
+		rollout.desired = 1
+		if sts.Spec.Replicas != nil {
+			rollout.desired = *sts.Spec.Replicas
+		}
+		rollout.updated = sts.Status.UpdatedReplicas
+		return rollout, nil
+	}
+	rollout := &vpnGwRollout{kind: "daemonset"}
+	ds := &appsv1.DaemonSet{}
+	if err := r.Get(ctx, name, ds); err != nil {
+		if apierrors.IsNotFound(err) {
+			return rollout, nil
+		}
+		return nil, err
+	}
+	rollout.found = true
+	rollout.observed = ds.Status.ObservedGeneration >= ds.Generation
+	rollout.desired = ds.Status.DesiredNumberScheduled
+	rollout.updated = ds.Status.UpdatedNumberScheduled
+	return rollout, nil
+}
+
+// vpnGwContainers returns the containers which should be ready in every vpn gw pod
+func vpnGwContainers(gw *myv1.VpnGw) []string {
+	var containers []string
+	if gw.Spec.EnableSslVpn {
+		containers = append(containers, util.SslVpnServer)
+	}
+	if gw.Spec.EnableIPSecVpn {
+		containers = append(containers, util.IPSecVpnServer)
+	}
+	if gw.Spec.EnableWireGuard {
+		containers = append(containers, util.WireGuardServer)
+	}
+	if gw.Spec.Keepalived != "" {
+		containers = append(containers, util.KeepAlivedServer)
+	}
+	return containers
+}
+
+// readyVpnGwPods counts the pods whose vpn containers are all ready, and returns the not ready ones
+func readyVpnGwPods(pods []corev1.Pod, containers []string) (int32, []string) {
+	var ready int32
+	var notReady []string
+	for _, pod := range pods {
+		if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+			// static pods copied by the daemonset are not counted
+			continue
+		}
+		if !pod.DeletionTimestamp.IsZero() {
+			continue
+		}
+		readyContainers := map[string]bool{}
+		for _, status := range pod.Status.ContainerStatuses {
+			readyContainers[status.Name] = status.Ready
+		}
+		var waiting []string
+		for _, name := range containers {
+			if !readyContainers[name] {
+				waiting = append(waiting, name)
+			}
+		}
+		if len(waiting) != 0 {
+			notReady = append(notReady, fmt.Sprintf("%s(%s)", pod.Name, strings.Join(waiting, ",")))
+			continue
+		}
+		ready++
+	}
+	return ready, notReady
+}
+
+// vpnGwReadinessConditions computes the Ready, Progressing and Degraded conditions
+func vpnGwReadinessConditions(gw *myv1.VpnGw, rollout *vpnGwRollout, ready int32, notReady []string, wait waitReason, syncErr error) []metav1.Condition {
+	progressing := metav1.Condition{
+		Type:               myv1.VpnGwProgressing,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: gw.Generation,
+		Reason:             "RolloutComplete",
+		Message:            fmt.Sprintf("%s rollout is complete", rollout.kind),
+	}
+	switch {
+	case !rollout.found:
+		progressing.Status = metav1.ConditionTrue
+		progressing.Reason = "WorkloadNotFound"
+		progressing.Message = fmt.Sprintf("%s %s is not created yet", rollout.kind, gw.Name)
+	case !rollout.done():
+		progressing.Status = metav1.ConditionTrue
+		progressing.Reason = "RollingOut"
+		progressing.Message = fmt.Sprintf("%s rollout: %d of %d pods updated", rollout.kind, rollout.updated, rollout.desired)
+	case wait != waitNone:
+		progressing.Status = metav1.ConditionTrue
+		progressing.Reason = string(wait)
+		progressing.Message = "vpn gw is waiting, see the condition " + string(wait)
+	}
+
+	degraded := metav1.Condition{
+		Type:               myv1.VpnGwDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: gw.Generation,
+		Reason:             "AsExpected",
+	}
+	switch {
+	case syncErr != nil:
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = "ReconcileError"
+		degraded.Message = syncErr.Error()
+	case rollout.done() && len(notReady) != 0:
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = "ContainersNotReady"
+		degraded.Message = "containers not ready: " + strings.Join(notReady, " ")
+	}
+
+	readyCond := metav1.Condition{
+		Type:               myv1.VpnGwReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: gw.Generation,
+	}
+	switch {
+	case degraded.Status == metav1.ConditionTrue:
+		readyCond.Reason = degraded.Reason
+		readyCond.Message = degraded.Message
+	case progressing.Status == metav1.ConditionTrue:
+		readyCond.Reason = progressing.Reason
+		readyCond.Message = progressing.Message
+	case ready < rollout.desired || rollout.desired == 0:
+		readyCond.Reason = "PodsNotReady"
+		readyCond.Message = fmt.Sprintf("%d of %d pods ready", ready, rollout.desired)
+	default:
+		readyCond.Status = metav1.ConditionTrue
+		readyCond.Reason = "AllPodsReady"
+		readyCond.Message = fmt.Sprintf("%d of %d pods ready", ready, rollout.desired)
+	}
+	return []metav1.Condition{readyCond, progressing, degraded}
+}
+
+// syncVpnGwReadiness writes the readiness summary of the vpn gw to its status,
+// syncErr is the error of the reconcile if it failed
+func (r *VpnGwReconciler) syncVpnGwReadiness(ctx context.Context, name types.NamespacedName, wait waitReason, syncErr error) error {
+	gw, err := r.getVpnGw(ctx, name)
+	if err != nil || gw == nil {
+		return err
+	}
+	rollout, err := r.getVpnGwRollout(ctx, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to get vpn gw rollout", "vpn gw", name.String())
+		return err
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(gw.Namespace), client.MatchingLabels{util.VpnGwLabel: gw.Name}); err != nil {
+		r.Log.Error(err, "failed to list vpn gw pods", "vpn gw", name.String())
+		return err
+	}
+	ready, notReady := readyVpnGwPods(pods.Items, vpnGwContainers(gw))
+
+	newGw := gw.DeepCopy()
+	newGw.Status.ReadyReplicas = ready
+	if syncErr == nil && wait == waitNone {
+		newGw.Status.ObservedGeneration = gw.Generation
+	}
+	for _, condition := range vpnGwReadinessConditions(gw, rollout, ready, notReady, wait, syncErr) {
+		meta.SetStatusCondition(&newGw.Status.Conditions, condition)
+	}
+	if reflect.DeepEqual(gw.Status, newGw.Status) {
+		return nil
+	}
+	return r.Status().Update(ctx, newGw)
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+func vpnGwTestPod(name string, ready, mirror bool) corev1.Pod {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: util.SslVpnServer, Ready: ready},
+		}},
+	}
+	if mirror {
+		pod.Annotations = map[string]string{corev1.MirrorPodAnnotationKey: "hash"}
+	}
+	return pod
+}
+
+func TestVpnGwReadiness(t *testing.T) {
+	meta1 := metav1.ObjectMeta{Namespace: "default", Name: "gw1", Generation: 1}
+	sts := func(replicas, updated int32) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: meta1,
+			Spec:       appsv1.StatefulSetSpec{Replicas: ptr.To(replicas)},
+			Status:     appsv1.StatefulSetStatus{ObservedGeneration: 1, UpdatedReplicas: updated},
+		}
+	}
+	ds := func(desired, updated int32) *appsv1.DaemonSet {
+		return &appsv1.DaemonSet{
+			ObjectMeta: meta1,
+			Status:     appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: desired, UpdatedNumberScheduled: updated},
+		}
+	}
+	type condition struct {
+		status metav1.ConditionStatus
+		reason string
+	}
+	tests := []struct {
+		name         string
+		workloadType string
+		workload     client.Object
+		pods         []corev1.Pod
+		wait         waitReason
+		syncErr      error
+		wantReady    int32
+		ready        condition
+		progressing  condition
+		degraded     condition
+	}{
+		{
+			name:         "statefulset not created",
+			workloadType: myv1.WorkloadTypeStatefulset,
+			ready:        condition{metav1.ConditionFalse, "WorkloadNotFound"},
+			progressing:  condition{metav1.ConditionTrue, "WorkloadNotFound"},
+			degraded:     condition{metav1.ConditionFalse, "AsExpected"},
+		},
+		{
+			name:         "statefulset rolling out",
+			workloadType: myv1.WorkloadTypeStatefulset,
+			workload:     sts(2, 1),
+			pods:         []corev1.Pod{vpnGwTestPod("gw1-0", true, false), vpnGwTestPod("gw1-1", false, false)},
+			wantReady:    1,
+			ready:        condition{metav1.ConditionFalse, "RollingOut"},
+			progressing:  condition{metav1.ConditionTrue, "RollingOut"},
+			degraded:     condition{metav1.ConditionFalse, "AsExpected"},
+		},
+		{
+			name:         "statefulset ready",
+			workloadType: myv1.WorkloadTypeStatefulset,
+			workload:     sts(2, 2),
+			pods:         []corev1.Pod{vpnGwTestPod("gw1-0", true, false), vpnGwTestPod("gw1-1", true, false)},
+			wantReady:    2,
+			ready:        condition{metav1.ConditionTrue, "AllPodsReady"},
+			progressing:  condition{metav1.ConditionFalse, "RolloutComplete"},
+			degraded:     condition{metav1.ConditionFalse, "AsExpected"},
+		},
+		{
+			name:         "statefulset containers not ready",
+			workloadType: myv1.WorkloadTypeStatefulset,
+			workload:     sts(2, 2),
+			pods:         []corev1.Pod{vpnGwTestPod("gw1-0", true, false), vpnGwTestPod("gw1-1", false, false)},
+			wantReady:    1,
+			ready:        condition{metav1.ConditionFalse, "ContainersNotReady"},
+			progressing:  condition{metav1.ConditionFalse, "RolloutComplete"},
+			degraded:     condition{metav1.ConditionTrue, "ContainersNotReady"},
+		},
+		{
+			name:         "daemonset waiting for config sync",
+			workloadType: util.WorkloadTypeDaemonset,
+			workload:     ds(1, 1),
+			pods:         []corev1.Pod{vpnGwTestPod("gw1-a", true, false)},
+			wait:         waitForConfigSync,
+			wantReady:    1,
+			ready:        condition{metav1.ConditionFalse, string(waitForConfigSync)},
+			progressing:  condition{metav1.ConditionTrue, string(waitForConfigSync)},
+			degraded:     condition{metav1.ConditionFalse, "AsExpected"},
+		},
+		{
+			name:         "daemonset reconcile error",
+			workloadType: util.WorkloadTypeDaemonset,
+			workload:     ds(1, 1),
+			pods:         []corev1.Pod{vpnGwTestPod("gw1-a", true, false)},
+			syncErr:      errors.New("failed"),
+			wantReady:    1,
+			ready:        condition{metav1.ConditionFalse, "ReconcileError"},
+			progressing:  condition{metav1.ConditionFalse, "RolloutComplete"},
+			degraded:     condition{metav1.ConditionTrue, "ReconcileError"},
+		},
+		{
+			name:         "daemonset not scheduled",
+			workloadType: util.WorkloadTypeDaemonset,
+			workload:     ds(0, 0),
+			ready:        condition{metav1.ConditionFalse, "PodsNotReady"},
+			progressing:  condition{metav1.ConditionFalse, "RolloutComplete"},
+			degraded:     condition{metav1.ConditionFalse, "AsExpected"},
+		},
+		{
+			name:         "static pods are not counted",
+			workloadType: myv1.WorkloadTypeStatic,
+			workload:     ds(1, 1),
+			pods:         []corev1.Pod{vpnGwTestPod("gw1-a", true, false), vpnGwTestPod("openvpn-node1", false, true)},
+			wantReady:    1,
+			ready:        condition{metav1.ConditionTrue, "AllPodsReady"},
+			progressing:  condition{metav1.ConditionFalse, "RolloutComplete"},
+			degraded:     condition{metav1.ConditionFalse, "AsExpected"},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = myv1.AddToScheme(scheme)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &myv1.VpnGw{ObjectMeta: meta1, Spec: myv1.VpnGwSpec{WorkloadType: tt.workloadType, EnableSslVpn: true}}
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			if tt.workload != nil {
+				builder = builder.WithObjects(tt.workload)
+			}
+			r := &VpnGwReconciler{Client: builder.Build(), Scheme: scheme}
+			rollout, err := r.getVpnGwRollout(context.Background(), gw)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			ready, notReady := readyVpnGwPods(tt.pods, vpnGwContainers(gw))
+			if ready != tt.wantReady {
+				t.Errorf("expected %d ready replicas, got %d", tt.wantReady, ready)
+			}
+			conditions := vpnGwReadinessConditions(gw, rollout, ready, notReady, tt.wait, tt.syncErr)
+			for conditionType, want := range map[string]condition{
+				myv1.VpnGwReady:       tt.ready,
+				myv1.VpnGwProgressing: tt.progressing,
+				myv1.VpnGwDegraded:    tt.degraded,
+			} {
+				got := meta.FindStatusCondition(conditions, conditionType)
+				if got == nil || got.Status != want.status || got.Reason != want.reason || got.ObservedGeneration != gw.Generation {
+					t.Errorf("expected %s %s/%s, got %+v", conditionType, want.status, want.reason, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+func TestWaitReasonRequeueAfter(t *testing.T) {
+	tests := []struct {
+		reason waitReason
+		want   time.Duration
+	}{
+		{waitNone, 0},
+		{waitForKeepalived, 2 * time.Second},
+		{waitForPods, 5 * time.Second},
+		{waitForConfigSync, 5 * time.Second},
+		{waitForCleanup, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.reason.requeueAfter(); got != tt.want {
+			t.Errorf("%q: expected requeue after %v, got %v", tt.reason, tt.want, got)
+		}
+		if tt.reason != waitNone && tt.reason.conditionReason() == "" {
+			t.Errorf("%q: expected a condition reason", tt.reason)
+		}
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = myv1.AddToScheme(scheme)
+	gw := &myv1.VpnGw{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gw1", Generation: 2}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(gw).WithStatusSubresource(gw).Build()
+	r := &VpnGwReconciler{Client: c, Scheme: scheme}
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: gw.Namespace, Name: gw.Name}
+
+	state, wait, err := r.waitFor(ctx, gw, waitForPods, "1/2 pods running")
+	if err != nil || state != SyncStateSuccess || wait != waitForPods {
+		t.Fatalf("expected to wait for pods, got %v, %q, %v", state, wait, err)
+	}
+	latest := &myv1.VpnGw{}
+	if err := c.Get(ctx, key, latest); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range waitReasons {
+		condition := meta.FindStatusCondition(latest.Status.Conditions, string(w))
+		if condition == nil || condition.ObservedGeneration != gw.Generation {
+			t.Fatalf("%q: expected the condition of generation %d, got %+v", w, gw.Generation, condition)
+		}
+		if w == waitForPods {
+			if condition.Status != metav1.ConditionTrue || condition.Reason != "PodNotRunning" || condition.Message != "1/2 pods running" {
+				t.Errorf("unexpected waiting condition %+v", condition)
+			}
+		} else if condition.Status != metav1.ConditionFalse {
+			t.Errorf("%q: expected not waiting, got %+v", w, condition)
+		}
+	}
+
+	// waiting for another reason clears the former one
+	if _, wait, err = r.waitFor(ctx, gw, waitForKeepalived, ""); err != nil || wait != waitForKeepalived {
+		t.Fatalf("expected to wait for keepalived, got %q, %v", wait, err)
+	}
+	if err := c.Get(ctx, key, latest); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(latest.Status.Conditions, myv1.VpnGwWaitingForKeepalived) ||
+		meta.IsStatusConditionTrue(latest.Status.Conditions, myv1.VpnGwWaitingForPods) {
+		t.Errorf("unexpected conditions %+v", latest.Status.Conditions)
+	}
+}
+
+func TestReconcileDebuggerCreateNoRequeue(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = myv1.AddToScheme(scheme)
+	debugger := &myv1.Debugger{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "debugger1"},
+		Spec: myv1.DebuggerSpec{
+			WorkloadType: util.WorkloadTypeDaemonset,
+			CPU:          "100m",
+			Memory:       "100Mi",
+			Image:        "kubecombo/debugger:latest",
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(debugger).WithStatusSubresource(debugger).Build()
+	r := &DebuggerReconciler{Client: c, Scheme: scheme, Log: logr.Discard()}
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: debugger.Namespace, Name: debugger.Name}
+
+	// the owned daemonset watch reconciles the debugger once the workload changes
+	res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil || res != (ctrl.Result{}) {
+		t.Fatalf("expected no requeue after create, got %+v, %v", res, err)
+	}
+	if err := c.Get(ctx, key, &appsv1.DaemonSet{}); err != nil {
+		t.Fatalf("expected the debugger daemonset to be created: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilexec "k8s.io/utils/exec"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+	"github.com/kubecombo/kube-combo/internal/util"
+	"github.com/kubecombo/kube-combo/internal/wireguard"
+)
+
+// wireGuardPeerVpnGwField indexes wireguard peers by spec.vpnGw
+const wireGuardPeerVpnGwField = "spec.vpnGw"
+
+func wireGuardConfSecretName(gw *myv1.VpnGw) string {
+	return gw.Name + util.WireGuardConfSecretSuffix
+}
+
+// wireGuardContainerForVpnGw returns the wireguard container and its volumes,
+// it is the same in the statefulset and the host network daemonset
+func wireGuardContainerForVpnGw(gw *myv1.VpnGw) (corev1.Container, []corev1.Volume) {
+	allowPrivilegeEscalation := true
+	privileged := true
+	container := corev1.Container{
+		Name:    util.WireGuardServer,
+		Image:   gw.Spec.WireGuardImage,
+		Command: []string{util.WireGuardStartCMD},
+		Env: []corev1.EnvVar{{
+			Name:  util.WireGuardAddressCidrKey,
+			Value: gw.Spec.WireGuardAddressCidr,
+		}},
+		Ports: []corev1.ContainerPort{{
+			ContainerPort: gw.Spec.WireGuardListenPort,
+			Name:          util.WireGuardPortKey,
+			Protocol:      corev1.Protocol(util.WireGuardProto),
+		}},
+		VolumeMounts: []corev1.VolumeMount{
+			// controller rendered wireguard config
+			{
+				Name:      util.WireGuardConfName,
+				MountPath: util.WireGuardConfPath,
+				ReadOnly:  true,
+			},
+			// wireguard private key
+			{
+				Name:      util.WireGuardKeyName,
+				MountPath: util.WireGuardKeyPath,
+				ReadOnly:  true,
+			},
+		},
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		SecurityContext: &corev1.SecurityContext{
+			Privileged:               &privileged,
+			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		},
+	}
+	volumes := []corev1.Volume{
+		{
+			Name: util.WireGuardConfName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: wireGuardConfSecretName(gw),
+					Optional:   &[]bool{true}[0],
+				},
+			},
+		},
+		{
+			Name: util.WireGuardKeyName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: gw.Spec.WireGuardSecret,
+					Optional:   &[]bool{true}[0],
+				},
+			},
+		},
+	}
+	return container, volumes
+}
+
+// handleWireGuard renders the wireguard peers of the vpn gw and reloads them in the vpn gw pods
+func (r *VpnGwReconciler) handleWireGuard(ctx context.Context, gw *myv1.VpnGw) (SyncState, waitReason, error) {
+	privateKey, err := r.getSecretKey(ctx, gw.Namespace, &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: gw.Spec.WireGuardSecret},
+		Key:                  wireguard.PrivateKeyKey,
+	})
+	if err != nil {
+		r.Log.Error(err, "failed to get wireguard private key", "secret", gw.Spec.WireGuardSecret)
+		return SyncStateError, waitNone, err
+	}
+	// getSecretKey returns base64 encoded value
+	raw, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return SyncStateError, waitNone, err
+	}
+	publicKey, err := wireguard.PublicKey(string(raw))
+	if err != nil {
+		err = fmt.Errorf("invalid wireguard private key in secret %s: %w", gw.Spec.WireGuardSecret, err)
+		r.Log.Error(err, "failed to derive wireguard public key")
+		return SyncStateErrorNoRetry, waitNone, err
+	}
+
+	peers, err := r.getWireGuardPeers(ctx, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to list vpn gw wireguard peers")
+		return SyncStateError, waitNone, err
+	}
+	conf := &wireguard.Config{
+		ListenPort: gw.Spec.WireGuardListenPort,
+		Addresses:  util.SplitCidrs(gw.Spec.WireGuardAddressCidr),
+	}
+	var peerNames []string
+	invalid := validateWireGuardPeers(peers)
+	for _, peer := range peers {
+		accepted := metav1.Condition{
+			Type:               myv1.WireGuardPeerAccepted,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: peer.Generation,
+			Reason:             "Rendered",
+			Message:            fmt.Sprintf("rendered into the wireguard config of vpn gw %s", gw.Name),
+		}
+		if err := invalid[peer.Name]; err != nil {
+			r.Log.Error(err, "skip invalid wireguard peer", "peer", peer.Name)
+			accepted.Status = metav1.ConditionFalse
+			accepted.Reason = "InvalidPeer"
+			accepted.Message = err.Error()
+		} else {
+			conf.Peers = append(conf.Peers, wireGuardPeer(peer))
+			peerNames = append(peerNames, peer.Name)
+		}
+		if err := r.updateWireGuardPeerCondition(ctx, &peer, accepted); err != nil {
+			r.Log.Error(err, "failed to update wireguard peer status", "peer", peer.Name)
+			return SyncStateError, waitNone, err
+		}
+	}
+	files, err := conf.Render()
+	if err != nil {
+		r.Log.Error(err, "failed to render wireguard config")
+		return SyncStateErrorNoRetry, waitNone, err
+	}
+	if err := r.handleAddOrUpdateConfSecret(ctx, gw, wireGuardConfSecretName(gw), files); err != nil {
+		r.Log.Error(err, "failed to handleAddOrUpdateConfSecret")
+		return SyncStateError, waitNone, err
+	}
+
+	// exec pod to reload the mounted wireguard config
+	podNames, err := r.getContainerPodNames(ctx, gw, util.WireGuardServer)
+	if err != nil {
+		r.Log.Info("wireguard pods not ready", "reason", err.Error())
+		return r.waitFor(ctx, gw, waitForPods, err.Error())
+	}
+	cmd := fmt.Sprintf(util.WireGuardReloadTemplate, util.Hash(files[wireguard.ConfKey]))
+	for _, podName := range podNames {
+		stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, gw.Namespace, podName, util.WireGuardServer, []string{"/bin/bash", "-c", cmd}...)
+		if err != nil {
+			var exitErr utilexec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitStatus() == util.ReloadNotSyncedCode {
+				r.Log.Info("wireguard config is not synced to the pod yet", "pod", podName)
+				return r.waitFor(ctx, gw, waitForConfigSync, fmt.Sprintf("wireguard config is not synced to pod %s yet", podName))
+			}
+			err = fmt.Errorf("failed to reload wireguard in pod %s: %w, stdout: %s, stderr: %s", podName, err, stdOutput, errOutput)
+			r.Log.Error(err, "failed to reload vpn gw wireguard peers")
+			return SyncStateError, waitNone, err
+		}
+		r.Log.Info("reload wireguard peers ok", "pod", podName)
+	}
+	if err := r.updateWireGuardStatus(ctx, gw, peerNames, publicKey); err != nil {
+		r.Log.Error(err, "failed to update vpn gw wireguard status")
+		return SyncStateError, waitNone, err
+	}
+	return SyncStateSuccess, waitNone, nil
+}
+
+func wireGuardPeer(peer myv1.WireGuardPeer) wireguard.Peer {
+	return wireguard.Peer{
+		Name:                peer.Name,
+		PublicKey:           peer.Spec.PublicKey,
+		AllowedIPs:          util.SplitCidrs(peer.Spec.AllowedIPs),
+		Endpoint:            peer.Spec.Endpoint,
+		PersistentKeepalive: peer.Spec.PersistentKeepalive,
+	}
+}
+
+// validateWireGuardPeers returns the errors of the invalid peers keyed by the peer name,
+// the peer whose public key is used by an older peer is invalid as well
+func validateWireGuardPeers(peers []myv1.WireGuardPeer) map[string]error {
+	sorted := slices.Clone(peers)
+	slices.SortFunc(sorted, func(a, b myv1.WireGuardPeer) int {
+		if c := a.CreationTimestamp.Compare(b.CreationTimestamp.Time); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	invalid := map[string]error{}
+	keys := map[string]string{}
+	for _, peer := range sorted {
+		p := wireGuardPeer(peer)
+		if err := p.Validate(); err != nil {
+			invalid[peer.Name] = err
+			continue
+		}
+		if other, exist := keys[p.PublicKey]; exist {
+			invalid[peer.Name] = fmt.Errorf("public key is used by wireguard peer %s", other)
+			continue
+		}
+		keys[p.PublicKey] = peer.Name
+	}
+	return invalid
+}
+
+// updateWireGuardPeerCondition reports whether the peer is rendered into the wireguard config
+func (r *VpnGwReconciler) updateWireGuardPeerCondition(ctx context.Context, peer *myv1.WireGuardPeer, condition metav1.Condition) error {
+	newPeer := peer.DeepCopy()
+	meta.SetStatusCondition(&newPeer.Status.Conditions, condition)
+	if reflect.DeepEqual(peer.Status, newPeer.Status) {
+		return nil
+	}
+	return r.Status().Update(ctx, newPeer)
+}
+
+// returns all wireguard peers of the vpn gw by the spec.vpnGw index
+func (r *VpnGwReconciler) getWireGuardPeers(ctx context.Context, gw *myv1.VpnGw) ([]myv1.WireGuardPeer, error) {
+	peers := &myv1.WireGuardPeerList{}
+	if err := r.List(ctx, peers, client.InNamespace(gw.Namespace), client.MatchingFields{wireGuardPeerVpnGwField: gw.Name}); err != nil {
+		return nil, err
+	}
+	res := make([]myv1.WireGuardPeer, 0, len(peers.Items))
+	for _, peer := range peers.Items {
+		if !peer.DeletionTimestamp.IsZero() {
+			continue
+		}
+		res = append(res, peer)
+	}
+	return res, nil
+}
+
+func (r *VpnGwReconciler) enqueueVpnGwForWireGuardPeer(_ context.Context, obj client.Object) []reconcile.Request {
+	peer, ok := obj.(*myv1.WireGuardPeer)
+	if !ok || peer.Spec.VpnGw == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: peer.Spec.VpnGw, Namespace: peer.Namespace}}}
+}
+
+// updateWireGuardStatus records the wireguard public key and the rendered peers,
+// they are cleared once wireguard is disabled
+func (r *VpnGwReconciler) updateWireGuardStatus(ctx context.Context, gw *myv1.VpnGw, peers []string, publicKey string) error {
+	latest, err := r.getVpnGw(ctx, types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace})
+	if err != nil || latest == nil {
+		return err
+	}
+	newGw := latest.DeepCopy()
+	newGw.Status.WireGuardPublicKey = publicKey
+	newGw.Status.WireGuardPeers = peers
+	if !gw.Spec.EnableWireGuard {
+		newGw.Status.WireGuardPeers = nil
+	}
+	if reflect.DeepEqual(latest.Status, newGw.Status) {
+		return nil
+	}
+	return r.Status().Update(ctx, newGw)
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	myv1 "github.com/kubecombo/kube-combo/api/v1"
+)
+
+func TestValidateWireGuardPeers(t *testing.T) {
+	const (
+		alicePublicKey = "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo="
+		bobPublicKey   = "3p7bfXt9wbTTW2HC7OQ1Nz+DQ8hbeGdNrfx+FG+IK08="
+	)
+	now := time.Now()
+	peer := func(name, publicKey, allowedIPs string, created time.Time) myv1.WireGuardPeer {
+		return myv1.WireGuardPeer{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)},
+			Spec:       myv1.WireGuardPeerSpec{VpnGw: "gw1", PublicKey: publicKey, AllowedIPs: allowedIPs},
+		}
+	}
+	peers := []myv1.WireGuardPeer{
+		// the newer peer reusing a public key is rejected, not the older one
+		peer("a-copy", alicePublicKey, "10.3.0.0/16", now),
+		peer("site-a", alicePublicKey, "10.2.0.0/16", now.Add(-time.Hour)),
+		peer("site-b", bobPublicKey, "10.4.0.0/16", now),
+		peer("bad-key", "not a key", "10.5.0.0/16", now),
+		peer("bad-cidr", bobPublicKey, "10.6.0.0/33", now),
+	}
+	invalid := validateWireGuardPeers(peers)
+	for _, name := range []string{"a-copy", "bad-key", "bad-cidr"} {
+		if invalid[name] == nil {
+			t.Errorf("expected wireguard peer %s to be invalid", name)
+		}
+	}
+	for _, name := range []string{"site-a", "site-b"} {
+		if err := invalid[name]; err != nil {
+			t.Errorf("expected wireguard peer %s to be valid, got %v", name, err)
+		}
+	}
+}
+
+func TestVpnGwWireGuardChanged(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = myv1.AddToScheme(scheme)
+	gw := &myv1.VpnGw{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gw1"},
+		Spec: myv1.VpnGwSpec{
+			CPU:                  "1",
+			Memory:               "1Gi",
+			Replicas:             1,
+			EnableIPSecVpn:       true,
+			IPSecVpnImage:        "kubecombo/strongswan:latest",
+			WireGuardSecret:      "wg-key",
+			WireGuardAddressCidr: "10.250.0.1/24",
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(gw).WithStatusSubresource(gw).Build()
+	r := &VpnGwReconciler{Client: c, Scheme: scheme, Defaults: myv1.DefaultOptions{WireGuardImage: "kubecombo/wireguard:latest"}}
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: gw.Namespace, Name: gw.Name}
+	req := ctrl.Request{NamespacedName: key}
+	latest := func() *myv1.VpnGw {
+		t.Helper()
+		res := &myv1.VpnGw{}
+		if err := c.Get(ctx, key, res); err != nil {
+			t.Fatal(err)
+		}
+		res.SetDefaults(r.Defaults)
+		return res
+	}
+	update := func(mutate func(*myv1.VpnGw)) {
+		t.Helper()
+		res := &myv1.VpnGw{}
+		if err := c.Get(ctx, key, res); err != nil {
+			t.Fatal(err)
+		}
+		mutate(res)
+		if err := c.Update(ctx, res); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := r.UpdateVpnGW(ctx, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if r.isChanged(latest(), nil) {
+		t.Fatal("expected the recorded vpn gw to be up to date")
+	}
+
+	// enable wireguard on the existing vpn gw, the workload gets the wireguard container
+	update(func(gw *myv1.VpnGw) { gw.Spec.EnableWireGuard = true })
+	if !r.isChanged(latest(), nil) {
+		t.Fatal("expected enabling wireguard to roll the workload")
+	}
+	if err := r.UpdateVpnGW(ctx, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	got := latest()
+	if !got.Status.EnableWireGuard || got.Status.WireGuardListenPort != myv1.DefaultWireGuardListenPort ||
+		got.Status.WireGuardImage != "kubecombo/wireguard:latest" || got.Status.WireGuardSecret != "wg-key" ||
+		got.Status.WireGuardAddressCidr != "10.250.0.1/24" {
+		t.Fatalf("expected the defaulted wireguard spec in the status, got %+v", got.Status)
+	}
+	if r.isChanged(got, nil) {
+		t.Fatal("expected the recorded wireguard vpn gw to be up to date")
+	}
+
+	update(func(gw *myv1.VpnGw) { gw.Spec.WireGuardAddressCidr = "10.251.0.1/24" })
+	if !r.isChanged(latest(), nil) {
+		t.Fatal("expected changing the wireguard address to roll the workload")
+	}
+
+	// disable wireguard, the wireguard container is removed and the status cleared
+	update(func(gw *myv1.VpnGw) { gw.Spec.EnableWireGuard = false })
+	if !r.isChanged(latest(), nil) {
+		t.Fatal("expected disabling wireguard to roll the workload")
+	}
+	if err := r.UpdateVpnGW(ctx, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	got = latest()
+	if got.Status.EnableWireGuard || got.Status.WireGuardListenPort != 0 || got.Status.WireGuardImage != "" ||
+		got.Status.WireGuardSecret != "" || got.Status.WireGuardAddressCidr != "" {
+		t.Fatalf("expected the wireguard status to be cleared, got %+v", got.Status)
+	}
+	if r.isChanged(got, nil) {
+		t.Fatal("expected the vpn gw without wireguard to be up to date")
+	}
+}
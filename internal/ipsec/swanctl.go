@@ -0,0 +1,108 @@
+package ipsec
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templates = template.Must(
+	template.New("ipsec").Funcs(template.FuncMap{
+		"quote":   quote,
+		"shquote": shquote,
+		"join":    util.JoinCidrs,
+	}).ParseFS(templateFS, "templates/*.tmpl"),
+)
+
+const (
+	AuthPSK    = "psk"
+	AuthPubkey = "pubkey"
+)
+
+// Connection is one strongswan connection rendered from an IpsecConn
+type Connection struct {
+	Name         string
+	Auth         string
+	IkeVersion   string
+	IKEProposals string
+	ESPProposals string
+
+	LocalCN           string
+	LocalVIP          string
+	LocalEIP          string
+	LocalPrivateCidrs []string
+	LocalGateway      string
+	LocalGatewayNic   string
+
+	RemoteCN           string
+	RemoteEIP          string
+	RemotePrivateCidrs []string
+
+	// PSK is the base64 encoded pre-shared key, only used in psk auth
+	PSK string
+}
+
+// IkeName is the connection name in swanctl.conf
+func (c Connection) IkeName() string {
+	if c.Auth == AuthPubkey {
+		return "gw-gw-" + c.Name
+	}
+	return c.Name
+}
+
+// Config is all the strongswan connections of one vpn gw
+type Config struct {
+	EnablePSK   bool
+	Connections []Connection
+}
+
+// Render renders swanctl.conf, the ipsec hosts file and the connection check script,
+// the result is keyed by the file name
+func (c *Config) Render() (map[string]string, error) {
+	swanctl := "swanctl.x509.conf.tmpl"
+	if c.EnablePSK {
+		swanctl = "swanctl.psk.conf.tmpl"
+	}
+	files := map[string]string{
+		SwanctlConfKey: swanctl,
+		HostsKey:       "hosts.tmpl",
+		CheckKey:       "check.tmpl",
+	}
+	res := make(map[string]string, len(files))
+	for key, name := range files {
+		var buf bytes.Buffer
+		if err := templates.ExecuteTemplate(&buf, name, c); err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", key, err)
+		}
+		res[key] = buf.String()
+	}
+	return res, nil
+}
+
+const (
+	// SwanctlConfKey is the swanctl config file
+	SwanctlConfKey = "swanctl.conf"
+	// HostsKey resolves the x509 certificate CN to eip
+	HostsKey = "hosts.ipsec"
+	// CheckKey is the script used to check and initiate connections in static pod
+	CheckKey = "check"
+)
+
+// quote formats a value as a swanctl quoted string
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// shquote formats a value as a bash single quoted string
+func shquote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,191 @@
+package ipsec
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+func TestRenderPSK(t *testing.T) {
+	conf := &Config{
+		EnablePSK: true,
+		Connections: []Connection{{
+			Name:               "moon-sun",
+			Auth:               AuthPSK,
+			IkeVersion:         "2",
+			IKEProposals:       "aes256-sha256-modp2048",
+			ESPProposals:       "aes256-sha256",
+			LocalVIP:           "10.1.0.100",
+			LocalEIP:           "172.19.0.101",
+			LocalPrivateCidrs:  util.SplitCidrs("10.1.0.0/24, 10.4.0.0/24"),
+			RemoteEIP:          "172.19.0.102",
+			RemotePrivateCidrs: util.SplitCidrs("10.2.0.0/24"),
+			PSK:                "c2VjcmV0",
+		}},
+	}
+	files, err := conf.Render()
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	swanctl := files[SwanctlConfKey]
+	for _, want := range []string{
+		"    moon-sun {",
+		`local_ts = "10.1.0.0/24,10.4.0.0/24"`,
+		`remote_ts = "10.2.0.0/24"`,
+		`esp_proposals = "aes256-sha256"`,
+		"   ike-moon-sun {",
+		"secret = 0sc2VjcmV0",
+	} {
+		if !strings.Contains(swanctl, want) {
+			t.Errorf("swanctl.conf should contain %q, got:\n%s", want, swanctl)
+		}
+	}
+	if files[HostsKey] != "" {
+		t.Errorf("psk mode should not render hosts, got:\n%s", files[HostsKey])
+	}
+	if !strings.Contains(files[CheckKey], "--ike 'moon-sun'") {
+		t.Errorf("check script should initiate moon-sun, got:\n%s", files[CheckKey])
+	}
+}
+
+func TestRenderX509(t *testing.T) {
+	conf := &Config{
+		Connections: []Connection{{
+			Name:               "moon-mars",
+			Auth:               AuthPubkey,
+			IkeVersion:         "2",
+			IKEProposals:       "default",
+			LocalCN:            "moon.vpn.gw.com",
+			LocalEIP:           "172.19.0.101",
+			LocalPrivateCidrs:  []string{"10.1.0.0/24"},
+			RemoteCN:           `mars "vpn"`,
+			RemoteEIP:          "172.19.0.103",
+			RemotePrivateCidrs: []string{"10.3.0.0/24"},
+		}},
+	}
+	files, err := conf.Render()
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	swanctl := files[SwanctlConfKey]
+	for _, want := range []string{
+		"    gw-gw-moon-mars {",
+		`id = "CN=mars \"vpn\""`,
+		"certs = tls.crt",
+	} {
+		if !strings.Contains(swanctl, want) {
+			t.Errorf("swanctl.conf should contain %q, got:\n%s", want, swanctl)
+		}
+	}
+	if strings.Contains(swanctl, "secrets") {
+		t.Errorf("x509 mode should not render secrets, got:\n%s", swanctl)
+	}
+	if !strings.Contains(files[HostsKey], "172.19.0.101 moon.vpn.gw.com") {
+		t.Errorf("hosts should resolve local cn, got:\n%s", files[HostsKey])
+	}
+}
+
+func TestShquote(t *testing.T) {
+	if got := shquote("it's"); got != `'it'\''s'` {
+		t.Errorf("unexpected shquote result %s", got)
+	}
+}
+
+func TestRenderEmpty(t *testing.T) {
+	// a vpn gw without connections renders an empty config to unload all of them
+	for _, enablePSK := range []bool{true, false} {
+		files, err := (&Config{EnablePSK: enablePSK}).Render()
+		if err != nil {
+			t.Fatalf("failed to render: %v", err)
+		}
+		if !strings.Contains(files[SwanctlConfKey], "connections {\n}") {
+			t.Errorf("swanctl.conf should have no connections, got:\n%s", files[SwanctlConfKey])
+		}
+	}
+}
+
+func TestRenderGatewayNic(t *testing.T) {
+	conn := Connection{
+		Name:              "moon-sun",
+		Auth:              AuthPSK,
+		LocalVIP:          "172.19.0.100",
+		LocalPrivateCidrs: util.SplitCidrs("10.1.0.0/24"),
+		RemoteEIP:         "172.19.0.102",
+		LocalGatewayNic:   "net1",
+	}
+	conf := &Config{EnablePSK: true, Connections: []Connection{conn}}
+	files, err := conf.Render()
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	check := files[CheckKey]
+	if !strings.Contains(check, "localGatewayNic='net1'") {
+		t.Errorf("check script should disable the rp_filter of net1, got:\n%s", check)
+	}
+	if strings.Contains(check, "ip route replace") {
+		t.Errorf("check script should not route the local cidrs without the local gateway, got:\n%s", check)
+	}
+
+	conn.LocalGateway = "10.1.0.1"
+	conf.Connections = []Connection{conn}
+	if files, err = conf.Render(); err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	if !strings.Contains(files[CheckKey], "via '10.1.0.1' dev 'net1'") {
+		t.Errorf("check script should route the local cidrs via the local gateway, got:\n%s", files[CheckKey])
+	}
+}
+
+func TestViciConns(t *testing.T) {
+	conn := Connection{
+		Name:               "moon-sun",
+		Auth:               AuthPSK,
+		IkeVersion:         "2",
+		IKEProposals:       "aes256-sha256-modp2048",
+		ESPProposals:       "aes256-sha256",
+		LocalCN:            "moon.vpn.gw.com",
+		LocalVIP:           "10.1.0.100",
+		LocalEIP:           "172.19.0.101",
+		LocalPrivateCidrs:  util.SplitCidrs("10.1.0.0/24, 10.4.0.0/24"),
+		RemoteCN:           "sun.vpn.gw.com",
+		RemoteEIP:          "172.19.0.102",
+		RemotePrivateCidrs: util.SplitCidrs("10.2.0.0/24"),
+		PSK:                "c2VjcmV0",
+	}
+	psk := (&Config{EnablePSK: true, Connections: []Connection{conn}}).ViciConns()
+	ike := psk["moon-sun"]
+	if ike == nil {
+		t.Fatalf("expected psk conn moon-sun, got %v", psk)
+	}
+	if got := ike.List("local_addrs"); !reflect.DeepEqual(got, []string{"10.1.0.100"}) {
+		t.Errorf("expected local addrs of the vip, got %v", got)
+	}
+	if got := ike.Section("local").Get("id"); got != "172.19.0.101" {
+		t.Errorf("expected local id of the eip, got %q", got)
+	}
+	child := ike.Section("children").Section(ChildName)
+	if got := child.List("local_ts"); !reflect.DeepEqual(got, []string{"10.1.0.0/24", "10.4.0.0/24"}) {
+		t.Errorf("unexpected local ts %v", got)
+	}
+	if got := child.Get("start_action"); got != "start" {
+		t.Errorf("expected psk start action start, got %q", got)
+	}
+
+	conn.Auth = AuthPubkey
+	x509 := (&Config{Connections: []Connection{conn}}).ViciConns()
+	ike = x509["gw-gw-moon-sun"]
+	if ike == nil {
+		t.Fatalf("expected x509 conn gw-gw-moon-sun, got %v", x509)
+	}
+	if got := ike.Section("local").Get("id"); got != "CN=moon.vpn.gw.com" {
+		t.Errorf("expected local id of the cert CN, got %q", got)
+	}
+	if got := ike.Section("remote").Get("id"); got != "CN=sun.vpn.gw.com" {
+		t.Errorf("expected remote id of the cert CN, got %q", got)
+	}
+	if got := ike.Section("children").Section(ChildName).Get("start_action"); got != "trap" {
+		t.Errorf("expected x509 start action trap, got %q", got)
+	}
+}
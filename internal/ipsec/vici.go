@@ -0,0 +1,86 @@
+package ipsec
+
+import (
+	"github.com/kubecombo/kube-combo/internal/vici"
+)
+
+// ChildName is the only child sa of every connection
+const ChildName = "net-net"
+
+// ViciConns returns the connections as vici load-conn sections keyed by the ike name,
+// they are the same as the connections rendered into swanctl.conf
+func (c *Config) ViciConns() map[string]vici.Message {
+	res := make(map[string]vici.Message, len(c.Connections))
+	for _, conn := range c.Connections {
+		if c.EnablePSK {
+			res[conn.IkeName()] = conn.viciPSK()
+		} else {
+			res[conn.IkeName()] = conn.viciX509()
+		}
+	}
+	return res
+}
+
+func (c Connection) viciPSK() vici.Message {
+	return vici.Message{
+		"version":      c.IkeVersion,
+		"local_addrs":  []string{c.LocalVIP},
+		"remote_addrs": []string{c.RemoteEIP},
+		"dpd_delay":    "10",
+		"dpd_timeout":  "30",
+		"rekey_time":   "84600",
+		"over_time":    "1800",
+		"proposals":    []string{c.IKEProposals},
+		"encap":        "yes",
+		"mobike":       "yes",
+		"local": vici.Message{
+			"auth": c.Auth,
+			"id":   c.LocalEIP,
+		},
+		"remote": vici.Message{
+			"auth": c.Auth,
+			"id":   c.RemoteEIP,
+		},
+		"children": vici.Message{
+			ChildName: vici.Message{
+				"local_ts":      c.LocalPrivateCidrs,
+				"remote_ts":     c.RemotePrivateCidrs,
+				"esp_proposals": []string{c.ESPProposals},
+				"updown":        "/usr/lib/ipsec/_updown iptables",
+				"mode":          "tunnel",
+				"rekey_time":    "85500",
+				"life_time":     "86400",
+				"dpd_action":    "restart",
+				"start_action":  "start",
+				"close_action":  "start",
+			},
+		},
+	}
+}
+
+func (c Connection) viciX509() vici.Message {
+	return vici.Message{
+		"version":      c.IkeVersion,
+		"remote_addrs": []string{c.RemoteCN},
+		"mobike":       "yes",
+		"reauth_time":  "10800",
+		"proposals":    []string{c.IKEProposals},
+		// swanctl loads tls.crt by --load-creds, charon finds it by the local CN
+		"local": vici.Message{
+			"auth": c.Auth,
+			"id":   "CN=" + c.LocalCN,
+		},
+		"remote": vici.Message{
+			"auth": c.Auth,
+			"id":   "CN=" + c.RemoteCN,
+		},
+		"children": vici.Message{
+			ChildName: vici.Message{
+				"local_ts":     c.LocalPrivateCidrs,
+				"remote_ts":    c.RemotePrivateCidrs,
+				"dpd_action":   "restart",
+				"start_action": "trap",
+			},
+		},
+	}
+}
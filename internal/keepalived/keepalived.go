@@ -0,0 +1,292 @@
+// Package keepalived renders the vrrp instances of a keepalived into keepalived.conf,
+// reference: https://keepalived.readthedocs.io/en/latest/configuration_synopsis.html#vrrp-instance-definitions-synopsis
+package keepalived
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templates = template.Must(template.New("keepalived").ParseFS(templateFS, "templates/*.tmpl"))
+
+const (
+	// ConfKey is the rendered config file
+	ConfKey = "keepalived.conf"
+
+	// DefaultPriority is the priority of the instances which do not set one,
+	// all the pods share the config, the vips stay on the current master with nopreempt
+	DefaultPriority = 100
+	// DefaultAdvertInterval is the vrrp advert interval in seconds
+	DefaultAdvertInterval = 1
+	// DefaultScriptInterval is the seconds between the track script checks
+	DefaultScriptInterval = 2
+	// DefaultScriptFall is the failed checks before the script is down
+	DefaultScriptFall = 2
+	// DefaultScriptRise is the succeeded checks before the script is up again
+	DefaultScriptRise = 2
+	// DefaultProcessQuorum is the running processes required by the track process
+	DefaultProcessQuorum = 1
+
+	// AuthTypePass sends the password in plain text
+	AuthTypePass = "PASS"
+	// AuthTypeAH uses the ipsec ah header
+	AuthTypeAH = "AH"
+)
+
+// instance names and interfaces are rendered as is, keep them a single word
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9_.:@-]+$`)
+
+// VIP is a virtual ip added to the interface by the vrrp master
+type VIP struct {
+	// ip or ip with prefix length
+	Address string
+	// defaults to the interface of the instance
+	Interface string
+}
+
+// Instance is one vrrp instance of keepalived.conf
+type Instance struct {
+	Name           string
+	Interface      string
+	RouterID       int
+	Priority       int
+	Preempt        bool
+	AdvertInterval int
+	UnicastPeers   []string
+	AuthType       string
+	AuthPass       string
+	VIPs           []VIP
+}
+
+// Script is a vrrp_script tracked by all the instances
+type Script struct {
+	Name     string
+	Script   string
+	Interval int
+	// 0 uses the interval
+	Timeout int
+	Fall    int
+	Rise    int
+	// 0 puts the instances into the fault state once the script is down
+	Weight int
+}
+
+// Process is a vrrp_track_process tracked by all the instances
+type Process struct {
+	Name    string
+	Process string
+	Quorum  int
+	Delay   int
+	// 0 puts the instances into the fault state once the process is down
+	Weight int
+}
+
+// Config is keepalived.conf of one vpn gw
+type Config struct {
+	Scripts   []Script
+	Processes []Process
+	Instances []Instance
+}
+
+// Validate checks the values before they are rendered into the config file
+func (c *Config) Validate() error {
+	if len(c.Instances) == 0 {
+		return fmt.Errorf("vrrp instance is required")
+	}
+	names := map[string]bool{}
+	routerIDs := map[string]string{}
+	for _, instance := range c.Instances {
+		if err := instance.Validate(); err != nil {
+			return fmt.Errorf("invalid vrrp instance %s: %w", instance.Name, err)
+		}
+		if names[instance.Name] {
+			return fmt.Errorf("duplicate vrrp instance %s", instance.Name)
+		}
+		names[instance.Name] = true
+		// ipv4 and ipv6 adverts do not collide, neither do the ones on different interfaces
+		key := fmt.Sprintf("%s/%d/%t", instance.Interface, instance.RouterID, instance.IPv6())
+		if other, exist := routerIDs[key]; exist {
+			return fmt.Errorf("vrrp instance %s and %s use the same router id %d on %s", other, instance.Name, instance.RouterID, instance.Interface)
+		}
+		routerIDs[key] = instance.Name
+	}
+	scripts := map[string]bool{}
+	for _, script := range c.Scripts {
+		if err := script.Validate(); err != nil {
+			return fmt.Errorf("invalid track script %s: %w", script.Name, err)
+		}
+		if scripts[script.Name] {
+			return fmt.Errorf("duplicate track script %s", script.Name)
+		}
+		scripts[script.Name] = true
+	}
+	processes := map[string]bool{}
+	for _, process := range c.Processes {
+		if err := process.Validate(); err != nil {
+			return fmt.Errorf("invalid track process %s: %w", process.Name, err)
+		}
+		if processes[process.Name] {
+			return fmt.Errorf("duplicate track process %s", process.Name)
+		}
+		processes[process.Name] = true
+	}
+	return nil
+}
+
+// Validate checks the script command line, intervals and weight
+func (s *Script) Validate() error {
+	if !namePattern.MatchString(s.Name) {
+		return fmt.Errorf("invalid name %q", s.Name)
+	}
+	// the script is rendered in double quotes
+	if strings.TrimSpace(s.Script) == "" || strings.ContainsAny(s.Script, "\"\r\n") {
+		return fmt.Errorf("invalid script %q, should be a single line without double quotes", s.Script)
+	}
+	if s.Interval < 1 || s.Timeout < 0 || s.Fall < 1 || s.Rise < 1 {
+		return fmt.Errorf("invalid interval %d, timeout %d, fall %d or rise %d", s.Interval, s.Timeout, s.Fall, s.Rise)
+	}
+	return validateWeight(s.Weight)
+}
+
+// Validate checks the process name, quorum and weight
+func (p *Process) Validate() error {
+	if !namePattern.MatchString(p.Name) {
+		return fmt.Errorf("invalid name %q", p.Name)
+	}
+	if !namePattern.MatchString(p.Process) {
+		return fmt.Errorf("invalid process %q", p.Process)
+	}
+	if p.Quorum < 1 || p.Delay < 0 {
+		return fmt.Errorf("invalid quorum %d or delay %d", p.Quorum, p.Delay)
+	}
+	return validateWeight(p.Weight)
+}
+
+// the priority with the weights added should stay in 1-254
+func validateWeight(weight int) error {
+	if weight < -253 || weight > 253 {
+		return fmt.Errorf("invalid weight %d, should be -253-253", weight)
+	}
+	return nil
+}
+
+// Validate checks the instance router id, priority, vips, peers and authentication
+func (i *Instance) Validate() error {
+	if !namePattern.MatchString(i.Name) {
+		return fmt.Errorf("invalid name %q", i.Name)
+	}
+	if !namePattern.MatchString(i.Interface) {
+		return fmt.Errorf("invalid interface %q", i.Interface)
+	}
+	if i.RouterID < 1 || i.RouterID > 255 {
+		return fmt.Errorf("invalid router id %d", i.RouterID)
+	}
+	if i.Priority < 1 || i.Priority > 254 {
+		return fmt.Errorf("invalid priority %d, should be 1-254", i.Priority)
+	}
+	if i.AdvertInterval < 1 || i.AdvertInterval > 255 {
+		return fmt.Errorf("invalid advert interval %d", i.AdvertInterval)
+	}
+	if len(i.VIPs) == 0 {
+		return fmt.Errorf("vip is required")
+	}
+	ipv6 := i.IPv6()
+	for _, vip := range i.VIPs {
+		addr, err := ParseVIP(vip.Address)
+		if err != nil {
+			return err
+		}
+		if addr.Is6() != ipv6 {
+			return fmt.Errorf("vip %s should be in an instance of its own ip family", vip.Address)
+		}
+		if vip.Interface != "" && !namePattern.MatchString(vip.Interface) {
+			return fmt.Errorf("invalid vip %s interface %q", vip.Address, vip.Interface)
+		}
+	}
+	for _, peer := range i.UnicastPeers {
+		addr, err := netip.ParseAddr(peer)
+		if err != nil {
+			return fmt.Errorf("invalid unicast peer %q", peer)
+		}
+		if addr.Is6() != ipv6 {
+			return fmt.Errorf("unicast peer %s should be of the vip ip family", peer)
+		}
+	}
+	switch i.AuthType {
+	case "":
+	case AuthTypePass, AuthTypeAH:
+		if ipv6 {
+			return fmt.Errorf("authentication is not supported by vrrp v3 of the ipv6 instance")
+		}
+		if i.AuthPass == "" || len(i.AuthPass) > 8 || strings.ContainsAny(i.AuthPass, " \t\r\n\"") {
+			return fmt.Errorf("invalid auth pass, should be 1-8 characters without spaces or quotes")
+		}
+	default:
+		return fmt.Errorf("invalid auth type %q, should be %s or %s", i.AuthType, AuthTypePass, AuthTypeAH)
+	}
+	return nil
+}
+
+// IPv6 reports whether the instance vips are ipv6 ones, keepalived runs vrrp v3 for them
+func (i *Instance) IPv6() bool {
+	if len(i.VIPs) == 0 {
+		return false
+	}
+	addr, err := ParseVIP(i.VIPs[0].Address)
+	return err == nil && addr.Is6()
+}
+
+// Render validates and renders keepalived.conf, the result is keyed by the file name
+func (c *Config) Render() (map[string]string, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	conf := Config{
+		Scripts:   append([]Script{}, c.Scripts...),
+		Processes: append([]Process{}, c.Processes...),
+		Instances: make([]Instance, 0, len(c.Instances)),
+	}
+	for _, instance := range c.Instances {
+		instance.VIPs = append([]VIP{}, instance.VIPs...)
+		for j := range instance.VIPs {
+			if instance.VIPs[j].Interface == "" {
+				instance.VIPs[j].Interface = instance.Interface
+			}
+		}
+		conf.Instances = append(conf.Instances, instance)
+	}
+	// keep the rendered file stable
+	sort.Slice(conf.Instances, func(i, j int) bool { return conf.Instances[i].Name < conf.Instances[j].Name })
+	sort.Slice(conf.Scripts, func(i, j int) bool { return conf.Scripts[i].Name < conf.Scripts[j].Name })
+	sort.Slice(conf.Processes, func(i, j int) bool { return conf.Processes[i].Name < conf.Processes[j].Name })
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "keepalived.conf.tmpl", &conf); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", ConfKey, err)
+	}
+	return map[string]string{ConfKey: buf.String()}, nil
+}
+
+// ParseVIP parses an ip or an ip with prefix length
+func ParseVIP(vip string) (netip.Addr, error) {
+	if strings.Contains(vip, "/") {
+		prefix, err := netip.ParsePrefix(vip)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("invalid vip %q: %w", vip, err)
+		}
+		return prefix.Addr(), nil
+	}
+	addr, err := netip.ParseAddr(vip)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid vip %q: %w", vip, err)
+	}
+	return addr, nil
+}
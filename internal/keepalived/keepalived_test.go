@@ -0,0 +1,142 @@
+package keepalived
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	conf := &Config{
+		Instances: []Instance{
+			{
+				Name:           "public",
+				Interface:      "net1",
+				RouterID:       3,
+				Priority:       150,
+				Preempt:        true,
+				AdvertInterval: 2,
+				UnicastPeers:   []string{"172.19.0.11", "172.19.0.12"},
+				AuthType:       AuthTypePass,
+				AuthPass:       "secret",
+				VIPs:           []VIP{{Address: "172.19.0.100/24"}},
+			},
+			{
+				Name:           "internal",
+				Interface:      "eth0",
+				RouterID:       4,
+				Priority:       DefaultPriority,
+				AdvertInterval: DefaultAdvertInterval,
+				VIPs:           []VIP{{Address: "10.1.0.100"}, {Address: "10.2.0.100", Interface: "eth1"}},
+			},
+			{
+				Name:           "internal6",
+				Interface:      "eth0",
+				RouterID:       4,
+				Priority:       DefaultPriority,
+				AdvertInterval: DefaultAdvertInterval,
+				VIPs:           []VIP{{Address: "fd00:10:1::100"}},
+			},
+		},
+	}
+	files, err := conf.Render()
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	ka := files[ConfKey]
+	for _, want := range []string{
+		"vrrp_instance public {\n    state BACKUP\n    interface net1\n    virtual_router_id 3\n    priority 150\n    advert_int 2\n",
+		"    unicast_peer {\n        172.19.0.11\n        172.19.0.12\n    }\n",
+		"    authentication {\n        auth_type PASS\n        auth_pass secret\n    }\n",
+		"        172.19.0.100/24 dev net1\n",
+		"vrrp_instance internal {\n    state BACKUP\n    nopreempt\n    interface eth0\n    virtual_router_id 4\n    priority 100\n    advert_int 1\n",
+		"        10.1.0.100 dev eth0\n        10.2.0.100 dev eth1\n",
+		"        fd00:10:1::100 dev eth0\n",
+	} {
+		if !strings.Contains(ka, want) {
+			t.Errorf("%s should contain %q, got:\n%s", ConfKey, want, ka)
+		}
+	}
+	if strings.Index(ka, "vrrp_instance internal ") > strings.Index(ka, "vrrp_instance public ") {
+		t.Errorf("instances should be sorted by name, got:\n%s", ka)
+	}
+	if conf.Instances[1].VIPs[0].Interface != "" {
+		t.Error("render should not change the config")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	instance := func(mutate func(*Instance)) Instance {
+		i := Instance{Name: "vi", Interface: "eth0", RouterID: 1, Priority: 100, AdvertInterval: 1, VIPs: []VIP{{Address: "10.1.0.100"}}}
+		mutate(&i)
+		return i
+	}
+	for name, conf := range map[string]Config{
+		"no instance":        {},
+		"invalid name":       {Instances: []Instance{instance(func(i *Instance) { i.Name = "vi 1" })}},
+		"invalid router id":  {Instances: []Instance{instance(func(i *Instance) { i.RouterID = 256 })}},
+		"invalid priority":   {Instances: []Instance{instance(func(i *Instance) { i.Priority = 255 })}},
+		"no vip":             {Instances: []Instance{instance(func(i *Instance) { i.VIPs = nil })}},
+		"invalid vip":        {Instances: []Instance{instance(func(i *Instance) { i.VIPs = []VIP{{Address: "10.1.0.300"}} })}},
+		"mixed families":     {Instances: []Instance{instance(func(i *Instance) { i.VIPs = append(i.VIPs, VIP{Address: "fd00::100"}) })}},
+		"peer family":        {Instances: []Instance{instance(func(i *Instance) { i.UnicastPeers = []string{"fd00::11"} })}},
+		"ipv6 auth":          {Instances: []Instance{instance(func(i *Instance) { i.VIPs = []VIP{{Address: "fd00::100"}}; i.AuthType = AuthTypePass; i.AuthPass = "x" })}},
+		"long auth pass":     {Instances: []Instance{instance(func(i *Instance) { i.AuthType = AuthTypeAH; i.AuthPass = "123456789" })}},
+		"duplicate name":     {Instances: []Instance{instance(func(*Instance) {}), instance(func(i *Instance) { i.RouterID = 2 })}},
+		"duplicate route id": {Instances: []Instance{instance(func(*Instance) {}), instance(func(i *Instance) { i.Name = "vi2" })}},
+	} {
+		if _, err := conf.Render(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	other := Config{Instances: []Instance{instance(func(*Instance) {}), instance(func(i *Instance) { i.Name = "vi2"; i.Interface = "eth1" })}}
+	if _, err := other.Render(); err != nil {
+		t.Errorf("same router id on another interface should be valid, got %v", err)
+	}
+}
+
+func TestRenderTracks(t *testing.T) {
+	conf := &Config{
+		Scripts: []Script{
+			{Name: "check_ssl_vpn", Script: "/check.sh port udp 1194", Interval: DefaultScriptInterval, Fall: DefaultScriptFall, Rise: DefaultScriptRise},
+			{Name: "check_gw", Script: "/usr/bin/ping -c1 10.1.0.1", Interval: 5, Timeout: 3, Fall: 1, Rise: 3, Weight: -20},
+		},
+		Processes: []Process{{Name: "openvpn", Process: "openvpn", Quorum: DefaultProcessQuorum, Delay: 2, Weight: 10}},
+		Instances: []Instance{{Name: "public", Interface: "net1", RouterID: 3, Priority: DefaultPriority, AdvertInterval: DefaultAdvertInterval, VIPs: []VIP{{Address: "172.19.0.100"}}}},
+	}
+	files, err := conf.Render()
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	ka := files[ConfKey]
+	for _, want := range []string{
+		"global_defs {\n    script_user root\n    enable_script_security\n}\n",
+		"vrrp_script check_ssl_vpn {\n    script \"/check.sh port udp 1194\"\n    interval 2\n    fall 2\n    rise 2\n}\n",
+		"    timeout 3\n",
+		"    weight -20\n",
+		"vrrp_track_process openvpn {\n    process openvpn\n    quorum 1\n    delay 2\n    weight 10\n}\n",
+		"    track_script {\n        check_gw\n        check_ssl_vpn\n    }\n",
+		"    track_process {\n        openvpn\n    }\n",
+	} {
+		if !strings.Contains(ka, want) {
+			t.Errorf("%s should contain %q, got:\n%s", ConfKey, want, ka)
+		}
+	}
+	if strings.Count(ka, "weight") != 2 {
+		t.Errorf("zero weights should not be rendered, got:\n%s", ka)
+	}
+
+	instances := conf.Instances
+	for name, conf := range map[string]Config{
+		"quoted script":     {Instances: instances, Scripts: []Script{{Name: "c", Script: `sh -c "true"`, Interval: 1, Fall: 1, Rise: 1}}},
+		"multi line script": {Instances: instances, Scripts: []Script{{Name: "c", Script: "true\nfalse", Interval: 1, Fall: 1, Rise: 1}}},
+		"zero interval":     {Instances: instances, Scripts: []Script{{Name: "c", Script: "true", Fall: 1, Rise: 1}}},
+		"invalid weight":    {Instances: instances, Scripts: []Script{{Name: "c", Script: "true", Interval: 1, Fall: 1, Rise: 1, Weight: 254}}},
+		"duplicate script":  {Instances: instances, Scripts: []Script{{Name: "c", Script: "true", Interval: 1, Fall: 1, Rise: 1}, {Name: "c", Script: "false", Interval: 1, Fall: 1, Rise: 1}}},
+		"invalid process":   {Instances: instances, Processes: []Process{{Name: "p", Process: "open vpn", Quorum: 1}}},
+		"zero quorum":       {Instances: instances, Processes: []Process{{Name: "p", Process: "openvpn"}}},
+	} {
+		if _, err := conf.Render(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	sslVpnConnectedClientsGaugeVec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_combo_ssl_vpn_connected_clients",
+		Help: "Number of the clients connected to the ssl vpn gw.",
+	}, []string{"namespace", "vpn_gw"})
+	sslVpnClientLabels                = []string{"namespace", "vpn_gw", "pod", "common_name", "real_address", "virtual_address"}
+	sslVpnClientBytesReceivedGaugeVec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_combo_ssl_vpn_client_received_bytes",
+		Help: "Bytes received from the connected ssl vpn client.",
+	}, sslVpnClientLabels)
+	sslVpnClientBytesSentGaugeVec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_combo_ssl_vpn_client_sent_bytes",
+		Help: "Bytes sent to the connected ssl vpn client.",
+	}, sslVpnClientLabels)
+	sslVpnClientConnectedSinceGaugeVec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_combo_ssl_vpn_client_connected_since_seconds",
+		Help: "Unix time the ssl vpn client connected.",
+	}, sslVpnClientLabels)
+)
+
+// SslVpnClient is a connected ssl vpn client exported as metrics
+type SslVpnClient struct {
+	Pod            string
+	CommonName     string
+	RealAddress    string
+	VirtualAddress string
+	BytesReceived  int64
+	BytesSent      int64
+	ConnectedSince time.Time
+}
+
+func InitSslVpnMetrics() {
+	metrics.Registry.MustRegister(sslVpnConnectedClientsGaugeVec)
+	metrics.Registry.MustRegister(sslVpnClientBytesReceivedGaugeVec)
+	metrics.Registry.MustRegister(sslVpnClientBytesSentGaugeVec)
+	metrics.Registry.MustRegister(sslVpnClientConnectedSinceGaugeVec)
+}
+
+// SetSslVpnClients replaces the connected clients of the vpn gw,
+// the clients disconnected since the last call are removed
+func SetSslVpnClients(namespace, gw string, clients []SslVpnClient) {
+	DeleteSslVpnClients(namespace, gw)
+	sslVpnConnectedClientsGaugeVec.WithLabelValues(namespace, gw).Set(float64(len(clients)))
+	for _, c := range clients {
+		labels := []string{namespace, gw, c.Pod, c.CommonName, c.RealAddress, c.VirtualAddress}
+		sslVpnClientBytesReceivedGaugeVec.WithLabelValues(labels...).Set(float64(c.BytesReceived))
+		sslVpnClientBytesSentGaugeVec.WithLabelValues(labels...).Set(float64(c.BytesSent))
+		sslVpnClientConnectedSinceGaugeVec.WithLabelValues(labels...).Set(float64(c.ConnectedSince.Unix()))
+	}
+}
+
+// DeleteSslVpnClients removes the metrics of the vpn gw, eg. once it is deleted or ssl vpn is disabled
+func DeleteSslVpnClients(namespace, gw string) {
+	labels := prometheus.Labels{"namespace": namespace, "vpn_gw": gw}
+	sslVpnConnectedClientsGaugeVec.DeletePartialMatch(labels)
+	sslVpnClientBytesReceivedGaugeVec.DeletePartialMatch(labels)
+	sslVpnClientBytesSentGaugeVec.DeletePartialMatch(labels)
+	sslVpnClientConnectedSinceGaugeVec.DeletePartialMatch(labels)
+}
@@ -0,0 +1,203 @@
+// Package sslvpn issues openvpn client certificates from the vpn gw ca,
+// signs the crl of the revoked clients, renders the client profiles
+// and parses the connected clients from the openvpn management status
+package sslvpn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	// CACertKey and CAKeyKey are the keys of the ca keypair secret, the same as a cert-manager ca issuer secret
+	CACertKey = "tls.crt"
+	CAKeyKey  = "tls.key"
+	// ServerCAKey is the ca of the ssl vpn server secret
+	ServerCAKey = "ca.crt"
+	// ServerCertKey is the server certificate of the ssl vpn server secret
+	ServerCertKey = "tls.crt"
+
+	// backdate the certificate a little for the clock skew between the controller and the clients
+	clockSkew = 5 * time.Minute
+)
+
+// CA signs the client certificates and the crl of one vpn gw
+type CA struct {
+	Cert    *x509.Certificate
+	CertPEM []byte
+	Key     crypto.Signer
+}
+
+// ClientCert is an issued client certificate and its private key
+type ClientCert struct {
+	Cert    *x509.Certificate
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// ParseCA parses the pem encoded ca certificate and its private key
+func ParseCA(certPEM, keyPEM []byte) (*CA, error) {
+	cert, err := ParseCert(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ca certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("certificate %s is not a ca", cert.Subject.CommonName)
+	}
+	key, err := parseKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ca private key: %w", err)
+	}
+	if !publicKeyEqual(cert.PublicKey, key.Public()) {
+		return nil, errors.New("ca private key does not match the ca certificate")
+	}
+	return &CA{Cert: cert, CertPEM: encodeCert(cert), Key: key}, nil
+}
+
+// ParseCert parses the first certificate of the pem data
+func ParseCert(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no pem encoded certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func parseKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no pem encoded private key found")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("unsupported pem block %s", block.Type)
+}
+
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+func encodeCert(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// Signed reports whether the certificate is issued by the ca, eg. the ca is not rotated
+func (ca *CA) Signed(cert *x509.Certificate) bool {
+	return cert.CheckSignatureFrom(ca.Cert) == nil
+}
+
+// SameAs reports whether the pem encoded certificate is the ca, it is used to make sure
+// the ssl vpn server trusts the client certificates issued by the ca
+func (ca *CA) SameAs(certPEM []byte) bool {
+	cert, err := ParseCert(certPEM)
+	return err == nil && bytes.Equal(cert.Raw, ca.Cert.Raw)
+}
+
+// IssueClient issues a client certificate for the common name,
+// the certificate does not outlive the ca
+func (ca *CA) IssueClient(commonName string, duration time.Duration, now time.Time) (*ClientCert, error) {
+	if commonName == "" {
+		return nil, errors.New("common name is required")
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("invalid certificate duration %s", duration)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	notAfter := now.Add(duration)
+	if notAfter.After(ca.Cert.NotAfter) {
+		notAfter = ca.Cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-clockSkew),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, &key.PublicKey, ca.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign client certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientCert{
+		Cert:    cert,
+		CertPEM: encodeCert(cert),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// NeedsRenewal reports whether the certificate is in the last third of its lifetime,
+// the same renewal window as cert-manager
+func NeedsRenewal(cert *x509.Certificate, now time.Time) bool {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return now.After(cert.NotAfter.Add(-lifetime / 3))
+}
+
+// SerialNumber formats the certificate serial number as the hex string shown by openssl
+func SerialNumber(cert *x509.Certificate) string {
+	return fmt.Sprintf("%X", cert.SerialNumber)
+}
+
+// ServerAuth reports whether the server certificate has a key usage and the server auth extended key usage,
+// the client profile only verifies it with remote-cert-tls server if it has both
+func ServerAuth(cert *x509.Certificate) bool {
+	if cert.KeyUsage == 0 {
+		return false
+	}
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageServerAuth {
+			return true
+		}
+	}
+	return false
+}
+
+func newSerialNumber() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 127)
+	serial, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return nil, err
+	}
+	// avoid a zero serial number which is rejected by some clients
+	return serial.Add(serial, big.NewInt(1)), nil
+}
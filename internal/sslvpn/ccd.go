@@ -0,0 +1,224 @@
+package sslvpn
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ACLKey keeps the acl of the clients in the client config secret,
+// it is never a valid common name so it does not clash with the client config files
+const ACLKey = "_acl"
+
+// commonNamePattern matches the common names which are valid client config file names and secret keys
+var commonNamePattern = regexp.MustCompile(`^[A-Za-z0-9][-._A-Za-z0-9]*$`)
+
+// ClientConfigSpec is the client config declared on the ssl vpn client
+type ClientConfigSpec struct {
+	CommonName   string
+	StaticIP     string
+	Routes       []string
+	DNS          []string
+	AllowedCidrs []string
+}
+
+// Empty reports whether the client just uses the config pushed to all clients
+func (s ClientConfigSpec) Empty() bool {
+	return s.StaticIP == "" && len(s.Routes) == 0 && len(s.DNS) == 0 && len(s.AllowedCidrs) == 0
+}
+
+// ClientConfig is a validated client config rendered into the openvpn client-config-dir
+type ClientConfig struct {
+	CommonName   string
+	StaticIP     net.IP
+	Netmask      net.IP
+	Routes       []*net.IPNet
+	DNS          []net.IP
+	AllowedCidrs []*net.IPNet
+}
+
+// Parse validates the client config against the vpn gw ssl vpn subnet cidr and static cidr
+func (s ClientConfigSpec) Parse(subnetCidr, staticCidr string) (*ClientConfig, error) {
+	if !commonNamePattern.MatchString(s.CommonName) {
+		return nil, fmt.Errorf("common name %q is not a valid client config file name, only letters, digits, '-', '.' and '_' are allowed", s.CommonName)
+	}
+	_, subnet, err := parseIPv4Cidr(subnetCidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssl vpn subnet cidr: %w", err)
+	}
+	c := &ClientConfig{CommonName: s.CommonName, Netmask: net.IP(subnet.Mask)}
+	if s.StaticIP != "" {
+		if staticCidr == "" {
+			return nil, errors.New("vpn gw ssl vpn static cidr is not set")
+		}
+		_, static, err := parseIPv4Cidr(staticCidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssl vpn static cidr: %w", err)
+		}
+		ip := net.ParseIP(s.StaticIP).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid static ip %q", s.StaticIP)
+		}
+		if !static.Contains(ip) {
+			return nil, fmt.Errorf("static ip %s is not in the ssl vpn static cidr %s", ip, static)
+		}
+		first, last := hostRange(subnet)
+		// the first host is the openvpn server
+		if ip4ToUint(ip) <= first || ip4ToUint(ip) > last {
+			return nil, fmt.Errorf("static ip %s is reserved in the ssl vpn subnet cidr %s", ip, subnet)
+		}
+		c.StaticIP = ip
+	}
+	for _, route := range s.Routes {
+		_, cidr, err := parseIPv4Cidr(route)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route: %w", err)
+		}
+		c.Routes = append(c.Routes, cidr)
+	}
+	for _, dns := range s.DNS {
+		ip := net.ParseIP(dns)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid dns server %q", dns)
+		}
+		c.DNS = append(c.DNS, ip)
+	}
+	if len(s.AllowedCidrs) != 0 && c.StaticIP == nil {
+		return nil, errors.New("static ip is required by the allowed cidrs")
+	}
+	for _, allowed := range s.AllowedCidrs {
+		_, cidr, err := parseIPv4Cidr(allowed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed cidr: %w", err)
+		}
+		c.AllowedCidrs = append(c.AllowedCidrs, cidr)
+	}
+	return c, nil
+}
+
+// Render renders the client config file, the routes only reach the client,
+// the vpn gw already routes the ssl vpn subnet back to it
+func (c *ClientConfig) Render() string {
+	var b strings.Builder
+	if c.StaticIP != nil {
+		fmt.Fprintf(&b, "ifconfig-push %s %s\n", c.StaticIP, c.Netmask)
+	}
+	for _, route := range c.Routes {
+		fmt.Fprintf(&b, "push \"route %s %s\"\n", route.IP, net.IP(route.Mask))
+	}
+	for _, dns := range c.DNS {
+		option := "DNS"
+		if dns.To4() == nil {
+			option = "DNS6"
+		}
+		fmt.Fprintf(&b, "push \"dhcp-option %s %s\"\n", option, dns)
+	}
+	return b.String()
+}
+
+// RenderACL renders one line per client with allowed cidrs: the static ip followed by the allowed cidrs,
+// the gw pod allows the forwarded traffic from the static ip to the allowed cidrs and drops the rest
+func RenderACL(configs []*ClientConfig) string {
+	var lines []string
+	for _, c := range configs {
+		if c.StaticIP == nil || len(c.AllowedCidrs) == 0 {
+			continue
+		}
+		fields := []string{c.StaticIP.String()}
+		for _, cidr := range c.AllowedCidrs {
+			fields = append(fields, cidr.String())
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// DynamicPool returns the largest ip range of the ssl vpn subnet cidr out of the static cidr,
+// openvpn allocates the dynamic ips of the clients from it
+func DynamicPool(subnetCidr, staticCidr string) (net.IP, net.IP, error) {
+	_, subnet, err := parseIPv4Cidr(subnetCidr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid ssl vpn subnet cidr: %w", err)
+	}
+	_, static, err := parseIPv4Cidr(staticCidr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid ssl vpn static cidr: %w", err)
+	}
+	first, last := hostRange(subnet)
+	staticFirst := ip4ToUint(static.IP)
+	staticLast := staticFirst | ^binary.BigEndian.Uint32(static.Mask)
+	if !subnet.Contains(static.IP) || staticLast > last+1 {
+		return nil, nil, fmt.Errorf("ssl vpn static cidr %s is not in the ssl vpn subnet cidr %s", static, subnet)
+	}
+	// the first host is the openvpn server
+	first++
+	var lower, upper uint32
+	if staticFirst > first {
+		lower = staticFirst - first
+	}
+	if staticLast < last {
+		upper = last - staticLast
+	}
+	switch {
+	case lower == 0 && upper == 0:
+		return nil, nil, fmt.Errorf("no dynamic ip is left out of the ssl vpn static cidr %s", static)
+	case lower >= upper:
+		return uintToIP4(first), uintToIP4(staticFirst - 1), nil
+	default:
+		return uintToIP4(staticLast + 1), uintToIP4(last), nil
+	}
+}
+
+// ConfigHash returns the sha256 of the client config files,
+// the gw pod hashes the mounted files by the file names in the same way
+func ConfigHash(files map[string]string) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sum := sha256.New()
+	for _, name := range names {
+		sum.Write([]byte(name + "\n" + files[name]))
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+func parseIPv4Cidr(s string) (net.IP, *net.IPNet, error) {
+	ip, cidr, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ip.To4() == nil {
+		return nil, nil, fmt.Errorf("%s is not an ipv4 cidr", s)
+	}
+	cidr.IP = cidr.IP.To4()
+	return ip, cidr, nil
+}
+
+// hostRange returns the first and last host of the cidr
+func hostRange(cidr *net.IPNet) (uint32, uint32) {
+	network := ip4ToUint(cidr.IP)
+	broadcast := network | ^binary.BigEndian.Uint32(cidr.Mask)
+	return network + 1, broadcast - 1
+}
+
+func ip4ToUint(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uintToIP4(n uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
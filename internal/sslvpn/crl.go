@@ -0,0 +1,198 @@
+package sslvpn
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// CRLKey is the crl file consumed by openvpn crl-verify
+	CRLKey = "crl.pem"
+	// RevokedKey keeps the revoked certificates in the crl secret,
+	// they are kept after the ssl vpn clients are deleted until they expire
+	RevokedKey = "revoked.json"
+	// RevokedCNsKey lists the revoked common names rejected by the openvpn tls-verify script
+	RevokedCNsKey = "revoked-cns"
+
+	// the same crl validity as easy-rsa, the crl is signed again in the last third of it
+	crlValidity = 180 * 24 * time.Hour
+)
+
+// Revoked is a revoked client certificate
+type Revoked struct {
+	SerialNumber   string    `json:"serialNumber"`
+	CommonName     string    `json:"commonName"`
+	Client         string    `json:"client,omitempty"`
+	RevocationTime time.Time `json:"revocationTime"`
+	// zero if the certificate is unknown, eg. revoked by the serial number in the vpn gw spec
+	NotAfter time.Time `json:"notAfter,omitempty"`
+	// Manual means the certificate is revoked in the vpn gw spec, it is kept until it is removed from the spec
+	Manual bool `json:"manual,omitempty"`
+}
+
+// ParseRevoked parses the revoked certificates kept in the crl secret
+func ParseRevoked(data []byte) ([]Revoked, error) {
+	var revoked []Revoked
+	if len(data) == 0 {
+		return revoked, nil
+	}
+	if err := json.Unmarshal(data, &revoked); err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
+// MergeRevoked merges the newly revoked certificates into the existing ones,
+// the expired certificates are pruned since openvpn rejects them anyway
+func MergeRevoked(existing, revoked []Revoked, now time.Time) []Revoked {
+	bySerial := map[string]Revoked{}
+	for _, list := range [][]Revoked{existing, revoked} {
+		for _, r := range list {
+			if r.SerialNumber == "" || (!r.NotAfter.IsZero() && now.After(r.NotAfter)) {
+				continue
+			}
+			if _, ok := bySerial[r.SerialNumber]; ok {
+				// keep the first revocation time
+				continue
+			}
+			bySerial[r.SerialNumber] = r
+		}
+	}
+	res := make([]Revoked, 0, len(bySerial))
+	for _, r := range bySerial {
+		res = append(res, r)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].SerialNumber < res[j].SerialNumber })
+	return res
+}
+
+// MarshalRevoked marshals the revoked certificates to be kept in the crl secret
+func MarshalRevoked(revoked []Revoked) (string, error) {
+	if revoked == nil {
+		revoked = []Revoked{}
+	}
+	data, err := json.MarshalIndent(revoked, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// NormalizeSerial formats the hex serial number, with or without colons, as SerialNumber does
+func NormalizeSerial(serial string) (string, error) {
+	n, ok := new(big.Int).SetString(strings.ReplaceAll(serial, ":", ""), 16)
+	if !ok || n.Sign() <= 0 {
+		return "", fmt.Errorf("invalid serial number %q", serial)
+	}
+	return fmt.Sprintf("%X", n), nil
+}
+
+// RenderRevokedCNs renders the revoked common names one per line
+func RenderRevokedCNs(commonNames []string) string {
+	cns := append([]string{}, commonNames...)
+	sort.Strings(cns)
+	var b strings.Builder
+	for i, cn := range cns {
+		if i > 0 && cn == cns[i-1] {
+			continue
+		}
+		b.WriteString(cn)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// ContainsSerial reports whether the serial number is revoked
+func ContainsSerial(revoked []Revoked, serial string) bool {
+	for _, r := range revoked {
+		if r.SerialNumber == serial {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateCRL signs the crl of the revoked certificates
+func (ca *CA) CreateCRL(revoked []Revoked, now time.Time) ([]byte, error) {
+	if ca.Cert.KeyUsage != 0 && ca.Cert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return nil, errors.New("ca certificate has no crl sign key usage")
+	}
+	entries := make([]x509.RevocationListEntry, 0, len(revoked))
+	for _, r := range revoked {
+		serial, ok := new(big.Int).SetString(r.SerialNumber, 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid serial number %q", r.SerialNumber)
+		}
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: r.RevocationTime,
+		})
+	}
+	template := &x509.RevocationList{
+		// the crl number only increases
+		Number:                    big.NewInt(now.UnixNano()),
+		ThisUpdate:                now.Add(-clockSkew),
+		NextUpdate:                now.Add(crlValidity),
+		RevokedCertificateEntries: entries,
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.Cert, ca.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign crl: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), nil
+}
+
+// CRLResignTime returns when the crl of the next update enters the last third of its validity and is signed again
+func CRLResignTime(nextUpdate time.Time) time.Time {
+	return nextUpdate.Add(-crlValidity / 3)
+}
+
+// CRLNextUpdate returns when the crl should be signed again at the latest
+func CRLNextUpdate(crlPEM []byte) (time.Time, error) {
+	block, _ := pem.Decode(crlPEM)
+	if block == nil || block.Type != "X509 CRL" {
+		return time.Time{}, errors.New("no pem encoded crl found")
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return crl.NextUpdate, nil
+}
+
+// CRLUpToDate reports whether the crl is signed by the ca, revokes exactly the given certificates
+// and is not in the last third of its validity
+func (ca *CA) CRLUpToDate(crlPEM []byte, revoked []Revoked, now time.Time) bool {
+	block, _ := pem.Decode(crlPEM)
+	if block == nil || block.Type != "X509 CRL" {
+		return false
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil || crl.CheckSignatureFrom(ca.Cert) != nil {
+		return false
+	}
+	if now.After(CRLResignTime(crl.NextUpdate)) {
+		return false
+	}
+	if len(crl.RevokedCertificateEntries) != len(revoked) {
+		return false
+	}
+	serials := map[string]bool{}
+	for _, entry := range crl.RevokedCertificateEntries {
+		serials[fmt.Sprintf("%X", entry.SerialNumber)] = true
+	}
+	for _, r := range revoked {
+		if !serials[r.SerialNumber] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package sslvpn
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"net"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templates = template.Must(template.New("sslvpn").ParseFS(templateFS, "templates/*.tmpl"))
+
+const (
+	// ProfileKey is the openvpn client profile in the profile secret
+	ProfileKey = "client.ovpn"
+	// the client certificate, key and ca are also kept in the profile secret for other clients
+	ProfileCertKey = "tls.crt"
+	ProfileKeyKey  = "tls.key"
+	ProfileCAKey   = "ca.crt"
+)
+
+// Profile is the openvpn client profile with the inline certificates
+type Profile struct {
+	CommonName string
+	// Remote is the public ip or domain of the vpn gw
+	Remote string
+	Port   string
+	Proto  string
+	Cipher string
+	Auth   string
+	// RemoteCertTLS verifies the server certificate key usage
+	RemoteCertTLS bool
+	CA            string
+	Cert          string
+	Key           string
+}
+
+// Validate checks the values before they are rendered into the profile
+func (p *Profile) Validate() error {
+	if p.Remote == "" {
+		return fmt.Errorf("remote address is required")
+	}
+	if net.ParseIP(p.Remote) == nil && !isDNSName(p.Remote) {
+		return fmt.Errorf("invalid remote address %q", p.Remote)
+	}
+	if p.Proto != "udp" && p.Proto != "tcp" {
+		return fmt.Errorf("invalid proto %q", p.Proto)
+	}
+	if p.Port == "" {
+		return fmt.Errorf("port is required")
+	}
+	for name, value := range map[string]string{"common name": p.CommonName, "port": p.Port, "cipher": p.Cipher, "auth": p.Auth} {
+		if strings.ContainsAny(value, " \t\r\n") {
+			return fmt.Errorf("invalid %s %q", name, value)
+		}
+	}
+	for name, value := range map[string]string{"ca": p.CA, "cert": p.Cert, "key": p.Key} {
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("%s is required", name)
+		}
+	}
+	return nil
+}
+
+// Render validates and renders the client profile
+func (p *Profile) Render() (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	profile := *p
+	profile.CA = strings.TrimSpace(p.CA)
+	profile.Cert = strings.TrimSpace(p.Cert)
+	profile.Key = strings.TrimSpace(p.Key)
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "client.ovpn.tmpl", &profile); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", ProfileKey, err)
+	}
+	return buf.String(), nil
+}
+
+func isDNSName(name string) bool {
+	if len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
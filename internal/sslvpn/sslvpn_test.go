@@ -0,0 +1,341 @@
+package sslvpn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCA(t *testing.T, usage x509.KeyUsage) *CA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ca key: %v", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ssl-vpn-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              usage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create ca: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal ca key: %v", err)
+	}
+	ca, err := ParseCA(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	)
+	if err != nil {
+		t.Fatalf("failed to parse ca: %v", err)
+	}
+	return ca
+}
+
+func TestIssueClient(t *testing.T) {
+	ca := newTestCA(t, x509.KeyUsageCertSign|x509.KeyUsageCRLSign)
+	now := time.Now()
+	client, err := ca.IssueClient("alice", time.Hour, now)
+	if err != nil {
+		t.Fatalf("failed to issue client: %v", err)
+	}
+	if client.Cert.Subject.CommonName != "alice" {
+		t.Errorf("expected common name alice, got %s", client.Cert.Subject.CommonName)
+	}
+	if !ca.Signed(client.Cert) {
+		t.Errorf("client certificate should be signed by the ca")
+	}
+	if len(client.Cert.ExtKeyUsage) != 1 || client.Cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Errorf("client certificate should only be used for client auth, got %v", client.Cert.ExtKeyUsage)
+	}
+	if NeedsRenewal(client.Cert, now) {
+		t.Errorf("new certificate should not need renewal")
+	}
+	if !NeedsRenewal(client.Cert, now.Add(50*time.Minute)) {
+		t.Errorf("certificate should be renewed in the last third of its lifetime")
+	}
+
+	// the certificate does not outlive the ca
+	long, err := ca.IssueClient("bob", 365*24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("failed to issue client: %v", err)
+	}
+	if long.Cert.NotAfter.After(ca.Cert.NotAfter) {
+		t.Errorf("client certificate expires %s after the ca %s", long.Cert.NotAfter, ca.Cert.NotAfter)
+	}
+	if SerialNumber(long.Cert) == SerialNumber(client.Cert) {
+		t.Errorf("serial numbers should be unique")
+	}
+
+	other := newTestCA(t, x509.KeyUsageCertSign|x509.KeyUsageCRLSign)
+	if other.Signed(client.Cert) {
+		t.Errorf("client certificate should not be signed by another ca")
+	}
+	if !ca.SameAs(ca.CertPEM) || other.SameAs(ca.CertPEM) {
+		t.Errorf("SameAs should only match the same ca certificate")
+	}
+}
+
+func TestCRL(t *testing.T) {
+	ca := newTestCA(t, x509.KeyUsageCertSign|x509.KeyUsageCRLSign)
+	now := time.Now()
+	alice, err := ca.IssueClient("alice", time.Hour, now)
+	if err != nil {
+		t.Fatalf("failed to issue client: %v", err)
+	}
+	revoked := MergeRevoked(nil, []Revoked{
+		{SerialNumber: SerialNumber(alice.Cert), CommonName: "alice", RevocationTime: now, NotAfter: alice.Cert.NotAfter},
+		// expired certificates are pruned
+		{SerialNumber: "0A", CommonName: "old", RevocationTime: now, NotAfter: now.Add(-time.Minute)},
+	}, now)
+	if len(revoked) != 1 || !ContainsSerial(revoked, SerialNumber(alice.Cert)) {
+		t.Fatalf("expected only alice revoked, got %v", revoked)
+	}
+	// merging again keeps the first revocation time
+	merged := MergeRevoked(revoked, []Revoked{{SerialNumber: SerialNumber(alice.Cert), RevocationTime: now.Add(time.Minute), NotAfter: alice.Cert.NotAfter}}, now)
+	if len(merged) != 1 || !merged[0].RevocationTime.Equal(now) {
+		t.Errorf("expected the first revocation to be kept, got %v", merged)
+	}
+
+	data, err := MarshalRevoked(revoked)
+	if err != nil {
+		t.Fatalf("failed to marshal revoked: %v", err)
+	}
+	parsed, err := ParseRevoked([]byte(data))
+	if err != nil || len(parsed) != 1 || parsed[0].SerialNumber != revoked[0].SerialNumber {
+		t.Fatalf("failed to parse revoked %s: %v", data, err)
+	}
+
+	crlPEM, err := ca.CreateCRL(revoked, now)
+	if err != nil {
+		t.Fatalf("failed to create crl: %v", err)
+	}
+	block, _ := pem.Decode(crlPEM)
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse crl: %v", err)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 || crl.RevokedCertificateEntries[0].SerialNumber.Cmp(alice.Cert.SerialNumber) != 0 {
+		t.Errorf("crl should revoke alice, got %v", crl.RevokedCertificateEntries)
+	}
+	if !ca.CRLUpToDate(crlPEM, revoked, now) {
+		t.Errorf("crl should be up to date")
+	}
+	if ca.CRLUpToDate(crlPEM, nil, now) {
+		t.Errorf("crl should be signed again once the revoked certificates change")
+	}
+	if ca.CRLUpToDate(crlPEM, revoked, now.Add(crlValidity)) {
+		t.Errorf("crl should be signed again before it expires")
+	}
+
+	noCRLSign := newTestCA(t, x509.KeyUsageCertSign)
+	if _, err := noCRLSign.CreateCRL(revoked, now); err == nil {
+		t.Errorf("expected error for ca without crl sign key usage")
+	}
+}
+
+func TestManualRevocation(t *testing.T) {
+	for serial, want := range map[string]string{"0a:1B": "A1B", "00FF": "FF"} {
+		got, err := NormalizeSerial(serial)
+		if err != nil || got != want {
+			t.Errorf("NormalizeSerial(%q) = %q, %v, want %q", serial, got, err, want)
+		}
+	}
+	for _, serial := range []string{"", "0", "xyz"} {
+		if _, err := NormalizeSerial(serial); err == nil {
+			t.Errorf("expected error for serial %q", serial)
+		}
+	}
+
+	now := time.Now()
+	// the certificate of a manual revocation is unknown, it is not pruned
+	revoked := MergeRevoked(nil, []Revoked{{SerialNumber: "A1B", RevocationTime: now, Manual: true}}, now.Add(24*time.Hour))
+	if len(revoked) != 1 {
+		t.Errorf("expected the manual revocation to be kept, got %v", revoked)
+	}
+	ca := newTestCA(t, x509.KeyUsageCertSign|x509.KeyUsageCRLSign)
+	crlPEM, err := ca.CreateCRL(revoked, now)
+	if err != nil {
+		t.Fatalf("failed to create crl: %v", err)
+	}
+	nextUpdate, err := CRLNextUpdate(crlPEM)
+	if err != nil || !nextUpdate.After(now) {
+		t.Errorf("unexpected crl next update %v, %v", nextUpdate, err)
+	}
+
+	if got := RenderRevokedCNs([]string{"bob", "alice", "bob"}); got != "alice\nbob\n" {
+		t.Errorf("unexpected revoked common names %q", got)
+	}
+	if got := RenderRevokedCNs(nil); got != "" {
+		t.Errorf("expected no revoked common names, got %q", got)
+	}
+}
+
+func TestRenderProfile(t *testing.T) {
+	profile := &Profile{
+		CommonName:    "alice",
+		Remote:        "172.19.0.101",
+		Port:          "1194",
+		Proto:         "udp",
+		Cipher:        "AES-256-GCM",
+		Auth:          "SHA1",
+		RemoteCertTLS: true,
+		CA:            "ca\n",
+		Cert:          "cert\n",
+		Key:           "key\n",
+	}
+	ovpn, err := profile.Render()
+	if err != nil {
+		t.Fatalf("failed to render profile: %v", err)
+	}
+	for _, want := range []string{
+		"client\n",
+		"proto udp\n",
+		"remote 172.19.0.101 1194\n",
+		"cipher AES-256-GCM\n",
+		"auth SHA1\n",
+		"remote-cert-tls server\n",
+		"<ca>\nca\n</ca>\n<cert>\ncert\n</cert>\n<key>\nkey\n</key>\n",
+	} {
+		if !strings.Contains(ovpn, want) {
+			t.Errorf("%s should contain %q, got:\n%s", ProfileKey, want, ovpn)
+		}
+	}
+	profile.RemoteCertTLS = false
+	if ovpn, _ = profile.Render(); strings.Contains(ovpn, "remote-cert-tls") {
+		t.Errorf("remote-cert-tls should not be rendered, got:\n%s", ovpn)
+	}
+
+	for name, mutate := range map[string]func(p *Profile){
+		"no remote":      func(p *Profile) { p.Remote = "" },
+		"invalid remote": func(p *Profile) { p.Remote = "1.1.1.1 1194\nscript-security 2" },
+		"invalid proto":  func(p *Profile) { p.Proto = "sctp" },
+		"invalid cipher": func(p *Profile) { p.Cipher = "AES-256-GCM\nup /bin/sh" },
+		"no key":         func(p *Profile) { p.Key = "" },
+	} {
+		p := *profile
+		mutate(&p)
+		if _, err := p.Render(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	profile.Remote = "vpn.example.com"
+	if _, err := profile.Render(); err != nil {
+		t.Errorf("domain remote should be valid, got %v", err)
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	output := strings.Join([]string{
+		"TITLE\tOpenVPN 2.5.9 x86_64-pc-linux-gnu",
+		"TIME\t2024-01-02 03:04:05\t1704164645",
+		"HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tVirtual Address\tVirtual IPv6 Address\tBytes Received\tBytes Sent\tConnected Since\tConnected Since (time_t)\tUsername\tClient ID\tPeer ID\tData Channel Cipher",
+		"CLIENT_LIST\talice\t1.2.3.4:51820\t10.240.0.6\t\t1234\t5678\t2024-01-02 03:00:00\t1704164400\tUNDEF\t0\t0\tAES-256-GCM",
+		"CLIENT_LIST\tbob\t5.6.7.8:1194\t10.240.0.10\t\t1\t2\t2024-01-02 03:01:00\t1704164460\tUNDEF\t1\t1\tAES-256-GCM",
+		"HEADER\tROUTING_TABLE\tVirtual Address\tCommon Name\tReal Address\tLast Ref\tLast Ref (time_t)",
+		"ROUTING_TABLE\t10.240.0.6\talice\t1.2.3.4:51820\t2024-01-02 03:04:00\t1704164640",
+		"GLOBAL_STATS\tMax bcast/mcast queue length\t0",
+		"END",
+	}, "\r\n")
+	clients, err := ParseStatus(output)
+	if err != nil {
+		t.Fatalf("failed to parse status: %v", err)
+	}
+	if len(clients) != 2 {
+		t.Fatalf("expected 2 clients, got %v", clients)
+	}
+	alice := clients[0]
+	if alice.CommonName != "alice" || alice.RealAddress != "1.2.3.4:51820" || alice.VirtualAddress != "10.240.0.6" ||
+		alice.BytesReceived != 1234 || alice.BytesSent != 5678 || alice.ConnectedSince.Unix() != 1704164400 {
+		t.Errorf("unexpected client %+v", alice)
+	}
+
+	if clients, err := ParseStatus("TITLE\tOpenVPN\nEND\n"); err != nil || len(clients) != 0 {
+		t.Errorf("expected no clients, got %v, %v", clients, err)
+	}
+	if _, err := ParseStatus("CLIENT_LIST\talice\n"); err == nil {
+		t.Errorf("expected error for client list without header")
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	spec := ClientConfigSpec{
+		CommonName:   "contractor",
+		StaticIP:     "10.240.255.10",
+		Routes:       []string{"10.0.1.0/24"},
+		DNS:          []string{"10.96.0.10", "fd00::10"},
+		AllowedCidrs: []string{"10.0.1.0/24"},
+	}
+	config, err := spec.Parse("10.240.0.0/16", "10.240.255.0/24")
+	if err != nil {
+		t.Fatalf("failed to parse client config: %v", err)
+	}
+	want := "ifconfig-push 10.240.255.10 255.255.0.0\n" +
+		"push \"route 10.0.1.0 255.255.255.0\"\n" +
+		"push \"dhcp-option DNS 10.96.0.10\"\n" +
+		"push \"dhcp-option DNS6 fd00::10\"\n"
+	if got := config.Render(); got != want {
+		t.Errorf("unexpected client config:\n%s", got)
+	}
+	if got := RenderACL([]*ClientConfig{config, {CommonName: "other"}}); got != "10.240.255.10 10.0.1.0/24\n" {
+		t.Errorf("unexpected acl %q", got)
+	}
+
+	for name, invalid := range map[string]ClientConfigSpec{
+		"static ip out of the static cidr": {StaticIP: "10.240.0.10"},
+		"invalid route":                    {Routes: []string{"10.0.1.0"}},
+		"ipv6 route":                       {Routes: []string{"fd00::/64"}},
+		"invalid dns":                      {DNS: []string{"dns"}},
+		"acl without static ip":            {AllowedCidrs: []string{"10.0.1.0/24"}},
+		"common name with @":               {CommonName: "alice@example.com", Routes: []string{"10.0.1.0/24"}},
+	} {
+		if invalid.CommonName == "" {
+			invalid.CommonName = "contractor"
+		}
+		if _, err := invalid.Parse("10.240.0.0/16", "10.240.255.0/24"); err == nil {
+			t.Errorf("expected error for %s", name)
+		}
+	}
+	if _, err := (ClientConfigSpec{CommonName: "contractor", StaticIP: "10.240.0.1"}).Parse("10.240.0.0/16", "10.240.0.0/24"); err == nil {
+		t.Errorf("expected error for the openvpn server ip")
+	}
+	if _, err := (ClientConfigSpec{CommonName: "contractor", StaticIP: "10.240.255.10"}).Parse("10.240.0.0/16", ""); err == nil {
+		t.Errorf("expected error for static ip without static cidr")
+	}
+}
+
+func TestDynamicPool(t *testing.T) {
+	for _, c := range []struct {
+		static     string
+		start, end string
+	}{
+		{"10.240.255.0/24", "10.240.0.2", "10.240.254.255"},
+		{"10.240.0.0/24", "10.240.1.0", "10.240.255.254"},
+		{"10.240.128.0/17", "10.240.0.2", "10.240.127.255"},
+	} {
+		start, end, err := DynamicPool("10.240.0.0/16", c.static)
+		if err != nil || start.String() != c.start || end.String() != c.end {
+			t.Errorf("DynamicPool(%s) = %s-%s, %v, want %s-%s", c.static, start, end, err, c.start, c.end)
+		}
+	}
+	for _, static := range []string{"10.241.0.0/24", "10.240.0.0/16", "10.0.0.0/8"} {
+		if _, _, err := DynamicPool("10.240.0.0/16", static); err == nil {
+			t.Errorf("expected error for static cidr %s", static)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package sslvpn
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConnectedClient is a client listed by the openvpn management status command
+type ConnectedClient struct {
+	CommonName     string
+	RealAddress    string
+	VirtualAddress string
+	BytesReceived  int64
+	BytesSent      int64
+	ConnectedSince time.Time
+}
+
+// ParseStatus parses the connected clients from the openvpn management "status 3" output,
+// the columns are looked up by the CLIENT_LIST header since they differ between openvpn versions
+func ParseStatus(output string) ([]ConnectedClient, error) {
+	var columns map[string]int
+	clients := []ConnectedClient{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimRight(scanner.Text(), "\r"), "\t")
+		switch {
+		case len(fields) > 1 && fields[0] == "HEADER" && fields[1] == "CLIENT_LIST":
+			columns = map[string]int{}
+			// the header has one more field than the client list lines
+			for i, name := range fields[1:] {
+				columns[name] = i
+			}
+		case fields[0] == "CLIENT_LIST":
+			if columns == nil {
+				return nil, fmt.Errorf("client list %q before its header", scanner.Text())
+			}
+			client, err := parseClient(fields, columns)
+			if err != nil {
+				return nil, err
+			}
+			clients = append(clients, client)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func parseClient(fields []string, columns map[string]int) (ConnectedClient, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	client := ConnectedClient{
+		CommonName:     get("Common Name"),
+		RealAddress:    get("Real Address"),
+		VirtualAddress: get("Virtual Address"),
+	}
+	var err error
+	if client.BytesReceived, err = parseInt(get("Bytes Received")); err != nil {
+		return client, fmt.Errorf("invalid bytes received of client %s: %w", client.CommonName, err)
+	}
+	if client.BytesSent, err = parseInt(get("Bytes Sent")); err != nil {
+		return client, fmt.Errorf("invalid bytes sent of client %s: %w", client.CommonName, err)
+	}
+	since, err := parseInt(get("Connected Since (time_t)"))
+	if err != nil {
+		return client, fmt.Errorf("invalid connected since of client %s: %w", client.CommonName, err)
+	}
+	if since != 0 {
+		client.ConnectedSince = time.Unix(since, 0)
+	}
+	return client, nil
+}
+
+func parseInt(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
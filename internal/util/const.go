@@ -11,6 +11,15 @@ const (
 	ProtocolDual = "Dual"
 )
 
+// const for sslvpnclient_controller
+const (
+	// keep the ssl vpn client until its certificate is in the vpn gw crl
+	SslVpnClientFinalizer = "vpn-gw.kubecombo.com/ssl-vpn-client"
+
+	// ssl vpn client profile secret with the client.ovpn and the client certificate
+	SslVpnProfileSecretSuffix = "-ssl-vpn-profile"
+)
+
 // const for vpngw_controller
 const (
 	DebuggerName = "debug"
@@ -102,15 +111,57 @@ const (
 	KubeovnEgressRateAnnotation    = "ovn.kubernetes.io/egress_rate"
 )
 
+// const for provider_multus and provider_cni
+const (
+	MultusNetworksAnnotation = "k8s.v1.cni.cncf.io/networks"
+	// annotations of the bandwidth plugin, cilium bandwidth manager reads the egress one
+	BandwidthIngressAnnotation = "kubernetes.io/ingress-bandwidth"
+	BandwidthEgressAnnotation  = "kubernetes.io/egress-bandwidth"
+)
+
 // const for keepalived_controller
 const (
 	RouterIDLabel = "router-id"
 	SubnetLabel   = "subnet"
+
+	// release the router ids of the keepalived before it is deleted
+	KeepAlivedFinalizer = "vpn-gw.kubecombo.com/keepalived"
+	// router ids of a subnet are allocated in one config map, keyed by the id and valued by the owner instance,
+	// the config map is updated with its resource version so concurrent allocations conflict instead of sharing an id
+	KeepAlivedRouterIDConfigMapPrefix = "keepalived-router-id"
+)
+
+// const for ipsecconn_controller
+const (
+	// unload the connection from the vpn gw pods before the ipsec connection is deleted
+	IpsecConnFinalizer = "vpn-gw.kubecombo.com/ipsec-conn"
 )
 
 // const for vpngw_controller
 const (
 	VpnGwLabel = "vpn-gw"
+	// the static pods are labeled with the vpn gw and its namespace, their mirror pods run in kube-system
+	VpnGwNamespaceLabel = "vpn-gw-namespace"
+
+	// remove the static pod manifests and the host caches from the nodes before the static vpn gw is deleted
+	VpnGwStaticPodFinalizer = "vpn-gw.kubecombo.com/static-pod"
+	// the cleanup pods of the static vpn gw, one for each node
+	VpnGwCleanupLabel = "vpn-gw-cleanup"
+	// the static pod manifests copied to the kubelet manifests path by the daemonset pods
+	SslVpnStaticPodManifest   = "static-openvpn.yaml"
+	IPSecVpnStaticPodManifest = "static-strongswan.yaml"
+	// the static pods run in kube-system, their mirror pods are named <name>-<node>
+	StaticPodNamespace    = "kube-system"
+	SslVpnStaticPodName   = "openvpn"
+	IPSecVpnStaticPodName = "strongswan"
+	// the resource limits of the daemonset container and the vpn gw which the static pod manifest is formatted with
+	StaticPodCPUKey            = "STATIC_POD_CPU"
+	StaticPodMemoryKey         = "STATIC_POD_MEMORY"
+	StaticPodVpnGwKey          = "STATIC_POD_VPN_GW"
+	StaticPodVpnGwNamespaceKey = "STATIC_POD_VPN_GW_NAMESPACE"
+
+	// reload exit code when the mounted config is not synced to the vpn gw pod yet
+	ReloadNotSyncedCode = 2
 
 	// ssl vpn openvpn
 	SslVpnServer = "ssl-vpn"
@@ -138,7 +189,34 @@ const (
 	SslVpnCipherKey     = "SSL_VPN_CIPHER"
 	SslVpnAuthKey       = "SSL_VPN_AUTH"
 	SslVpnSubnetCidrKey = "SSL_VPN_SUBNET_CIDR"
+	// the ssl vpn binds to the keepalived vip of the uplink network
+	SslVpnLocalKey      = "SSL_VPN_LOCAL"
 	SslVpnImageKey      = "SSL_VPN_IMAGE"
+	SslVpnCRLEnabledKey = "SSL_VPN_CRL_ENABLED"
+	// the rate and burst of each ssl vpn client in iptables hashlimit units
+	SslVpnClientRateKey  = "SSL_VPN_CLIENT_RATE"
+	SslVpnClientBurstKey = "SSL_VPN_CLIENT_BURST"
+
+	// controller signed crl of the revoked ssl vpn clients
+	SslVpnCRLPath         = "/etc/openvpn/crl"
+	SslVpnCRLName         = "ssl-vpn-crl"
+	SslVpnCRLSecretSuffix = "-ssl-vpn-crl"
+
+	// copy the crl for the static pod once the mounted file matches the given sha256
+	SslVpnReloadCRLTemplate = "/etc/openvpn/setup/reload-crl.sh %s"
+
+	// per client config of the ssl vpn clients, rendered into the openvpn client-config-dir
+	SslVpnCCDEnabledKey     = "SSL_VPN_CCD_ENABLED"
+	SslVpnPoolKey           = "SSL_VPN_POOL"
+	SslVpnCCDPath           = "/etc/openvpn/ccd"
+	SslVpnCCDName           = "ssl-vpn-ccd"
+	SslVpnCCDSecretSuffix   = "-ssl-vpn-ccd"
+	SslVpnReloadCCDTemplate = "/etc/openvpn/setup/reload-ccd.sh %s"
+
+	// list the connected ssl vpn clients by the openvpn management interface,
+	// at most SslVpnStatusMaxClients of them are kept in the vpn gw status
+	SslVpnStatusCmd        = "/etc/openvpn/setup/status.sh"
+	SslVpnStatusMaxClients = 100
 
 	// ipsec vpn strongswan
 	IPSecVpnServer = "ipsec-vpn"
@@ -149,8 +227,16 @@ const (
 	// statefulset ipsec vpn pod start up command
 	IPSecVpnStsCMD = "/usr/sbin/charon-systemd"
 
-	IPSecRefreshConnectionX509Template = "/connection.sh refresh-x509 %s"
-	IPSecRefreshConnectionPSKTemplate  = "/connection.sh refresh-psk %s"
+	// reload the rendered swanctl config once the mounted file matches the given sha256
+	IPSecReloadConnectionTemplate = "/connection.sh reload %s"
+
+	// relay the charon vici socket over the pod exec stream
+	IPSecViciAgentCMD = "socat STDIO UNIX-CONNECT:/var/run/charon.vici"
+
+	// controller rendered swanctl config secret mount path
+	IPSecVpnConfPath         = "/etc/ipsec/swanctl"
+	IPSecVpnConfName         = "swanctl-conf"
+	IPSecVpnConfSecretSuffix = "-swanctl"
 
 	// cache path from ds ipsec vpn to k8s static pod ipsecvpn
 	IPSecVpnHostCachePath = "/etc/host-init-strongswan"
@@ -167,15 +253,51 @@ const (
 	IPSecVpnImageKey = "IPSEC_VPN_IMAGE"
 	// IPSecRemoteAddrsKey = "IPSEC_REMOTE_ADDRS"
 	// IPSecRemoteTsKey    = "IPSEC_REMOTE_TS"
+
+	// wireguard vpn
+	WireGuardServer  = "wireguard"
+	WireGuardPortKey = "wireguard"
+	WireGuardProto   = "UDP"
+	// wireguard interface addresses, the interface left by the previous host network pod is readdressed
+	WireGuardAddressCidrKey = "WIREGUARD_ADDRESS_CIDR"
+
+	// wireguard pod start up command, it brings up the interface and waits
+	WireGuardStartCMD = "/wireguard.sh"
+	// reload the rendered wireguard config once the mounted file matches the given sha256
+	WireGuardReloadTemplate = "/wireguard.sh reload %s"
+
+	// controller rendered wireguard config secret mount path
+	WireGuardConfPath         = "/etc/wireguard/rendered"
+	WireGuardConfName         = "wireguard-conf"
+	WireGuardConfSecretSuffix = "-wireguard"
+
+	// wireguard private key secret mount path
+	WireGuardKeyPath = "/etc/wireguard/key"
+	WireGuardKeyName = "wireguard-key"
 )
 
 // keepalived
 const (
-	KeepalivedVipKey          = "KEEPALIVED_VIP"
-	KeepalivedVirtualRouterID = "KEEPALIVED_VIRTUAL_ROUTER_ID"
-	KeepalivedNicKey          = "KEEPALIVED_NIC"
-	KeepalivedStartUpCMD      = "/configure.sh"
-	KeepAlivedServer          = "keepalived"
+	KeepalivedVipKey     = "KEEPALIVED_VIP"
+	KeepalivedStartUpCMD = "/configure.sh"
+	KeepAlivedServer     = "keepalived"
+
+	// reload keepalived once the mounted keepalived.conf matches the given sha256
+	KeepalivedReloadTemplate = "/configure.sh reload %s"
+
+	// controller rendered keepalived.conf config map mount path
+	KeepalivedConfPath            = "/etc/keepalived.d/rendered"
+	KeepalivedConfName            = "keepalived-conf"
+	KeepalivedConfConfigMapSuffix = "-keepalived"
+
+	// track scripts added for the enabled vpn services, a keepalived track script of the same name replaces them
+	KeepalivedSslVpnCheck    = "check_ssl_vpn"
+	KeepalivedIPSecVpnCheck  = "check_ipsec_vpn"
+	KeepalivedWireGuardCheck = "check_wireguard"
+	// the vpn service port is listening in the pod or host network
+	KeepalivedPortCheckTemplate = "/check.sh port %s %s"
+	// the vpn interface is up
+	KeepalivedLinkCheckTemplate = "/check.sh link %s"
 )
 
 // const for debugger
@@ -2,6 +2,8 @@ package util
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
@@ -189,3 +191,27 @@ func BuildURL(address, port, path string) string {
 
 	return sb.String()
 }
+
+// Hash returns the sha256 of the rendered config,
+// the gw pod compares it with the mounted files to make sure it reloads the latest config
+func Hash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// SplitCidrs splits comma separated cidrs
+func SplitCidrs(cidrs string) []string {
+	res := []string{}
+	for _, cidr := range strings.Split(cidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr != "" {
+			res = append(res, cidr)
+		}
+	}
+	return res
+}
+
+// JoinCidrs joins cidrs with commas, it is the reverse of SplitCidrs
+func JoinCidrs(cidrs []string) string {
+	return strings.Join(cidrs, ",")
+}
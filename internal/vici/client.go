@@ -0,0 +1,309 @@
+// Package vici implements a client of the strongSwan vici protocol which is used to control charon,
+// reference: https://github.com/strongswan/strongswan/blob/master/src/libcharon/plugins/vici/README.md
+package vici
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSocket is the vici unix socket charon listens on
+const DefaultSocket = "/var/run/charon.vici"
+
+const (
+	// IKE SA state reported by charon once the tunnel is up
+	IkeStateEstablished = "ESTABLISHED"
+	// CHILD SA state reported by charon once the kernel policies are in place
+	ChildStateInstalled = "INSTALLED"
+)
+
+var (
+	// ErrProtocol is returned when a malformed packet is sent or received
+	ErrProtocol = errors.New("vici: protocol error")
+	// ErrUnknownCommand is returned when charon does not support the command
+	ErrUnknownCommand = errors.New("vici: unknown command")
+	// ErrUnknownEvent is returned when charon does not support the event
+	ErrUnknownEvent = errors.New("vici: unknown event")
+)
+
+// CommandError is returned when charon failed to execute a command
+type CommandError struct {
+	Command string
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("vici: %s failed: %s", e.Command, e.Message)
+}
+
+// IsNotFound reports whether the command failed because the connection or sa does not exist
+func IsNotFound(err error) bool {
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	return strings.Contains(cmdErr.Message, "not found") || strings.HasPrefix(cmdErr.Message, "no matching")
+}
+
+// Client is a vici session with charon, commands are executed one by one
+type Client struct {
+	mu   sync.Mutex
+	conn io.ReadWriteCloser
+}
+
+// NewClient creates a client over an established stream to the vici socket
+func NewClient(conn io.ReadWriteCloser) *Client {
+	return &Client{conn: conn}
+}
+
+// Dial connects to the vici unix socket
+func Dial(ctx context.Context, socket string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// Close closes the session
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Call executes a command and returns its response
+func (c *Client) Call(cmd string, req Message) (Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := writePacket(c.conn, &packet{ptype: packetCmdRequest, name: cmd, msg: req}); err != nil {
+		return nil, err
+	}
+	p, err := readPacket(c.conn)
+	if err != nil {
+		return nil, err
+	}
+	switch p.ptype {
+	case packetCmdResponse:
+		return p.msg, nil
+	case packetCmdUnknown:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCommand, cmd)
+	default:
+		return nil, fmt.Errorf("%w: unexpected packet type %d for command %s", ErrProtocol, p.ptype, cmd)
+	}
+}
+
+// StreamedCall executes a command which streams its result as events, and returns the events and the response
+func (c *Client) StreamedCall(cmd, event string, req Message) ([]Message, Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.register(packetEventRegister, event); err != nil {
+		return nil, nil, err
+	}
+	if err := writePacket(c.conn, &packet{ptype: packetCmdRequest, name: cmd, msg: req}); err != nil {
+		return nil, nil, err
+	}
+	var events []Message
+	var resp Message
+	for resp == nil {
+		p, err := readPacket(c.conn)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch p.ptype {
+		case packetEvent:
+			if p.name == event {
+				events = append(events, p.msg)
+			}
+		case packetCmdResponse:
+			resp = p.msg
+		case packetCmdUnknown:
+			return nil, nil, fmt.Errorf("%w: %s", ErrUnknownCommand, cmd)
+		default:
+			return nil, nil, fmt.Errorf("%w: unexpected packet type %d for command %s", ErrProtocol, p.ptype, cmd)
+		}
+	}
+	if err := c.register(packetEventUnregister, event); err != nil {
+		return nil, nil, err
+	}
+	return events, resp, nil
+}
+
+func (c *Client) register(ptype byte, event string) error {
+	if err := writePacket(c.conn, &packet{ptype: ptype, name: event}); err != nil {
+		return err
+	}
+	p, err := readPacket(c.conn)
+	if err != nil {
+		return err
+	}
+	switch p.ptype {
+	case packetEventConfirm:
+		return nil
+	case packetEventUnknown:
+		return fmt.Errorf("%w: %s", ErrUnknownEvent, event)
+	default:
+		return fmt.Errorf("%w: unexpected packet type %d for event %s", ErrProtocol, p.ptype, event)
+	}
+}
+
+func (c *Client) command(cmd string, req Message) (Message, error) {
+	resp, err := c.Call(cmd, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Get("success") != "yes" {
+		return nil, &CommandError{Command: cmd, Message: resp.Get("errmsg")}
+	}
+	return resp, nil
+}
+
+// LoadConn loads or replaces a connection, conn is the connection section as in swanctl.conf
+func (c *Client) LoadConn(name string, conn Message) error {
+	_, err := c.command("load-conn", Message{name: conn})
+	return err
+}
+
+// UnloadConn unloads a connection, its established sas are not terminated
+func (c *Client) UnloadConn(name string) error {
+	_, err := c.command("unload-conn", Message{"name": name})
+	return err
+}
+
+// GetConns returns the names of the loaded connections
+func (c *Client) GetConns() ([]string, error) {
+	resp, err := c.Call("get-conns", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.List("conns"), nil
+}
+
+// Initiate initiates the child sa of an ike connection, a negative timeout returns without waiting for the result
+func (c *Client) Initiate(ike, child string, timeout time.Duration) error {
+	req := Message{"timeout": strconv.FormatInt(timeout.Milliseconds(), 10)}
+	if timeout < 0 {
+		req["timeout"] = "-1"
+	}
+	if ike != "" {
+		req["ike"] = ike
+	}
+	if child != "" {
+		req["child"] = child
+	}
+	_, err := c.command("initiate", req)
+	return err
+}
+
+// Terminate terminates the sas of an ike connection, or only its child sa if child is set
+func (c *Client) Terminate(ike, child string, timeout time.Duration) error {
+	req := Message{"timeout": strconv.FormatInt(timeout.Milliseconds(), 10)}
+	if timeout < 0 {
+		req["timeout"] = "-1"
+	}
+	if ike != "" {
+		req["ike"] = ike
+	}
+	if child != "" {
+		req["child"] = child
+	}
+	_, err := c.command("terminate", req)
+	return err
+}
+
+// IkeSA is an IKE SA listed by list-sas
+type IkeSA struct {
+	Name     string
+	UniqueID string
+	State    string
+	Children []ChildSA
+}
+
+// ChildSA is a CHILD SA nested in an IKE SA
+type ChildSA struct {
+	Name     string
+	UniqueID string
+	State    string
+	// time since the child sa was installed, which is reset on every rekey
+	InstallTime time.Duration
+	BytesIn     int64
+	BytesOut    int64
+}
+
+// Established reports whether the IKE SA is up
+func (s *IkeSA) Established() bool {
+	return s.State == IkeStateEstablished
+}
+
+// InstalledChild returns the most recently installed child sa if any
+func (s *IkeSA) InstalledChild() *ChildSA {
+	var res *ChildSA
+	for i := range s.Children {
+		child := &s.Children[i]
+		if child.State != ChildStateInstalled {
+			continue
+		}
+		if res == nil || child.InstallTime < res.InstallTime {
+			res = child
+		}
+	}
+	return res
+}
+
+// ListSas lists the sas of the ike connection, or all sas if ike is empty
+func (c *Client) ListSas(ike string) ([]IkeSA, error) {
+	req := Message{"noblock": "yes"}
+	if ike != "" {
+		req["ike"] = ike
+	}
+	events, _, err := c.StreamedCall("list-sas", "list-sa", req)
+	if err != nil {
+		return nil, err
+	}
+	var sas []IkeSA
+	for _, event := range events {
+		for _, name := range event.Keys() {
+			section := event.Section(name)
+			if section == nil {
+				continue
+			}
+			sa := IkeSA{
+				Name:     name,
+				UniqueID: section.Get("uniqueid"),
+				State:    section.Get("state"),
+			}
+			children := section.Section("child-sas")
+			for _, key := range children.Keys() {
+				child := children.Section(key)
+				if child == nil {
+					continue
+				}
+				sa.Children = append(sa.Children, ChildSA{
+					Name:        child.Get("name"),
+					UniqueID:    child.Get("uniqueid"),
+					State:       child.Get("state"),
+					InstallTime: parseSeconds(child.Get("install-time")),
+					BytesIn:     parseInt(child.Get("bytes-in")),
+					BytesOut:    parseInt(child.Get("bytes-out")),
+				})
+			}
+			sas = append(sas, sa)
+		}
+	}
+	return sas, nil
+}
+
+func parseInt(s string) int64 {
+	v, _ := strconv.ParseInt(s, 10, 64)
+	return v
+}
+
+func parseSeconds(s string) time.Duration {
+	return time.Duration(parseInt(s)) * time.Second
+}
@@ -0,0 +1,248 @@
+package vici
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeCharon serves the vici protocol on a local unix socket
+type fakeCharon struct {
+	conns    map[string]Message
+	sas      []Message
+	requests []packet
+}
+
+func newFakeCharon(t *testing.T) (*fakeCharon, string) {
+	socket := filepath.Join(t.TempDir(), "charon.vici")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	f := &fakeCharon{conns: map[string]Message{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, socket
+}
+
+func (f *fakeCharon) serve(conn net.Conn) {
+	defer conn.Close()
+	events := map[string]bool{}
+	for {
+		p, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+		f.requests = append(f.requests, *p)
+		var replies []*packet
+		switch p.ptype {
+		case packetEventRegister:
+			if p.name != "list-sa" {
+				replies = append(replies, &packet{ptype: packetEventUnknown})
+				break
+			}
+			events[p.name] = true
+			replies = append(replies, &packet{ptype: packetEventConfirm})
+		case packetEventUnregister:
+			delete(events, p.name)
+			replies = append(replies, &packet{ptype: packetEventConfirm})
+		case packetCmdRequest:
+			replies = f.handle(p, events)
+		}
+		for _, reply := range replies {
+			if err := writePacket(conn, reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (f *fakeCharon) handle(p *packet, events map[string]bool) []*packet {
+	failed := func(msg string) []*packet {
+		return []*packet{{ptype: packetCmdResponse, msg: Message{"success": "no", "errmsg": msg}}}
+	}
+	ok := []*packet{{ptype: packetCmdResponse, msg: Message{"success": "yes"}}}
+	switch p.name {
+	case "load-conn":
+		for name := range p.msg {
+			f.conns[name] = p.msg.Section(name)
+		}
+		return ok
+	case "unload-conn":
+		name := p.msg.Get("name")
+		if _, exist := f.conns[name]; !exist {
+			return failed("unloading connection '" + name + "' failed, connection not found")
+		}
+		delete(f.conns, name)
+		return ok
+	case "get-conns":
+		conns := []string{}
+		for name := range f.conns {
+			conns = append(conns, name)
+		}
+		return []*packet{{ptype: packetCmdResponse, msg: Message{"conns": conns}}}
+	case "initiate":
+		if _, exist := f.conns[p.msg.Get("ike")]; !exist {
+			return failed("CHILD_SA config '" + p.msg.Get("child") + "' not found")
+		}
+		return ok
+	case "terminate":
+		return failed("no matching SAs to terminate found")
+	case "list-sas":
+		var replies []*packet
+		if events["list-sa"] {
+			for _, sa := range f.sas {
+				replies = append(replies, &packet{ptype: packetEvent, name: "list-sa", msg: sa})
+			}
+		}
+		return append(replies, &packet{ptype: packetCmdResponse, msg: Message{}})
+	}
+	return []*packet{{ptype: packetCmdUnknown}}
+}
+
+func dial(t *testing.T, socket string) *Client {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, socket)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	msg := Message{
+		"version": "2",
+		"local_addrs": []string{
+			"172.19.0.101",
+		},
+		"children": Message{
+			"net-net": Message{
+				"local_ts":     []string{"10.1.0.0/24", "10.4.0.0/24"},
+				"start_action": "start",
+			},
+		},
+		"empty": "",
+	}
+	f, socket := newFakeCharon(t)
+	c := dial(t, socket)
+	if err := c.LoadConn("moon-sun", msg); err != nil {
+		t.Fatalf("failed to load conn: %v", err)
+	}
+	if !reflect.DeepEqual(f.conns["moon-sun"], msg) {
+		t.Errorf("expected conn %v, got %v", msg, f.conns["moon-sun"])
+	}
+}
+
+func TestConnCommands(t *testing.T) {
+	f, socket := newFakeCharon(t)
+	c := dial(t, socket)
+	if err := c.LoadConn("moon-sun", Message{"version": "2"}); err != nil {
+		t.Fatalf("failed to load conn: %v", err)
+	}
+	conns, err := c.GetConns()
+	if err != nil || !reflect.DeepEqual(conns, []string{"moon-sun"}) {
+		t.Fatalf("unexpected conns %v, err %v", conns, err)
+	}
+	if err := c.Initiate("moon-sun", "net-net", -1); err != nil {
+		t.Errorf("failed to initiate: %v", err)
+	}
+	if got := f.requests[len(f.requests)-1].msg.Get("timeout"); got != "-1" {
+		t.Errorf("expected async initiate, got timeout %q", got)
+	}
+	if err := c.Initiate("moon-mars", "net-net", time.Second); !IsNotFound(err) {
+		t.Errorf("expected not found initiate error, got %v", err)
+	}
+	if err := c.Terminate("moon-sun", "", -1); !IsNotFound(err) {
+		t.Errorf("expected not found terminate error, got %v", err)
+	}
+	if got := f.requests[len(f.requests)-1].msg.Get("timeout"); got != "-1" {
+		t.Errorf("expected async terminate, got timeout %q", got)
+	}
+	if err := c.UnloadConn("moon-sun"); err != nil {
+		t.Errorf("failed to unload conn: %v", err)
+	}
+
+	err = c.UnloadConn("moon-sun")
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Command != "unload-conn" || !IsNotFound(err) {
+		t.Errorf("expected not found command error, got %v", err)
+	}
+	if err := c.Terminate("moon-sun", "", time.Second); !IsNotFound(err) {
+		t.Errorf("expected not found command error, got %v", err)
+	}
+	if _, err := c.Call("reload-settings", nil); !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("expected unknown command error, got %v", err)
+	}
+	if _, _, err := c.StreamedCall("list-certs", "list-cert", nil); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("expected unknown event error, got %v", err)
+	}
+}
+
+func TestListSas(t *testing.T) {
+	f, socket := newFakeCharon(t)
+	f.sas = []Message{
+		{"gw-gw-moon-sun": Message{
+			"uniqueid": "3",
+			"state":    "ESTABLISHED",
+			"child-sas": Message{
+				"net-net-2": Message{
+					"name":         "net-net",
+					"uniqueid":     "2",
+					"state":        "REKEYED",
+					"install-time": "3634",
+					"bytes-in":     "10",
+					"bytes-out":    "20",
+				},
+				"net-net-4": Message{
+					"name":         "net-net",
+					"uniqueid":     "4",
+					"state":        "INSTALLED",
+					"install-time": "600",
+					"bytes-in":     "1024",
+					"bytes-out":    "2048",
+				},
+			},
+		}},
+		{"moon-mars": Message{
+			"uniqueid": "5",
+			"state":    "CONNECTING",
+		}},
+	}
+	c := dial(t, socket)
+	sas, err := c.ListSas("")
+	if err != nil {
+		t.Fatalf("failed to list sas: %v", err)
+	}
+	if len(sas) != 2 {
+		t.Fatalf("expected 2 ike sas, got %d", len(sas))
+	}
+	if !sas[0].Established() || sas[1].Established() {
+		t.Errorf("unexpected ike sa state %+v", sas)
+	}
+	want := ChildSA{Name: "net-net", UniqueID: "4", State: ChildStateInstalled, InstallTime: 600 * time.Second, BytesIn: 1024, BytesOut: 2048}
+	if child := sas[0].InstalledChild(); child == nil || !reflect.DeepEqual(*child, want) {
+		t.Errorf("expected child sa %+v, got %+v", want, child)
+	}
+	if sas[1].InstalledChild() != nil {
+		t.Errorf("expected no installed child sa in %+v", sas[1])
+	}
+
+	// the session is still usable after the streamed command
+	if _, err := c.GetConns(); err != nil {
+		t.Errorf("failed to get conns: %v", err)
+	}
+}
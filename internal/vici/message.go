@@ -0,0 +1,290 @@
+package vici
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// message element types
+const (
+	elementSectionStart byte = iota + 1
+	elementSectionEnd
+	elementKeyValue
+	elementListStart
+	elementListItem
+	elementListEnd
+)
+
+// packet types
+const (
+	packetCmdRequest byte = iota
+	packetCmdResponse
+	packetCmdUnknown
+	packetEventRegister
+	packetEventUnregister
+	packetEventConfirm
+	packetEventUnknown
+	packetEvent
+)
+
+// max length of a packet accepted by charon
+const maxPacketLen = 512 * 1024
+
+// Message is a vici message, values are string, []string or nested Message sections
+type Message map[string]any
+
+// Get returns the string value of key, empty if missing or not a string
+func (m Message) Get(key string) string {
+	v, _ := m[key].(string)
+	return v
+}
+
+// List returns the list value of key
+func (m Message) List(key string) []string {
+	v, _ := m[key].([]string)
+	return v
+}
+
+// Section returns the section value of key
+func (m Message) Section(key string) Message {
+	v, _ := m[key].(Message)
+	return v
+}
+
+// Keys returns the sorted keys of the message
+func (m Message) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m Message) encode(buf *bytes.Buffer) error {
+	// keys are sorted to keep the encoding stable
+	for _, k := range m.Keys() {
+		if len(k) > 0xff {
+			return fmt.Errorf("%w: key %q too long", ErrProtocol, k)
+		}
+		switch v := m[k].(type) {
+		case string:
+			if err := encodeKeyValue(buf, k, []byte(v)); err != nil {
+				return err
+			}
+		case []byte:
+			if err := encodeKeyValue(buf, k, v); err != nil {
+				return err
+			}
+		case []string:
+			buf.WriteByte(elementListStart)
+			writeName(buf, k)
+			for _, item := range v {
+				if len(item) > 0xffff {
+					return fmt.Errorf("%w: list %q item too long", ErrProtocol, k)
+				}
+				buf.WriteByte(elementListItem)
+				writeValue(buf, []byte(item))
+			}
+			buf.WriteByte(elementListEnd)
+		case Message:
+			buf.WriteByte(elementSectionStart)
+			writeName(buf, k)
+			if err := v.encode(buf); err != nil {
+				return err
+			}
+			buf.WriteByte(elementSectionEnd)
+		default:
+			return fmt.Errorf("%w: unsupported value type %T of key %q", ErrProtocol, v, k)
+		}
+	}
+	return nil
+}
+
+func encodeKeyValue(buf *bytes.Buffer, key string, value []byte) error {
+	if len(value) > 0xffff {
+		return fmt.Errorf("%w: value of key %q too long", ErrProtocol, key)
+	}
+	buf.WriteByte(elementKeyValue)
+	writeName(buf, key)
+	writeValue(buf, value)
+	return nil
+}
+
+func writeName(buf *bytes.Buffer, name string) {
+	buf.WriteByte(byte(len(name)))
+	buf.WriteString(name)
+}
+
+func writeValue(buf *bytes.Buffer, value []byte) {
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(value)))
+	buf.Write(value)
+}
+
+func decodeMessage(data []byte) (Message, error) {
+	r := bytes.NewReader(data)
+	root := Message{}
+	stack := []Message{root}
+	var list []string
+	var listName string
+	inList := false
+	for r.Len() > 0 {
+		t, _ := r.ReadByte()
+		current := stack[len(stack)-1]
+		switch t {
+		case elementSectionStart:
+			name, err := readName(r)
+			if err != nil {
+				return nil, err
+			}
+			section := Message{}
+			current[name] = section
+			stack = append(stack, section)
+		case elementSectionEnd:
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("%w: unexpected section end", ErrProtocol)
+			}
+			stack = stack[:len(stack)-1]
+		case elementKeyValue:
+			name, err := readName(r)
+			if err != nil {
+				return nil, err
+			}
+			value, err := readValue(r)
+			if err != nil {
+				return nil, err
+			}
+			current[name] = string(value)
+		case elementListStart:
+			name, err := readName(r)
+			if err != nil {
+				return nil, err
+			}
+			inList, listName, list = true, name, []string{}
+		case elementListItem:
+			if !inList {
+				return nil, fmt.Errorf("%w: list item outside of list", ErrProtocol)
+			}
+			value, err := readValue(r)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, string(value))
+		case elementListEnd:
+			if !inList {
+				return nil, fmt.Errorf("%w: unexpected list end", ErrProtocol)
+			}
+			current[listName] = list
+			inList = false
+		default:
+			return nil, fmt.Errorf("%w: unknown element type %d", ErrProtocol, t)
+		}
+	}
+	if len(stack) != 1 || inList {
+		return nil, fmt.Errorf("%w: unterminated section or list", ErrProtocol)
+	}
+	return root, nil
+}
+
+func readName(r *bytes.Reader) (string, error) {
+	l, err := r.ReadByte()
+	if err != nil {
+		return "", fmt.Errorf("%w: truncated name", ErrProtocol)
+	}
+	name := make([]byte, l)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return "", fmt.Errorf("%w: truncated name", ErrProtocol)
+	}
+	return string(name), nil
+}
+
+func readValue(r *bytes.Reader) ([]byte, error) {
+	var l uint16
+	if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+		return nil, fmt.Errorf("%w: truncated value", ErrProtocol)
+	}
+	value := make([]byte, l)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, fmt.Errorf("%w: truncated value", ErrProtocol)
+	}
+	return value, nil
+}
+
+// packet is one transport segment exchanged with charon
+type packet struct {
+	ptype byte
+	// command or event name, only set for named packet types
+	name string
+	msg  Message
+}
+
+func (p *packet) named() bool {
+	switch p.ptype {
+	case packetCmdRequest, packetEventRegister, packetEventUnregister, packetEvent:
+		return true
+	}
+	return false
+}
+
+func writePacket(w io.Writer, p *packet) error {
+	var buf bytes.Buffer
+	buf.WriteByte(p.ptype)
+	if p.named() {
+		if len(p.name) > 0xff {
+			return fmt.Errorf("%w: name %q too long", ErrProtocol, p.name)
+		}
+		writeName(&buf, p.name)
+	}
+	if p.msg != nil {
+		if err := p.msg.encode(&buf); err != nil {
+			return err
+		}
+	}
+	if buf.Len() > maxPacketLen {
+		return fmt.Errorf("%w: packet too large", ErrProtocol)
+	}
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(buf.Len()))
+	if _, err := w.Write(append(header, buf.Bytes()...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func readPacket(r io.Reader) (*packet, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	l := binary.BigEndian.Uint32(header)
+	if l == 0 || l > maxPacketLen {
+		return nil, fmt.Errorf("%w: invalid packet length %d", ErrProtocol, l)
+	}
+	data := make([]byte, l)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	p := &packet{ptype: data[0]}
+	body := bytes.NewReader(data[1:])
+	if p.named() {
+		name, err := readName(body)
+		if err != nil {
+			return nil, err
+		}
+		p.name = name
+	}
+	rest := data[len(data)-body.Len():]
+	msg, err := decodeMessage(rest)
+	if err != nil {
+		return nil, err
+	}
+	p.msg = msg
+	return p, nil
+}
@@ -0,0 +1,146 @@
+// Package wireguard renders the wireguard interface config of a vpn gw,
+// reference: https://man7.org/linux/man-pages/man8/wg.8.html#CONFIGURATION_FILE_FORMAT
+package wireguard
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templates = template.Must(
+	template.New("wireguard").Funcs(template.FuncMap{
+		"join": util.JoinCidrs,
+	}).ParseFS(templateFS, "templates/*.tmpl"),
+)
+
+const (
+	// Interface is the wireguard interface created in the vpn gw pod
+	Interface = "wg0"
+	// ConfKey is the rendered interface config file
+	ConfKey = Interface + ".conf"
+	// PrivateKeyKey is the key of the private key in the wireguard secret
+	PrivateKeyKey = "private-key"
+)
+
+// Peer is one wireguard peer rendered from a WireGuardPeer
+type Peer struct {
+	Name                string
+	PublicKey           string
+	AllowedIPs          []string
+	Endpoint            string
+	PersistentKeepalive int32
+}
+
+// Config is the wireguard interface of one vpn gw, the private key is not part of it
+type Config struct {
+	ListenPort int32
+	Addresses  []string
+	Peers      []Peer
+}
+
+// Validate checks the values before they are rendered into the config file
+func (c *Config) Validate() error {
+	if c.ListenPort <= 0 || c.ListenPort > 65535 {
+		return fmt.Errorf("invalid listen port %d", c.ListenPort)
+	}
+	if len(c.Addresses) == 0 {
+		return fmt.Errorf("wireguard interface address is required")
+	}
+	for _, addr := range c.Addresses {
+		if _, _, err := net.ParseCIDR(addr); err != nil {
+			return fmt.Errorf("invalid wireguard interface address %q: %w", addr, err)
+		}
+	}
+	keys := map[string]string{}
+	for _, peer := range c.Peers {
+		if err := peer.Validate(); err != nil {
+			return fmt.Errorf("invalid wireguard peer %s: %w", peer.Name, err)
+		}
+		if other, exist := keys[peer.PublicKey]; exist {
+			return fmt.Errorf("wireguard peer %s and %s have the same public key", other, peer.Name)
+		}
+		keys[peer.PublicKey] = peer.Name
+	}
+	return nil
+}
+
+// Validate checks the peer public key, allowed ips and endpoint
+func (p *Peer) Validate() error {
+	if _, err := ParseKey(p.PublicKey); err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(p.AllowedIPs) == 0 {
+		return fmt.Errorf("allowed ips is required")
+	}
+	for _, cidr := range p.AllowedIPs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+			return fmt.Errorf("invalid allowed ip %q", cidr)
+		}
+	}
+	if p.Endpoint != "" {
+		host, _, err := net.SplitHostPort(p.Endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint %q: %w", p.Endpoint, err)
+		}
+		if host == "" || strings.ContainsAny(p.Endpoint, " \t\r\n") {
+			return fmt.Errorf("invalid endpoint %q", p.Endpoint)
+		}
+	}
+	if p.PersistentKeepalive < 0 || p.PersistentKeepalive > 65535 {
+		return fmt.Errorf("invalid persistent keepalive %d", p.PersistentKeepalive)
+	}
+	return nil
+}
+
+// Render validates and renders the interface config, the result is keyed by the file name
+func (c *Config) Render() (map[string]string, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	conf := *c
+	// keep the rendered file stable
+	conf.Peers = append([]Peer{}, c.Peers...)
+	sort.Slice(conf.Peers, func(i, j int) bool { return conf.Peers[i].Name < conf.Peers[j].Name })
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "wg.conf.tmpl", &conf); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", ConfKey, err)
+	}
+	return map[string]string{ConfKey: buf.String()}, nil
+}
+
+// ParseKey decodes a base64 encoded curve25519 key generated by wg genkey or wg pubkey
+func ParseKey(key string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("key should be 32 bytes, got %d", len(raw))
+	}
+	return raw, nil
+}
+
+// PublicKey derives the base64 encoded public key from the private key
+func PublicKey(privateKey string) (string, error) {
+	raw, err := ParseKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
@@ -0,0 +1,91 @@
+package wireguard
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kubecombo/kube-combo/internal/util"
+)
+
+// rfc 7748 x25519 test vectors
+const (
+	alicePrivateKey = "dwdtCnMYpX08FsFyUbJmRd9ML4frwJkqsXf7pR25LCo="
+	alicePublicKey  = "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo="
+	bobPublicKey    = "3p7bfXt9wbTTW2HC7OQ1Nz+DQ8hbeGdNrfx+FG+IK08="
+)
+
+func TestRender(t *testing.T) {
+	conf := &Config{
+		ListenPort: 51820,
+		Addresses:  util.SplitCidrs("10.250.0.1/24, fd00:250::1/64"),
+		Peers: []Peer{
+			{
+				Name:       "site-b",
+				PublicKey:  bobPublicKey,
+				AllowedIPs: util.SplitCidrs("10.250.0.3/32,10.3.0.0/16"),
+			},
+			{
+				Name:                "site-a",
+				PublicKey:           alicePublicKey,
+				AllowedIPs:          util.SplitCidrs("10.250.0.2/32, 10.2.0.0/16"),
+				Endpoint:            "172.19.0.102:51820",
+				PersistentKeepalive: 25,
+			},
+		},
+	}
+	files, err := conf.Render()
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	wg := files[ConfKey]
+	for _, want := range []string{
+		"Address = 10.250.0.1/24,fd00:250::1/64\n",
+		"ListenPort = 51820\n",
+		"# site-a\n[Peer]\nPublicKey = " + alicePublicKey + "\nAllowedIPs = 10.250.0.2/32,10.2.0.0/16\nEndpoint = 172.19.0.102:51820\nPersistentKeepalive = 25\n",
+		"# site-b\n[Peer]\nPublicKey = " + bobPublicKey + "\nAllowedIPs = 10.250.0.3/32,10.3.0.0/16\n",
+	} {
+		if !strings.Contains(wg, want) {
+			t.Errorf("%s should contain %q, got:\n%s", ConfKey, want, wg)
+		}
+	}
+	if strings.Index(wg, "# site-a") > strings.Index(wg, "# site-b") {
+		t.Errorf("peers should be sorted by name, got:\n%s", wg)
+	}
+	if strings.Contains(wg, "PrivateKey") {
+		t.Errorf("private key should not be rendered, got:\n%s", wg)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	peer := Peer{Name: "site-a", PublicKey: alicePublicKey, AllowedIPs: []string{"10.2.0.0/16"}}
+	for name, conf := range map[string]Config{
+		"no address":         {ListenPort: 51820, Peers: []Peer{peer}},
+		"invalid port":       {ListenPort: 0, Addresses: []string{"10.250.0.1/24"}},
+		"invalid address":    {ListenPort: 51820, Addresses: []string{"10.250.0.1"}},
+		"invalid public key": {ListenPort: 51820, Addresses: []string{"10.250.0.1/24"}, Peers: []Peer{{Name: "x", PublicKey: "c2VjcmV0", AllowedIPs: []string{"10.2.0.0/16"}}}},
+		"no allowed ips":     {ListenPort: 51820, Addresses: []string{"10.250.0.1/24"}, Peers: []Peer{{Name: "x", PublicKey: alicePublicKey}}},
+		"invalid endpoint":   {ListenPort: 51820, Addresses: []string{"10.250.0.1/24"}, Peers: []Peer{{Name: "x", PublicKey: alicePublicKey, AllowedIPs: []string{"10.2.0.0/16"}, Endpoint: "1.1.1.1:1\nPrivateKey = x"}}},
+		"duplicate key":      {ListenPort: 51820, Addresses: []string{"10.250.0.1/24"}, Peers: []Peer{peer, peer}},
+	} {
+		if _, err := conf.Render(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	empty := Config{ListenPort: 51820, Addresses: []string{"10.250.0.1/24"}}
+	if _, err := empty.Render(); err != nil {
+		t.Errorf("interface without peers should be valid, got %v", err)
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	pub, err := PublicKey(alicePrivateKey)
+	if err != nil {
+		t.Fatalf("failed to derive public key: %v", err)
+	}
+	if pub != alicePublicKey {
+		t.Errorf("expected public key %s, got %s", alicePublicKey, pub)
+	}
+	if _, err := PublicKey("c2VjcmV0"); err == nil {
+		t.Errorf("expected error for short key")
+	}
+}
@@ -25,6 +25,7 @@ kind-load-image:
 	$(call kind_load_image,$(KIND_CLUSTER_NAME),$(IMG))
 	$(call kind_load_image,$(KIND_CLUSTER_NAME),$(SSL_VPN_IMG))
 	$(call kind_load_image,$(KIND_CLUSTER_NAME),$(IPSEC_VPN_IMG))
+	$(call kind_load_image,$(KIND_CLUSTER_NAME),$(WIREGUARD_IMG))
 	$(call kind_load_image,$(KIND_CLUSTER_NAME),$(KEEPALIVED_IMG))
 	$(call kind_load_image,$(KIND_CLUSTER_NAME),$(NETSHOOT_IMG))
 	$(call kind_load_image,$(KIND_CLUSTER_NAME),$(DEBUGGER_IMG))
@@ -36,6 +37,7 @@ crictl-pull-image:
 	$(call crictl_pull_image,$(IMG))
 	$(call crictl_pull_image,$(SSL_VPN_IMG))
 	$(call crictl_pull_image,$(IPSEC_VPN_IMG))
+	$(call crictl_pull_image,$(WIREGUARD_IMG))
 	$(call crictl_pull_image,$(KEEPALIVED_IMG))
 	$(call crictl_pull_image,$(NETSHOOT_IMG))
 	$(call crictl_pull_image,$(DEBUGGER_IMG))